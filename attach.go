@@ -0,0 +1,149 @@
+package rlog
+
+/*
+This file implements attaching and detaching output modules while the logger is running, e.g. to add a
+debug sink while investigating an incident. Logging continues meanwhile: the lists of modules and their
+channels are guarded by modulesMutex, and a module is only detached while no flush is in progress. Messages
+are pushed outside of modulesMutex, so detaching a module which stopped taking messages does not wait for
+the pushes blocked on it.
+*/
+
+import (
+	"container/list"
+	"fmt"
+	"time"
+)
+
+//AttachModule activates an output module while the logger is running, see EnableModule for modules
+//activated on Start. Modules implementing a Validate method have to pass the validation.
+//Arguments: module to be activated, must implement the rlogModule interface
+//Returns: nil on success, error if the logger is not running, the module is already active or invalid
+func AttachModule(module rlogModule) error {
+	return std.AttachModule(module)
+}
+
+//AttachModule activates an output module while the logger is running, see EnableModule for modules
+//activated on Start. Modules implementing a Validate method have to pass the validation.
+//Arguments: module to be activated, must implement the rlogModule interface
+//Returns: nil on success, error if the logger is not running, the module is already active or invalid
+func (r *Instance) AttachModule(module rlogModule) error {
+	if !r.IsInitialized() {
+		return fmt.Errorf("cannot attach module %s when logger not running, use EnableModule", moduleName(module))
+	}
+	if vm, ok := module.(validatingModule); ok {
+		if err := vm.Validate(); err != nil {
+			return fmt.Errorf("validation failed for module %s: %v", moduleName(module), err)
+		}
+	}
+
+	//Hold the lock while checking and registering the module, it must not be attached twice
+	r.modulesMutex.Lock()
+	if r.findModule(module) != nil {
+		r.modulesMutex.Unlock()
+		return fmt.Errorf("module %s already active", moduleName(module))
+	}
+	r.activeModules.PushBack(module)
+	r.modulesMutex.Unlock()
+
+	r.launchModule(module, r.syncPrefix())
+	return nil
+}
+
+//DetachModule flushes an active output module and deactivates it while the logger is running. The
+//module does not receive any further messages and its goroutine exits once it has written the pending
+//messages. Its counters are not part of the statistics anymore.
+//Arguments: module to be deactivated, the one passed to EnableModule or AttachModule
+//Returns: nil on success, error if the module is not active or did not respond to the flush (it is
+//detached nevertheless)
+func DetachModule(module rlogModule) error {
+	return std.DetachModule(module)
+}
+
+//DetachModule flushes an active output module and deactivates it while the logger is running. The
+//module does not receive any further messages and its goroutine exits once it has written the pending
+//messages. Its counters are not part of the statistics anymore.
+//Arguments: module to be deactivated, the one passed to EnableModule or AttachModule
+//Returns: nil on success, error if the module is not active or did not respond to the flush (it is
+//detached nevertheless)
+func (r *Instance) DetachModule(module rlogModule) error {
+	if !r.IsInitialized() {
+		return fmt.Errorf("cannot detach module %s when logger not running", moduleName(module))
+	}
+
+	//A flush in progress must not send to the flush channel closed below
+	r.lockFlush(time.Time{}, nil)
+	defer r.unlockFlush()
+
+	//Stop sending messages to the module first
+	r.modulesMutex.Lock()
+	active := r.findModule(module)
+	fc := findChannel(r.flushChannels, module)
+	if active == nil || fc == nil {
+		r.modulesMutex.Unlock()
+		return fmt.Errorf("module %s not active", moduleName(module))
+	}
+	r.activeModules.Remove(active)
+	mc, _ := removeChannel(r.msgChannels, module).(*msgChannel)
+	r.modulesMutex.Unlock()
+
+	//Release the pushes blocked on the module and wait for the pushes still in progress, then flush so
+	//that the module writes back the messages and its buffered data
+	if mc != nil {
+		close(mc.done)
+	}
+	timeout := time.Second * time.Duration(r.config.FlushTimeout)
+	r.waitForPushes(timeout, nil)
+	_, err := r.flushModule(fc, timeout, nil)
+
+	r.modulesMutex.Lock()
+	removeChannel(r.flushChannels, module)
+	r.modulesMutex.Unlock()
+
+	//Nobody sends to the module anymore, signal it to write the messages still pending and exit
+	if fc.sync == nil {
+		close(fc.c)
+	}
+	return err
+}
+
+//findModule looks up an active module, the caller has to hold modulesMutex
+//Returns: element of activeModules, nil if the module is not active
+func (r *Instance) findModule(module rlogModule) *list.Element {
+	for e := r.activeModules.Front(); e != nil; e = e.Next() {
+		if m, ok := e.Value.(rlogModule); ok && sameModule(m, module) {
+			return e
+		}
+	}
+	return nil
+}
+
+//findChannel looks up the flush channel of a module, the caller has to hold modulesMutex
+//Returns: flush channel, nil if the module has none
+func findChannel(channels *list.List, module rlogModule) *flushChannel {
+	for e := channels.Front(); e != nil; e = e.Next() {
+		if fc, ok := e.Value.(*flushChannel); ok && sameModule(fc.module, module) {
+			return fc
+		}
+	}
+	return nil
+}
+
+//removeChannel removes the message or flush channel of a module from a list, the caller has to hold
+//modulesMutex
+//Arguments: [channels] msgChannels or flushChannels. [module] module reading from the channel
+//Returns: removed *msgChannel or *flushChannel, nil if the module has none
+func removeChannel(channels *list.List, module rlogModule) interface{} {
+	for e := channels.Front(); e != nil; e = e.Next() {
+		var m rlogModule
+		switch c := e.Value.(type) {
+		case *msgChannel:
+			m = c.module
+		case *flushChannel:
+			m = c.module
+		}
+		if sameModule(m, module) {
+			return channels.Remove(e)
+		}
+	}
+	return nil
+}
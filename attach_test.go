@@ -0,0 +1,168 @@
+/*
+These tests cover:
+- Attaching modules to the running logger
+- Detaching modules from the running logger
+- Logging while modules are attached and detached
+- Detaching a module which stopped taking messages
+*/
+package rlog
+
+import (
+	"github.com/rightscale/rlog/common"
+	. "launchpad.net/gocheck"
+	"sync"
+	"time"
+)
+
+//fakeAttachedModule records the messages it receives and signals when its goroutine exits
+type fakeAttachedModule struct {
+	mutex sync.Mutex
+	msgs  []string
+	done  chan struct{}
+}
+
+func newFakeAttachedModule() *fakeAttachedModule {
+	return &fakeAttachedModule{done: make(chan struct{})}
+}
+
+func (f *fakeAttachedModule) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
+	for {
+		select {
+		case msg := <-dataChan:
+			f.record(msg)
+		case ret, ok := <-flushChan:
+			for msg := nonBlockingChanRead(dataChan); msg != nil; msg = nonBlockingChanRead(dataChan) {
+				f.record(msg)
+			}
+			if !ok {
+				close(f.done)
+				return
+			}
+			ret <- common.FlushResult{}
+		}
+	}
+}
+
+func (f *fakeAttachedModule) record(msg *common.RlogMsg) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.msgs = append(f.msgs, msg.Msg)
+}
+
+func (f *fakeAttachedModule) received() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string(nil), f.msgs...)
+}
+
+//stuckModule neither takes messages nor responds to flushes, it only exits when detached
+type stuckModule struct{}
+
+func (stuckModule) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
+	for range flushChan {
+	}
+}
+
+//returnsWithin runs f and reports whether it returned before the timeout
+func returnsWithin(f func(), timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+//When attaching and detaching a module at runtime, it should receive the messages logged in between
+func (s *Uninitialized) TestAttachDetachModule(t *C) {
+	module := newFakeAttachedModule()
+	t.Assert(AttachModule(module), ErrorMatches, "cannot attach module .* when logger not running.*")
+
+	Start(GetDefaultConfig())
+	Info("before")
+	t.Assert(AttachModule(module), IsNil)
+	t.Assert(AttachModule(module), ErrorMatches, "module \\*rlog.fakeAttachedModule already active")
+	t.Assert(ActiveModules(), DeepEquals, []string{"*rlog.fakeAttachedModule"})
+
+	Info("attached")
+	t.Assert(DetachModule(module), IsNil)
+	select {
+	case <-module.done:
+	case <-time.After(time.Second):
+		t.Fatal("detached module did not exit")
+	}
+	Info("after")
+
+	t.Assert(module.received(), DeepEquals, []string{"attached"})
+	t.Assert(ActiveModules(), DeepEquals, []string{})
+	t.Assert(len(Stats().Modules), Equals, 0)
+	t.Assert(DetachModule(module), ErrorMatches, "module \\*rlog.fakeAttachedModule not active")
+}
+
+//When attaching and detaching modules while logging, it should neither lose the other modules'
+//messages nor race
+func (s *Uninitialized) TestAttachDetachWhileLogging(t *C) {
+	stable := newFakeAttachedModule()
+	EnableModule(stable)
+	conf := GetDefaultConfig()
+	conf.OverflowPolicy = Block
+	Start(conf)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			Info("message")
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		module := newFakeAttachedModule()
+		t.Assert(AttachModule(module), IsNil)
+		Flush()
+		t.Assert(DetachModule(module), IsNil)
+	}
+	wg.Wait()
+
+	Flush()
+	t.Assert(len(stable.received()), Equals, 200)
+}
+
+//When detaching a module which stopped taking messages while a logger blocks on its channel, it should
+//return after the flush timeout and release the logger
+func (s *Uninitialized) TestDetachStuckModule(t *C) {
+	stable := newFakeAttachedModule()
+	EnableModule(stable)
+	conf := GetDefaultConfig()
+	conf.ChanCapacity = 1
+	conf.OverflowPolicy = Block
+	conf.FlushTimeout = 1
+	Start(conf)
+	stuck := stuckModule{}
+	t.Assert(AttachModule(stuck), IsNil)
+
+	//The second message blocks on the full channel of the stuck module
+	Info("fills")
+	blocked := make(chan struct{})
+	go func() {
+		Info("blocks")
+		close(blocked)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	var err error
+	t.Assert(returnsWithin(func() { err = DetachModule(stuck) }, 5*time.Second), Equals, true)
+	t.Assert(err, ErrorMatches, "flush command ACK of module rlog.stuckModule timed out")
+	t.Assert(returnsWithin(func() { <-blocked }, time.Second), Equals, true)
+
+	//Logging and statistics go on without the stuck module
+	t.Assert(returnsWithin(func() { Info("after") }, time.Second), Equals, true)
+	t.Assert(len(Stats().Modules), Equals, 1)
+	Flush()
+	t.Assert(stable.received(), DeepEquals, []string{"fills", "blocks", "after"})
+}
@@ -0,0 +1,185 @@
+/*
+Implements a logger keeping the most recent log output in memory up to a size in bytes, e.g. to return
+recent logs from a diagnostic endpoint.
+*/
+package buffer
+
+import (
+	"github.com/rightscale/rlog/common"
+	"sync"
+	"unicode/utf8"
+)
+
+// Buffer logger (fields are private).
+type bufferLogger struct {
+	common.ModuleSeverity
+	mutex     sync.Mutex       // guards data, String and Bytes may be called from any goroutine
+	data      []byte           // formatted messages, the output kept starts at offset start
+	start     int              // offset of the oldest message kept, the bytes before are dropped
+	sizes     []int            // sizes of the messages kept including the newline, oldest first
+	maxBytes  int              // max size of the output kept
+	formatter common.Formatter // creates the text kept for each message
+}
+
+// Creates a logger keeping the most recent log output in memory. Messages are formatted when they are
+// received, each message followed by a newline. Once the output exceeds maxBytes, the oldest messages
+// are dropped as a whole, even if they span several lines. A single message exceeding maxBytes is cut
+// from its start.
+//
+// maxBytes: max size of the output kept in bytes (at least 1)
+//
+// return: instance of buffer logger
+func NewBufferLogger(maxBytes int) *bufferLogger {
+	if maxBytes < 1 {
+		maxBytes = 1
+	}
+	logger := new(bufferLogger)
+	logger.maxBytes = maxBytes
+	logger.formatter = common.DefaultFormatter{}
+	return logger
+}
+
+// Names the module for rlog diagnostics and statistics.
+//
+// return: "buffer"
+func (conf *bufferLogger) Name() string {
+	return "buffer"
+}
+
+// Sets a severity threshold for this module overriding the global rlog severity.
+//
+// severity: most verbose severity kept by this module
+//
+// return: the buffer logger to allow chaining with the constructor
+func (conf *bufferLogger) WithSeverity(severity common.RlogSeverity) *bufferLogger {
+	conf.SetSeverity(severity)
+	return conf
+}
+
+// Selects a custom formatter creating the text kept for each message, e.g. common.JSONFormatter{} to
+// embed the output in an API response.
+//
+// formatter: formatter to use instead of the plain text format
+//
+// return: the buffer logger to allow chaining with the constructor
+func (conf *bufferLogger) WithFormatter(formatter common.Formatter) *bufferLogger {
+	conf.formatter = formatter
+	return conf
+}
+
+// Retrieves the output kept in memory. Call rlog.Flush() first to include messages still on their way
+// to the module.
+//
+// return: messages ordered from oldest to most recent, one per line
+func (conf *bufferLogger) String() string {
+	conf.mutex.Lock()
+	defer conf.mutex.Unlock()
+	return string(conf.data[conf.start:])
+}
+
+// Retrieves the output kept in memory like String.
+//
+// return: copy of the output, the caller may modify it
+func (conf *bufferLogger) Bytes() []byte {
+	conf.mutex.Lock()
+	defer conf.mutex.Unlock()
+	return append([]byte(nil), conf.data[conf.start:]...)
+}
+
+// Intended to run in a separate goroutine. It appends log messages to the buffer.
+//
+// dataChan: receives log messages.
+//
+// flushChan: receives flush command.
+func (conf *bufferLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
+
+	prefix := common.SyslogHeader()
+
+	// wait forever on data and flush channel
+	for {
+		select {
+		case logMsg := <-dataChan:
+			// received log message, store it
+			conf.store(logMsg, prefix)
+		case ret, ok := <-flushChan:
+			if !ok {
+				// flush channel closed by rlog: write pending messages and exit
+				conf.flush(dataChan, prefix)
+				return
+			}
+			// flush and return the number of messages stored
+			ret <- common.FlushResult{Flushed: conf.flush(dataChan, prefix)}
+		}
+	}
+}
+
+// Stores a log message when rlog runs in synchronous mode, see rlog.RlogConfig.Synchronous.
+//
+// rawRlogMsg: log message to store.
+//
+// prefix: log prefix
+func (conf *bufferLogger) WriteSync(rawRlogMsg *common.RlogMsg, prefix string) {
+	conf.store(rawRlogMsg, prefix)
+}
+
+// Does nothing as messages are stored right away. Used when rlog runs in synchronous mode.
+func (conf *bufferLogger) FlushSync() {
+}
+
+// Appends the formatted message, dropping the oldest messages once the output exceeds its size. The
+// dropped bytes are only moved out of the buffer once they exceed half its size, which keeps the cost
+// per message independent of the size.
+//
+// rawRlogMsg: log message received from channel.
+//
+// prefix: log prefix
+func (conf *bufferLogger) store(rawRlogMsg *common.RlogMsg, prefix string) {
+	msg := conf.formatter.Format(rawRlogMsg, prefix)
+
+	conf.mutex.Lock()
+	defer conf.mutex.Unlock()
+
+	conf.data = append(conf.data, msg...)
+	conf.data = append(conf.data, '\n')
+	conf.sizes = append(conf.sizes, len(msg)+1)
+
+	// drop whole messages, unless the last message alone exceeds the size: cut it at a character boundary.
+	for len(conf.data)-conf.start > conf.maxBytes && len(conf.sizes) > 1 {
+		conf.start += conf.sizes[0]
+		conf.sizes = conf.sizes[1:]
+	}
+	if excess := len(conf.data) - conf.start - conf.maxBytes; excess > 0 {
+		cut := conf.start + excess
+		for cut < len(conf.data) && !utf8.RuneStart(conf.data[cut]) {
+			cut++
+		}
+		conf.sizes[0] -= cut - conf.start
+		conf.start = cut
+	}
+
+	if conf.start > conf.maxBytes/2 {
+		conf.data = append(conf.data[:0], conf.data[conf.start:]...)
+		conf.start = 0
+	}
+}
+
+// Stores pending messages.
+//
+// dataChan: data channel to access all pending messages
+//
+// prefix: log prefix
+//
+// return: number of messages stored
+func (conf *bufferLogger) flush(dataChan <-chan (*common.RlogMsg), prefix string) int {
+	flushed := 0
+	for {
+		// perform non blocking read until the channel is empty
+		select {
+		case logMsg := <-dataChan:
+			conf.store(logMsg, prefix)
+			flushed++
+		default:
+			return flushed
+		}
+	}
+}
@@ -0,0 +1,81 @@
+/*
+These tests cover:
+- Dropping the oldest messages as a whole, including multiline messages
+- Cutting a single message exceeding the size
+- Compacting the buffer once the dropped bytes exceed half its size
+*/
+package buffer
+
+import (
+	"github.com/rightscale/rlog/common"
+	. "launchpad.net/gocheck"
+	"strings"
+	"testing"
+)
+
+//Hook this testing framework into go test
+func Test(t *testing.T) { TestingT(t) }
+
+type BufferSuite struct{}
+
+var _ = Suite(&BufferSuite{})
+
+//messageFormatter keeps the message text only
+type messageFormatter struct{}
+
+func (messageFormatter) Format(rawRlogMsg *common.RlogMsg, prefix string) string {
+	return rawRlogMsg.Msg
+}
+
+//newTestLogger creates a buffer logger storing the message text only
+func newTestLogger(maxBytes int) *bufferLogger {
+	return NewBufferLogger(maxBytes).WithFormatter(messageFormatter{})
+}
+
+//When the output exceeds the size, the oldest messages should be dropped as a whole
+func (s *BufferSuite) TestDropMessages(c *C) {
+	logger := newTestLogger(16)
+	logger.WriteSync(&common.RlogMsg{Msg: "one"}, "")
+	logger.WriteSync(&common.RlogMsg{Msg: "two\nlines"}, "")
+	c.Assert(logger.String(), Equals, "one\ntwo\nlines\n")
+
+	//The multiline message is dropped entirely, not line by line
+	logger.WriteSync(&common.RlogMsg{Msg: "three"}, "")
+	c.Assert(logger.String(), Equals, "two\nlines\nthree\n")
+	logger.WriteSync(&common.RlogMsg{Msg: "four"}, "")
+	c.Assert(logger.String(), Equals, "three\nfour\n")
+	c.Assert(string(logger.Bytes()), Equals, "three\nfour\n")
+}
+
+//When a single message exceeds the size, it should be cut from its start at a character boundary
+func (s *BufferSuite) TestCutMessage(c *C) {
+	logger := newTestLogger(8)
+	logger.WriteSync(&common.RlogMsg{Msg: "old"}, "")
+	logger.WriteSync(&common.RlogMsg{Msg: "0123456789ü"}, "")
+	c.Assert(logger.String(), Equals, "56789ü\n")
+
+	//The remainder of the cut message is dropped as a whole later on
+	logger.WriteSync(&common.RlogMsg{Msg: "new"}, "")
+	c.Assert(logger.String(), Equals, "new\n")
+
+	//A multibyte character is not split
+	logger = newTestLogger(4)
+	logger.WriteSync(&common.RlogMsg{Msg: "üü"}, "")
+	c.Assert(logger.String(), Equals, "ü\n")
+}
+
+//When many messages are stored, the dropped bytes should not pile up in the buffer
+func (s *BufferSuite) TestCompaction(c *C) {
+	logger := newTestLogger(100)
+	for i := 0; i < 1000; i++ {
+		logger.WriteSync(&common.RlogMsg{Msg: strings.Repeat("x", i%20)}, "")
+		c.Assert(len(logger.String()) <= 100, Equals, true)
+		c.Assert(logger.start <= 50, Equals, true)
+		c.Assert(len(logger.data) <= 150+20, Equals, true)
+	}
+	total := 0
+	for _, size := range logger.sizes {
+		total += size
+	}
+	c.Assert(total, Equals, len(logger.String()))
+}
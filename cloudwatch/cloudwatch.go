@@ -0,0 +1,492 @@
+/*
+Package cloudwatch implements an output module sending log messages to Amazon CloudWatch Logs using
+rlog. Messages are batched and sent using the PutLogEvents API. Requests are signed with AWS Signature
+Version 4, the module does not depend on the AWS SDK. Credentials are either static keys or retrieved by
+a CredentialsProvider, e.g. from the shared credentials file or the IAM role of an EC2 instance.
+*/
+package cloudwatch
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/rightscale/rlog/common"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//Config holds the AWS settings of the CloudWatch module
+type Config struct {
+	Region          string              //AWS region of the log group (e.g. us-east-1)
+	AccessKeyID     string              //access key of static credentials, "" if Credentials provides them
+	SecretAccessKey string              //secret key of static credentials
+	SessionToken    string              //session token of temporary static credentials, "" if none
+	Credentials     CredentialsProvider //source of credentials retrieved again before they expire, nil for static keys
+	Endpoint        string              //endpoint URL overriding the regional endpoint, "" for the default
+	Client          *http.Client        //client used to send the requests, nil for a client with default timeout
+}
+
+//ConfigFromEnv creates a configuration the way the AWS CLI finds its settings: the region is taken from
+//AWS_REGION, AWS_DEFAULT_REGION or the shared config file (~/.aws/config), the credentials from the
+//environment variables, the shared credentials file or the IAM role of the instance (see
+//DefaultCredentials)
+//Returns: configuration, without region if none is configured
+func ConfigFromEnv() Config {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = sharedRegion("")
+	}
+	return Config{Region: region, Credentials: DefaultCredentials()}
+}
+
+//Configuration of CloudWatch logging module
+type cloudWatchLogger struct {
+	common.ModuleSeverity
+	group         string           // log group receiving the messages
+	stream        string           // log stream within the group
+	config        Config           // AWS settings
+	endpoint      string           // URL the requests are sent to
+	batchInterval time.Duration    // max time a message waits for its batch to fill up
+	retries       int              // attempts per batch after the first one failed
+	backoff       time.Duration    // wait time before the first retry, doubled for each retry
+	batch         []logEvent       // events waiting to be sent
+	batchBytes    int              // size of the batch as accounted by CloudWatch
+	sequenceToken string           // token of the next request, "" if unknown
+	formatter     common.Formatter // creates the message text of each event
+	creds         Credentials      // credentials retrieved from config.Credentials, empty if not yet retrieved
+	deliveryErr   error            // first delivery failure since the last flush, reported by the next flush
+}
+
+//Defaults and limits of the CloudWatch logger, see the PutLogEvents API reference
+const (
+	defaultBatchInterval = 5 * time.Second
+	defaultRetries       = 5
+	defaultBackoff       = 200 * time.Millisecond
+	defaultTimeout       = 10 * time.Second
+	maxBatchEvents       = 10000
+	maxBatchBytes        = 1048576
+	maxBatchSpan         = 24 * time.Hour
+	eventOverhead        = 26 // bytes accounted per event in addition to the message
+	maxEventBytes        = 262144 - eventOverhead
+	apiTarget            = "Logs_20140328.PutLogEvents"
+	serviceName          = "logs"
+)
+
+//logEvent is a message as sent to CloudWatch
+type logEvent struct {
+	Timestamp int64  `json:"timestamp"` // milliseconds since epoch
+	Message   string `json:"message"`
+}
+
+//putLogEventsRequest is the body of a PutLogEvents request
+type putLogEventsRequest struct {
+	LogGroupName  string     `json:"logGroupName"`
+	LogStreamName string     `json:"logStreamName"`
+	LogEvents     []logEvent `json:"logEvents"`
+	SequenceToken string     `json:"sequenceToken,omitempty"`
+}
+
+//putLogEventsResponse is the body of a successful PutLogEvents response
+type putLogEventsResponse struct {
+	NextSequenceToken string `json:"nextSequenceToken"`
+}
+
+//apiError is the body of a failed request
+type apiError struct {
+	Type                  string `json:"__type"`
+	Message               string `json:"message"`
+	ExpectedSequenceToken string `json:"expectedSequenceToken"`
+	status                int    // HTTP status of the response
+}
+
+//Error describes the failure
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s (status %d): %s", e.Type, e.status, e.Message)
+}
+
+//NewCloudWatchLogger enables sending log messages to the given log group and stream, which have to
+//exist. Messages are sent in batches once the CloudWatch size limits are reached, when the batch is
+//older than the batch interval or when rlog is flushed. Throttled and failed requests are retried
+//with exponential backoff, a batch still failing after the retry budget is dropped.
+//Returns: instance of CloudWatch logger module in case of success, error if the configuration lacks
+//the region or credentials (static keys or a credentials provider)
+func NewCloudWatchLogger(group, stream string, config Config) (*cloudWatchLogger, error) {
+	static := config.AccessKeyID != "" && config.SecretAccessKey != ""
+	if config.Region == "" || (config.Credentials == nil && !static) {
+		return nil, fmt.Errorf("rlog cloudwatch: region and credentials (access keys or provider) are required")
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: defaultTimeout}
+	}
+
+	conf := new(cloudWatchLogger)
+	conf.group = group
+	conf.stream = stream
+	conf.config = config
+	conf.endpoint = config.Endpoint
+	if conf.endpoint == "" {
+		conf.endpoint = "https://logs." + config.Region + ".amazonaws.com/"
+	}
+	conf.batchInterval = defaultBatchInterval
+	conf.retries = defaultRetries
+	conf.backoff = defaultBackoff
+	conf.formatter = common.DefaultFormatter{}
+	return conf, nil
+}
+
+//MustNewCloudWatchLogger enables sending log messages to CloudWatch like NewCloudWatchLogger but panics
+//if the configuration is incomplete, for concise setup in main
+func MustNewCloudWatchLogger(group, stream string, config Config) *cloudWatchLogger {
+	conf, err := NewCloudWatchLogger(group, stream, config)
+	if err != nil {
+		panic(err)
+	}
+	return conf
+}
+
+//Name names the module for rlog diagnostics and statistics
+func (conf *cloudWatchLogger) Name() string {
+	return "cloudwatch:" + conf.group + "/" + conf.stream
+}
+
+//WithBatchInterval sets the max time a message waits for its batch to fill up. Returns the CloudWatch
+//logger to allow chaining with the constructor.
+func (conf *cloudWatchLogger) WithBatchInterval(interval time.Duration) *cloudWatchLogger {
+	conf.batchInterval = interval
+	return conf
+}
+
+//WithRetries sets the number of attempts after a failed request and the wait time before the first
+//retry, which is doubled for each further retry. Returns the CloudWatch logger to allow chaining with
+//the constructor.
+func (conf *cloudWatchLogger) WithRetries(retries int, backoff time.Duration) *cloudWatchLogger {
+	conf.retries = retries
+	conf.backoff = backoff
+	return conf
+}
+
+//WithFormatter selects the formatter creating the message text of each event, e.g. common.JSONFormatter
+//for CloudWatch Logs Insights. The formatter receives an empty prefix. Returns the CloudWatch logger to
+//allow chaining with the constructor.
+func (conf *cloudWatchLogger) WithFormatter(formatter common.Formatter) *cloudWatchLogger {
+	conf.formatter = formatter
+	return conf
+}
+
+//WithSeverity sets a severity threshold for this module overriding the global rlog severity.
+//Returns the CloudWatch logger to allow chaining with the constructor.
+func (conf *cloudWatchLogger) WithSeverity(severity common.RlogSeverity) *cloudWatchLogger {
+	conf.SetSeverity(severity)
+	return conf
+}
+
+//LaunchModule is intended to run in a separate goroutine and used by rlog internally. It sends log
+//messages to CloudWatch. Arguments: [dataChan] Channel to receive log messages. [flushChan]
+//Channel to receive flush command
+func (conf *cloudWatchLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
+
+	//Send incomplete batches periodically, a nil channel never fires
+	var tick <-chan time.Time
+	if conf.batchInterval > 0 {
+		ticker := time.NewTicker(conf.batchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	//Wait forever on data and flush channel
+	for {
+		select {
+		case logMsg := <-dataChan:
+			//Received log message, add it to the batch
+			conf.add(logMsg)
+		case ret, ok := <-flushChan:
+			if !ok {
+				//Flush channel closed by rlog: send pending messages and exit
+				conf.flush(dataChan)
+				return
+			}
+			//Flush and return the number of messages sent and the delivery failures
+			flushed, err := conf.flush(dataChan)
+			ret <- common.FlushResult{Flushed: flushed, Err: err}
+		case <-tick:
+			//Send the messages waiting for their batch to fill up
+			conf.sendBatch()
+		}
+	}
+}
+
+//WriteSync adds a log message to the batch when rlog runs in synchronous mode (see
+//rlog.RlogConfig.Synchronous). The batch is sent once full or on flush, there is no batch interval.
+//Arguments: [rawRlogMsg] log message. [prefix] log prefix (unused)
+func (conf *cloudWatchLogger) WriteSync(rawRlogMsg *common.RlogMsg, prefix string) {
+	conf.add(rawRlogMsg)
+}
+
+//FlushSync sends the pending batch when rlog runs in synchronous mode
+func (conf *cloudWatchLogger) FlushSync() {
+	conf.sendBatch()
+}
+
+//add adds a message to the batch. The batch is sent before if the message would exceed the CloudWatch
+//limits on the number of events, the batch size or the time span of a batch.
+func (conf *cloudWatchLogger) add(rawRlogMsg *common.RlogMsg) {
+	event := logEvent{
+		Timestamp: rawRlogMsg.Time.UnixNano() / int64(time.Millisecond),
+		Message:   truncate(conf.formatter.Format(rawRlogMsg, ""), maxEventBytes),
+	}
+	size := len(event.Message) + eventOverhead
+
+	if len(conf.batch) > 0 {
+		first := conf.batch[0].Timestamp
+		span := time.Duration(event.Timestamp-first) * time.Millisecond
+		if len(conf.batch) >= maxBatchEvents || conf.batchBytes+size > maxBatchBytes || span >= maxBatchSpan {
+			conf.sendBatch()
+		}
+	}
+
+	conf.batch = append(conf.batch, event)
+	conf.batchBytes += size
+}
+
+//flush sends all pending log messages
+//Arguments:[dataChan] data channel to access all pending messages
+//Returns: number of messages sent, including those waiting for their batch to fill up, first delivery
+//failure since the last flush
+func (conf *cloudWatchLogger) flush(dataChan <-chan (*common.RlogMsg)) (int, error) {
+	flushed := len(conf.batch)
+	for {
+		//Perform non blocking read until the channel is empty
+		select {
+		case logMsg := <-dataChan:
+			conf.add(logMsg)
+			flushed++
+		default:
+			conf.sendBatch()
+			err := conf.deliveryErr
+			conf.deliveryErr = nil
+			return flushed, err
+		}
+	}
+}
+
+//sendBatch sends the batch to CloudWatch. Throttled or failed requests are retried with exponential
+//backoff, a rejected sequence token is replaced by the expected one. The batch is cleared in any case:
+//a batch failing after the retry budget is dropped and the failure is kept for the next flush.
+func (conf *cloudWatchLogger) sendBatch() {
+	if len(conf.batch) == 0 {
+		return
+	}
+
+	//CloudWatch requires the events of a batch in chronological order
+	events := conf.batch
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp < events[j].Timestamp })
+	conf.batch = nil
+	conf.batchBytes = 0
+
+	backoff := conf.backoff
+	err := conf.put(events)
+	for i := 0; err != nil && i < conf.retries; i++ {
+		if e, ok := err.(*apiError); ok {
+			if e.Type == "DataAlreadyAcceptedException" {
+				// the batch was sent before, the expected token refers to the next request.
+				conf.sequenceToken = e.ExpectedSequenceToken
+				return
+			}
+			if e.Type == "InvalidSequenceTokenException" {
+				// retry right away using the token CloudWatch expects.
+				conf.sequenceToken = e.ExpectedSequenceToken
+				err = conf.put(events)
+				continue
+			}
+			if !e.retryable() {
+				break
+			}
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		err = conf.put(events)
+	}
+	if err != nil {
+		// Do not log delivery failures using RightLog4Go because it would create a feedback loop
+		log.Printf("[RightLog4Go] CloudWatch %s failed, dropped %d message(s): %s", conf.Name(), len(events), err.Error())
+		if conf.deliveryErr == nil {
+			conf.deliveryErr = fmt.Errorf("dropped %d message(s): %s", len(events), err.Error())
+		}
+	}
+}
+
+//retryable determines whether a failed request may succeed when retried
+//Returns: true for throttling and server errors
+func (e *apiError) retryable() bool {
+	return e.status >= 500 || e.Type == "ThrottlingException" || e.Type == "ServiceUnavailableException"
+}
+
+//put sends a single PutLogEvents request and keeps the sequence token of the response
+//Returns: error if the request failed, *apiError if CloudWatch rejected it
+func (conf *cloudWatchLogger) put(events []logEvent) error {
+	body, err := json.Marshal(putLogEventsRequest{
+		LogGroupName:  conf.group,
+		LogStreamName: conf.stream,
+		LogEvents:     events,
+		SequenceToken: conf.sequenceToken,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", conf.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", apiTarget)
+	creds, err := conf.credentials()
+	if err != nil {
+		return err
+	}
+	sign(req, body, conf.config.Region, creds, time.Now().UTC())
+
+	resp, err := conf.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		e := &apiError{status: resp.StatusCode}
+		json.Unmarshal(respBody, e)
+		// the type may carry a namespace, e.g. "com.amazonaws.logs#ThrottlingException".
+		e.Type = e.Type[strings.LastIndex(e.Type, "#")+1:]
+		return e
+	}
+
+	var res putLogEventsResponse
+	if json.Unmarshal(respBody, &res) == nil {
+		conf.sequenceToken = res.NextSequenceToken
+	}
+	return nil
+}
+
+//credentials determines the credentials signing the next request. Credentials of a provider are kept
+//until they are about to expire.
+//Returns: credentials, error if the provider has none
+func (conf *cloudWatchLogger) credentials() (Credentials, error) {
+	if conf.config.Credentials == nil {
+		return Credentials{
+			AccessKeyID:     conf.config.AccessKeyID,
+			SecretAccessKey: conf.config.SecretAccessKey,
+			SessionToken:    conf.config.SessionToken,
+		}, nil
+	}
+
+	expiring := !conf.creds.Expires.IsZero() && time.Now().Add(refreshWindow).After(conf.creds.Expires)
+	if conf.creds.AccessKeyID == "" || expiring {
+		creds, err := conf.config.Credentials.Retrieve()
+		if err != nil {
+			//Keep using the current credentials until they actually expire
+			if conf.creds.AccessKeyID != "" && time.Now().Before(conf.creds.Expires) {
+				return conf.creds, nil
+			}
+			return Credentials{}, err
+		}
+		conf.creds = creds
+	}
+	return conf.creds, nil
+}
+
+//sign adds the AWS Signature Version 4 headers to a request
+//Arguments: [req] request to sign. [body] request body. [region] AWS region. [creds] credentials. [now]
+//time of signing (UTC)
+func sign(req *http.Request, body []byte, region string, creds Credentials, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	//Canonical headers have to be sorted by their lowercase name
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders bytes.Buffer
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hexSHA256(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + serviceName + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, serviceName)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+//hexSHA256 hashes data for signing
+//Returns: hex encoded SHA-256 hash
+func hexSHA256(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+//hmacSHA256 computes a keyed hash for signing
+//Returns: HMAC-SHA256 of data
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+//truncate shortens a message to at most size bytes without breaking UTF-8 characters
+//Returns: message, truncated if needed
+func truncate(msg string, size int) string {
+	if len(msg) <= size {
+		return msg
+	}
+	cut := size
+	for cut > 0 && !utf8.RuneStart(msg[cut]) {
+		cut--
+	}
+	return msg[:cut]
+}
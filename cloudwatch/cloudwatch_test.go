@@ -0,0 +1,387 @@
+/*
+These tests cover:
+- Signing of requests (AWS Signature Version 4)
+- Batching of messages and the sequence token
+- Retries of throttled and rejected requests
+- The flush protocol and the report of delivery failures
+- Credentials providers and the refresh of temporary credentials
+*/
+package cloudwatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/rightscale/rlog/common"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//Hook this testing framework into go test
+func Test(t *testing.T) { TestingT(t) }
+
+type CloudWatchSuite struct{}
+
+var _ = Suite(&CloudWatchSuite{})
+
+//fakeCloudWatch records the PutLogEvents requests and responds with the next sequence token or the
+//queued errors
+type fakeCloudWatch struct {
+	mutex    sync.Mutex
+	requests []putLogEventsRequest
+	headers  []http.Header
+	errors   []string // bodies of error responses sent before succeeding again
+	server   *httptest.Server
+}
+
+func newFakeCloudWatch() *fakeCloudWatch {
+	f := new(fakeCloudWatch)
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+func (f *fakeCloudWatch) serve(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var req putLogEventsRequest
+	body, _ := ioutil.ReadAll(r.Body)
+	json.Unmarshal(body, &req)
+	f.requests = append(f.requests, req)
+	f.headers = append(f.headers, r.Header)
+
+	if len(f.errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, f.errors[0])
+		f.errors = f.errors[1:]
+		return
+	}
+	fmt.Fprintf(w, `{"nextSequenceToken":"token-%d"}`, len(f.requests))
+}
+
+func (f *fakeCloudWatch) received() []putLogEventsRequest {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]putLogEventsRequest(nil), f.requests...)
+}
+
+//newTestLogger creates a logger sending to the fake service using static credentials
+func newTestLogger(c *C, f *fakeCloudWatch) *cloudWatchLogger {
+	logger, err := NewCloudWatchLogger("group", "stream", Config{
+		Region:          "us-east-1",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        f.server.URL + "/",
+	})
+	c.Assert(err, IsNil)
+	return logger.WithRetries(3, time.Millisecond).WithFormatter(messageFormatter{})
+}
+
+//messageFormatter keeps the message text only
+type messageFormatter struct{}
+
+func (messageFormatter) Format(rawRlogMsg *common.RlogMsg, prefix string) string {
+	return rawRlogMsg.Msg
+}
+
+//When signing a request, it should produce the AWS Signature Version 4 (independently computed)
+func (s *CloudWatchSuite) TestSign(c *C) {
+	body := []byte(`{"logGroupName":"g"}`)
+	req, _ := http.NewRequest("POST", "https://logs.us-east-1.amazonaws.com/", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", apiTarget)
+	creds := Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		SessionToken:    "TOKEN",
+	}
+	sign(req, body, "us-east-1", creds, time.Date(2015, time.August, 30, 12, 36, 0, 0, time.UTC))
+
+	c.Assert(req.Header.Get("X-Amz-Date"), Equals, "20150830T123600Z")
+	c.Assert(req.Header.Get("X-Amz-Security-Token"), Equals, "TOKEN")
+	c.Assert(req.Header.Get("Authorization"), Equals, "AWS4-HMAC-SHA256 "+
+		"Credential=AKIDEXAMPLE/20150830/us-east-1/logs/aws4_request, "+
+		"SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target, "+
+		"Signature=3fdfb4d775044e5f77af04c346196fb396a7df682cdf353617908b99125a4e07")
+}
+
+//When flushing, it should send the batch in chronological order and chain the sequence tokens
+func (s *CloudWatchSuite) TestSendBatches(c *C) {
+	f := newFakeCloudWatch()
+	defer f.server.Close()
+	logger := newTestLogger(c, f)
+
+	start := time.Unix(1400000000, 0)
+	for i, offset := range []int{2, 0, 1} {
+		logger.add(&common.RlogMsg{Msg: fmt.Sprintf("msg %d", i), Time: start.Add(time.Duration(offset) * time.Second)})
+	}
+	logger.sendBatch()
+	logger.add(&common.RlogMsg{Msg: "next", Time: start})
+	logger.sendBatch()
+
+	reqs := f.received()
+	c.Assert(reqs, HasLen, 2)
+	c.Assert(reqs[0].LogGroupName, Equals, "group")
+	c.Assert(reqs[0].LogStreamName, Equals, "stream")
+	c.Assert(reqs[0].SequenceToken, Equals, "")
+	c.Assert(reqs[0].LogEvents, DeepEquals, []logEvent{
+		{Timestamp: 1400000000000, Message: "msg 1"},
+		{Timestamp: 1400000001000, Message: "msg 2"},
+		{Timestamp: 1400000002000, Message: "msg 0"},
+	})
+	c.Assert(reqs[1].SequenceToken, Equals, "token-1")
+	c.Assert(f.headers[0].Get("X-Amz-Target"), Equals, apiTarget)
+	c.Assert(f.headers[0].Get("Authorization"), Matches, "AWS4-HMAC-SHA256 Credential=AKID/.*/us-east-1/logs/aws4_request, .*")
+}
+
+//When a message would exceed the limits of a batch, it should send the batch first
+func (s *CloudWatchSuite) TestBatchLimits(c *C) {
+	f := newFakeCloudWatch()
+	defer f.server.Close()
+	logger := newTestLogger(c, f)
+
+	//Number of events
+	start := time.Unix(1400000000, 0)
+	for i := 0; i <= maxBatchEvents; i++ {
+		logger.add(&common.RlogMsg{Msg: "m", Time: start})
+	}
+	c.Assert(f.received(), HasLen, 1)
+	c.Assert(f.received()[0].LogEvents, HasLen, maxBatchEvents)
+	logger.sendBatch()
+
+	//Time span
+	logger.add(&common.RlogMsg{Msg: "first", Time: start})
+	logger.add(&common.RlogMsg{Msg: "next day", Time: start.Add(maxBatchSpan)})
+	c.Assert(f.received(), HasLen, 3)
+	c.Assert(f.received()[2].LogEvents, DeepEquals, []logEvent{{Timestamp: 1400000000000, Message: "first"}})
+
+	//Size, an oversized message is truncated
+	logger.sendBatch()
+	big := strings.Repeat("x", maxEventBytes+10)
+	for i := 0; i < 5; i++ {
+		logger.add(&common.RlogMsg{Msg: big, Time: start})
+	}
+	c.Assert(f.received(), HasLen, 5)
+	c.Assert(f.received()[4].LogEvents, HasLen, maxBatchBytes/(maxEventBytes+eventOverhead))
+	c.Assert(f.received()[4].LogEvents[0].Message, HasLen, maxEventBytes)
+}
+
+//When a request is throttled or the sequence token is rejected, it should retry the batch
+func (s *CloudWatchSuite) TestRetries(c *C) {
+	f := newFakeCloudWatch()
+	defer f.server.Close()
+	f.errors = []string{
+		`{"__type":"com.amazonaws.logs#ThrottlingException","message":"Rate exceeded"}`,
+		`{"__type":"InvalidSequenceTokenException","expectedSequenceToken":"expected"}`,
+	}
+	logger := newTestLogger(c, f)
+
+	logger.add(&common.RlogMsg{Msg: "retried", Time: time.Unix(1400000000, 0)})
+	logger.sendBatch()
+
+	reqs := f.received()
+	c.Assert(reqs, HasLen, 3)
+	c.Assert(reqs[2].SequenceToken, Equals, "expected")
+	c.Assert(reqs[2].LogEvents, DeepEquals, reqs[0].LogEvents)
+	c.Assert(logger.sequenceToken, Equals, "token-3")
+
+	//A batch accepted before is not sent again
+	f.errors = []string{`{"__type":"DataAlreadyAcceptedException","expectedSequenceToken":"after"}`}
+	logger.add(&common.RlogMsg{Msg: "duplicate", Time: time.Unix(1400000000, 0)})
+	logger.sendBatch()
+	c.Assert(f.received(), HasLen, 4)
+	c.Assert(logger.sequenceToken, Equals, "after")
+}
+
+//When rlog flushes the module, it should send the pending messages and report their number
+func (s *CloudWatchSuite) TestLaunchModuleFlush(c *C) {
+	f := newFakeCloudWatch()
+	defer f.server.Close()
+	logger := newTestLogger(c, f).WithBatchInterval(0)
+
+	dataChan := make(chan *common.RlogMsg, 10)
+	flushChan := make(chan chan common.FlushResult, 1)
+	done := make(chan struct{})
+	go func() {
+		logger.LaunchModule(dataChan, flushChan)
+		close(done)
+	}()
+
+	dataChan <- &common.RlogMsg{Msg: "one", Time: time.Now()}
+	dataChan <- &common.RlogMsg{Msg: "two", Time: time.Now()}
+	ret := make(chan common.FlushResult, 1)
+	flushChan <- ret
+	c.Assert(<-ret, Equals, common.FlushResult{Flushed: 2})
+	c.Assert(f.received(), HasLen, 1)
+
+	//Closing the flush channel sends the rest and ends the module
+	dataChan <- &common.RlogMsg{Msg: "three", Time: time.Now()}
+	close(flushChan)
+	<-done
+	c.Assert(f.received(), HasLen, 2)
+}
+
+//When a batch is dropped, the next flush should report it
+func (s *CloudWatchSuite) TestFlushReportsFailures(c *C) {
+	f := newFakeCloudWatch()
+	defer f.server.Close()
+	f.errors = []string{`{"__type":"AccessDeniedException","message":"denied"}`}
+	logger := newTestLogger(c, f)
+
+	logger.add(&common.RlogMsg{Msg: "denied", Time: time.Now()})
+	flushed, err := logger.flush(nil)
+	c.Assert(flushed, Equals, 1)
+	c.Assert(err, ErrorMatches, "dropped 1 message\\(s\\): AccessDeniedException \\(status 400\\): denied")
+	c.Assert(f.received(), HasLen, 1)
+
+	logger.add(&common.RlogMsg{Msg: "accepted", Time: time.Now()})
+	_, err = logger.flush(nil)
+	c.Assert(err, IsNil)
+}
+
+//When the configuration lacks region or credentials, it should not create the module
+func (s *CloudWatchSuite) TestConfigValidation(c *C) {
+	_, err := NewCloudWatchLogger("g", "s", Config{Region: "us-east-1", AccessKeyID: "AKID"})
+	c.Assert(err, ErrorMatches, "rlog cloudwatch: region and credentials .* are required")
+	_, err = NewCloudWatchLogger("g", "s", Config{AccessKeyID: "AKID", SecretAccessKey: "SECRET"})
+	c.Assert(err, NotNil)
+	_, err = NewCloudWatchLogger("g", "s", Config{Region: "us-east-1", Credentials: EnvCredentials()})
+	c.Assert(err, IsNil)
+}
+
+//When reading the shared files of the AWS CLI, it should select the profile
+func (s *CloudWatchSuite) TestSharedFiles(c *C) {
+	dir := c.MkDir()
+	credentials := filepath.Join(dir, "credentials")
+	config := filepath.Join(dir, "config")
+	ioutil.WriteFile(credentials, []byte("[default]\naws_access_key_id = DEFAULT\naws_secret_access_key = s1\n\n"+
+		"# comment\n[dev]\naws_access_key_id=DEV\naws_secret_access_key=s2\naws_session_token = t2\n"), 0600)
+	ioutil.WriteFile(config, []byte("[default]\nregion = us-east-1\n[profile dev]\nregion = eu-west-1\n"), 0600)
+	defer restoreEnv("AWS_SHARED_CREDENTIALS_FILE", credentials)()
+	defer restoreEnv("AWS_CONFIG_FILE", config)()
+	defer restoreEnv("AWS_PROFILE", "")()
+
+	creds, err := SharedCredentials("").Retrieve()
+	c.Assert(err, IsNil)
+	c.Assert(creds, Equals, Credentials{AccessKeyID: "DEFAULT", SecretAccessKey: "s1"})
+	creds, err = SharedCredentials("dev").Retrieve()
+	c.Assert(err, IsNil)
+	c.Assert(creds, Equals, Credentials{AccessKeyID: "DEV", SecretAccessKey: "s2", SessionToken: "t2"})
+	_, err = SharedCredentials("missing").Retrieve()
+	c.Assert(err, ErrorMatches, "no profile missing in .*")
+
+	c.Assert(sharedRegion(""), Equals, "us-east-1")
+	os.Setenv("AWS_PROFILE", "dev")
+	c.Assert(sharedRegion(""), Equals, "eu-west-1")
+}
+
+//When running on an instance with an IAM role, it should retrieve the role's credentials using a
+//session token
+func (s *CloudWatchSuite) TestInstanceRole(c *C) {
+	expires := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			c.Check(r.Method, Equals, "PUT")
+			fmt.Fprint(w, "session")
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != "session" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			fmt.Fprint(w, "logger-role\n")
+		case "/latest/meta-data/iam/security-credentials/logger-role":
+			fmt.Fprintf(w, `{"Code":"Success","AccessKeyId":"ASIA","SecretAccessKey":"secret","Token":"token","Expiration":"%s"}`,
+				expires.Format(time.RFC3339))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	p := &instanceRole{endpoint: server.URL, client: server.Client()}
+	creds, err := p.Retrieve()
+	c.Assert(err, IsNil)
+	c.Assert(creds.AccessKeyID, Equals, "ASIA")
+	c.Assert(creds.SecretAccessKey, Equals, "secret")
+	c.Assert(creds.SessionToken, Equals, "token")
+	c.Assert(creds.Expires.Equal(expires), Equals, true)
+
+	//The chain falls back to the next provider
+	defer restoreEnv("AWS_ACCESS_KEY_ID", "")()
+	creds, err = chainCredentials{EnvCredentials(), p}.Retrieve()
+	c.Assert(err, IsNil)
+	c.Assert(creds.AccessKeyID, Equals, "ASIA")
+	_, err = chainCredentials{EnvCredentials()}.Retrieve()
+	c.Assert(err, ErrorMatches, "no AWS credentials found: .*")
+}
+
+//countingProvider hands out numbered credentials expiring after the given time
+type countingProvider struct {
+	calls    int
+	validFor time.Duration
+	fail     bool
+}
+
+func (p *countingProvider) Retrieve() (Credentials, error) {
+	p.calls++
+	if p.fail {
+		return Credentials{}, fmt.Errorf("unavailable")
+	}
+	return Credentials{AccessKeyID: fmt.Sprintf("key-%d", p.calls), SecretAccessKey: "s", Expires: time.Now().Add(p.validFor)}, nil
+}
+
+//When credentials of a provider are about to expire, it should retrieve them again
+func (s *CloudWatchSuite) TestCredentialsRefresh(c *C) {
+	p := &countingProvider{validFor: time.Hour}
+	logger, err := NewCloudWatchLogger("g", "s", Config{Region: "us-east-1", Credentials: p})
+	c.Assert(err, IsNil)
+
+	creds, err := logger.credentials()
+	c.Assert(err, IsNil)
+	c.Assert(creds.AccessKeyID, Equals, "key-1")
+	creds, _ = logger.credentials()
+	c.Assert(creds.AccessKeyID, Equals, "key-1")
+
+	//Within the refresh window
+	logger.creds.Expires = time.Now().Add(refreshWindow / 2)
+	creds, _ = logger.credentials()
+	c.Assert(creds.AccessKeyID, Equals, "key-2")
+
+	//A failed refresh keeps the credentials until they expire
+	p.fail = true
+	logger.creds.Expires = time.Now().Add(refreshWindow / 2)
+	creds, err = logger.credentials()
+	c.Assert(err, IsNil)
+	c.Assert(creds.AccessKeyID, Equals, "key-2")
+	logger.creds.Expires = time.Now().Add(-time.Second)
+	_, err = logger.credentials()
+	c.Assert(err, ErrorMatches, "unavailable")
+}
+
+//restoreEnv sets an environment variable ("" unsets it)
+//Returns: function restoring the previous value
+func restoreEnv(name, value string) func() {
+	old, had := os.LookupEnv(name)
+	if value == "" {
+		os.Unsetenv(name)
+	} else {
+		os.Setenv(name, value)
+	}
+	return func() {
+		if had {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
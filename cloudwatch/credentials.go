@@ -0,0 +1,281 @@
+package cloudwatch
+
+/*
+This file implements the sources of AWS credentials besides static keys: the environment variables, the
+shared credentials file of the AWS CLI and the IAM role of an EC2 instance. The module retrieves
+temporary credentials again before they expire.
+*/
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//Credentials are the AWS keys signing the requests
+type Credentials struct {
+	AccessKeyID     string    //access key
+	SecretAccessKey string    //secret key
+	SessionToken    string    //session token of temporary credentials, "" if none
+	Expires         time.Time //time the credentials expire, zero if they do not
+}
+
+//CredentialsProvider retrieves credentials, e.g. from a file or the instance metadata service
+type CredentialsProvider interface {
+	//Retrieve returns credentials, error if none are available
+	Retrieve() (Credentials, error)
+}
+
+//Defaults of the credentials providers
+const (
+	refreshWindow    = 5 * time.Minute // credentials are retrieved again this long before they expire
+	metadataEndpoint = "http://169.254.169.254"
+	metadataTimeout  = 2 * time.Second
+	metadataTokenTTL = "21600" // lifetime of the IMDSv2 session token in seconds
+)
+
+//envCredentials reads the credentials from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+type envCredentials struct{}
+
+//EnvCredentials reads the credentials from the standard AWS environment variables AWS_ACCESS_KEY_ID,
+//AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+//Returns: credentials provider
+func EnvCredentials() CredentialsProvider {
+	return envCredentials{}
+}
+
+//Retrieve reads the environment variables
+//Returns: credentials, error if the keys are not set
+func (envCredentials) Retrieve() (Credentials, error) {
+	creds := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return Credentials{}, fmt.Errorf("AWS_ACCESS_KEY_ID or AWS_SECRET_ACCESS_KEY not set")
+	}
+	return creds, nil
+}
+
+//sharedCredentials reads the credentials of a profile from the shared credentials file
+type sharedCredentials struct {
+	path    string // path of the credentials file
+	profile string // section of the file
+}
+
+//SharedCredentials reads the credentials of a profile from the shared credentials file of the AWS CLI
+//(AWS_SHARED_CREDENTIALS_FILE, ~/.aws/credentials by default). The file is read on each retrieval.
+//Arguments: profile name, "" for AWS_PROFILE or "default"
+//Returns: credentials provider
+func SharedCredentials(profile string) CredentialsProvider {
+	return sharedCredentials{path: sharedFile("AWS_SHARED_CREDENTIALS_FILE", "credentials"), profile: profileName(profile)}
+}
+
+//Retrieve reads the profile from the credentials file
+//Returns: credentials, error if the file or the keys of the profile are missing
+func (p sharedCredentials) Retrieve() (Credentials, error) {
+	values, err := readProfile(p.path, p.profile)
+	if err != nil {
+		return Credentials{}, err
+	}
+	creds := Credentials{
+		AccessKeyID:     values["aws_access_key_id"],
+		SecretAccessKey: values["aws_secret_access_key"],
+		SessionToken:    values["aws_session_token"],
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return Credentials{}, fmt.Errorf("no keys for profile %s in %s", p.profile, p.path)
+	}
+	return creds, nil
+}
+
+//instanceRole retrieves the temporary credentials of the IAM role of an EC2 instance
+type instanceRole struct {
+	endpoint string       // URL of the instance metadata service
+	client   *http.Client // client used to query the metadata service
+}
+
+//InstanceRoleCredentials retrieves the temporary credentials of the IAM role of the EC2 instance the
+//process runs on from the instance metadata service (IMDSv2). The module retrieves them again before
+//they expire.
+//Returns: credentials provider
+func InstanceRoleCredentials() CredentialsProvider {
+	return &instanceRole{endpoint: metadataEndpoint, client: &http.Client{Timeout: metadataTimeout}}
+}
+
+//Retrieve queries the metadata service for the role of the instance and its credentials
+//Returns: credentials, error if the metadata service is not available or the instance has no role
+func (p *instanceRole) Retrieve() (Credentials, error) {
+	token, err := p.query("PUT", "/latest/api/token", "")
+	if err != nil {
+		return Credentials{}, err
+	}
+	roles, err := p.query("GET", "/latest/meta-data/iam/security-credentials/", token)
+	if err != nil {
+		return Credentials{}, err
+	}
+	role := strings.TrimSpace(strings.SplitN(roles, "\n", 2)[0])
+	if role == "" {
+		return Credentials{}, fmt.Errorf("no IAM role attached to the instance")
+	}
+	doc, err := p.query("GET", "/latest/meta-data/iam/security-credentials/"+role, token)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	var res struct {
+		Code            string
+		AccessKeyId     string
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+	if err := json.Unmarshal([]byte(doc), &res); err != nil {
+		return Credentials{}, fmt.Errorf("invalid credentials of IAM role %s: %s", role, err.Error())
+	}
+	if res.Code != "Success" {
+		return Credentials{}, fmt.Errorf("credentials of IAM role %s not available: %s", role, res.Code)
+	}
+	return Credentials{
+		AccessKeyID:     res.AccessKeyId,
+		SecretAccessKey: res.SecretAccessKey,
+		SessionToken:    res.Token,
+		Expires:         res.Expiration,
+	}, nil
+}
+
+//query sends a request to the metadata service
+//Arguments: [method] HTTP method. [path] path of the resource. [token] session token, "" to request one
+//Returns: response body, error if the request failed
+func (p *instanceRole) query(method, path, token string) (string, error) {
+	req, err := http.NewRequest(method, p.endpoint+path, nil)
+	if err != nil {
+		return "", err
+	}
+	if token == "" {
+		req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", metadataTokenTTL)
+	} else {
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("instance metadata %s: status %d", path, resp.StatusCode)
+	}
+	return string(body), nil
+}
+
+//chainCredentials tries several providers in order
+type chainCredentials []CredentialsProvider
+
+//DefaultCredentials looks for credentials like the AWS CLI: in the environment variables (see
+//EnvCredentials), the shared credentials file (see SharedCredentials) and finally the IAM role of the
+//instance (see InstanceRoleCredentials)
+//Returns: credentials provider
+func DefaultCredentials() CredentialsProvider {
+	return chainCredentials{EnvCredentials(), SharedCredentials(""), InstanceRoleCredentials()}
+}
+
+//Retrieve returns the credentials of the first provider having some
+//Returns: credentials, error naming the failures of all providers if none has credentials
+func (c chainCredentials) Retrieve() (Credentials, error) {
+	var failures []string
+	for _, p := range c {
+		creds, err := p.Retrieve()
+		if err == nil {
+			return creds, nil
+		}
+		failures = append(failures, err.Error())
+	}
+	return Credentials{}, fmt.Errorf("no AWS credentials found: %s", strings.Join(failures, "; "))
+}
+
+//sharedRegion reads the region of a profile from the shared config file of the AWS CLI (AWS_CONFIG_FILE,
+//~/.aws/config by default)
+//Arguments: profile name, "" for AWS_PROFILE or "default"
+//Returns: region, "" if not configured
+func sharedRegion(profile string) string {
+	profile = profileName(profile)
+	section := "profile " + profile
+	if profile == "default" {
+		section = profile
+	}
+	values, _ := readProfile(sharedFile("AWS_CONFIG_FILE", "config"), section)
+	return values["region"]
+}
+
+//profileName selects the profile of the shared files
+//Returns: profile, AWS_PROFILE or "default" if empty
+func profileName(profile string) string {
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+	return profile
+}
+
+//sharedFile determines the path of a shared file of the AWS CLI
+//Arguments: [env] environment variable overriding the path. [name] name of the file in ~/.aws
+//Returns: path of the file
+func sharedFile(env, name string) string {
+	if path := os.Getenv(env); path != "" {
+		return path
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".aws", name)
+}
+
+//readProfile reads a section of an INI file like the shared files of the AWS CLI
+//Arguments: [path] path of the file. [section] name of the section
+//Returns: keys and values of the section, error if the file cannot be read or lacks the section
+func readProfile(path, section string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var values map[string]string
+	current := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+			continue
+		case line[0] == '[' && line[len(line)-1] == ']':
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			if current == section && values == nil {
+				values = make(map[string]string)
+			}
+		case current == section:
+			if i := strings.IndexByte(line, '='); i > 0 {
+				values[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if values == nil {
+		return nil, fmt.Errorf("no profile %s in %s", section, path)
+	}
+	return values, nil
+}
@@ -3,14 +3,73 @@ Package common contains data structures and constants shared between rlog and it
 */
 package common
 
+import (
+	"strconv"
+	"time"
+)
+
 //RlogMsg carries a formatted log message including some additional information.
 type RlogMsg struct {
-	Msg        string       //log message
-	Timestamp  string       //time of log generation (preformatted)
-	Severity   RlogSeverity //log severity
-	Pc         uint         //program counter position where log message was generated
-	StackTrace string       //stack trace (for error and fatal only)
+	Msg         string                 //log message
+	Timestamp   string                 //time of log generation preformatted as configured, see FormatTime
+	Time        time.Time              //time of log generation, for modules requiring their own format
+	Severity    RlogSeverity           //log severity
+	Pc          uint                   //program counter position where log message was generated
+	StackTrace  string                 //stack trace (for error and fatal only)
+	Fields      map[string]interface{} //structured key/value pairs (nil if none)
+	File        string                 //file of the log call if position info is included ("" otherwise)
+	Line        int                    //line of the log call if position info is included (0 otherwise)
+	Func        string                 //function of the log call if included as well, see rlog.RlogConfig.IncludeFuncName
+	PosInHeader bool                   //true if the header of Msg renders the position already (see rlog.HeaderFormatter)
+	Seq         uint64                 //consecutive message number, gaps indicate dropped or filtered messages
+}
+
+//FormatTime renders the time of log generation using the given Go reference time layout (e.g.
+//time.RFC3339Nano). Messages not carrying a time (e.g. created by hand) keep their preformatted timestamp.
+//Arguments: time layout, "" for the preformatted timestamp
+//Returns: formatted time
+func (m *RlogMsg) FormatTime(layout string) string {
+	if layout == "" || m.Time.IsZero() {
+		return m.Timestamp
+	}
+	return m.Time.Format(layout)
 }
 
 //RlogSeverity defines a type to represent severity levels for log messages
 type RlogSeverity uint
+
+//severityNames maps severity levels to the lowercase names used in structured output
+var severityNames = []string{"fatal", "error", "warning", "info", "debug", "trace"}
+
+//String converts a severity level to its lowercase name (e.g. "warning") as used in structured output
+//Returns: severity name, the number itself for unknown levels
+func (s RlogSeverity) String() string {
+	if int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return strconv.Itoa(int(s))
+}
+
+//ModuleSeverity can be embedded by output modules to support an optional severity threshold
+//overriding the global rlog severity for that module only
+type ModuleSeverity struct {
+	severity RlogSeverity //module severity threshold
+	set      bool         //true if the threshold overrides the global severity
+}
+
+//SetSeverity sets the severity threshold of the module
+func (m *ModuleSeverity) SetSeverity(severity RlogSeverity) {
+	m.severity = severity
+	m.set = true
+}
+
+//Severity returns the severity threshold of the module and whether it has been set at all
+func (m *ModuleSeverity) Severity() (RlogSeverity, bool) {
+	return m.severity, m.set
+}
+
+//FlushResult is the response of a module to a flush command
+type FlushResult struct {
+	Flushed int   //number of pending messages written by the flush
+	Err     error //error preventing the flush, nil on success
+}
@@ -1,10 +1,13 @@
 package common
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -17,6 +20,158 @@ const (
 
 var replaceWhitespaceRegex = regexp.MustCompile(replacementWhitespacePattern)
 
+//MessageFormat selects the layout output modules use to write log messages
+type MessageFormat int
+
+const (
+	FormatText   MessageFormat = iota //plain text, see FormatMessage
+	FormatJSON                        //one JSON object per line, see FormatMessageJSON
+	FormatLogfmt                      //key=value pairs per line, see FormatMessageLogfmt
+)
+
+//Formatter creates the text output modules write for a log message. Modules use the DefaultFormatter
+//unless configured otherwise, a custom Formatter can be set on any module using WithFormatter.
+type Formatter interface {
+	Format(rawRlogMsg *RlogMsg, prefix string) string
+}
+
+//FormatterFunc adapts an ordinary function to the Formatter interface
+type FormatterFunc func(rawRlogMsg *RlogMsg, prefix string) string
+
+//Format calls the function itself
+func (f FormatterFunc) Format(rawRlogMsg *RlogMsg, prefix string) string {
+	return f(rawRlogMsg, prefix)
+}
+
+//NewlineReplacement replaces newlines and tabs to keep each message on a single line, e.g.
+//NewlineReplacement{Newline: " | "} for separators or NewlineReplacement{Newline: `\n`, Tab: `\t`} to
+//escape them literally.
+type NewlineReplacement struct {
+	Newline string //replaces each newline ("\r\n", "\r" or "\n")
+	Tab     string //replaces each tab
+}
+
+//Replace replaces the newlines and tabs of a message. The zero value replaces each sequence of them
+//with two spaces and trims the message, see ReplaceNewlines.
+//Returns: message without newlines and tabs
+func (r NewlineReplacement) Replace(msg string) string {
+	if r == (NewlineReplacement{}) {
+		return ReplaceNewlines(msg)
+	}
+	return strings.NewReplacer("\r\n", r.Newline, "\r", r.Newline, "\n", r.Newline, "\t", r.Tab).Replace(msg)
+}
+
+//DefaultFormatter formats messages as plain text, see FormatMessage
+type DefaultFormatter struct {
+	RemoveNewlines     bool               //replace newlines and tabs as in syslog
+	Newlines           NewlineReplacement //replacement used if RemoveNewlines is set, zero value for two spaces
+	ContinuationPrefix string             //starts each line after the first if newlines are kept, e.g. "\t" or "| "
+	NumericSeverity    bool               //start each message with the syslog priority, e.g. "<3>", see SyslogPriority
+	TimeLayout         string             //layout of the timestamp, "" for the rlog timestamp format, see RlogMsg.FormatTime
+}
+
+//Format generates a plain text log message
+func (f DefaultFormatter) Format(rawRlogMsg *RlogMsg, prefix string) string {
+	res := formatMessage(withTimeLayout(rawRlogMsg, f.TimeLayout), prefix, f)
+	if f.NumericSeverity {
+		//Same prefix as understood by systemd and the kernel log for lines written to stdout/stderr
+		res = "<" + strconv.Itoa(SyslogPriority(rawRlogMsg.Severity)) + ">" + res
+	}
+	return res
+}
+
+//JSONFormatter formats messages as single line JSON objects, see FormatMessageJSON
+type JSONFormatter struct {
+	NumericSeverity bool   //add the syslog priority as "priority" field, see SyslogPriority
+	TimeLayout      string //layout of the timestamp (e.g. time.RFC3339Nano), "" for the rlog timestamp format
+}
+
+//Format generates a JSON log message
+func (f JSONFormatter) Format(rawRlogMsg *RlogMsg, prefix string) string {
+	return formatMessageJSON(withTimeLayout(rawRlogMsg, f.TimeLayout), prefix, f.NumericSeverity)
+}
+
+//LogfmtFormatter formats messages as logfmt key=value pairs, see FormatMessageLogfmt
+type LogfmtFormatter struct {
+	NumericSeverity bool   //add the syslog priority as "priority" pair after the level, see SyslogPriority
+	TimeLayout      string //layout of the timestamp (e.g. time.RFC3339), "" for the rlog timestamp format
+}
+
+//Format generates a logfmt log message
+func (f LogfmtFormatter) Format(rawRlogMsg *RlogMsg, prefix string) string {
+	return formatMessageLogfmt(withTimeLayout(rawRlogMsg, f.TimeLayout), f.NumericSeverity)
+}
+
+//withTimeLayout renders the timestamp of a message using a formatter specific layout
+//Arguments: [rawRlogMsg] log message. [layout] time layout, "" to keep the timestamp
+//Returns: the message itself if the layout is empty, a copy carrying the rendered timestamp otherwise
+func withTimeLayout(rawRlogMsg *RlogMsg, layout string) *RlogMsg {
+	if layout == "" {
+		return rawRlogMsg
+	}
+	msg := *rawRlogMsg
+	msg.Timestamp = rawRlogMsg.FormatTime(layout)
+	return &msg
+}
+
+//NewFormatter creates the built-in formatter for the given format. removeNewlines only applies to the
+//text format because JSON and logfmt escape newlines anyway.
+func NewFormatter(format MessageFormat, removeNewlines bool) Formatter {
+	switch format {
+	case FormatJSON:
+		return JSONFormatter{}
+	case FormatLogfmt:
+		return LogfmtFormatter{}
+	}
+	return DefaultFormatter{RemoveNewlines: removeNewlines}
+}
+
+//WithNewlineReplacement sets the replacement of newlines and tabs of the built-in text formatter, e.g.
+//for modules offering the replacement as option while the format can be selected independently
+//Returns: formatter using the replacement, formatters other than DefaultFormatter as they are
+func WithNewlineReplacement(f Formatter, newlines NewlineReplacement) Formatter {
+	if df, ok := f.(DefaultFormatter); ok {
+		df.Newlines = newlines
+		return df
+	}
+	return f
+}
+
+//syslogPriorities maps severity levels to syslog priorities (RFC5424 severities), as used by the
+//syslog module. Syslog has no level below debug, trace is mapped to debug as well.
+var syslogPriorities = []int{
+	2, // fatal: critical
+	3, // error
+	4, // warning
+	6, // info
+	7, // debug
+	7, // trace
+}
+
+//Environment information emitted with every JSON log message. It does not change during the
+//lifetime of the process and hence is fetched only once.
+var (
+	jsonPid         = os.Getpid()
+	jsonHostname, _ = os.Hostname()
+)
+
+//jsonMsg is the representation of a log message written by FormatMessageJSON
+type jsonMsg struct {
+	Timestamp  string                 `json:"timestamp"`
+	Severity   string                 `json:"severity"`
+	Pid        int                    `json:"pid"`
+	Hostname   string                 `json:"hostname"`
+	Message    string                 `json:"message"`
+	StackTrace string                 `json:"stack_trace,omitempty"`
+	File       string                 `json:"file,omitempty"`
+	Line       int                    `json:"line,omitempty"`
+	Func       string                 `json:"func,omitempty"`
+	Priority   int                    `json:"priority,omitempty"`
+	Pc         uint                   `json:"pc"`
+	Seq        uint64                 `json:"seq"`
+	Fields     map[string]interface{} `json:"fields,omitempty"`
+}
+
 //SyslogHeader gathers environment information to generate a log prefix
 func SyslogHeader() string {
 	//Fetch process name, pid and hostname
@@ -35,29 +190,233 @@ func SyslogHeader() string {
 	return prefix
 }
 
-//FormatMessage generates a log message
+//FormatMessage generates a log message, starting with the position of the log call if present (see
+//FormatPosition)
 func FormatMessage(rawRlogMsg *RlogMsg, prefix string, removeNewlines bool) string {
-	logMsg := rawRlogMsg.Msg
+	return formatMessage(rawRlogMsg, prefix, DefaultFormatter{RemoveNewlines: removeNewlines})
+}
+
+//formatMessage generates a plain text log message, see FormatMessage
+//Arguments: [rawRlogMsg] log message. [prefix] log prefix. [f] newline handling, the timestamp layout
+//and numeric severity are applied by the caller
+func formatMessage(rawRlogMsg *RlogMsg, prefix string, f DefaultFormatter) string {
+	logMsg := FormatPosition(rawRlogMsg) + rawRlogMsg.Msg + FormatFields(rawRlogMsg.Fields)
 	trace := rawRlogMsg.StackTrace
-	if removeNewlines {
+	if f.RemoveNewlines {
 		//Replace whitespace
-		logMsg = ReplaceNewlines(logMsg)
+		logMsg = f.Newlines.Replace(logMsg)
 	}
 
 	//Print the log message and stack trace if appropriate
 	res := rawRlogMsg.Timestamp + " " + prefix + logMsg
 	if trace != "" {
-		if removeNewlines {
-			trace = ReplaceNewlines(trace)
+		if f.RemoveNewlines {
+			trace = f.Newlines.Replace(trace)
 			res += ", trace: " + trace
 		} else {
 			res += "\n" + trace
 		}
 	}
 
+	if !f.RemoveNewlines && f.ContinuationPrefix != "" {
+		//Mark the lines belonging to this entry, e.g. of a stack trace
+		res = prefixContinuationLines(res, f.ContinuationPrefix)
+	}
+	return res
+}
+
+//prefixContinuationLines starts each line of a multiline message except the first with a marker.
+//Trailing newlines do not start a line of their own.
+//Arguments: [msg] message. [marker] prefix of continuation lines
+//Returns: message with marked continuation lines
+func prefixContinuationLines(msg, marker string) string {
+	body := strings.TrimRight(msg, "\r\n")
+	return strings.Replace(body, "\n", "\n"+marker, -1) + msg[len(body):]
+}
+
+//FormatMessageJSON generates a log message as a single line JSON object. Newlines in the message
+//and stack trace are preserved by JSON escaping. Hostname and pid are emitted as separate fields,
+//the prefix is accepted to keep the signature interchangeable with FormatMessage but not used.
+func FormatMessageJSON(rawRlogMsg *RlogMsg, prefix string) string {
+	return formatMessageJSON(rawRlogMsg, prefix, false)
+}
+
+//formatMessageJSON generates a JSON log message, see FormatMessageJSON
+//Arguments: [rawRlogMsg] log message. [prefix] log prefix, used if falling back to text. [priority]
+//add the syslog priority
+func formatMessageJSON(rawRlogMsg *RlogMsg, prefix string, priority bool) string {
+	jm := jsonMsg{
+		Timestamp:  rawRlogMsg.Timestamp,
+		Severity:   rawRlogMsg.Severity.String(),
+		Pid:        jsonPid,
+		Hostname:   jsonHostname,
+		Message:    rawRlogMsg.Msg,
+		StackTrace: rawRlogMsg.StackTrace,
+		File:       rawRlogMsg.File,
+		Line:       rawRlogMsg.Line,
+		Func:       rawRlogMsg.Func,
+		Pc:         rawRlogMsg.Pc,
+		Seq:        rawRlogMsg.Seq,
+		Fields:     rawRlogMsg.Fields,
+	}
+	if priority {
+		jm.Priority = SyslogPriority(rawRlogMsg.Severity)
+	}
+
+	res, err := json.Marshal(jm)
+	if err != nil {
+		//A field value cannot be marshaled (e.g. a channel), never lose the message because of it
+		return FormatMessage(rawRlogMsg, prefix, true)
+	}
+	return string(res)
+}
+
+//FormatMessageLogfmt generates a log message as a single line of logfmt key=value pairs: ts, level,
+//seq, msg, the structured fields sorted by key and, if present, file, line, func and trace. Values containing
+//spaces, quotes, "=" or control characters are quoted and escaped, such characters in keys are replaced
+//with "_". The prefix is accepted to keep the signature interchangeable with FormatMessage but not used.
+func FormatMessageLogfmt(rawRlogMsg *RlogMsg, prefix string) string {
+	return formatMessageLogfmt(rawRlogMsg, false)
+}
+
+//formatMessageLogfmt generates a logfmt log message, see FormatMessageLogfmt
+//Arguments: [rawRlogMsg] log message. [priority] add the syslog priority
+func formatMessageLogfmt(rawRlogMsg *RlogMsg, priority bool) string {
+	var buf bytes.Buffer
+	writeLogfmtPair(&buf, "ts", rawRlogMsg.Timestamp)
+	writeLogfmtPair(&buf, "level", rawRlogMsg.Severity.String())
+	if priority {
+		writeLogfmtPair(&buf, "priority", strconv.Itoa(SyslogPriority(rawRlogMsg.Severity)))
+	}
+	writeLogfmtPair(&buf, "seq", strconv.FormatUint(rawRlogMsg.Seq, 10))
+	writeLogfmtPair(&buf, "msg", rawRlogMsg.Msg)
+
+	keys := make([]string, 0, len(rawRlogMsg.Fields))
+	for k := range rawRlogMsg.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeLogfmtPair(&buf, k, fmt.Sprint(rawRlogMsg.Fields[k]))
+	}
+
+	if rawRlogMsg.File != "" {
+		writeLogfmtPair(&buf, "file", rawRlogMsg.File)
+		writeLogfmtPair(&buf, "line", strconv.Itoa(rawRlogMsg.Line))
+	}
+	if rawRlogMsg.Func != "" {
+		writeLogfmtPair(&buf, "func", rawRlogMsg.Func)
+	}
+	if rawRlogMsg.StackTrace != "" {
+		writeLogfmtPair(&buf, "trace", rawRlogMsg.StackTrace)
+	}
+	return buf.String()
+}
+
+//writeLogfmtPair appends a key=value pair separated by a space from the previous pair
+//Arguments: [buf] destination. [key] key of the pair, sanitized if needed. [value] value, quoted if needed
+func writeLogfmtPair(buf *bytes.Buffer, key, value string) {
+	if buf.Len() > 0 {
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(logfmtKey(key))
+	buf.WriteByte('=')
+	if needsLogfmtQuoting(value) {
+		buf.WriteString(strconv.Quote(value))
+	} else {
+		buf.WriteString(value)
+	}
+}
+
+//logfmtKey sanitizes a logfmt key. Keys cannot be quoted, so spaces, quotes, "=", backslashes and control
+//characters are replaced with "_" to keep the pairs parseable.
+//Returns: key safe to write unquoted, "_" if the key is empty
+func logfmtKey(key string) string {
+	if key == "" {
+		return "_"
+	}
+	if !needsLogfmtQuoting(key) {
+		return key
+	}
+	return strings.Map(func(c rune) rune {
+		if isLogfmtSpecial(c) {
+			return '_'
+		}
+		return c
+	}, key)
+}
+
+//needsLogfmtQuoting determines whether a logfmt value has to be quoted
+//Returns: true if the value is empty or contains spaces, quotes, "=" or control characters
+func needsLogfmtQuoting(value string) bool {
+	if value == "" {
+		return true
+	}
+	for _, c := range value {
+		if isLogfmtSpecial(c) {
+			return true
+		}
+	}
+	return false
+}
+
+//isLogfmtSpecial determines whether a character breaks an unquoted logfmt key or value
+//Returns: true for spaces, quotes, "=", backslashes and control characters
+func isLogfmtSpecial(c rune) bool {
+	return c <= ' ' || c == '"' || c == '=' || c == '\\' || c == 0x7f
+}
+
+//FormatMessageAs generates a log message in the given format. removeNewlines only applies to the
+//text format because JSON and logfmt escape newlines anyway.
+func FormatMessageAs(format MessageFormat, rawRlogMsg *RlogMsg, prefix string, removeNewlines bool) string {
+	return NewFormatter(format, removeNewlines).Format(rawRlogMsg, prefix)
+}
+
+//FormatFields renders structured fields as " key=value" pairs sorted by key
+//Returns: formatted fields, empty string if there are no fields
+func FormatFields(fields map[string]interface{}) string {
+	if len(fields) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	res := ""
+	for _, k := range keys {
+		res += fmt.Sprintf(" %s=%v", k, fields[k])
+	}
 	return res
 }
 
+//FormatPosition renders the position of the log call as text, e.g. "[main.go:42] " or
+//"[main.run main.go:42] " if the message carries the function as well
+//Returns: formatted position, empty string if the message carries no position or its header renders it
+func FormatPosition(rawRlogMsg *RlogMsg) string {
+	if rawRlogMsg.File == "" || rawRlogMsg.PosInHeader {
+		return ""
+	}
+	pos := rawRlogMsg.File + ":" + strconv.Itoa(rawRlogMsg.Line)
+	if rawRlogMsg.Func != "" {
+		pos = rawRlogMsg.Func + " " + pos
+	}
+	return "[" + pos + "] "
+}
+
+//SyslogPriority converts a severity level to its syslog priority (2 for fatal up to 7 for debug and
+//trace), allowing log processors to filter on a numeric level consistent with the syslog module. See
+//RlogSeverity.SyslogPriority for the log/syslog type.
+//Returns: syslog priority
+func SyslogPriority(severity RlogSeverity) int {
+	if int(severity) < len(syslogPriorities) {
+		return syslogPriorities[severity]
+	}
+	return syslogPriorities[len(syslogPriorities)-1]
+}
+
 //ReplaceNewlines any tabs/newlines with double-space and removes indentations
 //Arguments: a string for newline replacement
 //Returns: string with #012 instead of newlines
@@ -0,0 +1,46 @@
+/*
+These tests cover:
+- Quoting of logfmt values
+- Sanitizing of logfmt keys
+*/
+package common
+
+import (
+	. "launchpad.net/gocheck"
+	"testing"
+)
+
+//Hook this testing framework into go test
+func Test(t *testing.T) { TestingT(t) }
+
+type FormatSuite struct{}
+
+var _ = Suite(&FormatSuite{})
+
+//When a logfmt value contains spaces, quotes, "=" or control characters, it should be quoted and escaped
+func (s *FormatSuite) TestLogfmtQuoting(c *C) {
+	c.Assert(needsLogfmtQuoting("plain"), Equals, false)
+	c.Assert(needsLogfmtQuoting("ünïcode"), Equals, false)
+	for _, value := range []string{"", "two words", `say "hi"`, "a=b", `back\slash`, "new\nline", "del\x7f"} {
+		c.Assert(needsLogfmtQuoting(value), Equals, true, Commentf("value %q", value))
+	}
+
+	msg := &RlogMsg{Timestamp: "2026-10-16T10:00:00Z", Severity: 3, Seq: 7, Msg: "user \"bob\" logged in\n"}
+	c.Assert(FormatMessageLogfmt(msg, ""), Equals, `ts=2026-10-16T10:00:00Z level=info seq=7 msg="user \"bob\" logged in\n"`)
+}
+
+//When a logfmt key contains characters breaking the pair, they should be replaced as keys cannot be quoted
+func (s *FormatSuite) TestLogfmtKeys(c *C) {
+	c.Assert(logfmtKey("request_id"), Equals, "request_id")
+	c.Assert(logfmtKey(""), Equals, "_")
+	c.Assert(logfmtKey("a b=c"), Equals, "a_b_c")
+	c.Assert(logfmtKey("\"quoted\"\n"), Equals, "_quoted__")
+
+	msg := &RlogMsg{
+		Timestamp: "2026-10-16T10:00:00Z",
+		Severity:  1,
+		Msg:       "failed",
+		Fields:    map[string]interface{}{"user id": 42, "k=v": "x y", "": "empty"},
+	}
+	c.Assert(FormatMessageLogfmt(msg, ""), Equals, `ts=2026-10-16T10:00:00Z level=error seq=0 msg=failed _=empty k_v="x y" user_id=42`)
+}
@@ -0,0 +1,13 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package common
+
+import goSyslog "log/syslog"
+
+//SyslogPriority converts a severity level to its syslog severity, see the SyslogPriority function. The
+//log/syslog package is not available on Windows and Plan 9, neither is this method.
+//Returns: syslog priority without facility
+func (s RlogSeverity) SyslogPriority() goSyslog.Priority {
+	return goSyslog.Priority(SyslogPriority(s))
+}
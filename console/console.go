@@ -5,14 +5,19 @@ package console
 
 import (
 	"fmt"
+	"github.com/rightscale/rlog"
 	"github.com/rightscale/rlog/common"
 	"os"
 )
 
 // Console logger (type exported for deprecated stdout module but fields are private).
 type ConsoleLogger struct {
+	common.ModuleSeverity
 	removeNewlines bool
+	newlines       common.NewlineReplacement // replacement of newlines and tabs if removed
 	outputFile     *os.File
+	errorFile      *os.File // destination of warnings and more severe messages if set
+	formatter      common.Formatter
 }
 
 // Creates a logger for stdout.
@@ -24,6 +29,7 @@ func NewStdoutLogger(removeNewlines bool) *ConsoleLogger {
 	logger := new(ConsoleLogger)
 	logger.removeNewlines = removeNewlines
 	logger.outputFile = os.Stdout
+	logger.formatter = common.DefaultFormatter{RemoveNewlines: removeNewlines}
 	return logger
 }
 
@@ -36,15 +42,88 @@ func NewStderrLogger(removeNewlines bool) *ConsoleLogger {
 	logger := new(ConsoleLogger)
 	logger.removeNewlines = removeNewlines
 	logger.outputFile = os.Stderr
+	logger.formatter = common.DefaultFormatter{RemoveNewlines: removeNewlines}
 	return logger
 }
 
+// Creates a logger writing warnings, errors and fatal messages to stderr and all other messages to
+// stdout.
+//
+// removeNewlines: true to replace newlines
+//
+// return: instance of console logger
+func NewSplitLogger(removeNewlines bool) *ConsoleLogger {
+	logger := new(ConsoleLogger)
+	logger.removeNewlines = removeNewlines
+	logger.outputFile = os.Stdout
+	logger.errorFile = os.Stderr
+	logger.formatter = common.DefaultFormatter{RemoveNewlines: removeNewlines}
+	return logger
+}
+
+// Selects the output format, plain text is used by default.
+//
+// format: output format
+//
+// return: the console logger to allow chaining with the constructor
+func (conf *ConsoleLogger) WithFormat(format common.MessageFormat) *ConsoleLogger {
+	conf.formatter = common.WithNewlineReplacement(common.NewFormatter(format, conf.removeNewlines), conf.newlines)
+	return conf
+}
+
+// Selects the replacement of newlines and tabs when removing them (see constructor), two spaces are
+// used by default.
+//
+// newline: replaces each newline, e.g. " | " or `\n` for literal escaping
+//
+// tab: replaces each tab
+//
+// return: the console logger to allow chaining with the constructor
+func (conf *ConsoleLogger) WithNewlineReplacement(newline, tab string) *ConsoleLogger {
+	conf.newlines = common.NewlineReplacement{Newline: newline, Tab: tab}
+	conf.formatter = common.WithNewlineReplacement(conf.formatter, conf.newlines)
+	return conf
+}
+
+// Selects a custom formatter creating the text written for each message.
+//
+// formatter: formatter to use instead of the built-in formats
+//
+// return: the console logger to allow chaining with the constructor
+func (conf *ConsoleLogger) WithFormatter(formatter common.Formatter) *ConsoleLogger {
+	conf.formatter = formatter
+	return conf
+}
+
+// Names the module for rlog diagnostics and statistics.
+//
+// return: "console:stdout", "console:stderr" or "console:split"
+func (conf *ConsoleLogger) Name() string {
+	if conf.errorFile != nil {
+		return "console:split"
+	}
+	if conf.outputFile == os.Stderr {
+		return "console:stderr"
+	}
+	return "console:stdout"
+}
+
+// Sets a severity threshold for this module overriding the global rlog severity.
+//
+// severity: most verbose severity written by this module
+//
+// return: the console logger to allow chaining with the constructor
+func (conf *ConsoleLogger) WithSeverity(severity common.RlogSeverity) *ConsoleLogger {
+	conf.SetSeverity(severity)
+	return conf
+}
+
 // Intended to run in a separate goroutine. It prints log messages to console.
 //
 // dataChan: receives log messages.
 //
 // flushChan: receives flush command.
-func (conf *ConsoleLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (bool))) {
+func (conf *ConsoleLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
 
 	prefix := common.SyslogHeader()
 
@@ -54,22 +133,43 @@ func (conf *ConsoleLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flush
 		case logMsg := <-dataChan:
 			// received log message, print it
 			conf.printMsg(logMsg, prefix)
-		case ret := <-flushChan:
-			// flush and return success
-			conf.flush(dataChan, prefix)
-			ret <- true
+		case ret, ok := <-flushChan:
+			if !ok {
+				// flush channel closed by rlog: write pending messages and exit
+				conf.flush(dataChan, prefix)
+				return
+			}
+			// flush and return the number of messages printed
+			ret <- common.FlushResult{Flushed: conf.flush(dataChan, prefix)}
 		}
 	}
 }
 
+// Prints a log message when rlog runs in synchronous mode, see rlog.RlogConfig.Synchronous.
+//
+// rawRlogMsg: log message to print.
+//
+// prefix: log prefix
+func (conf *ConsoleLogger) WriteSync(rawRlogMsg *common.RlogMsg, prefix string) {
+	conf.printMsg(rawRlogMsg, prefix)
+}
+
+// Does nothing as console output is not buffered. Used when rlog runs in synchronous mode.
+func (conf *ConsoleLogger) FlushSync() {
+}
+
 // Prints the message to console.
 //
 // rawRlogMsg: log message received from channel.
 //
 // prefix: log prefix
 func (conf *ConsoleLogger) printMsg(rawRlogMsg *common.RlogMsg, prefix string) {
-	msg := common.FormatMessage(rawRlogMsg, prefix, conf.removeNewlines)
-	fmt.Fprintln(conf.outputFile, msg)
+	msg := conf.formatter.Format(rawRlogMsg, prefix)
+	if conf.errorFile != nil && rawRlogMsg.Severity <= rlog.SeverityWarning {
+		fmt.Fprintln(conf.errorFile, msg)
+	} else {
+		fmt.Fprintln(conf.outputFile, msg)
+	}
 }
 
 // Flushes pending messages to console.
@@ -77,14 +177,18 @@ func (conf *ConsoleLogger) printMsg(rawRlogMsg *common.RlogMsg, prefix string) {
 // dataChan: data channel to access all pending messages
 //
 // prefix: log prefix
-func (conf *ConsoleLogger) flush(dataChan <-chan (*common.RlogMsg), prefix string) {
+//
+// return: number of messages printed
+func (conf *ConsoleLogger) flush(dataChan <-chan (*common.RlogMsg), prefix string) int {
+	flushed := 0
 	for {
 		// perform non blocking read until the channel is empty
 		select {
 		case logMsg := <-dataChan:
 			conf.printMsg(logMsg, prefix)
+			flushed++
 		default:
-			return
+			return flushed
 		}
 	}
 }
@@ -0,0 +1,205 @@
+package rlog
+
+/*
+This file implements the propagation of request scoped values from a context.Context into log messages.
+Values stored in a context under a registered key are attached to the log message as structured fields,
+as are the fields derived by registered extractors (e.g. the IDs of the current trace span).
+*/
+
+import (
+	"context"
+	"sync"
+)
+
+//contextKey associates a context key with the field label used in log messages
+type contextKey struct {
+	key   interface{}
+	label string
+}
+
+//contextExtractor associates a function deriving fields from a context with its name
+type contextExtractor struct {
+	name    string
+	extract func(ctx context.Context) map[string]interface{}
+}
+
+//contextKeys and contextExtractors hold all registered context keys and extractors, guarded by
+//contextKeysMutex
+var contextKeys []contextKey
+var contextExtractors []contextExtractor
+var contextKeysMutex sync.RWMutex
+
+//RegisterContextKey declares a context key whose value is attached to messages logged with one of the
+//Ctx methods (e.g. InfoCtx). The value appears as structured field named label. Registering a key
+//again replaces its label.
+func RegisterContextKey(key interface{}, label string) {
+	contextKeysMutex.Lock()
+	defer contextKeysMutex.Unlock()
+
+	for i := range contextKeys {
+		if contextKeys[i].key == key {
+			contextKeys[i].label = label
+			return
+		}
+	}
+	contextKeys = append(contextKeys, contextKey{key, label})
+}
+
+//RegisterContextExtractor declares a function deriving structured fields from the context passed to
+//one of the Ctx methods (e.g. InfoCtx), for values which are not stored under a key of their own (e.g.
+//the span of a tracing library, see the otel package). extract returns nil if the context carries
+//nothing to attach. Registering an extractor under a name again replaces it.
+//Arguments: [name] name of the extractor. [extract] function deriving the fields from a context
+func RegisterContextExtractor(name string, extract func(ctx context.Context) map[string]interface{}) {
+	contextKeysMutex.Lock()
+	defer contextKeysMutex.Unlock()
+
+	for i := range contextExtractors {
+		if contextExtractors[i].name == name {
+			contextExtractors[i].extract = extract
+			return
+		}
+	}
+	contextExtractors = append(contextExtractors, contextExtractor{name, extract})
+}
+
+//contextFields extracts the values of all registered keys and the fields of all registered extractors
+//from the given context.
+//Returns: structured fields, nil if the context is nil or carries none of the registered keys
+func contextFields(ctx context.Context) map[string]interface{} {
+	if ctx == nil {
+		return nil
+	}
+
+	contextKeysMutex.RLock()
+	defer contextKeysMutex.RUnlock()
+
+	var fields map[string]interface{}
+	for _, ck := range contextKeys {
+		if v := ctx.Value(ck.key); v != nil {
+			if fields == nil {
+				fields = make(map[string]interface{})
+			}
+			fields[ck.label] = v
+		}
+	}
+	for _, ce := range contextExtractors {
+		for label, v := range ce.extract(ctx) {
+			if fields == nil {
+				fields = make(map[string]interface{})
+			}
+			fields[label] = v
+		}
+	}
+	return fields
+}
+
+//===== Logging API with context =====
+
+//FatalCtx logs a message of severity "fatal" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func FatalCtx(ctx context.Context, format string, a ...interface{}) {
+	std.genericLogHandler("FATAL", nil, contextFields(ctx), format, a, SeverityFatal, true, 0, nil)
+}
+
+//FatalCtx logs a message of severity "fatal" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func (l logger) FatalCtx(ctx context.Context, format string, a ...interface{}) {
+	l.inst.genericLogHandler("FATAL", nil, mergeFields(l.fields, contextFields(ctx)), format, a, SeverityFatal, l.pos(true), 0, nil)
+}
+
+//FatalCtx logs a message of severity "fatal" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func (r *Instance) FatalCtx(ctx context.Context, format string, a ...interface{}) {
+	r.genericLogHandler("FATAL", nil, contextFields(ctx), format, a, SeverityFatal, true, 0, nil)
+}
+
+//ErrorCtx logs a message of severity "error" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func ErrorCtx(ctx context.Context, format string, a ...interface{}) {
+	std.genericLogHandler("ERROR", nil, contextFields(ctx), format, a, SeverityError, true, 0, nil)
+}
+
+//ErrorCtx logs a message of severity "error" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func (l logger) ErrorCtx(ctx context.Context, format string, a ...interface{}) {
+	l.inst.genericLogHandler("ERROR", nil, mergeFields(l.fields, contextFields(ctx)), format, a, SeverityError, l.pos(true), 0, nil)
+}
+
+//ErrorCtx logs a message of severity "error" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func (r *Instance) ErrorCtx(ctx context.Context, format string, a ...interface{}) {
+	r.genericLogHandler("ERROR", nil, contextFields(ctx), format, a, SeverityError, true, 0, nil)
+}
+
+//WarningCtx logs a message of severity "warning" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func WarningCtx(ctx context.Context, format string, a ...interface{}) {
+	std.genericLogHandler("WARNING", nil, contextFields(ctx), format, a, SeverityWarning, false, 0, nil)
+}
+
+//WarningCtx logs a message of severity "warning" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func (l logger) WarningCtx(ctx context.Context, format string, a ...interface{}) {
+	l.inst.genericLogHandler("WARNING", nil, mergeFields(l.fields, contextFields(ctx)), format, a, SeverityWarning, l.pos(false), 0, nil)
+}
+
+//WarningCtx logs a message of severity "warning" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func (r *Instance) WarningCtx(ctx context.Context, format string, a ...interface{}) {
+	r.genericLogHandler("WARNING", nil, contextFields(ctx), format, a, SeverityWarning, false, 0, nil)
+}
+
+//InfoCtx logs a message of severity "info" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func InfoCtx(ctx context.Context, format string, a ...interface{}) {
+	std.genericLogHandler("INFO", nil, contextFields(ctx), format, a, SeverityInfo, false, 0, nil)
+}
+
+//InfoCtx logs a message of severity "info" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func (l logger) InfoCtx(ctx context.Context, format string, a ...interface{}) {
+	l.inst.genericLogHandler("INFO", nil, mergeFields(l.fields, contextFields(ctx)), format, a, SeverityInfo, l.pos(false), 0, nil)
+}
+
+//InfoCtx logs a message of severity "info" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func (r *Instance) InfoCtx(ctx context.Context, format string, a ...interface{}) {
+	r.genericLogHandler("INFO", nil, contextFields(ctx), format, a, SeverityInfo, false, 0, nil)
+}
+
+//DebugCtx logs a message of severity "debug" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func DebugCtx(ctx context.Context, format string, a ...interface{}) {
+	std.genericLogHandler("DEBUG", nil, contextFields(ctx), format, a, SeverityDebug, false, 0, nil)
+}
+
+//DebugCtx logs a message of severity "debug" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func (l logger) DebugCtx(ctx context.Context, format string, a ...interface{}) {
+	l.inst.genericLogHandler("DEBUG", nil, mergeFields(l.fields, contextFields(ctx)), format, a, SeverityDebug, l.pos(false), 0, nil)
+}
+
+//DebugCtx logs a message of severity "debug" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func (r *Instance) DebugCtx(ctx context.Context, format string, a ...interface{}) {
+	r.genericLogHandler("DEBUG", nil, contextFields(ctx), format, a, SeverityDebug, false, 0, nil)
+}
+
+//TraceCtx logs a message of severity "trace" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func TraceCtx(ctx context.Context, format string, a ...interface{}) {
+	std.genericLogHandler("TRACE", nil, contextFields(ctx), format, a, SeverityTrace, false, 0, nil)
+}
+
+//TraceCtx logs a message of severity "trace" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func (l logger) TraceCtx(ctx context.Context, format string, a ...interface{}) {
+	l.inst.genericLogHandler("TRACE", nil, mergeFields(l.fields, contextFields(ctx)), format, a, SeverityTrace, l.pos(false), 0, nil)
+}
+
+//TraceCtx logs a message of severity "trace" carrying the registered values found in ctx.
+//Arguments: context and printf formatted message
+func (r *Instance) TraceCtx(ctx context.Context, format string, a ...interface{}) {
+	r.genericLogHandler("TRACE", nil, contextFields(ctx), format, a, SeverityTrace, false, 0, nil)
+}
@@ -0,0 +1,78 @@
+/*
+These tests cover:
+- Extraction of registered context values
+- Registered context extractors
+- Logging with context
+*/
+package rlog
+
+import (
+	"container/list"
+	"context"
+	. "launchpad.net/gocheck"
+)
+
+//testContextKey is a private key type as recommended for context values
+type testContextKey string
+
+//When extracting fields from a context, it should only return values of registered keys
+func (s *Stateless) TestContextFields(t *C) {
+	const requestKey testContextKey = "requestFields"
+	const otherKey testContextKey = "otherFields"
+	RegisterContextKey(requestKey, "request")
+
+	//Nil context and context without registered values do not produce fields
+	t.Assert(contextFields(nil), IsNil)
+	t.Assert(contextFields(context.Background()), IsNil)
+	t.Assert(contextFields(context.WithValue(context.Background(), otherKey, "x")), IsNil)
+
+	ctx := context.WithValue(context.Background(), requestKey, "abc")
+	ctx = context.WithValue(ctx, otherKey, "x")
+	fields := contextFields(ctx)
+	t.Assert(len(fields), Equals, 1)
+	t.Assert(fields["request"], Equals, "abc")
+
+	//Registering again replaces the label
+	RegisterContextKey(requestKey, "req")
+	t.Assert(contextFields(ctx)["req"], Equals, "abc")
+}
+
+//When extracting fields from a context, it should add the fields derived by registered extractors
+func (s *Stateless) TestContextExtractor(t *C) {
+	const spanKey testContextKey = "span"
+	RegisterContextExtractor("test", func(ctx context.Context) map[string]interface{} {
+		if span, ok := ctx.Value(spanKey).(string); ok {
+			return map[string]interface{}{"span": span}
+		}
+		return nil
+	})
+
+	t.Assert(contextFields(context.Background()), IsNil)
+	ctx := context.WithValue(context.Background(), spanKey, "s1")
+	t.Assert(contextFields(ctx), DeepEquals, map[string]interface{}{"span": "s1"})
+
+	//Registering again replaces the extractor
+	RegisterContextExtractor("test", func(ctx context.Context) map[string]interface{} { return nil })
+	t.Assert(contextFields(ctx), IsNil)
+}
+
+//When logging with a context, it should attach the registered values as fields
+func (s *Initialized) TestLoggingRoutinesWithContext(t *C) {
+	const userKey testContextKey = "userCtx"
+	RegisterContextKey(userKey, "user")
+
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	InfoCtx(context.WithValue(context.Background(), userKey, 42), "testmessage %d", 10)
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm, NotNil)
+	t.Assert(rlm.Msg, Equals, "testmessage 10")
+	t.Assert(rlm.Fields["user"], Equals, 42)
+
+	//Without matching values, it should behave like Info
+	NewLogger().InfoCtx(nil, "testmessage %d", 10)
+	rlm = nonBlockingChanRead(myChan)
+	t.Assert(rlm, NotNil)
+	t.Assert(rlm.Fields, IsNil)
+}
@@ -0,0 +1,120 @@
+package rlog
+
+/*
+This file implements collapsing of duplicate log messages. Within a window starting with the first
+occurrence of a message, identical messages of the same severity are dropped and counted. When the
+window closes, the count is reported as a single summary message. The window is closed by a timer, so
+the summary is logged even if no further messages arrive.
+*/
+
+import (
+	"fmt"
+	"github.com/rightscale/rlog/common"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+//deduplicator keeps track of the messages logged within their current window
+type deduplicator struct {
+	mutex   sync.Mutex
+	entries map[uint64]*dedupeEntry //messages within their window by dedupeKey
+	stopped bool                    //set once the instance is reset, no summaries are logged anymore
+	emits   sync.WaitGroup          //summaries being logged, awaited on stop
+}
+
+//dedupeEntry holds the first occurrence of a message and the number of duplicates dropped since
+type dedupeEntry struct {
+	raw      logPieces   //first occurrence of the message, used to create the summary
+	repeated uint64      //duplicates dropped within the window
+	timer    *time.Timer //closes the window
+}
+
+//newDeduplicator creates a deduplicator without any messages
+func newDeduplicator() *deduplicator {
+	return &deduplicator{entries: make(map[uint64]*dedupeEntry)}
+}
+
+//dedupeKey hashes the severity and the formatted message
+//Arguments: [severity] message severity. [msg] formatted message
+//Returns: key identifying duplicate messages
+func dedupeKey(severity common.RlogSeverity, msg string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte{byte(severity)})
+	h.Write([]byte(msg))
+	return h.Sum64()
+}
+
+//check determines whether a message is a duplicate within its window and counts it. The first
+//occurrence of a message opens a new window, emit is invoked with the summary when it closes.
+//Arguments: [raw] message to check. [window] duration of the window. [emit] logs the summary
+//Returns: true if the message is a duplicate and has to be dropped
+func (d *deduplicator) check(raw *logPieces, window time.Duration, emit func(*logPieces)) bool {
+	key := dedupeKey(raw.severity, raw.msg)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.stopped {
+		return false
+	}
+	if e, ok := d.entries[key]; ok {
+		e.repeated++
+		return true
+	}
+
+	e := &dedupeEntry{raw: *raw}
+	e.timer = time.AfterFunc(window, func() { d.expire(key, emit) })
+	d.entries[key] = e
+	return false
+}
+
+//expire closes the window of a message and emits the summary if duplicates were dropped
+//Arguments: [key] key of the message. [emit] logs the summary
+func (d *deduplicator) expire(key uint64, emit func(*logPieces)) {
+	d.mutex.Lock()
+	e, ok := d.entries[key]
+	delete(d.entries, key)
+	if !ok || d.stopped || e.repeated == 0 {
+		d.mutex.Unlock()
+		return
+	}
+	d.emits.Add(1)
+	d.mutex.Unlock()
+	defer d.emits.Done()
+
+	//The summary carries neither position info nor stack trace of the first occurrence
+	raw := logPieces{
+		level:    e.raw.level,
+		tag:      e.raw.tag,
+		msg:      fmt.Sprintf("%s (repeated %d times)", e.raw.msg, e.repeated),
+		fields:   e.raw.fields,
+		severity: e.raw.severity,
+	}
+	emit(&raw)
+}
+
+//stop cancels all open windows without logging their summaries and waits for summaries already
+//being logged
+func (d *deduplicator) stop() {
+	d.mutex.Lock()
+	d.stopped = true
+	for _, e := range d.entries {
+		e.timer.Stop()
+	}
+	d.entries = make(map[uint64]*dedupeEntry)
+	d.mutex.Unlock()
+
+	d.emits.Wait()
+}
+
+//isDuplicate determines whether a message repeats a message logged within the dedupe window. The
+//summary of the window is never deduplicated or rate limited.
+//Arguments: message to check
+//Returns: true if the message has to be dropped
+func (r *Instance) isDuplicate(raw *logPieces) bool {
+	if r.config.DedupeWindow <= 0 {
+		return false
+	}
+	return r.dedupe.check(raw, r.config.DedupeWindow, r.dispatch)
+}
@@ -0,0 +1,59 @@
+/*
+These tests cover:
+- Collapsing of duplicate messages within the dedupe window
+- Reporting of duplicates when the window closes
+*/
+package rlog
+
+import (
+	"container/list"
+	. "launchpad.net/gocheck"
+	"time"
+)
+
+//When the same message is checked repeatedly, only the first occurrence should pass
+func (s *Stateless) TestDeduplicatorCheck(t *C) {
+	d := newDeduplicator()
+	defer d.stop()
+	emit := func(*logPieces) {}
+
+	raw := logPieces{msg: "flapping", severity: SeverityError}
+	t.Assert(d.check(&raw, time.Hour, emit), Equals, false)
+	t.Assert(d.check(&raw, time.Hour, emit), Equals, true)
+
+	//The severity is part of the key
+	other := logPieces{msg: "flapping", severity: SeverityWarning}
+	t.Assert(d.check(&other, time.Hour, emit), Equals, false)
+	t.Assert(d.entries[dedupeKey(SeverityError, "flapping")].repeated, Equals, uint64(1))
+}
+
+//When logging identical messages within the window, it should log the first one and report the
+//duplicates in a summary once the window closes, even if no further messages arrive
+func (s *Initialized) TestDedupeLogging(t *C) {
+	std.config.DedupeWindow = 20 * time.Millisecond
+
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	for i := 0; i < 5; i++ {
+		Warning("dependency down")
+	}
+	Warning("dependency up")
+	t.Assert(nonBlockingChanRead(myChan).Msg, Equals, "dependency down")
+	t.Assert(nonBlockingChanRead(myChan).Msg, Equals, "dependency up")
+	t.Assert(nonBlockingChanRead(myChan), IsNil)
+
+	select {
+	case summary := <-myChan:
+		t.Assert(summary.Msg, Equals, "dependency down (repeated 4 times)")
+		t.Assert(summary.Severity, Equals, SeverityWarning)
+	case <-time.After(time.Second):
+		t.Fatalf("Summary of duplicate messages not logged")
+	}
+
+	//A message without duplicates has no summary, the window reopens for the next occurrence
+	time.Sleep(40 * time.Millisecond)
+	t.Assert(nonBlockingChanRead(myChan), IsNil)
+	Warning("dependency down")
+	t.Assert(nonBlockingChanRead(myChan).Msg, Equals, "dependency down")
+}
@@ -3,17 +3,46 @@ Package rlog is an advanced and extensible logger for Go.
 
 Package rlog implements the core logging facility, which are the user API and log message
 processing. The rlog output modules are producing the output, i.e. without any enabled modules, rlog
-does not produce any output. Note that all methods provided by rlog are thread safe.
+does not produce any output and skips building the messages altogether (unless a hook receives them).
+Note that all methods provided by rlog are thread safe. Messages are printf formatted, unless no
+arguments are given: then the message is logged verbatim, e.g. rlog.Info("50% complete").
 
 Configuring rlog & enabling modules
 
 Output modules offer a "new" method to create a new instance for that particular output type and rlog
-offers the EnableModule method to enable each method satisfying the required interface provided by
-the rlog. rlog is configured by retrieving and modifying the default configuration using the
-GetDefaultConfig() method. Once started, rlog's configuration cannot be modified. rlog is
-usually initialized in main. When calling "rlog.Start()", it is advisable to call "defer
-rlog.Flush() right after to ensure that upon termination of the main method, all log entries are
-written.
+offers the EnableModule method to enable each method satisfying the required interface provided by the
+rlog. rlog is configured by retrieving and modifying the default configuration using the
+GetDefaultConfig() method. Once started, rlog's configuration cannot be modified except for the global
+severity which can be changed at any time using SetSeverity(). EffectiveConfig() returns a copy of the
+configuration in effect, including the current severity, e.g. to find out why messages are filtered.
+rlog is usually initialized in main.
+When calling "rlog.Start()", it is advisable to call "defer rlog.Flush() right after to ensure that
+upon termination of the main method, all log entries are written. This includes messages other
+goroutines are still handing to the modules when Flush is called. ConfigFromEnv creates the default
+configuration overridden by environment variables (e.g. RLOG_SEVERITY=debug), to tune logging per
+deployment. To fail fast on misconfigured modules, use StartE instead of Start: it returns an error
+instead of starting if a module fails its validation (e.g. the file of a file module is not open).
+While running, HealthCheck tells whether the connections of network modules (syslog, tcp) are up, e.g.
+for a readiness probe.
+Long-running daemons may set RlogConfig.AutoFlushInterval to have buffered log entries written
+periodically as well. Setting RlogConfig.FlushOnSeverity (e.g. to ThresholdAt(SeverityError)) flushes
+all modules after each message of that severity or more severe, so that it is persisted even if the
+process crashes right after. On graceful shutdown, FlushContext bounds the time spent flushing all
+modules by the deadline of a context and FlushWithReport tells how many pending messages each module
+wrote.
+FlushModule flushes a single module only, e.g. to checkpoint a critical sink on demand. rlog reports
+its own problems (e.g. messages dropped because a module cannot keep up) to RlogConfig.InternalLogger,
+or to the standard library logger if not set. Test suites may set
+RlogConfig.PanicOnOverflow to panic instead of dropping messages, which reveals undersized buffers.
+RlogConfig.OverflowPolicy selects what happens once a module cannot keep up: the default drops the
+oldest messages, BlockAboveWatermark slows down the logging goroutines while a module channel is filled
+above RlogConfig.Watermark (90% by default), for at most RlogConfig.WatermarkTimeout (100ms by
+default), and only then drops the oldest messages. Bursts are thus absorbed while sustained floods do
+not stall the application.
+Calling MirrorErrorsToStderr(true) before Start additionally writes warnings and more severe messages
+to stderr, e.g. while the complete log goes to a file. The mirror is not counted in the statistics.
+Once started, AttachModule adds a module while logging continues (e.g. a debug sink while
+investigating an incident) and DetachModule flushes and removes it again.
 
 Example setup procedure with stdout and syslog output:
 
@@ -27,6 +56,62 @@ Example setup procedure with stdout and syslog output:
 	rlog.Start(rlog.GetDefaultConfig())
 	defer rlog.Flush()
 
+Module constructors returning an error have Must variants panicking instead, e.g.
+syslog.MustNewLocalSyslogLogger() or file.MustNewFileLogger(...), for a concise setup in main.
+Remote syslog servers requiring encrypted transport are reached with syslog.NewTLSSyslogLogger, which
+sends the messages over TLS per RFC5425.
+
+Example: verbose console output while keeping the file log at the global severity (info)
+
+	fileModule, err := file.NewFileLogger("myLog.txt", true, false)
+	if err != nil {
+		panic("Getting file logger instance failed")
+	}
+
+	rlog.EnableModule(fileModule)
+	rlog.EnableModule(console.NewStdoutLogger(true).WithSeverity(rlog.SeverityDebug))
+	rlog.Start(rlog.GetDefaultConfig())
+	defer rlog.Flush()
+
+Example: info and debug to the file only, warnings and more severe messages to the file and syslog
+
+	conf := rlog.GetDefaultConfig()
+	conf.Severity = rlog.SeverityDebug
+	conf.Routes = []rlog.Route{
+		rlog.NewRoute(rlog.SeverityDebug, rlog.SeverityInfo, fileModule),
+		rlog.NewRoute(rlog.SeverityWarning, rlog.SeverityFatal, fileModule, syslogModule),
+	}
+	rlog.EnableModule(fileModule)
+	rlog.EnableModule(syslogModule)
+	rlog.Start(conf)
+
+Example: custom layout shared by several modules using a common.Formatter
+
+	short := common.FormatterFunc(func(m *common.RlogMsg, prefix string) string {
+		return m.Timestamp + " " + m.Msg
+	})
+	rlog.EnableModule(console.NewStdoutLogger(true).WithFormatter(short))
+	rlog.EnableModule(fileModule.WithFormatter(short))
+
+The built-in formatters can emit the severity as numeric syslog priority (see common.SyslogPriority)
+for log processors filtering on a numeric level, e.g.
+console.NewStdoutLogger(true).WithFormatter(common.JSONFormatter{NumericSeverity: true}).
+
+Modules removing newlines from the text format replace them with two spaces (" -- " for syslog). The
+console, file and syslog modules accept other replacements for newlines and tabs, e.g.
+console.NewStdoutLogger(true).WithNewlineReplacement(`\n`, `\t`) to escape them literally. Modules
+keeping newlines can mark the continuation lines of multiline messages and stack traces instead, e.g.
+fileModule.WithFormatter(common.DefaultFormatter{ContinuationPrefix: "| "}).
+
+To expose the recent log output of a process (e.g. on a diagnostic endpoint), the buffer module keeps
+the most recent messages in memory up to a size in bytes, dropping the oldest ones:
+
+	recent := buffer.NewBufferLogger(64 * 1024)
+	rlog.EnableModule(recent)
+	...
+	rlog.Flush()
+	w.Write(recent.Bytes())
+
 Example: setup using tags
 
 	const TAG1 string = "tag1"
@@ -43,12 +128,18 @@ Example: setup using tags
 	rlog.InfoT(TAG1, "This msg appears")
 	rlog.InfoT(TAG2, "This msg does NOT appear")
 
+Tags passed to EnableTagsExcept and DisableTagsExcept may contain "*" wildcards, e.g. "db.*" matches the
+hierarchical tags "db.query" and "db.conn". Other tags are matched exactly.
+
+Methods ending with Tags (e.g. InfoTags) take several tags. Such a message appears if any of its tags is
+enabled, or only if all of them are enabled when RlogConfig.TagMatch is set to TagMatchAll.
+
 Producing log output
 
 rlog exists as a singleton and output can be produced by simply importing the rlog package and
 calling the various print messages on it. Output methods ending with a T (e.g. infoT) require a tag
 argument. Tags are user defined strings. It is highly recommended to define tags as constants to
-avoid typos. Tags are currently NOT implemented.
+avoid typos. The tag appears in curly braces in front of the message (e.g. "{database} ").
 
 Example:
 
@@ -57,15 +148,79 @@ Example:
 	rlog.ErrorT(DATABASE, "Connection terminated")
 	rlog.Fatal("fatal log entry")
 
+Libraries wrapping rlog report the position of their own caller by setting RlogConfig.CallerSkip to the
+number of wrapper frames or by calling the methods ending with Skip (e.g. ErrorSkip) with that number.
+Only Fatal and Error messages include the position of the call by default. Functions ending with Pos
+(e.g. InfoPos) include it for a single message, FatalNoPos and ErrorNoPos omit it. A logger created with
+WithPosInfo (e.g. rlog.NewLogger().WithPosInfo(true)) includes or omits it for all of its messages.
+RlogConfig.DisablePositionInfo still omits it for all messages.
+Methods ending with Func (e.g. DebugFunc) take a function creating the message, which is only invoked if
+the message is not filtered. This saves building expensive messages which would be dropped anyway.
+To guard whole blocks instead, e.g. "if rlog.IsEnabled(rlog.SeverityDebug) {...}", IsEnabled and
+IsEnabledTag tell whether a message would be logged.
+Setting RlogConfig.IncludeFuncName adds the calling function to the position, e.g. "[main.run main.go:42]".
+The position is not part of the message text: messages carry it as File, Line and Func, which the text
+formatter renders in front of the message and the JSON and logfmt formatters emit as separate fields.
+Services sharing a destination (e.g. one syslog) are told apart by RlogConfig.GlobalPrefix, e.g.
+"[payments:prod]", which is prepended to every message after the header in all modules.
+Messages logging untrusted input may contain invalid UTF-8 or control characters (e.g. a stray "\x00")
+breaking terminals and log pipelines. Setting RlogConfig.SanitizeMessages replaces invalid UTF-8 in
+messages, stack traces and structured fields (keys and string values) with U+FFFD and strips control
+characters (including C1 controls like U+009B) other than newlines, carriage returns and tabs.
+
+Errors are logged using the methods ending with Err (e.g. ErrorErr). The messages of the wrapped causes
+are attached as structured field "causes" and the stack trace is taken from the error if it carries one
+(e.g. errors created by github.com/pkg/errors, rlog does not depend on the package). To keep
+repetitive error logs small, set RlogConfig.StackTraceDedupeWindow: a stack trace is logged in full
+once along with a "stack_id" field, messages repeating it within the window only carry the "stack_id".
+
+Structured fields
+
+Output methods ending with an F (e.g. InfoF) take a map of key/value pairs in addition to the printf
+formatted message. The fields travel along with the message to the modules which render them as
+key=value pairs (text) or as a nested "fields" object (JSON).
+
+Example:
+
+	rlog.InfoF(map[string]interface{}{"request": reqID, "user": userID}, "Request served")
+
+Synchronous mode
+
+By default, messages are passed to the modules through channels and written by the module goroutines.
+Setting RlogConfig.Synchronous makes the logging goroutine write each message itself before the log call
+returns, e.g. for deterministic tests or short-lived command line tools. This sacrifices the non-blocking
+behavior. All modules of the rlog repository support it, other modules are launched as usual.
+
+Independent instances
+
+The rlog package functions refer to a default instance. New creates an independent instance with its
+own modules and configuration offering the same API, e.g. for a library that must not interfere with
+the logging of the application:
+
+	libLog := rlog.New()
+	libLog.EnableModule(console.NewStderrLogger(true))
+	libLog.Start(rlog.GetDefaultConfig())
+	defer libLog.Flush()
+
+	libLog.Info("logged by the library instance only")
+
 Generating IDs
 
 GenerateID() generates a unique, hex formatted string ID. The initial value is random and each successive call
-increments it.
+increments it. ConfigureIDGenerator() sets a prefix and a zero padded width, e.g. "req-0000001a3f", so that IDs
+sort lexically.
 
 Log objects
 
 Log objects are can be retrieved using the NewLogger method. The user gets back an object referring to the singleton
 logger, offering the same API as the rlog package. This allows to mock rlog package using an interface requirement
-when generating shared libraries.
+when generating shared libraries. WithFields returns a logger adding the given fields to each of its messages:
+
+	reqLog := rlog.NewLogger().WithFields(map[string]interface{}{"request": reqID})
+	reqLog.Info("Request received")
+
+Log objects also offer Print, Printf and Println like the standard library logger, so they can be passed to
+libraries expecting such a logger. These messages are logged as "info", NewLoggerAtSeverity selects a different
+severity.
 */
 package rlog
@@ -0,0 +1,228 @@
+package rlog
+
+/*
+This file implements the configuration of the logger by environment variables. Each variable overrides a
+single setting of the default configuration, variables which are not set or empty keep the default.
+Output modules are not covered, they are created and enabled by the application.
+*/
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//envSetting applies the value of an environment variable to the configuration
+type envSetting struct {
+	name  string                          //name of the environment variable
+	apply func(*RlogConfig, string) error //parses the value and sets it, error if invalid
+}
+
+//envSettings lists the environment variables read by ConfigFromEnv
+var envSettings = []envSetting{
+	{"RLOG_SEVERITY", func(c *RlogConfig, v string) error { return c.SeverityFromString(v) }},
+	{"RLOG_STACK_TRACE_SEVERITY", func(c *RlogConfig, v string) (err error) {
+		c.StackTraceMinSeverity, err = parseSeverityOrDisabled(v, StackTraceDisabled)
+		return err
+	}},
+	{"RLOG_FLUSH_ON_SEVERITY", func(c *RlogConfig, v string) (err error) {
+		c.FlushOnSeverity, err = parseSeverityOrDisabled(v, FlushDisabled)
+		return err
+	}},
+	{"RLOG_TIMESTAMP_FORMAT", func(c *RlogConfig, v string) error {
+		c.TimestampFormat = parseTimeLayout(v)
+		return nil
+	}},
+	{"RLOG_TIMESTAMP_UTC", func(c *RlogConfig, v string) (err error) {
+		c.TimestampUTC, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"RLOG_CHAN_CAPACITY", func(c *RlogConfig, v string) error { return parseUint32(v, &c.ChanCapacity) }},
+	{"RLOG_FLUSH_TIMEOUT", func(c *RlogConfig, v string) error { return parseUint32(v, &c.FlushTimeout) }},
+	{"RLOG_RATE_LIMIT", func(c *RlogConfig, v string) error { return parseUint32(v, &c.RateLimit) }},
+	{"RLOG_OVERFLOW_POLICY", func(c *RlogConfig, v string) (err error) {
+		c.OverflowPolicy, err = parseOverflowPolicy(v)
+		return err
+	}},
+	{"RLOG_BLOCK_TIMEOUT", func(c *RlogConfig, v string) (err error) {
+		c.BlockTimeout, err = time.ParseDuration(v)
+		return err
+	}},
+	{"RLOG_WATERMARK", func(c *RlogConfig, v string) (err error) {
+		c.Watermark, err = parseWatermark(v)
+		return err
+	}},
+	{"RLOG_WATERMARK_TIMEOUT", func(c *RlogConfig, v string) (err error) {
+		c.WatermarkTimeout, err = time.ParseDuration(v)
+		return err
+	}},
+	{"RLOG_AUTO_FLUSH_INTERVAL", func(c *RlogConfig, v string) (err error) {
+		c.AutoFlushInterval, err = time.ParseDuration(v)
+		return err
+	}},
+	{"RLOG_DEDUPE_WINDOW", func(c *RlogConfig, v string) (err error) {
+		c.DedupeWindow, err = time.ParseDuration(v)
+		return err
+	}},
+	{"RLOG_FATAL_EXITS", func(c *RlogConfig, v string) (err error) {
+		c.FatalExits, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"RLOG_PANIC_ON_OVERFLOW", func(c *RlogConfig, v string) (err error) {
+		c.PanicOnOverflow, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"RLOG_SYNCHRONOUS", func(c *RlogConfig, v string) (err error) {
+		c.Synchronous, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"RLOG_DISABLE_POSITION_INFO", func(c *RlogConfig, v string) (err error) {
+		c.DisablePositionInfo, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"RLOG_INCLUDE_FUNC_NAME", func(c *RlogConfig, v string) (err error) {
+		c.IncludeFuncName, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"RLOG_SANITIZE_MESSAGES", func(c *RlogConfig, v string) (err error) {
+		c.SanitizeMessages, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"RLOG_STARTUP_BANNER", func(c *RlogConfig, v string) (err error) {
+		c.StartupBanner, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"RLOG_GLOBAL_PREFIX", func(c *RlogConfig, v string) error {
+		c.GlobalPrefix = v
+		return nil
+	}},
+	{"RLOG_VERSION", func(c *RlogConfig, v string) error {
+		c.Version = v
+		return nil
+	}},
+}
+
+//timeLayouts maps the names of the layouts of the time package to the layouts
+var timeLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+}
+
+//ConfigFromEnv creates the default configuration (see GetDefaultConfig) and overrides it with the
+//environment variables which are set, e.g. to tune logging per deployment without code changes:
+//RLOG_SEVERITY, RLOG_STACK_TRACE_SEVERITY and RLOG_FLUSH_ON_SEVERITY take a severity ("warning", "err",
+//etc.), the latter two "disabled" as well. RLOG_TIMESTAMP_FORMAT takes the name of a layout of the
+//time package (e.g. "RFC3339") or a layout. RLOG_CHAN_CAPACITY, RLOG_FLUSH_TIMEOUT (seconds) and
+//RLOG_RATE_LIMIT take a number, RLOG_WATERMARK a fraction (e.g. "0.8"), RLOG_OVERFLOW_POLICY
+//"drop_oldest", "drop_newest", "block" or "block_above_watermark". RLOG_AUTO_FLUSH_INTERVAL,
+//RLOG_DEDUPE_WINDOW, RLOG_BLOCK_TIMEOUT and RLOG_WATERMARK_TIMEOUT take a duration (e.g. "5s").
+//RLOG_TIMESTAMP_UTC, RLOG_FATAL_EXITS, RLOG_PANIC_ON_OVERFLOW, RLOG_SYNCHRONOUS,
+//RLOG_DISABLE_POSITION_INFO, RLOG_INCLUDE_FUNC_NAME, RLOG_SANITIZE_MESSAGES and RLOG_STARTUP_BANNER
+//take a boolean ("true", "1", etc.), RLOG_GLOBAL_PREFIX and RLOG_VERSION any string.
+//Returns: configuration, error naming the variables with invalid values (which keep their default)
+func ConfigFromEnv() (RlogConfig, error) {
+	return configFromEnv(os.LookupEnv)
+}
+
+//configFromEnv creates the configuration like ConfigFromEnv reading the variables using lookup
+func configFromEnv(lookup func(string) (string, bool)) (RlogConfig, error) {
+	conf := GetDefaultConfig()
+
+	var invalid []string
+	for _, s := range envSettings {
+		value, ok := lookup(s.name)
+		if !ok || value == "" {
+			continue
+		}
+		//Apply to a copy, an invalid value must not clobber the default
+		updated := conf
+		if err := s.apply(&updated, value); err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s=%q", s.name, value))
+		} else {
+			conf = updated
+		}
+	}
+
+	if len(invalid) > 0 {
+		return conf, fmt.Errorf("invalid rlog environment variable(s): %s", strings.Join(invalid, ", "))
+	}
+	return conf, nil
+}
+
+//parseSeverityOrDisabled converts a severity like SeverityFromString into a threshold, "disabled"
+//yields the given value
+//Returns: threshold, error if the value is neither a known severity nor "disabled"
+func parseSeverityOrDisabled(value string, disabled SeverityThreshold) (SeverityThreshold, error) {
+	if strings.ToLower(value) == "disabled" {
+		return disabled, nil
+	}
+	severity, err := parseSeverity(value)
+	if err != nil {
+		return disabled, err
+	}
+	return ThresholdAt(severity), nil
+}
+
+//parseTimeLayout resolves the name of a layout of the time package
+//Returns: named layout, the value itself if it is no name
+func parseTimeLayout(value string) string {
+	if layout, ok := timeLayouts[value]; ok {
+		return layout
+	}
+	return value
+}
+
+//parseUint32 parses a decimal number into dst
+//Returns: error if the value is not a number or out of range
+func parseUint32(value string, dst *uint32) error {
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return err
+	}
+	*dst = uint32(n)
+	return nil
+}
+
+//parseWatermark parses the fill level of a channel as a fraction of its capacity, see RlogConfig.Watermark
+//Returns: watermark, error if the value is not a number greater than 0 and at most 1
+func parseWatermark(value string) (float64, error) {
+	w, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return defaultWatermark, err
+	}
+	if w <= 0 || w > 1 {
+		return defaultWatermark, fmt.Errorf("Watermark out of range (0, 1]: %s", value)
+	}
+	return w, nil
+}
+
+//parseOverflowPolicy converts the name of an overflow policy
+//Returns: overflow policy, error if the name is unknown
+func parseOverflowPolicy(value string) (OverflowPolicy, error) {
+	switch strings.ToLower(value) {
+	case "drop_oldest":
+		return DropOldest, nil
+	case "drop_newest":
+		return DropNewest, nil
+	case "block":
+		return Block, nil
+	case "block_above_watermark":
+		return BlockAboveWatermark, nil
+	}
+	return DropOldest, fmt.Errorf("Unknown overflow policy: %s", value)
+}
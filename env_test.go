@@ -0,0 +1,81 @@
+/*
+These tests cover:
+- Configuration by environment variables
+- Reporting of invalid values
+*/
+package rlog
+
+import (
+	. "launchpad.net/gocheck"
+	"time"
+)
+
+//fakeEnv looks up variables in a map instead of the process environment
+func fakeEnv(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+//When environment variables are set, they should override the defaults
+func (s *Stateless) TestConfigFromEnv(t *C) {
+	conf, err := configFromEnv(fakeEnv(nil))
+	t.Assert(err, IsNil)
+	t.Assert(conf.Severity, Equals, GetDefaultConfig().Severity)
+
+	conf, err = configFromEnv(fakeEnv(map[string]string{
+		"RLOG_SEVERITY":             "warn",
+		"RLOG_STACK_TRACE_SEVERITY": "disabled",
+		"RLOG_FLUSH_ON_SEVERITY":    "error",
+		"RLOG_TIMESTAMP_FORMAT":     "RFC3339",
+		"RLOG_CHAN_CAPACITY":        "1000",
+		"RLOG_OVERFLOW_POLICY":      "block",
+		"RLOG_AUTO_FLUSH_INTERVAL":  "5s",
+		"RLOG_TIMESTAMP_UTC":        "true",
+		"RLOG_VERSION":              "v1.2.3",
+		"RLOG_GLOBAL_PREFIX":        "[payments:prod]",
+		"RLOG_BLOCK_TIMEOUT":        "250ms",
+		"RLOG_WATERMARK":            "0.75",
+		"RLOG_WATERMARK_TIMEOUT":    "20ms",
+		"RLOG_RATE_LIMIT":           "",
+	}))
+	t.Assert(err, IsNil)
+	t.Assert(conf.Severity, Equals, SeverityWarning)
+	t.Assert(conf.StackTraceMinSeverity, Equals, StackTraceDisabled)
+	t.Assert(conf.FlushOnSeverity, Equals, ThresholdAt(SeverityError))
+	t.Assert(conf.TimestampFormat, Equals, time.RFC3339)
+	t.Assert(conf.ChanCapacity, Equals, uint32(1000))
+	t.Assert(conf.OverflowPolicy, Equals, Block)
+	t.Assert(conf.AutoFlushInterval, Equals, 5*time.Second)
+	t.Assert(conf.TimestampUTC, Equals, true)
+	t.Assert(conf.Version, Equals, "v1.2.3")
+	t.Assert(conf.GlobalPrefix, Equals, "[payments:prod]")
+	t.Assert(conf.BlockTimeout, Equals, 250*time.Millisecond)
+	t.Assert(conf.Watermark, Equals, 0.75)
+	t.Assert(conf.WatermarkTimeout, Equals, 20*time.Millisecond)
+	t.Assert(conf.RateLimit, Equals, uint32(0))
+
+	//A layout which is not a name is taken as is
+	conf, err = configFromEnv(fakeEnv(map[string]string{"RLOG_TIMESTAMP_FORMAT": "15:04:05"}))
+	t.Assert(conf.TimestampFormat, Equals, "15:04:05")
+}
+
+//When environment variables carry invalid values, it should name them and keep their defaults
+func (s *Stateless) TestConfigFromEnvInvalid(t *C) {
+	conf, err := configFromEnv(fakeEnv(map[string]string{
+		"RLOG_SEVERITY":             "verbose",
+		"RLOG_STACK_TRACE_SEVERITY": "sometimes",
+		"RLOG_CHAN_CAPACITY":        "-1",
+		"RLOG_FLUSH_TIMEOUT":        "3",
+		"RLOG_WATERMARK":            "1.5",
+	}))
+	t.Assert(err, ErrorMatches, `invalid rlog environment variable\(s\): RLOG_SEVERITY="verbose", `+
+		`RLOG_STACK_TRACE_SEVERITY="sometimes", RLOG_CHAN_CAPACITY="-1", RLOG_WATERMARK="1.5"`)
+	defaults := GetDefaultConfig()
+	t.Assert(conf.Severity, Equals, defaults.Severity)
+	t.Assert(conf.StackTraceMinSeverity, Equals, defaults.StackTraceMinSeverity)
+	t.Assert(conf.ChanCapacity, Equals, defaults.ChanCapacity)
+	t.Assert(conf.FlushTimeout, Equals, uint32(3))
+	t.Assert(conf.Watermark, Equals, defaults.Watermark)
+}
@@ -0,0 +1,171 @@
+package rlog
+
+/*
+This file implements logging of error values. The message of an error is logged along with the messages
+of its causes, found by unwrapping it (see errors.Unwrap). If an error in the chain carries a stack trace
+(errors created by github.com/pkg/errors), that stack trace is logged instead of the stack trace of
+the log call. Such errors are detected by their StackTrace method, so that rlog does not depend on
+github.com/pkg/errors.
+*/
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//errorCauses lists the messages of all errors wrapped by the given error, outermost first. Errors
+//wrapping several errors (e.g. errors.Join) contribute all of them.
+//Returns: structured fields holding the causes as "causes", nil if the error wraps no other error
+func errorCauses(err error) map[string]interface{} {
+	var causes []string
+	for _, cause := range unwrapAll(err) {
+		//fmt reports a typed nil pointer as "<nil>" instead of panicking
+		causes = append(causes, fmt.Sprint(cause))
+	}
+	if len(causes) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"causes": causes}
+}
+
+//unwrapAll collects the errors wrapped by the given error depth-first. Typed nil pointers are not
+//unwrapped, their methods would dereference them.
+//Returns: wrapped errors, not including the error itself
+func unwrapAll(err error) []error {
+	if isNilError(err) {
+		return nil
+	}
+	var wrapped []error
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		if cause := e.Unwrap(); cause != nil {
+			wrapped = append(wrapped, cause)
+			wrapped = append(wrapped, unwrapAll(cause)...)
+		}
+	case interface{ Unwrap() []error }:
+		for _, cause := range e.Unwrap() {
+			if cause != nil {
+				wrapped = append(wrapped, cause)
+				wrapped = append(wrapped, unwrapAll(cause)...)
+			}
+		}
+	}
+	return wrapped
+}
+
+//errorStackTrace finds the stack trace carried by an error logged using one of the Err methods. The
+//innermost error carrying a stack trace (see stackTraceOf) is the one closest to the origin of the
+//failure, its stack trace is formatted using "%+v".
+//Arguments: logged error, nil if the message was not logged by an Err method
+//Returns: stack trace, "" if there is no error or it carries none
+func errorStackTrace(err error) string {
+	if isNilError(err) {
+		return ""
+	}
+
+	chain := append([]error{err}, unwrapAll(err)...)
+	for i := len(chain) - 1; i >= 0; i-- {
+		if isNilError(chain[i]) {
+			continue
+		}
+		st := stackTraceOf(chain[i])
+		if st == nil {
+			continue
+		}
+		trace := strings.TrimSpace(fmt.Sprintf("%+v", st))
+		if trace != "" {
+			return trace
+		}
+	}
+	return ""
+}
+
+//stackTraceOf retrieves the stack trace of an error having a method "StackTrace()" whose result formats
+//itself, like errors.StackTrace of github.com/pkg/errors. The method is looked up by reflection as its
+//result type is specific to the package creating the error.
+//Arguments: error, not nil
+//Returns: stack trace, nil if the error carries none
+func stackTraceOf(err error) fmt.Formatter {
+	m := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+		return nil
+	}
+	st, _ := m.Call(nil)[0].Interface().(fmt.Formatter)
+	return st
+}
+
+//isNilError checks for a nil error, including a typed nil pointer stored in the error interface
+//Returns: true if the error is nil or a nil pointer
+func isNilError(err error) bool {
+	if err == nil {
+		return true
+	}
+	v := reflect.ValueOf(err)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+//===== Logging API with errors =====
+
+//FatalErr logs an error with severity "fatal". The message of the error is followed by the messages of
+//its causes as structured field "causes". The stack trace is taken from the error if it carries one.
+//Arguments: error to log
+func FatalErr(err error) {
+	std.genericLogHandler("FATAL", nil, errorCauses(err), "%v", []interface{}{err}, SeverityFatal, true, 0, err)
+}
+
+//FatalErr logs an error with severity "fatal". The message of the error is followed by the messages of
+//its causes as structured field "causes". The stack trace is taken from the error if it carries one.
+//Arguments: error to log
+func (l logger) FatalErr(err error) {
+	l.inst.genericLogHandler("FATAL", nil, mergeFields(l.fields, errorCauses(err)), "%v", []interface{}{err}, SeverityFatal, l.pos(true), 0, err)
+}
+
+//FatalErr logs an error with severity "fatal". The message of the error is followed by the messages of
+//its causes as structured field "causes". The stack trace is taken from the error if it carries one.
+//Arguments: error to log
+func (r *Instance) FatalErr(err error) {
+	r.genericLogHandler("FATAL", nil, errorCauses(err), "%v", []interface{}{err}, SeverityFatal, true, 0, err)
+}
+
+//ErrorErr logs an error with severity "error". The message of the error is followed by the messages of
+//its causes as structured field "causes". The stack trace is taken from the error if it carries one.
+//Arguments: error to log
+func ErrorErr(err error) {
+	std.genericLogHandler("ERROR", nil, errorCauses(err), "%v", []interface{}{err}, SeverityError, true, 0, err)
+}
+
+//ErrorErr logs an error with severity "error". The message of the error is followed by the messages of
+//its causes as structured field "causes". The stack trace is taken from the error if it carries one.
+//Arguments: error to log
+func (l logger) ErrorErr(err error) {
+	l.inst.genericLogHandler("ERROR", nil, mergeFields(l.fields, errorCauses(err)), "%v", []interface{}{err}, SeverityError, l.pos(true), 0, err)
+}
+
+//ErrorErr logs an error with severity "error". The message of the error is followed by the messages of
+//its causes as structured field "causes". The stack trace is taken from the error if it carries one.
+//Arguments: error to log
+func (r *Instance) ErrorErr(err error) {
+	r.genericLogHandler("ERROR", nil, errorCauses(err), "%v", []interface{}{err}, SeverityError, true, 0, err)
+}
+
+//WarningErr logs an error with severity "warning". The message of the error is followed by the messages
+//of its causes as structured field "causes". The stack trace is taken from the error if it carries one.
+//Arguments: error to log
+func WarningErr(err error) {
+	std.genericLogHandler("WARNING", nil, errorCauses(err), "%v", []interface{}{err}, SeverityWarning, false, 0, err)
+}
+
+//WarningErr logs an error with severity "warning". The message of the error is followed by the messages
+//of its causes as structured field "causes". The stack trace is taken from the error if it carries one.
+//Arguments: error to log
+func (l logger) WarningErr(err error) {
+	l.inst.genericLogHandler("WARNING", nil, mergeFields(l.fields, errorCauses(err)), "%v", []interface{}{err}, SeverityWarning, l.pos(false), 0, err)
+}
+
+//WarningErr logs an error with severity "warning". The message of the error is followed by the messages
+//of its causes as structured field "causes". The stack trace is taken from the error if it carries one.
+//Arguments: error to log
+func (r *Instance) WarningErr(err error) {
+	r.genericLogHandler("WARNING", nil, errorCauses(err), "%v", []interface{}{err}, SeverityWarning, false, 0, err)
+}
@@ -0,0 +1,117 @@
+/*
+These tests cover:
+- Unwrapping of error chains
+- Stack traces carried by errors, including typed nil pointers
+- Logging of errors
+*/
+package rlog
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	pkgerrors "github.com/pkg/errors"
+	. "launchpad.net/gocheck"
+	"strings"
+)
+
+//stackOrigin creates an error carrying the stack trace of its creation
+func stackOrigin() error {
+	return pkgerrors.New("origin")
+}
+
+//nilStackError dereferences its receiver like most error types do, a typed nil pointer panics
+type nilStackError struct {
+	msg   string
+	trace pkgerrors.StackTrace
+}
+
+func (e *nilStackError) Error() string {
+	return e.msg
+}
+
+func (e *nilStackError) StackTrace() pkgerrors.StackTrace {
+	return e.trace
+}
+
+//ownTrace is the stack trace of an error package other than github.com/pkg/errors
+type ownTrace string
+
+func (t ownTrace) Format(f fmt.State, verb rune) {
+	fmt.Fprint(f, string(t))
+}
+
+//ownStackError carries a stack trace of its own type, textError a stack trace which cannot format itself
+type ownStackError struct{ trace ownTrace }
+type textError struct{}
+
+func (e ownStackError) Error() string        { return "own" }
+func (e ownStackError) StackTrace() ownTrace { return e.trace }
+func (e textError) Error() string            { return "text" }
+func (e textError) StackTrace() string       { return "main.f()" }
+
+//When collecting the causes of an error, it should walk the entire chain including joined errors
+func (s *Stateless) TestErrorCauses(t *C) {
+	t.Assert(errorCauses(errors.New("plain")), IsNil)
+	t.Assert(errorCauses(nil), IsNil)
+
+	inner := errors.New("inner")
+	err := fmt.Errorf("outer: %w", fmt.Errorf("mid: %w", inner))
+	t.Assert(errorCauses(err)["causes"], DeepEquals, []string{"mid: inner", "inner"})
+
+	joined := errors.Join(errors.New("a"), fmt.Errorf("b: %w", inner))
+	t.Assert(errorCauses(joined)["causes"], DeepEquals, []string{"a", "b: inner", "inner"})
+}
+
+//When an error in the chain carries a stack trace, the innermost one should be used
+func (s *Stateless) TestErrorStackTrace(t *C) {
+	err := fmt.Errorf("request failed: %w", pkgerrors.Wrap(stackOrigin(), "wrapper"))
+	t.Assert(errorStackTrace(err), Matches, `(?s)github.com/rightscale/rlog.stackOrigin\n\t.*errors_test.go:\d+\n.*`)
+	t.Assert(errorStackTrace(errors.New("plain")), Equals, "")
+	t.Assert(errorStackTrace(nil), Equals, "")
+
+	//Any StackTrace method whose result formats itself qualifies
+	t.Assert(errorStackTrace(fmt.Errorf("wrapped: %w", ownStackError{"main.g()"})), Equals, "main.g()")
+	t.Assert(errorStackTrace(textError{}), Equals, "")
+}
+
+//When an error is a typed nil pointer, it should neither be unwrapped nor asked for its stack trace
+func (s *Stateless) TestErrorTypedNil(t *C) {
+	var typedNil *nilStackError
+	t.Assert(errorStackTrace(typedNil), Equals, "")
+	t.Assert(errorCauses(typedNil), IsNil)
+
+	err := fmt.Errorf("wrapped: %w", typedNil)
+	t.Assert(errorStackTrace(err), Equals, "")
+	t.Assert(errorCauses(err)["causes"], DeepEquals, []string{"<nil>"})
+}
+
+//When logging an error, it should carry the causes and the stack trace of the error if present
+func (s *Initialized) TestLoggingRoutinesWithErrors(t *C) {
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	ErrorErr(fmt.Errorf("request failed: %w", stackOrigin()))
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm.Msg, Equals, "request failed: origin")
+	t.Assert(rlm.File, Matches, `.*errors_test.go`)
+	t.Assert(rlm.Fields["causes"], DeepEquals, []string{"origin"})
+	t.Assert(strings.HasPrefix(rlm.StackTrace, "github.com/rightscale/rlog.stackOrigin\n"), Equals, true)
+	t.Assert(rlm.Severity, Equals, SeverityError)
+
+	//Without a stack trace in the error, the stack trace of the log call is used
+	NewLogger().WithFields(map[string]interface{}{"user": "x"}).ErrorErr(errors.New("plain"))
+	rlm = nonBlockingChanRead(myChan)
+	t.Assert(strings.HasPrefix(rlm.StackTrace, "github.com/rightscale/rlog.(*Initialized).TestLoggingRoutinesWithErrors"), Equals, true)
+	t.Assert(rlm.Fields, DeepEquals, map[string]interface{}{"user": "x"})
+
+	WarningErr(nil)
+	t.Assert(nonBlockingChanRead(myChan).Msg, Equals, "<nil>")
+
+	//A typed nil pointer must not panic
+	var typedNil *nilStackError
+	ErrorErr(typedNil)
+	rlm = nonBlockingChanRead(myChan)
+	t.Assert(rlm.Msg, Equals, "<nil>")
+	t.Assert(strings.HasPrefix(rlm.StackTrace, "github.com/rightscale/rlog.(*Initialized).TestLoggingRoutinesWithErrors"), Equals, true)
+}
@@ -4,26 +4,149 @@ Package file implements an output module for logging to a file using rlog.
 package file
 
 import (
+	"bufio"
+	"compress/gzip"
+	"errors"
 	"fmt"
 	"github.com/rightscale/rlog/common"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 )
 
 //Configuration of file logging module
 type fileLogger struct {
+	common.ModuleSeverity
+	path           string
 	removeNewlines bool
+	newlines       common.NewlineReplacement // replacement of newlines and tabs if removed
 	fileHandle     *os.File
 	loggedError    bool
+	formatter      common.Formatter
+	maxBytes       int64         // rotate once the file exceeds this size, 0 to disable rotation
+	maxBackups     int           // number of rotated files to keep
+	written        int64         // current size of the log file
+	compress       bool          // gzip compress the log file
+	gzipWriter     *gzip.Writer  // compressing writer on top of fileHandle if compress is set
+	buffered       bool          // buffer messages in memory before writing them to file
+	flushInterval  time.Duration // max time messages stay in the buffer, 0 to flush only when full
+	bufWriter      *bufio.Writer // buffering writer on top of all other writers if buffered is set
+	fileMode       os.FileMode   // permissions of created log files
+	dirMode        os.FileMode   // permissions of created parent directories
+	syncEachWrite  bool          // fsync the file after every message
 }
 
+//FileLoggerOptions holds optional settings of the file logger. Zero values select the defaults.
+type FileLoggerOptions struct {
+	FileMode os.FileMode // permissions of created log files, 0664 by default
+	DirMode  os.FileMode // permissions of created parent directories, 0775 by default
+}
+
+//Default permissions of created files and directories
+const (
+	defaultFileMode os.FileMode = 0664 // user/group-only read/write, world read
+	defaultDirMode  os.FileMode = 0775 // user/group-only read/write/traverse, world read/traverse
+)
+
+//compressedSuffix is appended to the path of compressed log files
+const compressedSuffix = ".gz"
+
+//bufferSize is the size of the message buffer of a buffered file logger
+const bufferSize = 64 * 1024
+
 //NewFileLogger enables logging to a file. The path (path/filename) can be specified either relative
 //to the application directory or as full path (example: "myLog.txt"). When removeNewlines is set,
 //newlines and tabs are replaced with ASCII characters as in syslog. If overwrite is set, the log
 //file is overwritten each time the application is restarted. If disabled, logs are appended.
 func NewFileLogger(path string, removeNewlines bool, overwrite bool) (*fileLogger, error) {
-	f := new(fileLogger)
-	f.removeNewlines = removeNewlines
+	f := newFileLogger(path, removeNewlines)
+	err := f.openFile(path, overwrite)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+//MustNewFileLogger enables logging to a file like NewFileLogger but panics if the file cannot be
+//opened, for concise setup in main
+func MustNewFileLogger(path string, removeNewlines bool, overwrite bool) *fileLogger {
+	f, err := NewFileLogger(path, removeNewlines, overwrite)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+//NewFileLoggerWithOptions enables logging to a file like NewFileLogger. In addition, the permissions
+//of the log file and its parent directories are taken from opts if set. Permissions only apply to
+//files and directories created by the logger, the umask of the process still applies.
+//Returns: instance of file logger module in case of success, error if opts holds invalid modes or
+//the file cannot be opened
+func NewFileLoggerWithOptions(path string, removeNewlines bool, overwrite bool, opts FileLoggerOptions) (*fileLogger, error) {
+	f := newFileLogger(path, removeNewlines)
+	err := f.applyOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	err = f.openFile(path, overwrite)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+//MustNewFileLoggerWithOptions enables logging to a file like NewFileLoggerWithOptions but panics if
+//opts holds invalid modes or the file cannot be opened, for concise setup in main
+func MustNewFileLoggerWithOptions(path string, removeNewlines bool, overwrite bool, opts FileLoggerOptions) *fileLogger {
+	f, err := NewFileLoggerWithOptions(path, removeNewlines, overwrite, opts)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+//NewRotatingFileLogger enables logging to a file which is rotated automatically once it exceeds
+//maxBytes. Upon rotation, the log file is renamed to path.1, existing backups are shifted (path.1
+//becomes path.2, etc.) and a new log file is started. At most maxBackups rotated files are kept, older
+//ones are deleted. Existing log files are appended. See NewFileLogger for the remaining arguments.
+func NewRotatingFileLogger(path string, maxBytes int64, maxBackups int, removeNewlines bool) (*fileLogger, error) {
+	f := newFileLogger(path, removeNewlines)
+	f.maxBytes = maxBytes
+	f.maxBackups = maxBackups
+	err := f.openFile(path, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+//MustNewRotatingFileLogger enables logging to a rotated file like NewRotatingFileLogger but panics
+//if the file cannot be opened, for concise setup in main
+func MustNewRotatingFileLogger(path string, maxBytes int64, maxBackups int, removeNewlines bool) *fileLogger {
+	f, err := NewRotatingFileLogger(path, maxBytes, maxBackups, removeNewlines)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+//NewCompressedFileLogger enables logging to a gzip compressed file. The suffix ".gz" is appended to
+//the path unless present already. Appending to an existing compressed log file adds a new gzip member
+//which standard tools (gunzip, zcat) read transparently. Compressed data is written on flush, the
+//current gzip member is completed when the file is reopened or rotated, so reading a log file that is
+//still in use reports an unexpected end of file. See NewFileLogger for the remaining arguments.
+func NewCompressedFileLogger(path string, removeNewlines bool, overwrite bool) (*fileLogger, error) {
+	if !strings.HasSuffix(path, compressedSuffix) {
+		path += compressedSuffix
+	}
+	f := newFileLogger(path, removeNewlines)
+	f.compress = true
 	err := f.openFile(path, overwrite)
 	if err != nil {
 		return nil, err
@@ -32,14 +155,137 @@ func NewFileLogger(path string, removeNewlines bool, overwrite bool) (*fileLogge
 	return f, nil
 }
 
+//MustNewCompressedFileLogger enables logging to a compressed file like NewCompressedFileLogger but
+//panics if the file cannot be opened, for concise setup in main
+func MustNewCompressedFileLogger(path string, removeNewlines bool, overwrite bool) *fileLogger {
+	f, err := NewCompressedFileLogger(path, removeNewlines, overwrite)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+//NewBufferedFileLogger enables logging to a file through an in-memory buffer to save a system call
+//per message. The buffer is written to file when it is full, when rlog is flushed and at the latest
+//flushInterval after the last write (0 disables the periodic write). Existing log files are appended.
+//See NewFileLogger for the remaining arguments.
+func NewBufferedFileLogger(path string, removeNewlines bool, flushInterval time.Duration) (*fileLogger, error) {
+	f := newFileLogger(path, removeNewlines)
+	f.buffered = true
+	f.flushInterval = flushInterval
+	err := f.openFile(path, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+//MustNewBufferedFileLogger enables buffered logging to a file like NewBufferedFileLogger but
+//panics if the file cannot be opened, for concise setup in main
+func MustNewBufferedFileLogger(path string, removeNewlines bool, flushInterval time.Duration) *fileLogger {
+	f, err := NewBufferedFileLogger(path, removeNewlines, flushInterval)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// creates a file logger with the default settings shared by all constructors, the file
+// is not opened yet.
+func newFileLogger(path string, removeNewlines bool) *fileLogger {
+	f := new(fileLogger)
+	f.removeNewlines = removeNewlines
+	f.formatter = common.DefaultFormatter{RemoveNewlines: removeNewlines}
+	f.fileMode = defaultFileMode
+	f.dirMode = defaultDirMode
+	f.path = path
+	return f
+}
+
+//Name names the module for rlog diagnostics and statistics
+func (conf *fileLogger) Name() string {
+	return "file:" + conf.path
+}
+
+//WithFormat selects the output format, plain text is used by default. Returns the file logger to
+//allow chaining with the constructor.
+func (conf *fileLogger) WithFormat(format common.MessageFormat) *fileLogger {
+	conf.formatter = common.WithNewlineReplacement(common.NewFormatter(format, conf.removeNewlines), conf.newlines)
+	return conf
+}
+
+//WithNewlineReplacement selects the strings replacing each newline and each tab when removing them
+//(see removeNewlines of the constructors), e.g. " | " or `\n` for literal escaping. Two spaces are used
+//by default. Returns the file logger to allow chaining with the constructor.
+func (conf *fileLogger) WithNewlineReplacement(newline, tab string) *fileLogger {
+	conf.newlines = common.NewlineReplacement{Newline: newline, Tab: tab}
+	conf.formatter = common.WithNewlineReplacement(conf.formatter, conf.newlines)
+	return conf
+}
+
+//WithFormatter selects a custom formatter creating the text written for each message. Returns the
+//file logger to allow chaining with the constructor.
+func (conf *fileLogger) WithFormatter(formatter common.Formatter) *fileLogger {
+	conf.formatter = formatter
+	return conf
+}
+
+//WithSyncEachWrite makes the file logger write each message through to disk (fsync) before handling
+//the next one, so that no message is lost on a system crash, e.g. for audit logs. This costs a disk
+//round trip per message and typically reduces the throughput by orders of magnitude, the module's
+//channel fills up faster and messages are dropped unless RlogConfig.OverflowPolicy is Block. Buffered
+//and compressed data is written with each message as well. Returns the file logger to allow chaining
+//with the constructor.
+func (conf *fileLogger) WithSyncEachWrite() *fileLogger {
+	conf.syncEachWrite = true
+	return conf
+}
+
+//WithSeverity sets a severity threshold for this module overriding the global rlog severity.
+//Returns the file logger to allow chaining with the constructor.
+func (conf *fileLogger) WithSeverity(severity common.RlogSeverity) *fileLogger {
+	conf.SetSeverity(severity)
+	return conf
+}
+
+//Validate checks that the log file is open and usable, see rlog.StartE
+//Returns: nil if the file is usable, error otherwise
+func (conf *fileLogger) Validate() error {
+	if conf.fileHandle == nil {
+		return fmt.Errorf("rlog file: %s is not open", conf.path)
+	}
+	if _, err := conf.fileHandle.Stat(); err != nil {
+		return fmt.Errorf("rlog file: %s is not usable: %s", conf.path, err.Error())
+	}
+	return nil
+}
+
+// validates the options and takes over the modes which are set.
+func (conf *fileLogger) applyOptions(opts FileLoggerOptions) error {
+	if opts.FileMode&^os.ModePerm != 0 {
+		return fmt.Errorf("rlog file: invalid file mode %v, only permission bits are allowed", opts.FileMode)
+	}
+	if opts.DirMode&^os.ModePerm != 0 {
+		return fmt.Errorf("rlog file: invalid directory mode %v, only permission bits are allowed", opts.DirMode)
+	}
+
+	if opts.FileMode != 0 {
+		conf.fileMode = opts.FileMode
+	}
+	if opts.DirMode != 0 {
+		conf.dirMode = opts.DirMode
+	}
+	return nil
+}
+
 // opens the log file using the given criteria.
 func (conf *fileLogger) openFile(path string, overwrite bool) error {
 	var err error
 
 	parentDir, _ := filepath.Split(path)
 	if parentDir != "" {
-		var dirMode os.FileMode = 0775 // user/group-only read/write/traverse, world read/traverse
-		err = os.MkdirAll(parentDir, dirMode)
+		err = os.MkdirAll(parentDir, conf.dirMode)
 		if err != nil {
 			return err
 		}
@@ -47,7 +293,7 @@ func (conf *fileLogger) openFile(path string, overwrite bool) error {
 
 	// open write-only (will never read back from log file).
 	var fh *os.File
-	var fileMode os.FileMode = 0664 // user/group-only read/write, world read
+	fileMode := conf.fileMode
 
 	if overwrite {
 		// create or truncate
@@ -73,53 +319,156 @@ func (conf *fileLogger) openFile(path string, overwrite bool) error {
 		}
 	}
 	conf.fileHandle = fh
+	if conf.compress {
+		conf.gzipWriter = gzip.NewWriter(fh)
+	}
+	if conf.buffered {
+		if conf.gzipWriter != nil {
+			conf.bufWriter = bufio.NewWriterSize(conf.gzipWriter, bufferSize)
+		} else {
+			conf.bufWriter = bufio.NewWriterSize(fh, bufferSize)
+		}
+	}
+
+	// keep track of the file size for rotation.
+	conf.written = 0
+	if !overwrite {
+		info, err := fh.Stat()
+		if err != nil {
+			return err
+		}
+		conf.written = info.Size()
+	}
 	return nil
 }
 
 //LaunchModule is intended to run in a separate goroutine and used by rlog internally. It writes log
 //messages to file Arguments: [dataChan] Channel to receive log messages. [flushChan] Channel to
 //receive flush command
-func (conf *fileLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (bool))) {
+func (conf *fileLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
 
 	prefix := common.SyslogHeader()
 
+	//Write buffered messages periodically, a nil channel never fires
+	var tick <-chan time.Time
+	if conf.buffered && conf.flushInterval > 0 {
+		ticker := time.NewTicker(conf.flushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
 	//Wait forever on data and flush channel
 	for {
 		select {
 		case logMsg := <-dataChan:
 			//Received log message, print it
-			err := conf.writeMsg(logMsg, prefix)
-			if err != nil {
-				// we may be able to work around intermittent failures by reopening.
-				if conf.reopenFile() != nil {
-					err = conf.writeMsg(logMsg, prefix)
-				}
+			conf.WriteSync(logMsg, prefix)
+		case ret, ok := <-flushChan:
+			if !ok {
+				//Flush channel closed by rlog: write pending messages and exit
+				conf.flush(dataChan, prefix)
+				return
 			}
+			//Flush and return the number of messages written and the flush errors
+			flushed, err := conf.flush(dataChan, prefix)
+			ret <- common.FlushResult{Flushed: flushed, Err: err}
+		case <-tick:
+			//Write buffered messages to file
+			err := conf.flushBuffer()
 			if err != nil {
-				// panic if reopening did not resolve the issue.
+				// panic like the data path as the buffered messages are lost.
 				panic(err)
 			}
-		case ret := <-flushChan:
-			//Flush and return success
-			conf.flush(dataChan, prefix)
-			ret <- true
 		}
 	}
 }
 
-//writeMsg writes message to file
+//WriteSync writes a log message to file, reopening the file on failure. It is used by LaunchModule
+//and by rlog directly when running in synchronous mode (see rlog.RlogConfig.Synchronous).
+//Arguments: [rawRlogMsg] log message. [prefix] log prefix
+func (conf *fileLogger) WriteSync(rawRlogMsg *common.RlogMsg, prefix string) {
+	err := conf.writeMsg(rawRlogMsg, prefix)
+	if err != nil {
+		// we may be able to work around intermittent failures by reopening.
+		if conf.reopenFile() != nil {
+			err = conf.writeMsg(rawRlogMsg, prefix)
+		}
+	}
+	if err != nil {
+		// panic if reopening did not resolve the issue.
+		panic(err)
+	}
+}
+
+//FlushSync writes buffered data to file when rlog runs in synchronous mode. Like a flush command, it
+//reopens the file to support rotation of file logs.
+func (conf *fileLogger) FlushSync() {
+	//A nil channel has no pending messages
+	conf.flush(nil, "")
+}
+
+//writeMsg writes message to file and rotates the file if it exceeds its max size
 func (conf *fileLogger) writeMsg(rawRlogMsg *common.RlogMsg, prefix string) error {
-	_, err := fmt.Fprintln(conf.fileHandle, common.FormatMessage(rawRlogMsg, prefix, conf.removeNewlines))
+	n, err := fmt.Fprintln(conf.writer(), conf.formatter.Format(rawRlogMsg, prefix))
+	conf.written += int64(n)
+	if err == nil && conf.syncEachWrite {
+		err = conf.flushBuffer()
+		if err == nil {
+			err = conf.fileHandle.Sync()
+		}
+	}
+	if err == nil && conf.maxBytes > 0 && conf.written >= conf.maxBytes {
+		err = conf.rotate()
+	}
 	return err
 }
 
+// renames the log file to the first backup, shifts existing backups and starts a new
+// log file. rotation happens inside the module goroutine, hence no locking is needed.
+func (conf *fileLogger) rotate() error {
+	err := conf.closeFile()
+	if err != nil {
+		return err
+	}
+
+	if conf.maxBackups > 0 {
+		// shift backups, the oldest one is replaced by its successor.
+		for i := conf.maxBackups - 1; i > 0; i-- {
+			err = os.Rename(conf.backupPath(i), conf.backupPath(i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		err = os.Rename(conf.path, conf.backupPath(1))
+		if err != nil {
+			return err
+		}
+	}
+
+	// delete backups beyond max backups (e.g. left over from a previous configuration).
+	for i := conf.maxBackups + 1; ; i++ {
+		err = os.Remove(conf.backupPath(i))
+		if err != nil {
+			break
+		}
+	}
+
+	return conf.openFile(conf.path, true)
+}
+
+// returns the path of the n-th backup of the log file.
+func (conf *fileLogger) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", conf.path, n)
+}
+
 //flush writes all pending log messages to file
 //Arguments:[dataChan] data channel to access all pending messages, [prefix] log prefix
-func (conf *fileLogger) flush(dataChan <-chan (*common.RlogMsg), prefix string) {
+//Returns: number of messages written, error if the buffered data could not be written to disk
+func (conf *fileLogger) flush(dataChan <-chan (*common.RlogMsg), prefix string) (int, error) {
 
 	// we may already be panicking due to losing file handle.
 	if conf.fileHandle == nil {
-		return
+		return 0, nil
 	}
 
 	// reopen file before flushing any messages to support rotation of file logs
@@ -131,6 +480,7 @@ func (conf *fileLogger) flush(dataChan <-chan (*common.RlogMsg), prefix string)
 		panic(err)
 	}
 
+	flushed := 0
 	for {
 		//Perform non blocking read until the channel is empty
 		select {
@@ -141,13 +491,16 @@ func (conf *fileLogger) flush(dataChan <-chan (*common.RlogMsg), prefix string)
 				// cannot logically be resolved by reopening again here.
 				panic(err)
 			}
+			flushed++
 		default:
-			return
+			// write buffered and compressed data to file, a failure shows on the next write as well.
+			err = conf.flushBuffer()
+			if err == nil {
+				err = conf.syncFile()
+			}
+			return flushed, err
 		}
 	}
-
-	//Do not handle error, as there is nothing we can do about it
-	conf.fileHandle.Sync()
 }
 
 // reopen existing log file and/or create new file if log rotation renamed
@@ -155,13 +508,72 @@ func (conf *fileLogger) flush(dataChan <-chan (*common.RlogMsg), prefix string)
 func (conf *fileLogger) reopenFile() error {
 	// note that the trick here is that the file struct remembers the original
 	// file name before it was renamed by rotation, if ever.
-	oldFileHandle := conf.fileHandle
-	conf.fileHandle = nil
-	path := oldFileHandle.Name()
-	err := oldFileHandle.Close()
+	path := conf.fileHandle.Name()
+	err := conf.closeFile()
 	if err == nil {
 		err = conf.openFile(path, false)
 	}
 
 	return err
 }
+
+// returns the writer for log messages, i.e. the buffering writer if buffering is
+// enabled, the compressing writer if compression is enabled or the file itself.
+func (conf *fileLogger) writer() io.Writer {
+	if conf.bufWriter != nil {
+		return conf.bufWriter
+	}
+	if conf.gzipWriter != nil {
+		return conf.gzipWriter
+	}
+	return conf.fileHandle
+}
+
+// writes the log file through to disk, files which cannot be synced (e.g. pipes) are fine.
+func (conf *fileLogger) syncFile() error {
+	err := conf.fileHandle.Sync()
+	if err != nil && !errors.Is(err, syscall.EINVAL) {
+		return err
+	}
+	return nil
+}
+
+// writes buffered and compressed data to the file without closing it.
+func (conf *fileLogger) flushBuffer() error {
+	if conf.bufWriter != nil {
+		err := conf.bufWriter.Flush()
+		if err != nil {
+			return err
+		}
+	}
+	if conf.gzipWriter != nil {
+		return conf.gzipWriter.Flush()
+	}
+	return nil
+}
+
+// closes the log file, buffered and compressed data is written before closing.
+func (conf *fileLogger) closeFile() error {
+	fh := conf.fileHandle
+	bw := conf.bufWriter
+	gw := conf.gzipWriter
+	conf.fileHandle = nil
+	conf.bufWriter = nil
+	conf.gzipWriter = nil
+
+	if bw != nil {
+		err := bw.Flush()
+		if err != nil {
+			fh.Close()
+			return err
+		}
+	}
+	if gw != nil {
+		err := gw.Close()
+		if err != nil {
+			fh.Close()
+			return err
+		}
+	}
+	return fh.Close()
+}
@@ -0,0 +1,260 @@
+/*
+These tests cover:
+- Rotation: shifting of backups and deletion of backups beyond the max
+- Compressed files appended after reopening
+- Buffered files written on tick, on flush and on each write if synced
+- Validation of the file and directory modes
+- Routing messages to files by severity, reopening them on flush
+*/
+package file
+
+import (
+	"compress/gzip"
+	"github.com/rightscale/rlog"
+	"github.com/rightscale/rlog/common"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//Hook this testing framework into go test
+func Test(t *testing.T) { TestingT(t) }
+
+type FileSuite struct{}
+
+var _ = Suite(&FileSuite{})
+
+//messageFormatter keeps the message text only
+type messageFormatter struct{}
+
+func (messageFormatter) Format(rawRlogMsg *common.RlogMsg, prefix string) string {
+	return rawRlogMsg.Msg
+}
+
+//readFile returns the content of a file, "" if it does not exist
+func readFile(c *C, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	c.Assert(err, IsNil)
+	return string(content)
+}
+
+//launch runs the module until the returned function closes the flush channel and waits for it to exit
+func launch(module interface {
+	LaunchModule(<-chan (*common.RlogMsg), chan (chan (common.FlushResult)))
+}, dataChan chan *common.RlogMsg, flushChan chan chan common.FlushResult) func() {
+	done := make(chan struct{})
+	go func() {
+		module.LaunchModule(dataChan, flushChan)
+		close(done)
+	}()
+	return func() {
+		close(flushChan)
+		<-done
+	}
+}
+
+//flush sends a flush command to the module and waits for the ACK
+func flush(c *C, flushChan chan chan common.FlushResult) common.FlushResult {
+	ret := make(chan common.FlushResult, 1)
+	flushChan <- ret
+	select {
+	case res := <-ret:
+		return res
+	case <-time.After(5 * time.Second):
+		c.Fatal("flush command ACK timed out")
+	}
+	return common.FlushResult{}
+}
+
+//When the file exceeds its max size, it should become the first backup, shift the others and delete
+//the backups beyond the max
+func (s *FileSuite) TestRotation(c *C) {
+	path := filepath.Join(c.MkDir(), "app.log")
+	//Left over from a configuration keeping more backups
+	c.Assert(ioutil.WriteFile(path+".3", []byte("stale\n"), 0644), IsNil)
+
+	logger, err := NewRotatingFileLogger(path, 10, 2, false)
+	c.Assert(err, IsNil)
+	logger.WithFormatter(messageFormatter{})
+	for _, msg := range []string{"message 1", "message 2", "message 3", "short"} {
+		logger.WriteSync(&common.RlogMsg{Msg: msg}, "")
+	}
+	c.Assert(logger.closeFile(), IsNil)
+
+	c.Assert(readFile(c, path), Equals, "short\n")
+	c.Assert(readFile(c, path+".1"), Equals, "message 3\n")
+	c.Assert(readFile(c, path+".2"), Equals, "message 2\n")
+	_, err = os.Stat(path + ".3")
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+//When a compressed file is reopened, the messages should be appended as new gzip member
+func (s *FileSuite) TestCompressedReopen(c *C) {
+	path := filepath.Join(c.MkDir(), "app.log")
+	logger, err := NewCompressedFileLogger(path, false, false)
+	c.Assert(err, IsNil)
+	c.Assert(logger.Name(), Equals, "file:"+path+".gz")
+	logger.WithFormatter(messageFormatter{})
+
+	logger.WriteSync(&common.RlogMsg{Msg: "one"}, "")
+	//Flushing reopens the file
+	logger.FlushSync()
+	logger.WriteSync(&common.RlogMsg{Msg: "two"}, "")
+	c.Assert(logger.closeFile(), IsNil)
+
+	f, err := os.Open(path + ".gz")
+	c.Assert(err, IsNil)
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "one\ntwo\n")
+}
+
+//When buffering with a flush interval, the buffer should be written to file on tick
+func (s *FileSuite) TestBufferedTick(c *C) {
+	path := filepath.Join(c.MkDir(), "app.log")
+	logger, err := NewBufferedFileLogger(path, false, 10*time.Millisecond)
+	c.Assert(err, IsNil)
+	logger.WithFormatter(messageFormatter{})
+
+	dataChan := make(chan *common.RlogMsg, 10)
+	flushChan := make(chan chan common.FlushResult, 1)
+	defer launch(logger, dataChan, flushChan)()
+
+	dataChan <- &common.RlogMsg{Msg: "ticked"}
+	deadline := time.Now().Add(5 * time.Second)
+	for readFile(c, path) == "" && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.Assert(readFile(c, path), Equals, "ticked\n")
+}
+
+//When buffering without a flush interval, the buffer should be written to file on flush only
+func (s *FileSuite) TestBufferedFlush(c *C) {
+	path := filepath.Join(c.MkDir(), "app.log")
+	logger, err := NewBufferedFileLogger(path, false, 0)
+	c.Assert(err, IsNil)
+	defer logger.closeFile()
+	logger.WithFormatter(messageFormatter{})
+
+	logger.WriteSync(&common.RlogMsg{Msg: "buffered"}, "")
+	c.Assert(readFile(c, path), Equals, "")
+	//The flush writes the messages still pending in the channel as well
+	dataChan := make(chan *common.RlogMsg, 10)
+	dataChan <- &common.RlogMsg{Msg: "pending"}
+	flushed, err := logger.flush(dataChan, "")
+	c.Assert(err, IsNil)
+	c.Assert(flushed, Equals, 1)
+	c.Assert(readFile(c, path), Equals, "buffered\npending\n")
+}
+
+//When syncing each write, buffered messages should be written to file right away
+func (s *FileSuite) TestSyncEachWrite(c *C) {
+	path := filepath.Join(c.MkDir(), "app.log")
+	logger, err := NewBufferedFileLogger(path, false, 0)
+	c.Assert(err, IsNil)
+	defer logger.closeFile()
+	logger.WithFormatter(messageFormatter{}).WithSyncEachWrite()
+
+	logger.WriteSync(&common.RlogMsg{Msg: "synced"}, "")
+	c.Assert(readFile(c, path), Equals, "synced\n")
+}
+
+//When creating a file logger with options, it should reject modes beyond the permission bits and
+//apply valid modes to the created file and directories
+func (s *FileSuite) TestModes(c *C) {
+	dir := c.MkDir()
+	path := filepath.Join(dir, "logs", "app.log")
+
+	_, err := NewFileLoggerWithOptions(path, false, false, FileLoggerOptions{FileMode: os.ModeSetuid | 0644})
+	c.Assert(err, ErrorMatches, "rlog file: invalid file mode .*")
+	_, err = NewFileLoggerWithOptions(path, false, false, FileLoggerOptions{DirMode: os.ModeDir | 0755})
+	c.Assert(err, ErrorMatches, "rlog file: invalid directory mode .*")
+	_, err = os.Stat(filepath.Dir(path))
+	c.Assert(os.IsNotExist(err), Equals, true)
+
+	logger, err := NewFileLoggerWithOptions(path, false, false, FileLoggerOptions{FileMode: 0600, DirMode: 0700})
+	c.Assert(err, IsNil)
+	defer logger.closeFile()
+	info, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Assert(info.Mode().Perm(), Equals, os.FileMode(0600))
+	info, err = os.Stat(filepath.Dir(path))
+	c.Assert(err, IsNil)
+	c.Assert(info.Mode().Perm(), Equals, os.FileMode(0700))
+}
+
+//When creating a file logger, it should be usable right away and named after the path
+func (s *FileSuite) TestDefaults(c *C) {
+	path := filepath.Join(c.MkDir(), "app.log")
+	logger, err := NewFileLogger(path, false, true)
+	c.Assert(err, IsNil)
+	defer logger.closeFile()
+	c.Assert(logger.Name(), Equals, "file:"+path)
+	c.Assert(logger.Validate(), IsNil)
+
+	logger.WriteSync(&common.RlogMsg{Msg: "hello", Severity: rlog.SeverityInfo}, "")
+	c.Assert(readFile(c, path), Matches, "(?s).*hello\n")
+}
+
+//When routing by severity, each message should be written to the file of the most severe threshold it
+//meets and a flush should reopen all files
+func (s *FileSuite) TestSeverityRouted(c *C) {
+	dir := c.MkDir()
+	errPath := filepath.Join(dir, "errors.log")
+	appPath := filepath.Join(dir, "app.log")
+	_, err := NewSeverityRoutedLogger(nil, false)
+	c.Assert(err, ErrorMatches, "rlog file: no paths to route messages to")
+	logger, err := NewSeverityRoutedLogger(map[common.RlogSeverity]string{
+		rlog.SeverityError: errPath,
+		rlog.SeverityInfo:  appPath,
+	}, false)
+	c.Assert(err, IsNil)
+	logger.WithFormatter(messageFormatter{})
+	defer logger.closeFiles()
+
+	for _, msg := range []*common.RlogMsg{
+		{Msg: "fatal", Severity: rlog.SeverityFatal},
+		{Msg: "error", Severity: rlog.SeverityError},
+		{Msg: "warning", Severity: rlog.SeverityWarning},
+		{Msg: "debug", Severity: rlog.SeverityDebug},
+	} {
+		logger.WriteSync(msg, "")
+	}
+	c.Assert(readFile(c, errPath), Equals, "fatal\nerror\n")
+	c.Assert(readFile(c, appPath), Equals, "warning\n")
+
+	//Rotated files are recreated by the flush, pending messages are written to the new files
+	c.Assert(os.Rename(appPath, appPath+".1"), IsNil)
+	dataChan := make(chan *common.RlogMsg, 10)
+	dataChan <- &common.RlogMsg{Msg: "info", Severity: rlog.SeverityInfo}
+	flushed, err := logger.flush(dataChan, "")
+	c.Assert(err, IsNil)
+	c.Assert(flushed, Equals, 1)
+	c.Assert(readFile(c, appPath), Equals, "info\n")
+	c.Assert(readFile(c, appPath+".1"), Equals, "warning\n")
+
+	//The flush command is acknowledged with the result of the flush
+	flushChan := make(chan chan common.FlushResult, 1)
+	stop := launch(logger, dataChan, flushChan)
+	c.Assert(flush(c, flushChan), Equals, common.FlushResult{})
+	stop()
+
+	//A lost handle leaves all files untouched
+	handle := logger.files[0].fileHandle
+	lost := logger.files[1].fileHandle
+	logger.files[1].fileHandle = nil
+	flushed, err = logger.flush(dataChan, "")
+	c.Assert(flushed, Equals, 0)
+	c.Assert(err, IsNil)
+	c.Assert(logger.files[0].fileHandle, Equals, handle)
+	lost.Close()
+}
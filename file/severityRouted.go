@@ -0,0 +1,252 @@
+package file
+
+/*
+This file implements a file logger writing each message to one of several files depending on its
+severity, e.g. errors to errors.log and all other messages to app.log.
+*/
+
+import (
+	"fmt"
+	"github.com/rightscale/rlog/common"
+	"sort"
+	"strings"
+)
+
+//Configuration of the severity routed file logging module
+type severityRoutedLogger struct {
+	common.ModuleSeverity
+	routes         []severityRoute           // routes ordered from the most to the least severe threshold
+	files          []*fileLogger             // one handle per distinct path, shared by its routes
+	removeNewlines bool                      // replace newlines and tabs
+	newlines       common.NewlineReplacement // replacement of newlines and tabs if removed
+}
+
+//severityRoute sends messages down to a severity threshold to a file
+type severityRoute struct {
+	severity common.RlogSeverity // least severe level written to the file
+	file     *fileLogger         // handle of the file
+}
+
+//NewSeverityRoutedLogger enables logging to several files split by severity. paths maps a severity
+//threshold to a file, each message is written to the file of the most severe threshold it meets (e.g.
+//with {SeverityError: "errors.log", SeverityInfo: "app.log"}, errors and fatal messages go to
+//errors.log, warnings and info messages to app.log and less severe messages are not written). A path
+//may be used for several thresholds. Existing log files are appended. On flush, all files are reopened
+//to support rotation of file logs. See NewFileLogger for removeNewlines.
+//Returns: instance of the module in case of success, error if no path is given or a file cannot be
+//opened
+func NewSeverityRoutedLogger(paths map[common.RlogSeverity]string, removeNewlines bool) (*severityRoutedLogger, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("rlog file: no paths to route messages to")
+	}
+
+	severities := make([]common.RlogSeverity, 0, len(paths))
+	for severity := range paths {
+		severities = append(severities, severity)
+	}
+	sort.Slice(severities, func(i, j int) bool { return severities[i] < severities[j] })
+
+	conf := new(severityRoutedLogger)
+	conf.removeNewlines = removeNewlines
+	opened := make(map[string]*fileLogger)
+	for _, severity := range severities {
+		path := paths[severity]
+		f, ok := opened[path]
+		if !ok {
+			var err error
+			f, err = NewFileLogger(path, removeNewlines, false)
+			if err != nil {
+				conf.closeFiles()
+				return nil, err
+			}
+			opened[path] = f
+			conf.files = append(conf.files, f)
+		}
+		conf.routes = append(conf.routes, severityRoute{severity: severity, file: f})
+	}
+
+	return conf, nil
+}
+
+//MustNewSeverityRoutedLogger enables logging to several files like NewSeverityRoutedLogger but panics
+//if no path is given or a file cannot be opened, for concise setup in main
+func MustNewSeverityRoutedLogger(paths map[common.RlogSeverity]string, removeNewlines bool) *severityRoutedLogger {
+	conf, err := NewSeverityRoutedLogger(paths, removeNewlines)
+	if err != nil {
+		panic(err)
+	}
+	return conf
+}
+
+//Name names the module for rlog diagnostics and statistics
+func (conf *severityRoutedLogger) Name() string {
+	paths := make([]string, len(conf.files))
+	for i, f := range conf.files {
+		paths[i] = f.path
+	}
+	return "file:" + strings.Join(paths, ",")
+}
+
+//WithFormat selects the output format of all files, plain text is used by default. Returns the file
+//logger to allow chaining with the constructor.
+func (conf *severityRoutedLogger) WithFormat(format common.MessageFormat) *severityRoutedLogger {
+	conf.setFormatter(common.WithNewlineReplacement(common.NewFormatter(format, conf.removeNewlines), conf.newlines))
+	return conf
+}
+
+//WithNewlineReplacement selects the strings replacing each newline and each tab when removing them, see
+//fileLogger.WithNewlineReplacement. Returns the file logger to allow chaining with the constructor.
+func (conf *severityRoutedLogger) WithNewlineReplacement(newline, tab string) *severityRoutedLogger {
+	conf.newlines = common.NewlineReplacement{Newline: newline, Tab: tab}
+	for _, f := range conf.files {
+		f.WithNewlineReplacement(newline, tab)
+	}
+	return conf
+}
+
+//WithFormatter selects a custom formatter creating the text written for each message to all files.
+//Returns the file logger to allow chaining with the constructor.
+func (conf *severityRoutedLogger) WithFormatter(formatter common.Formatter) *severityRoutedLogger {
+	conf.setFormatter(formatter)
+	return conf
+}
+
+//WithSeverity sets a severity threshold for this module overriding the global rlog severity.
+//Returns the file logger to allow chaining with the constructor.
+func (conf *severityRoutedLogger) WithSeverity(severity common.RlogSeverity) *severityRoutedLogger {
+	conf.SetSeverity(severity)
+	return conf
+}
+
+//Validate checks that all log files are open and usable, see rlog.StartE
+//Returns: nil if the files are usable, error otherwise
+func (conf *severityRoutedLogger) Validate() error {
+	for _, f := range conf.files {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sets the formatter of all files.
+func (conf *severityRoutedLogger) setFormatter(formatter common.Formatter) {
+	for _, f := range conf.files {
+		f.formatter = formatter
+	}
+}
+
+// closes all files opened so far.
+func (conf *severityRoutedLogger) closeFiles() {
+	for _, f := range conf.files {
+		f.closeFile()
+	}
+}
+
+//LaunchModule is intended to run in a separate goroutine and used by rlog internally. It writes log
+//messages to the files. Arguments: [dataChan] Channel to receive log messages. [flushChan] Channel to
+//receive flush command
+func (conf *severityRoutedLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
+
+	prefix := common.SyslogHeader()
+
+	//Wait forever on data and flush channel
+	for {
+		select {
+		case logMsg := <-dataChan:
+			//Received log message, print it
+			conf.WriteSync(logMsg, prefix)
+		case ret, ok := <-flushChan:
+			if !ok {
+				//Flush channel closed by rlog: write pending messages and exit
+				conf.flush(dataChan, prefix)
+				return
+			}
+			//Flush and return the number of messages written and the flush errors
+			flushed, err := conf.flush(dataChan, prefix)
+			ret <- common.FlushResult{Flushed: flushed, Err: err}
+		}
+	}
+}
+
+//WriteSync writes a log message to the file its severity is routed to, reopening the file on failure.
+//It is used by LaunchModule and by rlog directly when running in synchronous mode.
+//Arguments: [rawRlogMsg] log message. [prefix] log prefix
+func (conf *severityRoutedLogger) WriteSync(rawRlogMsg *common.RlogMsg, prefix string) {
+	if f := conf.route(rawRlogMsg.Severity); f != nil {
+		f.WriteSync(rawRlogMsg, prefix)
+	}
+}
+
+//FlushSync reopens all files when rlog runs in synchronous mode, see flush
+func (conf *severityRoutedLogger) FlushSync() {
+	//A nil channel has no pending messages
+	conf.flush(nil, "")
+}
+
+//writeMsg writes a message to the file its severity is routed to, messages less severe than all
+//thresholds are not written
+func (conf *severityRoutedLogger) writeMsg(rawRlogMsg *common.RlogMsg, prefix string) error {
+	if f := conf.route(rawRlogMsg.Severity); f != nil {
+		return f.writeMsg(rawRlogMsg, prefix)
+	}
+	return nil
+}
+
+// returns the file of the most severe threshold met by a severity, nil if none.
+func (conf *severityRoutedLogger) route(severity common.RlogSeverity) *fileLogger {
+	for _, r := range conf.routes {
+		if severity <= r.severity {
+			return r.file
+		}
+	}
+	return nil
+}
+
+//flush reopens all files and writes all pending log messages
+//Arguments:[dataChan] data channel to access all pending messages, [prefix] log prefix
+//Returns: number of messages handled, error if a file could not be written to disk
+func (conf *severityRoutedLogger) flush(dataChan <-chan (*common.RlogMsg), prefix string) (int, error) {
+
+	// we may already be panicking due to losing a file handle, leave all files as they are.
+	for _, f := range conf.files {
+		if f.fileHandle == nil {
+			return 0, nil
+		}
+	}
+
+	// reopen files before flushing any messages to support rotation of file logs
+	// in response to SIGHUP, etc.
+	for _, f := range conf.files {
+		err := f.reopenFile()
+		if err != nil {
+			// panic if unable to reopen log file so that service can be restarted by
+			// outer harness with alerts, etc.
+			panic(err)
+		}
+	}
+
+	flushed := 0
+	for {
+		//Perform non blocking read until the channel is empty
+		select {
+		case logMsg := <-dataChan:
+			err := conf.writeMsg(logMsg, prefix)
+			if err != nil {
+				// we reopened before we began flushing so any failure during flush
+				// cannot logically be resolved by reopening again here.
+				panic(err)
+			}
+			flushed++
+		default:
+			// sync all files, the first failure is reported.
+			var err error
+			for _, f := range conf.files {
+				if syncErr := f.syncFile(); syncErr != nil && err == nil {
+					err = syncErr
+				}
+			}
+			return flushed, err
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package rlog
+
+/*
+This file implements the health check of output modules, e.g. for a readiness probe reflecting whether
+the connections of network modules are up.
+*/
+
+//HealthCheck asks all active modules implementing Healthy (e.g. the syslog and tcp modules) for their
+//health, e.g. to serve an HTTP /healthz endpoint. Other modules are not listed.
+//Returns: map from module name to nil if the module is healthy, or to the error it reports
+func HealthCheck() map[string]error {
+	return std.HealthCheck()
+}
+
+//HealthCheck asks all active modules implementing Healthy (e.g. the syslog and tcp modules) for their
+//health, e.g. to serve an HTTP /healthz endpoint. Other modules are not listed.
+//Returns: map from module name to nil if the module is healthy, or to the error it reports
+func (r *Instance) HealthCheck() map[string]error {
+	//Ask the modules without holding the lock, a module may take its time to answer
+	var modules []healthModule
+	r.modulesMutex.RLock()
+	for e := r.activeModules.Front(); e != nil; e = e.Next() {
+		if hm, ok := e.Value.(healthModule); ok {
+			modules = append(modules, hm)
+		}
+	}
+	r.modulesMutex.RUnlock()
+
+	health := make(map[string]error, len(modules))
+	for _, hm := range modules {
+		name := moduleName(hm.(rlogModule))
+		err := hm.Healthy()
+		if _, listed := health[name]; !listed || err != nil {
+			//Modules sharing a name are unhealthy if one of them is
+			health[name] = err
+		}
+	}
+	return health
+}
@@ -0,0 +1,40 @@
+/*
+These tests cover:
+- Health check of modules reporting their health
+*/
+package rlog
+
+import (
+	"errors"
+	. "launchpad.net/gocheck"
+)
+
+//fakeHealthModule reports the given health
+type fakeHealthModule struct {
+	fakeLogModule
+	name string
+	err  error
+}
+
+func (f *fakeHealthModule) Name() string {
+	return f.name
+}
+
+func (f *fakeHealthModule) Healthy() error {
+	return f.err
+}
+
+//When checking the health, it should list the modules reporting their health by name
+func (s *Uninitialized) TestHealthCheck(t *C) {
+	down := errors.New("connection refused")
+	EnableModule(&fakeHealthModule{name: "up"})
+	EnableModule(&fakeHealthModule{name: "down", err: down})
+	EnableModule(new(fakeLogModule))
+	Start(GetDefaultConfig())
+
+	t.Assert(HealthCheck(), DeepEquals, map[string]error{"up": nil, "down": down})
+
+	//Modules sharing a name are unhealthy if one of them is
+	t.Assert(AttachModule(&fakeHealthModule{name: "down"}), IsNil)
+	t.Assert(HealthCheck()["down"], Equals, down)
+}
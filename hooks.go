@@ -0,0 +1,78 @@
+package rlog
+
+/*
+This file implements hooks, i.e. callbacks invoked synchronously for each log message. Hooks are a
+lightweight alternative to output modules, e.g. to update metrics or trigger alerts on errors.
+*/
+
+import (
+	"github.com/rightscale/rlog/common"
+)
+
+//hook couples a callback with the least severe level it is invoked for
+type hook struct {
+	severity common.RlogSeverity   //least severe level passed to the callback
+	fn       func(*common.RlogMsg) //callback
+}
+
+//AddHook registers a callback invoked for every log message of the given severity or more severe. Hooks
+//run synchronously in the goroutine logging the message before the message is passed to the modules,
+//hence they should be cheap. A hook must not modify the message. A panicking hook is recovered and
+//does not affect the logging goroutine. AddHook is thread safe, hooks may call it as well.
+//Arguments: [severity] least severe level passed to the hook. [fn] callback
+func AddHook(severity common.RlogSeverity, fn func(*common.RlogMsg)) {
+	std.AddHook(severity, fn)
+}
+
+//AddHook registers a callback invoked for every log message of the given severity or more severe. Hooks
+//run synchronously in the goroutine logging the message before the message is passed to the modules,
+//hence they should be cheap. A hook must not modify the message. A panicking hook is recovered and
+//does not affect the logging goroutine. AddHook is thread safe, hooks may call it as well.
+//Arguments: [severity] least severe level passed to the hook. [fn] callback
+func (r *Instance) AddHook(severity common.RlogSeverity, fn func(*common.RlogMsg)) {
+	r.hooksMutex.Lock()
+	defer r.hooksMutex.Unlock()
+
+	r.hooks = append(r.hooks, hook{severity, fn})
+}
+
+//isFilteredByAllHooks determines whether no registered hook accepts messages of the given severity
+func (r *Instance) isFilteredByAllHooks(severity common.RlogSeverity) bool {
+	r.hooksMutex.RLock()
+	defer r.hooksMutex.RUnlock()
+
+	for _, h := range r.hooks {
+		if severity <= h.severity {
+			return false
+		}
+	}
+	return true
+}
+
+//runHooks invokes all hooks accepting the severity of the given message. The hooks are invoked without
+//holding the lock, so that a hook may register further hooks.
+//Arguments: message to pass to the hooks
+func (r *Instance) runHooks(msg *common.RlogMsg) {
+	//AddHook only appends, the elements of the snapshot are never modified
+	r.hooksMutex.RLock()
+	hooks := r.hooks
+	r.hooksMutex.RUnlock()
+
+	for _, h := range hooks {
+		if msg.Severity <= h.severity {
+			r.runHook(h.fn, msg)
+		}
+	}
+}
+
+//runHook invokes a single hook and recovers from a panic raised by it
+//Arguments: [fn] hook callback. [msg] message to pass to the hook
+func (r *Instance) runHook(fn func(*common.RlogMsg), msg *common.RlogMsg) {
+	defer func() {
+		if err := recover(); err != nil {
+			// Do not log hook failures using RightLog4Go because it would create a feedback loop
+			r.internalf("[RightLog4Go] Log hook panicked: %v", err)
+		}
+	}()
+	fn(msg)
+}
@@ -0,0 +1,69 @@
+/*
+These tests cover:
+- Invocation of hooks according to their severity
+- Recovery from panicking hooks
+- Hooks registering further hooks
+*/
+package rlog
+
+import (
+	"container/list"
+	"github.com/rightscale/rlog/common"
+	. "launchpad.net/gocheck"
+	"time"
+)
+
+//When logging, it should invoke the hooks accepting the message severity before reaching the modules
+func (s *Initialized) TestHooks(t *C) {
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	var errors, all []string
+	AddHook(SeverityError, func(msg *common.RlogMsg) { errors = append(errors, msg.Msg) })
+	AddHook(SeverityTrace, func(msg *common.RlogMsg) { all = append(all, msg.Msg) })
+
+	Error("error message")
+	Info("info message")
+	t.Assert(errors, HasLen, 1)
+	t.Assert(errors[0], Matches, ".*error message")
+	t.Assert(all, HasLen, 2)
+
+	//Hooks receive messages filtered by all modules
+	Trace("trace message")
+	t.Assert(all, HasLen, 3)
+	t.Assert(nonBlockingChanRead(myChan), NotNil)
+	t.Assert(nonBlockingChanRead(myChan), NotNil)
+	t.Assert(nonBlockingChanRead(myChan), IsNil)
+}
+
+//When a hook panics, it should not prevent other hooks and modules from receiving the message
+func (s *Initialized) TestPanickingHook(t *C) {
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	called := false
+	AddHook(SeverityInfo, func(msg *common.RlogMsg) { panic("hook failure") })
+	AddHook(SeverityInfo, func(msg *common.RlogMsg) { called = true })
+
+	Info("info message")
+	t.Assert(called, Equals, true)
+	t.Assert(nonBlockingChanRead(myChan), NotNil)
+}
+
+//When a hook registers another hook, it should not deadlock and the new hook should see later messages
+func (s *Initialized) TestHookAddingHook(t *C) {
+	std.msgChannels = list.New()
+
+	var added []string
+	AddHook(SeverityInfo, func(msg *common.RlogMsg) {
+		if len(added) == 0 {
+			AddHook(SeverityInfo, func(msg *common.RlogMsg) { added = append(added, msg.Msg) })
+			added = append(added, "registered")
+		}
+	})
+
+	t.Assert(returnsWithin(func() { Info("first") }, 5*time.Second), Equals, true)
+	Info("second")
+	t.Assert(added, HasLen, 2)
+	t.Assert(added[1], Matches, ".*second")
+}
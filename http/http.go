@@ -0,0 +1,274 @@
+/*
+Package http implements an output module posting log messages to a webhook (e.g. Slack, PagerDuty)
+using rlog. It is meant for alerting on severe messages rather than as the primary log sink.
+*/
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/rightscale/rlog/common"
+	"log"
+	nethttp "net/http"
+	"time"
+)
+
+//Configuration of webhook logging module
+type webhookLogger struct {
+	common.ModuleSeverity
+	url           string            // webhook receiving the messages
+	client        *nethttp.Client   // client used to post the batches
+	batchSize     int               // max messages per request
+	batchInterval time.Duration     // max time a message waits for its batch to fill up
+	retries       int               // attempts per batch after the first one failed
+	backoff       time.Duration     // wait time before the first retry, doubled for each retry
+	batch         []*common.RlogMsg // messages waiting to be posted
+	deliveries    chan delivery     // batches and flush commands for the sender, nil unless launched
+	deliveryErr   error             // first delivery failure since the last flush, reported by the next flush
+}
+
+//delivery is either a batch to post or a flush command, handled in order by the sender goroutine
+type delivery struct {
+	body    []byte                    // JSON encoded batch, nil for a flush command
+	n       int                       // number of messages in the batch
+	flushed int                       // number of messages flushed, reported with the ACK of a flush command
+	ret     chan (common.FlushResult) // channel receiving the ACK of a flush command, nil for a batch
+}
+
+//Defaults of the webhook logger
+const (
+	defaultBatchSize     = 20
+	defaultBatchInterval = time.Second
+	defaultRetries       = 3
+	defaultBackoff       = 500 * time.Millisecond
+	defaultTimeout       = 10 * time.Second
+	deliveryQueue        = 16 // batches waiting for the sender before the module stops reading messages
+)
+
+//NewWebhookLogger enables posting log messages of minSeverity or more severe to a webhook. The
+//severity overrides the global rlog severity for this module, see WithSeverity. Messages are posted in
+//batches as JSON array of objects in the format of common.FormatMessageJSON. A batch is posted once it
+//is full, when it is older than the batch interval or when rlog is flushed. Failed requests (network
+//errors or non-2xx responses) are retried with exponential backoff by a separate goroutine, so the
+//module keeps receiving messages meanwhile. A batch still failing after the retry budget is dropped.
+//Returns: instance of webhook logger module
+func NewWebhookLogger(url string, minSeverity common.RlogSeverity) *webhookLogger {
+	conf := new(webhookLogger)
+	conf.url = url
+	conf.SetSeverity(minSeverity)
+	conf.client = &nethttp.Client{Timeout: defaultTimeout}
+	conf.batchSize = defaultBatchSize
+	conf.batchInterval = defaultBatchInterval
+	conf.retries = defaultRetries
+	conf.backoff = defaultBackoff
+	return conf
+}
+
+//Name names the module for rlog diagnostics and statistics
+func (conf *webhookLogger) Name() string {
+	return "http:" + conf.url
+}
+
+//WithBatching sets the max number of messages per request and the max time a message waits for its
+//batch to fill up. Returns the webhook logger to allow chaining with the constructor.
+func (conf *webhookLogger) WithBatching(size int, interval time.Duration) *webhookLogger {
+	if size < 1 {
+		size = 1
+	}
+	conf.batchSize = size
+	conf.batchInterval = interval
+	return conf
+}
+
+//WithRetries sets the number of attempts after a failed request and the wait time before the first
+//retry, which is doubled for each further retry. Returns the webhook logger to allow chaining with the
+//constructor.
+func (conf *webhookLogger) WithRetries(retries int, backoff time.Duration) *webhookLogger {
+	conf.retries = retries
+	conf.backoff = backoff
+	return conf
+}
+
+//WithClient replaces the HTTP client, e.g. to configure TLS or a proxy. Returns the webhook logger to
+//allow chaining with the constructor.
+func (conf *webhookLogger) WithClient(client *nethttp.Client) *webhookLogger {
+	conf.client = client
+	return conf
+}
+
+//WithSeverity sets a severity threshold for this module overriding the global rlog severity.
+//Returns the webhook logger to allow chaining with the constructor.
+func (conf *webhookLogger) WithSeverity(severity common.RlogSeverity) *webhookLogger {
+	conf.SetSeverity(severity)
+	return conf
+}
+
+//LaunchModule is intended to run in a separate goroutine and used by rlog internally. It batches log
+//messages and hands the batches to a sender goroutine posting them to the webhook. A flush is
+//acknowledged by the sender once the batches before it have been posted. Arguments: [dataChan] Channel
+//to receive log messages. [flushChan] Channel to receive flush command
+func (conf *webhookLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
+
+	conf.deliveries = make(chan delivery, deliveryQueue)
+	senderDone := make(chan struct{})
+	go conf.send(senderDone)
+
+	//Post incomplete batches periodically, a nil channel never fires
+	var tick <-chan time.Time
+	if conf.batchInterval > 0 {
+		ticker := time.NewTicker(conf.batchInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	//Wait forever on data and flush channel
+	for {
+		select {
+		case logMsg := <-dataChan:
+			//Received log message, add it to the batch
+			conf.add(logMsg)
+		case ret, ok := <-flushChan:
+			if !ok {
+				//Flush channel closed by rlog: post pending messages and exit once the sender is done
+				conf.flush(dataChan)
+				close(conf.deliveries)
+				<-senderDone
+				return
+			}
+			//Flush, the sender returns the number of messages posted and the delivery failures
+			conf.deliveries <- delivery{flushed: conf.flush(dataChan), ret: ret}
+		case <-tick:
+			//Post the messages waiting for their batch to fill up
+			conf.postBatch()
+		}
+	}
+}
+
+//WriteSync adds a log message to the batch when rlog runs in synchronous mode (see
+//rlog.RlogConfig.Synchronous). The batch is posted once full or on flush, there is no batch interval.
+//Arguments: [rawRlogMsg] log message. [prefix] log prefix (unused)
+func (conf *webhookLogger) WriteSync(rawRlogMsg *common.RlogMsg, prefix string) {
+	conf.add(rawRlogMsg)
+}
+
+//FlushSync posts the pending batch when rlog runs in synchronous mode
+func (conf *webhookLogger) FlushSync() {
+	conf.postBatch()
+}
+
+//send runs in a separate goroutine started by LaunchModule. It posts the batches in order and
+//acknowledges the flush commands, until the delivery queue is closed.
+//Arguments: channel closed when the sender exits
+func (conf *webhookLogger) send(done chan struct{}) {
+	defer close(done)
+	for d := range conf.deliveries {
+		if d.ret == nil {
+			conf.deliver(d.body, d.n)
+			continue
+		}
+		err := conf.deliveryErr
+		conf.deliveryErr = nil
+		d.ret <- common.FlushResult{Flushed: d.flushed, Err: err}
+	}
+}
+
+//add adds a message to the batch and posts the batch once it is full
+func (conf *webhookLogger) add(rawRlogMsg *common.RlogMsg) {
+	conf.batch = append(conf.batch, rawRlogMsg)
+	if len(conf.batch) >= conf.batchSize {
+		conf.postBatch()
+	}
+}
+
+//flush posts all pending log messages
+//Arguments:[dataChan] data channel to access all pending messages
+//Returns: number of messages posted, including those waiting for their batch to fill up
+func (conf *webhookLogger) flush(dataChan <-chan (*common.RlogMsg)) int {
+	flushed := len(conf.batch)
+	for {
+		//Perform non blocking read until the channel is empty
+		select {
+		case logMsg := <-dataChan:
+			conf.add(logMsg)
+			flushed++
+		default:
+			conf.postBatch()
+			return flushed
+		}
+	}
+}
+
+//postBatch hands the batch to the sender goroutine, or posts it right away in synchronous mode
+func (conf *webhookLogger) postBatch() {
+	if len(conf.batch) == 0 {
+		return
+	}
+
+	body := encodeBatch(conf.batch)
+	n := len(conf.batch)
+	conf.batch = conf.batch[:0]
+
+	if conf.deliveries != nil {
+		conf.deliveries <- delivery{body: body, n: n}
+		return
+	}
+	conf.deliver(body, n)
+}
+
+//deliver posts a batch to the webhook, retrying failed requests with exponential backoff. A batch failing
+//after the retry budget is dropped and the failure is kept for the next flush.
+//Arguments: [body] JSON encoded batch. [n] number of messages in the batch
+func (conf *webhookLogger) deliver(body []byte, n int) {
+	backoff := conf.backoff
+	err := conf.post(body)
+	for i := 0; err != nil && i < conf.retries; i++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		err = conf.post(body)
+	}
+	if err != nil {
+		// Do not log delivery failures using RightLog4Go because it would create a feedback loop
+		log.Printf("[RightLog4Go] webhook %s failed, dropped %d message(s): %s", conf.url, n, err.Error())
+		if conf.deliveryErr == nil {
+			conf.deliveryErr = fmt.Errorf("dropped %d message(s): %s", n, err.Error())
+		}
+	}
+}
+
+//post sends a single request to the webhook
+//Returns: error if the request failed or the response status is not 2xx
+func (conf *webhookLogger) post(body []byte) error {
+	resp, err := conf.client.Post(conf.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+//encodeBatch creates the request body, a JSON array of messages
+//Returns: JSON encoded batch
+func encodeBatch(batch []*common.RlogMsg) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, rawRlogMsg := range batch {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		msg := common.FormatMessageJSON(rawRlogMsg, "")
+		if !json.Valid([]byte(msg)) {
+			// the message fell back to text because of a field not supported by JSON, send it
+			// as string rather than breaking the entire batch.
+			quoted, _ := json.Marshal(msg)
+			msg = string(quoted)
+		}
+		buf.WriteString(msg)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
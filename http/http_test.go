@@ -0,0 +1,181 @@
+/*
+These tests cover:
+- Batching of messages and the request body
+- Retries of failed requests and the report of dropped batches
+- Receiving messages while a batch is being retried
+- The flush protocol
+*/
+package http
+
+import (
+	"encoding/json"
+	"github.com/rightscale/rlog"
+	"github.com/rightscale/rlog/common"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	nethttp "net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+//Hook this testing framework into go test
+func Test(t *testing.T) { TestingT(t) }
+
+type WebhookSuite struct{}
+
+var _ = Suite(&WebhookSuite{})
+
+//fakeWebhook records the posted batches and responds with the queued status codes before succeeding
+type fakeWebhook struct {
+	mutex    sync.Mutex
+	batches  [][]map[string]interface{}
+	statuses []int         // status codes sent before succeeding again
+	release  chan struct{} // blocks the requests until closed, nil to respond right away
+	server   *httptest.Server
+}
+
+func newFakeWebhook() *fakeWebhook {
+	f := new(fakeWebhook)
+	f.server = httptest.NewServer(nethttp.HandlerFunc(f.serve))
+	return f
+}
+
+func (f *fakeWebhook) serve(w nethttp.ResponseWriter, r *nethttp.Request) {
+	if f.release != nil {
+		<-f.release
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var batch []map[string]interface{}
+	body, _ := ioutil.ReadAll(r.Body)
+	json.Unmarshal(body, &batch)
+	f.batches = append(f.batches, batch)
+
+	if len(f.statuses) > 0 {
+		w.WriteHeader(f.statuses[0])
+		f.statuses = f.statuses[1:]
+	}
+}
+
+func (f *fakeWebhook) received() [][]map[string]interface{} {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([][]map[string]interface{}(nil), f.batches...)
+}
+
+//launch runs the module until the returned function closes the flush channel and waits for it to exit
+func launch(logger *webhookLogger, dataChan chan *common.RlogMsg, flushChan chan chan common.FlushResult) func() {
+	done := make(chan struct{})
+	go func() {
+		logger.LaunchModule(dataChan, flushChan)
+		close(done)
+	}()
+	return func() {
+		close(flushChan)
+		<-done
+	}
+}
+
+//flush sends a flush command to the module and waits for the ACK
+func flush(c *C, flushChan chan chan common.FlushResult) common.FlushResult {
+	ret := make(chan common.FlushResult, 1)
+	flushChan <- ret
+	select {
+	case res := <-ret:
+		return res
+	case <-time.After(5 * time.Second):
+		c.Fatal("flush command ACK timed out")
+	}
+	return common.FlushResult{}
+}
+
+//When messages are logged, they should be posted as JSON arrays once the batch is full or on flush
+func (s *WebhookSuite) TestBatches(c *C) {
+	f := newFakeWebhook()
+	defer f.server.Close()
+	logger := NewWebhookLogger(f.server.URL, rlog.SeverityError).WithBatching(2, 0)
+
+	dataChan := make(chan *common.RlogMsg, 10)
+	flushChan := make(chan chan common.FlushResult, 1)
+	stop := launch(logger, dataChan, flushChan)
+	for _, msg := range []string{"one", "two", "three"} {
+		dataChan <- &common.RlogMsg{Msg: msg, Severity: rlog.SeverityError}
+	}
+	//The module may post the full batch before reading the flush command
+	res := flush(c, flushChan)
+	c.Assert(res.Err, IsNil)
+	c.Assert(res.Flushed >= 1, Equals, true)
+
+	batches := f.received()
+	c.Assert(batches, HasLen, 2)
+	c.Assert(batches[0], HasLen, 2)
+	c.Assert(batches[0][0]["message"], Equals, "one")
+	c.Assert(batches[1], HasLen, 1)
+	c.Assert(batches[1][0]["message"], Equals, "three")
+
+	//Closing the flush channel posts the rest and ends the module
+	dataChan <- &common.RlogMsg{Msg: "four", Severity: rlog.SeverityError}
+	stop()
+	c.Assert(f.received(), HasLen, 3)
+}
+
+//When creating the module, the severity should be the module severity threshold
+func (s *WebhookSuite) TestSeverity(c *C) {
+	severity, ok := NewWebhookLogger("http://localhost", rlog.SeverityWarning).Severity()
+	c.Assert(severity, Equals, rlog.SeverityWarning)
+	c.Assert(ok, Equals, true)
+}
+
+//When a request fails, it should be retried and a batch failing after the retry budget should be reported
+func (s *WebhookSuite) TestRetries(c *C) {
+	f := newFakeWebhook()
+	defer f.server.Close()
+	f.statuses = []int{nethttp.StatusServiceUnavailable, nethttp.StatusInternalServerError}
+	logger := NewWebhookLogger(f.server.URL, rlog.SeverityError).WithBatching(10, 0).WithRetries(2, time.Millisecond)
+
+	dataChan := make(chan *common.RlogMsg, 10)
+	flushChan := make(chan chan common.FlushResult, 1)
+	defer launch(logger, dataChan, flushChan)()
+
+	dataChan <- &common.RlogMsg{Msg: "retried", Severity: rlog.SeverityError}
+	c.Assert(flush(c, flushChan), Equals, common.FlushResult{Flushed: 1})
+	c.Assert(f.received(), HasLen, 3)
+
+	f.mutex.Lock()
+	f.statuses = []int{500, 500, 500}
+	f.mutex.Unlock()
+	dataChan <- &common.RlogMsg{Msg: "dropped", Severity: rlog.SeverityError}
+	res := flush(c, flushChan)
+	c.Assert(res.Flushed, Equals, 1)
+	c.Assert(res.Err, ErrorMatches, "dropped 1 message\\(s\\): unexpected response status 500 Internal Server Error")
+	c.Assert(f.received(), HasLen, 6)
+
+	//The failure is reported once
+	c.Assert(flush(c, flushChan), Equals, common.FlushResult{})
+}
+
+//When a batch is being posted, the module should keep receiving messages
+func (s *WebhookSuite) TestReceiveWhilePosting(c *C) {
+	f := newFakeWebhook()
+	defer f.server.Close()
+	f.release = make(chan struct{})
+	logger := NewWebhookLogger(f.server.URL, rlog.SeverityError).WithBatching(1, 0)
+
+	dataChan := make(chan *common.RlogMsg)
+	flushChan := make(chan chan common.FlushResult, 1)
+	defer launch(logger, dataChan, flushChan)()
+
+	for i := 0; i < 5; i++ {
+		select {
+		case dataChan <- &common.RlogMsg{Msg: "msg", Severity: rlog.SeverityError}:
+		case <-time.After(5 * time.Second):
+			c.Fatal("module stopped receiving messages while posting")
+		}
+	}
+	close(f.release)
+	c.Assert(flush(c, flushChan), Equals, common.FlushResult{})
+	c.Assert(f.received(), HasLen, 5)
+}
@@ -0,0 +1,250 @@
+/*
+Package journald implements an output module sending native journal entries to systemd-journald using
+rlog. In contrast to the syslog module, structured fields are kept as separate journal fields.
+*/
+package journald
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/rightscale/rlog/common"
+	"log"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+//Configuration of journald logging module
+type journaldLogger struct {
+	common.ModuleSeverity
+	socketPath string        // path of the journal socket
+	identifier string        // SYSLOG_IDENTIFIER of all entries
+	conn       *net.UnixConn // datagram connection to the journal
+	buf        bytes.Buffer  // entry being serialized, reused for each message
+}
+
+//defaultSocketPath is the socket journald receives native entries on
+const defaultSocketPath = "/run/systemd/journal/socket"
+
+//reservedFields are the journal fields written by the module or interpreted by the journal, structured
+//fields of the same name are prefixed to not override them
+var reservedFields = map[string]bool{
+	"MESSAGE":            true,
+	"MESSAGE_ID":         true,
+	"PRIORITY":           true,
+	"SYSLOG_IDENTIFIER":  true,
+	"SYSLOG_FACILITY":    true,
+	"SYSLOG_PID":         true,
+	"SYSLOG_TIMESTAMP":   true,
+	"CODE_FILE":          true,
+	"CODE_LINE":          true,
+	"CODE_FUNC":          true,
+	"STACK_TRACE":        true,
+	"ERRNO":              true,
+	"INVOCATION_ID":      true,
+	"USER_INVOCATION_ID": true,
+	"DOCUMENTATION":      true,
+	"TID":                true,
+}
+
+//NewJournaldLogger enables logging to the local systemd-journald. Each message is sent as a journal
+//entry with MESSAGE, PRIORITY, SYSLOG_IDENTIFIER (the process name), CODE_FILE, CODE_LINE and CODE_FUNC
+//if position info is included, STACK_TRACE if present and the structured fields of the message as
+//uppercase journal fields (e.g. "request_id" becomes REQUEST_ID). Structured fields named like a field
+//the module writes or the journal interprets get an "F_" prefix (e.g. "message" becomes F_MESSAGE).
+//Entries too large for a datagram are passed to the journal as sealed memory file.
+//Returns: instance of journald logger module in case of success, error if the journal socket is absent
+func NewJournaldLogger() (*journaldLogger, error) {
+	return NewJournaldLoggerWithSocket(defaultSocketPath)
+}
+
+//MustNewJournaldLogger enables logging to systemd-journald like NewJournaldLogger but panics if the
+//journal socket is absent, for concise setup in main
+func MustNewJournaldLogger() *journaldLogger {
+	conf, err := NewJournaldLogger()
+	if err != nil {
+		panic(err)
+	}
+	return conf
+}
+
+//NewJournaldLoggerWithSocket enables logging to systemd-journald like NewJournaldLogger but uses the
+//given journal socket, e.g. when it is mounted to a different path in a container.
+//Returns: instance of journald logger module in case of success, error if the socket is absent
+func NewJournaldLoggerWithSocket(socketPath string) (*journaldLogger, error) {
+	conf := new(journaldLogger)
+	conf.socketPath = socketPath
+	conf.identifier = path.Base(os.Args[0])
+	err := conf.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+//Name names the module for rlog diagnostics and statistics
+func (conf *journaldLogger) Name() string {
+	return "journald"
+}
+
+//WithIdentifier sets the SYSLOG_IDENTIFIER of the entries, the process name is used by default.
+//Returns the journald logger to allow chaining with the constructor.
+func (conf *journaldLogger) WithIdentifier(identifier string) *journaldLogger {
+	conf.identifier = identifier
+	return conf
+}
+
+//WithSeverity sets a severity threshold for this module overriding the global rlog severity.
+//Returns the journald logger to allow chaining with the constructor.
+func (conf *journaldLogger) WithSeverity(severity common.RlogSeverity) *journaldLogger {
+	conf.SetSeverity(severity)
+	return conf
+}
+
+//LaunchModule is intended to run in a separate goroutine and used by rlog internally. It sends log
+//messages to the journal. Arguments: [dataChan] Channel to receive log messages. [flushChan]
+//Channel to receive flush command
+func (conf *journaldLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
+
+	//Wait forever on data and flush channel
+	for {
+		select {
+		case logMsg := <-dataChan:
+			//Received log message, send it
+			conf.WriteSync(logMsg, "")
+		case ret, ok := <-flushChan:
+			if !ok {
+				//Flush channel closed by rlog: write pending messages and exit
+				conf.flush(dataChan)
+				conf.conn.Close()
+				return
+			}
+			//Flush and return the number of messages sent
+			ret <- common.FlushResult{Flushed: conf.flush(dataChan)}
+		}
+	}
+}
+
+//WriteSync sends a log message to the journal. It is used by LaunchModule and by rlog directly when
+//running in synchronous mode (see rlog.RlogConfig.Synchronous). The journal adds its own timestamp
+//and process information, the prefix is not used.
+//Arguments: [rawRlogMsg] log message. [prefix] log prefix
+func (conf *journaldLogger) WriteSync(rawRlogMsg *common.RlogMsg, prefix string) {
+	entry := conf.serialize(rawRlogMsg)
+	_, err := conf.conn.Write(entry)
+	if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+		// the entry exceeds the max datagram size, pass it as file descriptor instead.
+		err = sendMemfd(conf.conn, entry)
+	}
+	if err != nil {
+		// there is no way to recover from other failures.
+		log.Printf("[RightLog4Go] journal write to %s failed, message dropped: %s", conf.socketPath, err.Error())
+	}
+}
+
+//FlushSync does nothing as entries are sent right away. Used when rlog runs in synchronous mode.
+func (conf *journaldLogger) FlushSync() {
+}
+
+//flush sends all pending log messages to the journal
+//Arguments: data channel to access all pending messages
+//Returns: number of messages sent
+func (conf *journaldLogger) flush(dataChan <-chan (*common.RlogMsg)) int {
+	flushed := 0
+	for {
+		//Perform non blocking read until the channel is empty
+		select {
+		case logMsg := <-dataChan:
+			conf.WriteSync(logMsg, "")
+			flushed++
+		default:
+			return flushed
+		}
+	}
+}
+
+//serialize creates a journal entry in the native protocol
+//Returns: entry ready to send, valid until the next call
+func (conf *journaldLogger) serialize(rawRlogMsg *common.RlogMsg) []byte {
+	conf.buf.Reset()
+	writeField(&conf.buf, "MESSAGE", rawRlogMsg.Msg)
+	writeField(&conf.buf, "PRIORITY", strconv.Itoa(common.SyslogPriority(rawRlogMsg.Severity)))
+	writeField(&conf.buf, "SYSLOG_IDENTIFIER", conf.identifier)
+	if rawRlogMsg.File != "" {
+		writeField(&conf.buf, "CODE_FILE", rawRlogMsg.File)
+		writeField(&conf.buf, "CODE_LINE", strconv.Itoa(rawRlogMsg.Line))
+	}
+	if rawRlogMsg.Func != "" {
+		writeField(&conf.buf, "CODE_FUNC", rawRlogMsg.Func)
+	}
+	if rawRlogMsg.StackTrace != "" {
+		writeField(&conf.buf, "STACK_TRACE", rawRlogMsg.StackTrace)
+	}
+	for k, v := range rawRlogMsg.Fields {
+		writeField(&conf.buf, fieldName(k), fmt.Sprint(v))
+	}
+	return conf.buf.Bytes()
+}
+
+//writeField appends a field to a journal entry. Values containing newlines are written in the binary
+//format, i.e. the name is followed by a newline, the value size as little endian 64 bit integer and
+//the value.
+//Arguments: [buf] entry. [name] valid journal field name. [value] field value
+func writeField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if strings.ContainsRune(value, '\n') {
+		buf.WriteByte('\n')
+		binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	} else {
+		buf.WriteByte('=')
+	}
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+//fieldName converts the key of a structured field to a journal field name, which consists of
+//uppercase letters, digits and underscores only, starts with a letter and has at most 64 characters.
+//Names of reserved fields are prefixed with "F_".
+//Returns: journal field name
+func fieldName(key string) string {
+	name := []byte(strings.ToUpper(key))
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			name[i] = '_'
+		}
+	}
+
+	res := string(name)
+	if res == "" || !(res[0] >= 'A' && res[0] <= 'Z') {
+		// names starting with an underscore are reserved for trusted fields set by the journal.
+		res = "F" + res
+	} else if reservedFields[res] {
+		res = "F_" + res
+	}
+	if len(res) > 64 {
+		res = res[:64]
+	}
+	return res
+}
+
+// connects to the journal socket.
+func (conf *journaldLogger) connect() error {
+	_, err := os.Stat(conf.socketPath)
+	if err != nil {
+		return fmt.Errorf("rlog journald: journal socket not available: %s", err.Error())
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: conf.socketPath, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+
+	conf.conn = conn
+	return nil
+}
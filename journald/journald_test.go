@@ -0,0 +1,101 @@
+//go:build linux
+// +build linux
+
+/*
+These tests cover:
+- Serialization of entries in the native protocol
+- Structured fields colliding with the fields of the module or the journal
+- Entries too large for a datagram passed as memory file
+*/
+package journald
+
+import (
+	"github.com/rightscale/rlog"
+	"github.com/rightscale/rlog/common"
+	"golang.org/x/sys/unix"
+	"io/ioutil"
+	. "launchpad.net/gocheck"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+//Hook this testing framework into go test
+func Test(t *testing.T) { TestingT(t) }
+
+type JournaldSuite struct{}
+
+var _ = Suite(&JournaldSuite{})
+
+//fakeJournal listens on a datagram socket like systemd-journald
+func fakeJournal(c *C) (*net.UnixConn, string) {
+	path := filepath.Join(c.MkDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	c.Assert(err, IsNil)
+	return conn, path
+}
+
+//When a structured field is named like a field of the module or the journal, it should be prefixed
+func (s *JournaldSuite) TestFieldNames(c *C) {
+	c.Assert(fieldName("request_id"), Equals, "REQUEST_ID")
+	c.Assert(fieldName("_hidden"), Equals, "F_HIDDEN")
+	c.Assert(fieldName("message"), Equals, "F_MESSAGE")
+	c.Assert(fieldName("Priority"), Equals, "F_PRIORITY")
+	c.Assert(fieldName("syslog-identifier"), Equals, "F_SYSLOG_IDENTIFIER")
+	c.Assert(fieldName(strings.Repeat("a", 70)), HasLen, 64)
+
+	conf := &journaldLogger{identifier: "app"}
+	entry := string(conf.serialize(&common.RlogMsg{
+		Msg:      "hello",
+		Severity: rlog.SeverityError,
+		Fields:   map[string]interface{}{"message": "user", "multi": "a\nb"},
+	}))
+	c.Assert(strings.HasPrefix(entry, "MESSAGE=hello\nPRIORITY=3\nSYSLOG_IDENTIFIER=app\n"), Equals, true)
+	c.Assert(strings.Contains(entry, "F_MESSAGE=user\n"), Equals, true)
+	c.Assert(strings.Contains(entry, "MULTI\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n"), Equals, true)
+}
+
+//When an entry is too large for a datagram, it should be passed as sealed memory file
+func (s *JournaldSuite) TestLargeEntry(c *C) {
+	journal, path := fakeJournal(c)
+	defer journal.Close()
+	conf, err := NewJournaldLoggerWithSocket(path)
+	c.Assert(err, IsNil)
+	defer conf.conn.Close()
+
+	conf.WriteSync(&common.RlogMsg{Msg: "small", Severity: rlog.SeverityInfo}, "")
+	buf := make([]byte, 4096)
+	oob := make([]byte, 64)
+	journal.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, oobn, _, _, err := journal.ReadMsgUnix(buf, oob)
+	c.Assert(err, IsNil)
+	c.Assert(oobn, Equals, 0)
+	c.Assert(strings.HasPrefix(string(buf[:n]), "MESSAGE=small\n"), Equals, true)
+
+	large := strings.Repeat("x", 4<<20)
+	conf.WriteSync(&common.RlogMsg{Msg: large, Severity: rlog.SeverityInfo}, "")
+	n, oobn, _, _, err = journal.ReadMsgUnix(buf, oob)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	c.Assert(err, IsNil)
+	c.Assert(msgs, HasLen, 1)
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	c.Assert(err, IsNil)
+	c.Assert(fds, HasLen, 1)
+	f := os.NewFile(uintptr(fds[0]), "entry")
+	defer f.Close()
+	seals, err := unix.FcntlInt(f.Fd(), unix.F_GET_SEALS, 0)
+	c.Assert(err, IsNil)
+	c.Assert(seals&unix.F_SEAL_WRITE, Not(Equals), 0)
+
+	f.Seek(0, 0)
+	entry, err := ioutil.ReadAll(f)
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasPrefix(string(entry), "MESSAGE="+large+"\nPRIORITY=6\n"), Equals, true)
+}
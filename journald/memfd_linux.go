@@ -0,0 +1,46 @@
+//go:build linux
+// +build linux
+
+package journald
+
+import (
+	"golang.org/x/sys/unix"
+	"net"
+	"os"
+)
+
+//sendMemfd passes an entry too large for a datagram to the journal as a sealed memory file, which is
+//the fallback of the native protocol for large entries
+//Arguments: [conn] connection to the journal. [entry] serialized entry
+//Returns: error if the memory file cannot be created or sent
+func sendMemfd(conn *net.UnixConn, entry []byte) error {
+	fd, err := unix.MemfdCreate("journal-entry", unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return err
+	}
+	f := os.NewFile(uintptr(fd), "journal-entry")
+	defer f.Close()
+
+	if _, err = f.Write(entry); err != nil {
+		return err
+	}
+	//The journal only maps sealed files, a sender must not modify the entry while it is being read
+	_, err = unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE|unix.F_SEAL_SEAL)
+	if err != nil {
+		return err
+	}
+	//The connection is connected, which rules out WriteMsgUnix, send the descriptor on the socket itself
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := unix.UnixRights(int(f.Fd()))
+	werr := raw.Write(func(s uintptr) bool {
+		err = unix.Sendmsg(int(s), nil, rights, nil, 0)
+		return err != unix.EAGAIN
+	})
+	if werr != nil {
+		return werr
+	}
+	return err
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package journald
+
+import (
+	"errors"
+	"net"
+)
+
+//sendMemfd is not supported outside Linux, systemd-journald does not exist there
+//Returns: error in any case
+func sendMemfd(conn *net.UnixConn, entry []byte) error {
+	return errors.New("memory files are only supported on Linux")
+}
@@ -0,0 +1,168 @@
+/*
+Implements a logger keeping the most recent log messages in memory, e.g. to attach them to crash reports.
+*/
+package memory
+
+import (
+	"bytes"
+	"github.com/rightscale/rlog/common"
+	"sync"
+)
+
+// Ring logger (fields are private).
+type ringLogger struct {
+	common.ModuleSeverity
+	mutex     sync.Mutex        // guards the buffer, Dump may be called from any goroutine
+	messages  []*common.RlogMsg // circular buffer of messages
+	next      int               // index of the slot receiving the next message
+	full      bool              // true once the buffer wrapped around
+	formatter common.Formatter  // creates the text of DumpString for each message
+}
+
+// Creates a logger keeping the most recent log messages in memory.
+//
+// capacity: max number of messages kept, older messages are discarded (at least 1)
+//
+// return: instance of ring logger
+func NewRingLogger(capacity int) *ringLogger {
+	if capacity < 1 {
+		capacity = 1
+	}
+	logger := new(ringLogger)
+	logger.messages = make([]*common.RlogMsg, capacity)
+	logger.formatter = common.DefaultFormatter{}
+	return logger
+}
+
+// Names the module for rlog diagnostics and statistics.
+//
+// return: "memory"
+func (conf *ringLogger) Name() string {
+	return "memory"
+}
+
+// Sets a severity threshold for this module overriding the global rlog severity.
+//
+// severity: most verbose severity kept by this module
+//
+// return: the ring logger to allow chaining with the constructor
+func (conf *ringLogger) WithSeverity(severity common.RlogSeverity) *ringLogger {
+	conf.SetSeverity(severity)
+	return conf
+}
+
+// Selects a custom formatter creating the text of DumpString for each message.
+//
+// formatter: formatter to use instead of the plain text format
+//
+// return: the ring logger to allow chaining with the constructor
+func (conf *ringLogger) WithFormatter(formatter common.Formatter) *ringLogger {
+	conf.formatter = formatter
+	return conf
+}
+
+// Retrieves the messages kept in memory. Call rlog.Flush() first to include messages still on their way
+// to the module.
+//
+// return: messages ordered from oldest to most recent
+func (conf *ringLogger) Dump() []*common.RlogMsg {
+	conf.mutex.Lock()
+	defer conf.mutex.Unlock()
+
+	if !conf.full {
+		res := make([]*common.RlogMsg, conf.next)
+		copy(res, conf.messages[:conf.next])
+		return res
+	}
+
+	res := make([]*common.RlogMsg, 0, len(conf.messages))
+	res = append(res, conf.messages[conf.next:]...)
+	res = append(res, conf.messages[:conf.next]...)
+	return res
+}
+
+// Retrieves the messages kept in memory formatted as text, one message per line.
+//
+// return: messages ordered from oldest to most recent
+func (conf *ringLogger) DumpString() string {
+	prefix := common.SyslogHeader()
+
+	var buf bytes.Buffer
+	for _, msg := range conf.Dump() {
+		buf.WriteString(conf.formatter.Format(msg, prefix))
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// Intended to run in a separate goroutine. It stores log messages in the ring buffer.
+//
+// dataChan: receives log messages.
+//
+// flushChan: receives flush command.
+func (conf *ringLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
+
+	// wait forever on data and flush channel
+	for {
+		select {
+		case logMsg := <-dataChan:
+			// received log message, store it
+			conf.store(logMsg)
+		case ret, ok := <-flushChan:
+			if !ok {
+				// flush channel closed by rlog: write pending messages and exit
+				conf.flush(dataChan)
+				return
+			}
+			// flush and return the number of messages stored
+			ret <- common.FlushResult{Flushed: conf.flush(dataChan)}
+		}
+	}
+}
+
+// Stores a log message when rlog runs in synchronous mode, see rlog.RlogConfig.Synchronous.
+//
+// rawRlogMsg: log message to store.
+//
+// prefix: log prefix (unused)
+func (conf *ringLogger) WriteSync(rawRlogMsg *common.RlogMsg, prefix string) {
+	conf.store(rawRlogMsg)
+}
+
+// Does nothing as messages are stored right away. Used when rlog runs in synchronous mode.
+func (conf *ringLogger) FlushSync() {
+}
+
+// Stores the message, replacing the oldest message once the buffer is full.
+//
+// rawRlogMsg: log message received from channel.
+func (conf *ringLogger) store(rawRlogMsg *common.RlogMsg) {
+	conf.mutex.Lock()
+	defer conf.mutex.Unlock()
+
+	conf.messages[conf.next] = rawRlogMsg
+	conf.next++
+	if conf.next == len(conf.messages) {
+		conf.next = 0
+		conf.full = true
+	}
+}
+
+// Stores pending messages.
+//
+// dataChan: data channel to access all pending messages
+//
+// return: number of messages stored
+func (conf *ringLogger) flush(dataChan <-chan (*common.RlogMsg)) int {
+	flushed := 0
+	for {
+		// perform non blocking read until the channel is empty
+		select {
+		case logMsg := <-dataChan:
+			conf.store(logMsg)
+			flushed++
+		default:
+			return flushed
+		}
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Package metrics implements an output module exporting rlog counters as Prometheus metrics. It counts
+the messages it receives by severity (rlog_messages_total) and reports the messages rlog dropped because
+a module could not keep up (rlog_dropped_total, see rlog.Stats). The Prometheus dependency is confined
+to this package.
+*/
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rightscale/rlog"
+	"github.com/rightscale/rlog/common"
+)
+
+//Configuration of metrics module
+type metricsModule struct {
+	common.ModuleSeverity
+	messages *prometheus.CounterVec // messages received by severity
+	dropped  prometheus.CounterFunc // messages dropped by rlog, read from the stats on collection
+}
+
+//NewMetricsModule creates a module counting the log messages of the rlog singleton. Enable it like any
+//other module and register it with a Prometheus registry, e.g. prometheus.MustRegister(module). Only
+//messages passing the severity threshold of the module are counted.
+//Returns: instance of metrics module
+func NewMetricsModule() *metricsModule {
+	return NewMetricsModuleWithStats(rlog.Stats)
+}
+
+//NewMetricsModuleWithStats creates a module like NewMetricsModule but reads the dropped messages from
+//the given function, e.g. the Stats method of an rlog.Instance the module is enabled on.
+//Returns: instance of metrics module
+func NewMetricsModuleWithStats(stats func() rlog.LogStats) *metricsModule {
+	conf := new(metricsModule)
+	conf.messages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rlog_messages_total",
+		Help: "Log messages by severity.",
+	}, []string{"severity"})
+	conf.dropped = prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Name: "rlog_dropped_total",
+		Help: "Log messages dropped because a module channel was full.",
+	}, func() float64 {
+		return float64(stats().Dropped)
+	})
+
+	//Export all severities from the start, a counter appearing only with the first message hides
+	//its increase from rate queries
+	for severity := rlog.SeverityFatal; severity <= rlog.SeverityTrace; severity++ {
+		conf.messages.WithLabelValues(severity.String())
+	}
+	return conf
+}
+
+//Name names the module for rlog diagnostics and statistics
+func (conf *metricsModule) Name() string {
+	return "metrics"
+}
+
+//WithSeverity sets a severity threshold for this module overriding the global rlog severity, e.g. to
+//count debug messages without writing them. Returns the metrics module to allow chaining with the
+//constructor.
+func (conf *metricsModule) WithSeverity(severity common.RlogSeverity) *metricsModule {
+	conf.SetSeverity(severity)
+	return conf
+}
+
+//Describe sends the descriptors of the metrics, implementing prometheus.Collector
+func (conf *metricsModule) Describe(ch chan<- *prometheus.Desc) {
+	conf.messages.Describe(ch)
+	conf.dropped.Describe(ch)
+}
+
+//Collect sends the current values of the metrics, implementing prometheus.Collector
+func (conf *metricsModule) Collect(ch chan<- prometheus.Metric) {
+	conf.messages.Collect(ch)
+	conf.dropped.Collect(ch)
+}
+
+//LaunchModule is intended to run in a separate goroutine and used by rlog internally. It counts log
+//messages. Arguments: [dataChan] Channel to receive log messages. [flushChan] Channel to receive flush
+//command
+func (conf *metricsModule) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
+
+	//Wait forever on data and flush channel
+	for {
+		select {
+		case logMsg := <-dataChan:
+			//Received log message, count it
+			conf.count(logMsg)
+		case ret, ok := <-flushChan:
+			if !ok {
+				//Flush channel closed by rlog: count pending messages and exit
+				conf.flush(dataChan)
+				return
+			}
+			//Flush and return the number of messages counted
+			ret <- common.FlushResult{Flushed: conf.flush(dataChan)}
+		}
+	}
+}
+
+//WriteSync counts a log message when rlog runs in synchronous mode (see rlog.RlogConfig.Synchronous)
+//Arguments: [rawRlogMsg] log message. [prefix] log prefix (unused)
+func (conf *metricsModule) WriteSync(rawRlogMsg *common.RlogMsg, prefix string) {
+	conf.count(rawRlogMsg)
+}
+
+//FlushSync does nothing, messages are counted as they arrive
+func (conf *metricsModule) FlushSync() {
+}
+
+//count increments the counter of the message severity
+func (conf *metricsModule) count(rawRlogMsg *common.RlogMsg) {
+	conf.messages.WithLabelValues(rawRlogMsg.Severity.String()).Inc()
+}
+
+//flush counts all pending log messages
+//Arguments:[dataChan] data channel to access all pending messages
+//Returns: number of messages counted
+func (conf *metricsModule) flush(dataChan <-chan (*common.RlogMsg)) int {
+	flushed := 0
+	for {
+		//Perform non blocking read until the channel is empty
+		select {
+		case logMsg := <-dataChan:
+			conf.count(logMsg)
+			flushed++
+		default:
+			return flushed
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package rlog
+
+/*
+This file implements mirroring of warnings and more severe messages to stderr. The mirror is an internal
+output module launched in addition to the enabled modules. It is not listed among the active modules and
+not accounted in the statistics, so that enabling it does not change them.
+*/
+
+import (
+	"fmt"
+	"github.com/rightscale/rlog/common"
+	"io"
+	"os"
+)
+
+//mirrorOutput is the destination of mirrored messages, replaced by tests
+var mirrorOutput io.Writer = os.Stderr
+
+//stderrMirror is the output module writing mirrored messages
+type stderrMirror struct {
+	common.ModuleSeverity
+	formatter common.Formatter //creates the text written for each message
+}
+
+//MirrorErrorsToStderr writes warnings and more severe messages to stderr in addition to the enabled
+//modules, e.g. for operators watching a terminal while the complete log goes to a file. The global
+//severity does not apply to the mirror. Like EnableModule, it has to be called before Start.
+//Arguments: true to mirror messages, false to stop mirroring them
+func MirrorErrorsToStderr(enable bool) {
+	std.MirrorErrorsToStderr(enable)
+}
+
+//MirrorErrorsToStderr writes warnings and more severe messages to stderr in addition to the enabled
+//modules, e.g. for operators watching a terminal while the complete log goes to a file. The global
+//severity does not apply to the mirror. Like EnableModule, it has to be called before Start.
+//Arguments: true to mirror messages, false to stop mirroring them
+func (r *Instance) MirrorErrorsToStderr(enable bool) {
+	if r.IsInitialized() {
+		// Do not allow modification if logger already initialized
+		r.Error("Cannot mirror errors to stderr when logger already running")
+	} else {
+		r.mirrorErrors = enable
+	}
+}
+
+//newStderrMirror creates the mirror module accepting warnings and more severe messages
+func newStderrMirror() *stderrMirror {
+	m := &stderrMirror{formatter: common.DefaultFormatter{}}
+	m.SetSeverity(SeverityWarning)
+	return m
+}
+
+//Name names the module for rlog diagnostics
+func (m *stderrMirror) Name() string {
+	return "mirror:stderr"
+}
+
+//LaunchModule writes mirrored messages until rlog closes the flush channel
+//Arguments: [dataChan] Channel to receive log messages. [flushChan] Channel to receive flush command
+func (m *stderrMirror) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
+	prefix := common.SyslogHeader()
+	for {
+		select {
+		case logMsg := <-dataChan:
+			m.WriteSync(logMsg, prefix)
+		case ret, ok := <-flushChan:
+			flushed := m.flush(dataChan, prefix)
+			if !ok {
+				return
+			}
+			ret <- common.FlushResult{Flushed: flushed}
+		}
+	}
+}
+
+//WriteSync writes a mirrored message, used directly when rlog runs in synchronous mode
+//Arguments: [rawRlogMsg] log message. [prefix] log prefix
+func (m *stderrMirror) WriteSync(rawRlogMsg *common.RlogMsg, prefix string) {
+	fmt.Fprintln(mirrorOutput, m.formatter.Format(rawRlogMsg, prefix))
+}
+
+//FlushSync does nothing as the output is not buffered
+func (m *stderrMirror) FlushSync() {
+}
+
+//flush writes all pending messages
+//Arguments: [dataChan] data channel to access all pending messages. [prefix] log prefix
+//Returns: number of messages written
+func (m *stderrMirror) flush(dataChan <-chan (*common.RlogMsg), prefix string) int {
+	flushed := 0
+	for {
+		select {
+		case logMsg := <-dataChan:
+			m.WriteSync(logMsg, prefix)
+			flushed++
+		default:
+			return flushed
+		}
+	}
+}
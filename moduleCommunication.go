@@ -6,60 +6,305 @@ goroutine accessing the logger API and the modules writing the log messages to v
 */
 
 import (
-	"container/list"
+	"fmt"
 	"github.com/rightscale/rlog/common"
-	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-//msgChannels is a linked list of channels. The channels are used to send messages to the modules
-var msgChannels *list.List = list.New()
+//msgChannel couples a message channel with the name and severity threshold of the module reading from it
+type msgChannel struct {
+	enqueued    uint64               //messages pushed to the channel (atomic access only)
+	dropped     uint64               //messages deleted from or not pushed to the full channel (atomic access only)
+	c           chan *common.RlogMsg //channel to the module
+	module      rlogModule           //module reading from the channel, nil if unregistered
+	name        string               //module name for diagnostics
+	severity    common.RlogSeverity  //severity threshold of the module
+	ownSeverity bool                 //true if the module overrides the global severity threshold
+	routes      []Route              //routes listing the module, nil if it receives all messages
+	sync        *syncWriter          //module written to synchronously instead of c, nil if none
+	internal    bool                 //true if the module is launched by rlog itself, excluded from statistics
+	done        chan struct{}        //closed when the module is detached, releases the pushes blocked on c
+}
+
+//flushChannel couples a flush command channel with the name of the module reading from it
+type flushChannel struct {
+	c      chan (chan (common.FlushResult)) //flush command channel to the module
+	module rlogModule                       //module reading from the channel, nil if unregistered
+	name   string                           //module name for diagnostics
+	sync   *syncWriter                      //module flushed synchronously instead of c, nil if none
+}
+
+//syncWriter serializes the calls to a module in synchronous mode, as messages are written by the
+//logging goroutines themselves
+type syncWriter struct {
+	mutex  sync.Mutex
+	module syncModule //module written to
+	prefix string     //log prefix passed to the module
+}
+
+//write writes a message to the module and returns once it has been written
+func (w *syncWriter) write(msg *common.RlogMsg) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.module.WriteSync(msg, w.prefix)
+}
+
+//flush makes the module write back its buffered data
+func (w *syncWriter) flush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.module.FlushSync()
+}
 
-//flushChannels is a linked list of channels. The channels are used to send the flush command to
-//the modules
-var flushChannels *list.List = list.New()
+//isFiltered determines whether a message of the given severity shall not be sent to the module
+//Arguments: [severity] message severity. [r] instance providing the global severity threshold
+func (mc *msgChannel) isFiltered(severity common.RlogSeverity, r *Instance) bool {
+	if mc.routes != nil && !mc.isRouted(severity) {
+		return true
+	}
+	if mc.ownSeverity {
+		return severity > mc.severity
+	}
+	return r.isFilteredSeverity(severity)
+}
+
+//isRouted determines whether any route of the module covers the given severity
+func (mc *msgChannel) isRouted(severity common.RlogSeverity) bool {
+	for i := range mc.routes {
+		if mc.routes[i].includes(severity) {
+			return true
+		}
+	}
+	return false
+}
 
 //getMsgChannel creates a log message channel and registers it.
+//Arguments: module reading from the channel (may be nil)
 //Returns: log message channel
-func getMsgChannel() <-chan (*common.RlogMsg) {
-	c := make(chan *common.RlogMsg, config.ChanCapacity)
-	msgChannels.PushBack(c)
-	return c
+func (r *Instance) getMsgChannel(module rlogModule) <-chan (*common.RlogMsg) {
+	mc := r.newMsgChannel(module)
+	mc.c = make(chan *common.RlogMsg, r.config.ChanCapacity)
+	r.modulesMutex.Lock()
+	r.msgChannels.PushBack(mc)
+	r.modulesMutex.Unlock()
+	return mc.c
+}
+
+//registerSyncModule registers a module written to synchronously instead of using channels
+//Arguments: [module] module to register. [prefix] log prefix passed to the module
+func (r *Instance) registerSyncModule(module syncModule, prefix string) {
+	w := &syncWriter{module: module, prefix: prefix}
+	mc := r.newMsgChannel(module)
+	mc.sync = w
+	r.modulesMutex.Lock()
+	defer r.modulesMutex.Unlock()
+	r.msgChannels.PushBack(mc)
+	r.flushChannels.PushBack(&flushChannel{module: module, name: mc.name, sync: w})
+}
+
+//newMsgChannel creates a message channel entry for a module without the channel itself
+//Arguments: module reading from the channel (may be nil)
+//Returns: message channel entry carrying name, severity threshold and routes of the module
+func (r *Instance) newMsgChannel(module rlogModule) *msgChannel {
+	mc := &msgChannel{module: module, name: moduleName(module), routes: routesOf(r.config.Routes, module)}
+	mc.done = make(chan struct{})
+	if sm, ok := module.(severityModule); ok {
+		mc.severity, mc.ownSeverity = sm.Severity()
+	}
+	return mc
 }
 
 //getFlushChannel creates a flush command channel and registers it. A flush channel
 //has capacity 1 so even if the flush receiver is currently busy handling a message,
 //it gets the flush command. Termination is enforced by waiting only a limited amount
 //of time for the module to respond with a success message to the flush.
+//Arguments: module reading from the channel (may be nil)
 //Returns: flush message channel
-func getFlushChannel() chan (chan (bool)) {
-	c := make(chan chan (bool), 1)
-	flushChannels.PushBack(c)
+func (r *Instance) getFlushChannel(module rlogModule) chan (chan (common.FlushResult)) {
+	c := make(chan chan (common.FlushResult), 1)
+	r.modulesMutex.Lock()
+	r.flushChannels.PushBack(&flushChannel{c: c, module: module, name: moduleName(module)})
+	r.modulesMutex.Unlock()
 	return c
 }
 
-//pushToChannels pushes a message to all registered channels.
+//moduleName determines the name of a module for diagnostics. Modules may provide a name by
+//implementing the namedModule interface, otherwise the name of the concrete type is used.
+//Returns: module name
+func moduleName(module rlogModule) string {
+	if module == nil {
+		return "unregistered"
+	}
+	if nm, ok := module.(namedModule); ok {
+		return nm.Name()
+	}
+	return reflect.TypeOf(module).String()
+}
+
+//pushToChannels pushes a message to all registered channels whose module does not filter it.
 //Arguments: message to push
-func pushToChannels(msg *common.RlogMsg) {
+func (r *Instance) pushToChannels(msg *common.RlogMsg) {
+	//A flush starting meanwhile waits for this push, see waitForPushes
+	defer r.endPush(r.beginPush())
 
-	for e := msgChannels.Front(); e != nil; e = e.Next() {
-		//Cycle over all registered channels, perform a type conversion (because of the linked
-		//list) and call the helper function to push the log data without blocking
-		c, ok := e.Value.(chan (*common.RlogMsg))
+	//Modules may be attached or detached concurrently. Push to a snapshot of the channels, a push blocked
+	//on a full channel (see Block) must not hold modulesMutex.
+	var buf [8]*msgChannel
+	channels := buf[:0]
+	r.modulesMutex.RLock()
+	for e := r.msgChannels.Front(); e != nil; e = e.Next() {
+		//Cycle over all registered channels and perform a type conversion (because of the linked list)
+		mc, ok := e.Value.(*msgChannel)
 		if ok {
-			pushToChannelsHelper(c, msg)
+			channels = append(channels, mc)
+		} else {
+			r.internalf("[RightLog4Go] type assertion for msg channel failed, message not delivered")
+		}
+	}
+	r.modulesMutex.RUnlock()
+
+	for _, mc := range channels {
+		//Call the helper function to push the log data, skipping modules detached meanwhile
+		if mc.isFiltered(msg.Severity, r) || isClosed(mc.done) {
+			continue
+		}
+		if mc.sync != nil {
+			mc.sync.write(msg)
+			atomic.AddUint64(&mc.enqueued, 1)
 		} else {
-			log.Panic("[RightLog4Go FATAL] type assertion for msg channel failed\n")
+			success, dropped := pushToChannelsHelper(mc.c, msg, r.config.OverflowPolicy, r.overflowTimeout(), r.config.Watermark, mc.done)
+			if success {
+				atomic.AddUint64(&mc.enqueued, 1)
+			}
+			if dropped > 0 {
+				// Do not log send failures using RightLog4Go because it would create a feedback loop
+				r.internalf("[RightLog4Go] Log buffer of module %s full, dropped %d message(s)", mc.name, dropped)
+				atomic.AddUint64(&mc.dropped, dropped)
+				if r.config.PanicOnOverflow {
+					panic(fmt.Sprintf("rlog: log buffer of module %s full, dropped %d message(s)", mc.name, dropped))
+				}
+			}
+		}
+	}
+}
+
+//beginPush accounts for a push in progress in the slot of the current flush epoch. If a flush starts
+//concurrently, the push is accounted for in the slot of the new epoch instead, so that a flush either
+//sees the push or the push started after the flush.
+//Returns: slot to pass to endPush
+func (r *Instance) beginPush() *int64 {
+	for {
+		epoch := atomic.LoadUint32(&r.pushEpoch)
+		slot := &r.inFlight[epoch&1]
+		atomic.AddInt64(slot, 1)
+		if atomic.LoadUint32(&r.pushEpoch) == epoch {
+			return slot
+		}
+		atomic.AddInt64(slot, -1)
+	}
+}
+
+//endPush ends the accounting of a push started by beginPush
+//Arguments: slot returned by beginPush
+func (r *Instance) endPush(slot *int64) {
+	atomic.AddInt64(slot, -1)
+}
+
+//waitForPushes starts a new flush epoch and waits for the pushes of the previous epochs which are still
+//in progress, so that the modules' drain of their channels covers them. Pushes starting meanwhile are not
+//waited for. The wait is bounded, a push blocked on a module which stopped taking messages must not stall
+//the flush. The caller has to hold the flush lock (see lockFlush).
+//Arguments: [timeout] max time to wait. [cancel] aborts the wait when closed, nil if not cancelable
+func (r *Instance) waitForPushes(timeout time.Duration, cancel <-chan struct{}) {
+	slot := &r.inFlight[(atomic.AddUint32(&r.pushEpoch, 1)-1)&1]
+	deadline := time.Now().Add(timeout)
+	for atomic.LoadInt64(slot) > 0 && time.Now().Before(deadline) && !isClosed(cancel) {
+		//Pushes do not signal their end, poll the counter
+		time.Sleep(pollInterval)
+	}
+}
+
+//getStats sums up the message counters of all registered channels
+//Returns: message statistics
+func (r *Instance) getStats() LogStats {
+	r.modulesMutex.RLock()
+	defer r.modulesMutex.RUnlock()
+
+	var stats LogStats
+	for e := r.msgChannels.Front(); e != nil; e = e.Next() {
+		if mc, ok := e.Value.(*msgChannel); ok && !mc.internal {
+			ms := ModuleStats{
+				Name:     mc.name,
+				Enqueued: atomic.LoadUint64(&mc.enqueued),
+				Dropped:  atomic.LoadUint64(&mc.dropped),
+			}
+			stats.Enqueued += ms.Enqueued
+			stats.Dropped += ms.Dropped
+			stats.Modules = append(stats.Modules, ms)
 		}
 	}
+	stats.FlushTimeouts = atomic.LoadUint64(&r.flushTimeouts)
+	stats.Suppressed = atomic.LoadUint64(&r.suppressedMsgs)
+	return stats
 }
 
-//pushToChannelsHelper pushes to a channel without blocking forever. If the channel is full, one element gets
-//deleted and the message is pushed again (FIFO ringbuffer channel). The number of retries is limited to three
-//to guarantee termination (deleting one element and writing the next element is not atomic).
-//Arguments: [c] destination channel. [msg] Message to log
-func pushToChannelsHelper(c chan (*common.RlogMsg), msg *common.RlogMsg) {
+//isFilteredByAllModules determines whether no registered module accepts messages of the given
+//severity, in which case there is no need to generate the message at all
+func (r *Instance) isFilteredByAllModules(severity common.RlogSeverity) bool {
+	r.modulesMutex.RLock()
+	defer r.modulesMutex.RUnlock()
+
+	//Without modules, there is nobody to generate the message for
+	if r.msgChannels.Len() == 0 {
+		return true
+	}
+
+	//Without routes, messages passing the global threshold are always generated
+	if len(r.config.Routes) == 0 && !r.isFilteredSeverity(severity) {
+		return false
+	}
+
+	for e := r.msgChannels.Front(); e != nil; e = e.Next() {
+		mc, ok := e.Value.(*msgChannel)
+		if ok && !mc.isFiltered(severity, r) {
+			return false
+		}
+	}
+	return true
+}
+
+//pushToChannelsHelper pushes to a channel according to the overflow policy. With DropOldest, it does not block
+//forever: if the channel is full, one element gets deleted and the message is pushed again (FIFO ringbuffer
+//channel). The number of retries is limited to three to guarantee termination (deleting one element and writing
+//the next element is not atomic). With DropNewest, the message is not pushed if the channel is full. With Block,
+//it waits for the module to make room, at most for the given timeout (0 waits forever). With BlockAboveWatermark,
+//it waits while the channel is filled above the watermark, at most for the given timeout (0 for the default),
+//and then behaves like DropOldest: bursts are slowed down briefly while sustained floods lose the oldest messages.
+//Arguments: [c] destination channel. [msg] Message to log. [policy] behavior if the channel is full. [timeout]
+//max time to block. [watermark] fill level as fraction of the channel capacity (BlockAboveWatermark only).
+//[done] stops blocking when closed (the module is detached), nil if never closed
+//Returns: whether the message was pushed and the number of messages lost (deleted or not pushed)
+func pushToChannelsHelper(c chan (*common.RlogMsg), msg *common.RlogMsg, policy OverflowPolicy, timeout time.Duration, watermark float64, done <-chan struct{}) (bool, uint64) {
+
+	switch policy {
+	case DropNewest:
+		select {
+		case c <- msg:
+			return true, 0
+		default:
+			return false, 1
+		}
+	case Block:
+		return pushBlocking(c, msg, timeout, done)
+	case BlockAboveWatermark:
+		waitBelowWatermark(c, watermark, timeout, done)
+	}
 
+	var dropped uint64
 	success := false
 	for retries := 0; retries < 3 && !success; retries++ {
 		//Loop until either (a) success (b) #retries exceeded
@@ -69,11 +314,77 @@ func pushToChannelsHelper(c chan (*common.RlogMsg), msg *common.RlogMsg) {
 			success = true
 		default:
 			//Send failed, remove one item and retry
-			// Do not log send failures using RightLog4Go because it would create a feedback loop
-			log.Printf("[RightLog4Go] Log buffer full, delete and retry")
-			nonBlockingChanRead(c)
+			if nonBlockingChanRead(c) != nil {
+				dropped++
+			}
 		}
 	}
+
+	if !success {
+		dropped++
+	}
+	return success, dropped
+}
+
+//pushBlocking pushes to a channel, waiting for the module to make room if the channel is full
+//Arguments: [c] destination channel. [msg] Message to log. [timeout] max time to block, 0 waits forever.
+//[done] stops blocking when closed, nil if never closed
+//Returns: whether the message was pushed and the number of messages lost (not pushed)
+func pushBlocking(c chan (*common.RlogMsg), msg *common.RlogMsg, timeout time.Duration, done <-chan struct{}) (bool, uint64) {
+	//A nil timer channel never fires, i.e. wait forever
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case c <- msg:
+		return true, 0
+	case <-expired:
+		return false, 1
+	case <-done:
+		return false, 1
+	}
+}
+
+//pollInterval is the time between two checks of a condition which is not signaled, e.g. the fill level of
+//a channel (see waitBelowWatermark)
+const pollInterval = time.Millisecond
+
+//overflowTimeout selects the max time to block on a full channel for the configured overflow policy
+//Returns: RlogConfig.WatermarkTimeout for BlockAboveWatermark, RlogConfig.BlockTimeout otherwise
+func (r *Instance) overflowTimeout() time.Duration {
+	if r.config.OverflowPolicy == BlockAboveWatermark {
+		return r.config.WatermarkTimeout
+	}
+	return r.config.BlockTimeout
+}
+
+//waitBelowWatermark waits until the fill level of a channel is below the watermark. The watermark is at
+//least one message so that an empty channel never blocks. The wait is always bounded, so that a module
+//which stopped taking messages does not stall the logging goroutines.
+//Arguments: [c] channel to a module. [watermark] fill level as fraction of the channel capacity, out of
+//range values (e.g. 0) select the default. [timeout] max time to wait, 0 selects the default. [done] stops
+//waiting when closed, nil if never closed
+func waitBelowWatermark(c chan (*common.RlogMsg), watermark float64, timeout time.Duration, done <-chan struct{}) {
+	if watermark <= 0 || watermark > 1 {
+		watermark = defaultWatermark
+	}
+	if timeout <= 0 {
+		timeout = defaultWatermarkTimeout
+	}
+	mark := int(watermark * float64(cap(c)))
+	if mark < 1 {
+		mark = 1
+	}
+
+	deadline := time.Now().Add(timeout)
+	for len(c) >= mark && time.Now().Before(deadline) && !isClosed(done) {
+		//Channels do not notify when the module takes a message, poll the fill level
+		time.Sleep(pollInterval)
+	}
 }
 
 //nonBlockingChanRead reads one item from the given channel. nonBlockingChanRead
@@ -94,25 +405,183 @@ func nonBlockingChanRead(c <-chan (*common.RlogMsg)) *common.RlogMsg {
 //we wait for a response or timeout. When timing out, there is no cleanup required as the return channel has
 //buffer capacity 1 as well ==> the module can place it response into it without us receiving it. The channel
 //will be garbage collected afterwards.
-//Arguments: Channel to send flush command
-//Returns: true on success, false otherwise
-func flushHelper(c chan (chan (bool))) bool {
-	responseChan := make(chan (bool), 1)
+//Arguments: [c] Channel to send flush command. [name] Module name for diagnostics. [timeout] Max time to wait
+//for the response. [cancel] Aborts waiting for the response when closed, nil if not cancelable
+//Returns: number of messages the module flushed, nil on success, error otherwise
+func (r *Instance) flushHelper(c chan (chan (common.FlushResult)), name string, timeout time.Duration, cancel <-chan struct{}) (int, error) {
+	responseChan := make(chan (common.FlushResult), 1)
 	select {
 	//Phase 1: send flush command including a return channel to module
 	case c <- responseChan:
 		//Phase 2: wait for module to respond (or time out)
 		select {
-		case <-responseChan:
+		case res := <-responseChan:
+			if res.Err != nil {
+				r.internalf("[RightLog4Go] flush of module %s failed: %s", name, res.Err.Error())
+				return res.Flushed, fmt.Errorf("flush of module %s failed: %s", name, res.Err.Error())
+			}
 			//OK, we are done
-			return true
-		case <-time.After(time.Second * time.Duration(config.FlushTimeout)):
-			log.Printf("[RightLog4Go] flush command ACK timed out\n")
-			return false
+			return res.Flushed, nil
+		case <-time.After(timeout):
+			r.internalf("[RightLog4Go] flush command ACK of module %s timed out", name)
+			atomic.AddUint64(&r.flushTimeouts, 1)
+			return 0, fmt.Errorf("flush command ACK of module %s timed out", name)
+		case <-cancel:
+			r.internalf("[RightLog4Go] flush command ACK of module %s canceled", name)
+			return 0, fmt.Errorf("flush command ACK of module %s canceled", name)
 		}
 	default:
 		//Flush channel full ==> pending flush?
-		log.Printf("[RightLog4Go] Sending flush command to module failed, pending flush?\n")
+		r.internalf("[RightLog4Go] Sending flush command to module %s failed, pending flush?", name)
+		return 0, fmt.Errorf("sending flush command to module %s failed, pending flush?", name)
+	}
+}
+
+//flushModules sends the flush command to all modules one after the other. Messages being pushed to the
+//modules when the flush starts are completely pushed before (within the timeout of the first module),
+//so that the modules' drain of their channels covers them. Once canceled, the remaining modules are not
+//flushed anymore and reported as failed.
+//Arguments: [timeout] determines the max time to wait for the response of the next module. [deadline]
+//bounds the wait for a concurrent flush, zero if unbounded. [cancel] aborts the flush when closed, nil if
+//not cancelable
+//Returns: messages flushed per module, nil if all modules responded, otherwise an error naming the modules
+//which did not
+func (r *Instance) flushModules(timeout func() time.Duration, deadline time.Time, cancel <-chan struct{}) (FlushReport, error) {
+	//A module accepts a single pending flush command, wait for a concurrent flush to complete instead of
+	//failing because of it
+	if !r.lockFlush(deadline, cancel) {
+		r.internalf("[RightLog4Go] flush aborted while waiting for a concurrent flush")
+		return FlushReport{}, fmt.Errorf("flush aborted while waiting for a concurrent flush")
+	}
+	defer r.unlockFlush()
+
+	//Flush the modules registered now without holding the lock, a module attached meanwhile is not
+	//flushed and a module is only detached while no flush is in progress
+	r.modulesMutex.RLock()
+	channels := make([]interface{}, 0, r.flushChannels.Len())
+	for e := r.flushChannels.Front(); e != nil; e = e.Next() {
+		channels = append(channels, e.Value)
+	}
+	r.modulesMutex.RUnlock()
+
+	//A message being pushed must not reach a module right after it drained its channel
+	r.waitForPushes(timeout(), cancel)
+
+	var report FlushReport
+	var failed []string
+	for _, v := range channels {
+		//Cycle over all registered channels, perform a type conversion because of the linked list
+		// and call the helper function implementing the flush protocol
+		fc, ok := v.(*flushChannel)
+		if !ok {
+			r.internalf("[RightLog4Go] type assertion for flush channel failed")
+			continue
+		}
+
+		mf := ModuleFlush{Name: fc.name}
+		if isClosed(cancel) {
+			mf.Err = fmt.Errorf("flush of module %s canceled", fc.name)
+		} else {
+			mf.Flushed, mf.Err = r.flushModule(fc, timeout(), cancel)
+		}
+		if mf.Err != nil {
+			failed = append(failed, fc.name)
+		}
+		report.Flushed += mf.Flushed
+		report.Modules = append(report.Modules, mf)
+	}
+
+	if len(failed) > 0 {
+		return report, fmt.Errorf("flush failed for module(s): %s", strings.Join(failed, ", "))
+	}
+	return report, nil
+}
+
+//lockFlush waits until no other flush is in progress, see unlockFlush. The wait ends early once the
+//deadline passes or cancel is closed.
+//Arguments: [deadline] max time to wait, zero if unbounded. [cancel] aborts the wait when closed, nil if not
+//cancelable
+//Returns: true if the lock is held, false if the wait ended early
+func (r *Instance) lockFlush(deadline time.Time, cancel <-chan struct{}) bool {
+	//A nil timer channel never fires, i.e. wait until canceled
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(deadline.Sub(time.Now()))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case r.flushSem <- struct{}{}:
+		return true
+	case <-expired:
 		return false
+	case <-cancel:
+		return false
+	}
+}
+
+//unlockFlush releases the lock taken by lockFlush
+func (r *Instance) unlockFlush() {
+	<-r.flushSem
+}
+
+//flushModule runs the flush protocol with a single module, the caller has to hold the flush lock
+//Arguments: [fc] flush channel of the module. [timeout] max time to wait for the response. [cancel]
+//aborts the flush when closed, nil if not cancelable
+//Returns: number of messages flushed, error if the module did not respond
+func (r *Instance) flushModule(fc *flushChannel, timeout time.Duration, cancel <-chan struct{}) (int, error) {
+	if fc.sync != nil {
+		//Synchronous modules have no pending messages, only buffered data
+		fc.sync.flush()
+		return 0, nil
+	}
+	return r.flushHelper(fc.c, fc.name, timeout, cancel)
+}
+
+//isClosed determines whether a cancel channel has been closed
+//Returns: true if closed, false if open or nil
+func isClosed(cancel <-chan struct{}) bool {
+	select {
+	case <-cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+//startAutoFlush launches a goroutine flushing all modules periodically (see
+//RlogConfig.AutoFlushInterval) until stopAutoFlush is invoked
+//Arguments: time between flushes
+func (r *Instance) startAutoFlush(interval time.Duration) {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	r.autoFlushStop = stop
+	r.autoFlushDone = done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.Flush()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+//stopAutoFlush stops the background flush and waits for a flush in progress to complete. It does
+//nothing if the background flush is not running.
+func (r *Instance) stopAutoFlush() {
+	if r.autoFlushStop == nil {
+		return
 	}
+	close(r.autoFlushStop)
+	<-r.autoFlushDone
+	r.autoFlushStop = nil
+	r.autoFlushDone = nil
 }
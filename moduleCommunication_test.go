@@ -3,22 +3,37 @@ These tests cover:
 - Channel creation
 - Channel multipush: 1 message to multiple channels
 - Channel FIFO behavior
+- Channel overflow policies
+- Panicking on overflow
+- Routing of severity ranges to modules
 - Non blocking channel read
+- Background flush
+- Flush bounded by a context
+- Flush bounded while waiting for a concurrent flush
+- Flushing a single module
+- Flush waiting for messages in flight
+- Internal diagnostics
+- Resetting while logging
 */
 package rlog
 
 import (
+	"bytes"
 	"container/list"
+	"context"
+	"errors"
 	"github.com/rightscale/rlog/common"
 	. "launchpad.net/gocheck"
+	"log"
 	"strconv"
+	"sync"
 	"time"
 )
 
 //When invoking nonBlockingChanRead, it should never block
 func (s *Stateless) TestNonBlockingDelete(t *C) {
 	//Create a channel and push 1 item into it
-	logItem := &common.RlogMsg{"", "", SeverityError, 0, ""}
+	logItem := &common.RlogMsg{Severity: SeverityError}
 	c := make(chan (*common.RlogMsg), 2)
 	c <- logItem
 
@@ -40,7 +55,7 @@ func (s *Stateless) TestPushToChannelHelper(t *C) {
 	//Create message channel with capacity 2 and stuff 5 elements into it
 	c := make(chan (*common.RlogMsg), 2)
 	for i := 0; i < 5; i++ {
-		pushToChannelsHelper(c, &common.RlogMsg{strconv.Itoa(i), "", SeverityError, uint(i), ""})
+		pushToChannelsHelper(c, &common.RlogMsg{Msg: strconv.Itoa(i), Severity: SeverityError, Pc: uint(i)}, DropOldest, 0, 0, nil)
 	}
 
 	//Read back the elements, should receive the last two elements (FIFO)
@@ -54,18 +69,106 @@ func (s *Stateless) TestPushToChannelHelper(t *C) {
 	}
 }
 
+//When channel buffer capacity is exceeded with the DropNewest policy, it should keep the first elements
+func (s *Stateless) TestPushToChannelHelperDropNewest(t *C) {
+	c := make(chan (*common.RlogMsg), 2)
+	var dropped uint64
+	for i := 0; i < 5; i++ {
+		_, n := pushToChannelsHelper(c, &common.RlogMsg{Severity: SeverityError, Pc: uint(i)}, DropNewest, 0, 0, nil)
+		dropped += n
+	}
+
+	t.Assert(dropped, Equals, uint64(3))
+	t.Assert((<-c).Pc, Equals, uint(0))
+	t.Assert((<-c).Pc, Equals, uint(1))
+}
+
+//When channel buffer capacity is exceeded with the Block policy, it should wait for the reader and give
+//up after the timeout
+func (s *Stateless) TestPushToChannelHelperBlock(t *C) {
+	c := make(chan (*common.RlogMsg), 1)
+	pushToChannelsHelper(c, &common.RlogMsg{Pc: 0}, Block, 0, 0, nil)
+
+	//Nobody reads, the timeout expires
+	success, dropped := pushToChannelsHelper(c, &common.RlogMsg{Pc: 1}, Block, 10*time.Millisecond, 0, nil)
+	t.Assert(success, Equals, false)
+	t.Assert(dropped, Equals, uint64(1))
+
+	//The reader makes room while the push is blocked, no message is lost
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-c
+	}()
+	success, dropped = pushToChannelsHelper(c, &common.RlogMsg{Pc: 2}, Block, 0, 0, nil)
+	t.Assert(success, Equals, true)
+	t.Assert(dropped, Equals, uint64(0))
+	t.Assert((<-c).Pc, Equals, uint(2))
+}
+
+//When the channel is filled above the watermark with the BlockAboveWatermark policy, it should wait for the
+//reader, push anyway after the timeout and drop the oldest message only if the channel is full
+func (s *Stateless) TestPushToChannelHelperWatermark(t *C) {
+	c := make(chan (*common.RlogMsg), 4)
+
+	//Below the watermark, pushing does not wait
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		success, dropped := pushToChannelsHelper(c, &common.RlogMsg{Pc: uint(i)}, BlockAboveWatermark, time.Second, 0.5, nil)
+		t.Assert(success, Equals, true)
+		t.Assert(dropped, Equals, uint64(0))
+	}
+	t.Assert(time.Since(start) < time.Second, Equals, true)
+
+	//Above the watermark, nobody reads: the message is pushed once the timeout expires
+	start = time.Now()
+	success, dropped := pushToChannelsHelper(c, &common.RlogMsg{Pc: 2}, BlockAboveWatermark, 10*time.Millisecond, 0.5, nil)
+	t.Assert(success, Equals, true)
+	t.Assert(dropped, Equals, uint64(0))
+	t.Assert(time.Since(start) >= 10*time.Millisecond, Equals, true)
+
+	//The channel is full: the oldest message makes room after the timeout
+	pushToChannelsHelper(c, &common.RlogMsg{Pc: 3}, BlockAboveWatermark, time.Millisecond, 0.5, nil)
+	success, dropped = pushToChannelsHelper(c, &common.RlogMsg{Pc: 4}, BlockAboveWatermark, time.Millisecond, 0.5, nil)
+	t.Assert(success, Equals, true)
+	t.Assert(dropped, Equals, uint64(1))
+	t.Assert((<-c).Pc, Equals, uint(1))
+
+	//The reader drains the channel below the watermark while the push waits, no message is lost
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-c
+		<-c
+	}()
+	success, dropped = pushToChannelsHelper(c, &common.RlogMsg{Pc: 5}, BlockAboveWatermark, time.Second, 0.5, nil)
+	t.Assert(success, Equals, true)
+	t.Assert(dropped, Equals, uint64(0))
+	t.Assert((<-c).Pc, Equals, uint(4))
+	t.Assert((<-c).Pc, Equals, uint(5))
+
+	//Without timeout, the default bounds the wait for a module which stopped taking messages
+	for i := 0; i < cap(c); i++ {
+		c <- &common.RlogMsg{Pc: uint(i)}
+	}
+	start = time.Now()
+	success, dropped = pushToChannelsHelper(c, &common.RlogMsg{Pc: 6}, BlockAboveWatermark, 0, 0, nil)
+	t.Assert(success, Equals, true)
+	t.Assert(dropped, Equals, uint64(1))
+	t.Assert(time.Since(start) >= defaultWatermarkTimeout, Equals, true)
+	t.Assert(time.Since(start) < time.Second, Equals, true)
+}
+
 //(1) When calling getMsgChannel, it should create a message channel and register it.
 //(2) When pushing a message to a set of channels using pushToChannels, it should push
 //exactly one message element to each channel.
 func (s *Initialized) TestPushToChannels(t *C) {
 
 	//Setup two of our channels for testing
-	msgChannels = list.New()
-	c1 := getMsgChannel()
-	c2 := getMsgChannel()
+	std.msgChannels = list.New()
+	c1 := std.getMsgChannel(nil)
+	c2 := std.getMsgChannel(nil)
 
-	logItem := &common.RlogMsg{"", "", SeverityError, 0, ""}
-	pushToChannels(logItem)
+	logItem := &common.RlogMsg{Severity: SeverityError}
+	std.pushToChannels(logItem)
 
 	//Read back items
 	if testPushToChannelsHelper(t, c1) != logItem {
@@ -76,6 +179,80 @@ func (s *Initialized) TestPushToChannels(t *C) {
 	}
 }
 
+//When a module has its own severity threshold, it should only receive messages according to
+//its threshold whereas other modules use the global threshold
+func (s *Initialized) TestPushToChannelsModuleSeverity(t *C) {
+
+	SetSeverity(SeverityInfo)
+	verbose := new(fakeSeverityModule)
+	verbose.SetSeverity(SeverityDebug)
+	quiet := new(fakeSeverityModule)
+	quiet.SetSeverity(SeverityError)
+
+	std.msgChannels = list.New()
+	cDefault := std.getMsgChannel(nil)
+	cVerbose := std.getMsgChannel(verbose)
+	cQuiet := std.getMsgChannel(quiet)
+
+	//A debug message should only reach the verbose module
+	t.Assert(std.isFilteredByAllModules(SeverityDebug), Equals, false)
+	Debug("debug message")
+	t.Assert(nonBlockingChanRead(cDefault), IsNil)
+	t.Assert(nonBlockingChanRead(cVerbose), NotNil)
+	t.Assert(nonBlockingChanRead(cQuiet), IsNil)
+
+	//An info message should reach all but the quiet module
+	Info("info message")
+	t.Assert(nonBlockingChanRead(cDefault), NotNil)
+	t.Assert(nonBlockingChanRead(cVerbose), NotNil)
+	t.Assert(nonBlockingChanRead(cQuiet), IsNil)
+
+	//Without the verbose module, debug messages should not be generated at all
+	std.msgChannels = list.New()
+	std.getMsgChannel(quiet)
+	t.Assert(std.isFilteredByAllModules(SeverityDebug), Equals, true)
+}
+
+//When routes are configured, routed modules should only receive the severities of their routes whereas
+//other modules receive all messages
+func (s *Initialized) TestPushToChannelsRoutes(t *C) {
+	SetSeverity(SeverityDebug)
+	file := new(fakeLogModule)
+	remote := new(fakeLogModule)
+	std.config.Routes = []Route{
+		NewRoute(SeverityTrace, SeverityInfo, file),
+		NewRoute(SeverityWarning, SeverityFatal, file, remote),
+	}
+
+	std.msgChannels = list.New()
+	cFile := std.getMsgChannel(file)
+	cRemote := std.getMsgChannel(remote)
+	cOther := std.getMsgChannel(new(fakeLogModule))
+
+	Debug("debug message")
+	t.Assert(nonBlockingChanRead(cFile), NotNil)
+	t.Assert(nonBlockingChanRead(cRemote), IsNil)
+	t.Assert(nonBlockingChanRead(cOther), NotNil)
+
+	Error("error message")
+	t.Assert(nonBlockingChanRead(cFile), NotNil)
+	t.Assert(nonBlockingChanRead(cRemote), NotNil)
+	t.Assert(nonBlockingChanRead(cOther), NotNil)
+
+	//Without unrouted modules, messages no route covers are not generated at all
+	std.config.Routes = []Route{NewRoute(SeverityWarning, SeverityFatal, remote)}
+	std.msgChannels = list.New()
+	std.getMsgChannel(remote)
+	t.Assert(std.isFilteredByAllModules(SeverityInfo), Equals, true)
+	t.Assert(std.isFilteredByAllModules(SeverityWarning), Equals, false)
+}
+
+//fakeSeverityModule is a module carrying its own severity threshold
+type fakeSeverityModule struct {
+	fakeLogModule
+	common.ModuleSeverity
+}
+
 //testPushToChannelsHelper is a helper function for TestPushToChannels that reads two elements from
 //the given channel: the first element is expected to be there whereas the second element should be
 //not be available. However, the read shall never block.
@@ -95,6 +272,60 @@ func testPushToChannelsHelper(t *C, c <-chan (*common.RlogMsg)) *common.RlogMsg
 	return ret
 }
 
+//When pushing to channels, it should count enqueued and dropped messages
+func (s *Initialized) TestStats(t *C) {
+
+	//Setup a channel with capacity 2 and push 5 messages
+	std.config.ChanCapacity = 2
+	std.msgChannels = list.New()
+	std.getMsgChannel(nil)
+	for i := 0; i < 5; i++ {
+		std.pushToChannels(&common.RlogMsg{Severity: SeverityError})
+	}
+
+	stats := Stats()
+	t.Assert(len(stats.Modules), Equals, 1)
+	t.Assert(stats.Modules[0].Name, Equals, "unregistered")
+	t.Assert(stats.Modules[0].Dropped, Equals, uint64(3))
+	t.Assert(stats.Enqueued, Equals, uint64(5))
+	t.Assert(stats.Dropped, Equals, uint64(3))
+	t.Assert(stats.FlushTimeouts, Equals, uint64(0))
+
+	//A flush command without receiver should count as time out
+	std.config.FlushTimeout = 0
+	std.flushHelper(std.getFlushChannel(nil), "test", 0, nil)
+	t.Assert(Stats().FlushTimeouts, Equals, uint64(1))
+}
+
+//When a module channel overflows with PanicOnOverflow set, it should panic instead of dropping silently
+func (s *Initialized) TestPanicOnOverflow(t *C) {
+	std.config.ChanCapacity = 1
+	std.config.PanicOnOverflow = true
+	std.msgChannels = list.New()
+	std.getMsgChannel(nil)
+
+	std.pushToChannels(&common.RlogMsg{Severity: SeverityError})
+	t.Assert(func() { std.pushToChannels(&common.RlogMsg{Severity: SeverityError}) }, PanicMatches,
+		"rlog: log buffer of module unregistered full, dropped 1 message\\(s\\)")
+	t.Assert(Stats().Dropped, Equals, uint64(1))
+}
+
+//When naming a module, it should prefer the name provided by the module over its type name
+func (s *Stateless) TestModuleName(t *C) {
+	t.Assert(moduleName(nil), Equals, "unregistered")
+	t.Assert(moduleName(new(fakeLogModule)), Equals, "*rlog.fakeLogModule")
+	t.Assert(moduleName(new(fakeNamedModule)), Equals, "fake")
+}
+
+//fakeNamedModule is a module providing its own name
+type fakeNamedModule struct {
+	fakeLogModule
+}
+
+func (f *fakeNamedModule) Name() string {
+	return "fake"
+}
+
 //When invoking the flush command, it should notify all subscribers
 func (s *Initialized) TestFlush(t *C) {
 
@@ -102,8 +333,8 @@ func (s *Initialized) TestFlush(t *C) {
 	confirm := make(chan (bool), 2)
 
 	//Register two flush listeners
-	c1 := getFlushChannel()
-	c2 := getFlushChannel()
+	c1 := std.getFlushChannel(nil)
+	c2 := std.getFlushChannel(nil)
 
 	//Spawn two goroutines simulating the modules
 	simulateModuleAndConfirm(c1, confirm)
@@ -129,11 +360,11 @@ func (s *Initialized) TestFlush(t *C) {
 
 //simulateModuleAndConfirm implements the protocol which is expected to run inside a logger module and
 //has in addition a confirmation channel to verify that indeed the flush command has been sent
-func simulateModuleAndConfirm(c chan (chan (bool)), confirm chan (bool)) {
-	go func(ch chan (chan (bool))) {
+func simulateModuleAndConfirm(c chan (chan (common.FlushResult)), confirm chan (bool)) {
+	go func(ch chan (chan (common.FlushResult))) {
 		//Block on c until we get something and send response immediately
 		ret := <-ch
-		ret <- true
+		ret <- common.FlushResult{}
 
 		//Put true in confirm channel to notify that we were invoked
 		confirm <- true
@@ -144,33 +375,237 @@ func simulateModuleAndConfirm(c chan (chan (bool)), confirm chan (bool)) {
 func (s *Initialized) TestFlushHelper(t *C) {
 
 	//A flush channel and a variable to capture the return value
-	var c chan (chan (bool))
-	var ret bool
+	var c chan (chan (common.FlushResult))
+	var err error
 
 	//Disable flush timeout to speed-up the test case with no receiver
-	config.FlushTimeout = 0
+	std.config.FlushTimeout = 0
 
 	//When sending a flush command with no receiver (e.g module crashed), it should fail but not block forever
 	//This includes the following test case: When sending a flush command to a goroutine which receives the
 	//command but never responds, it should fail but not block forever
-	c = getFlushChannel()
-	ret = flushHelper(c)
-	if ret {
+	c = std.getFlushChannel(nil)
+	_, err = std.flushHelper(c, "test", time.Second*time.Duration(std.config.FlushTimeout), nil)
+	if err == nil {
 		t.Fatalf("Flush helper succeeded although there was no receiver")
 	}
 
 	//Set flush timeout again to give the goroutine time to respond success to flush command
-	config.FlushTimeout = 2
+	std.config.FlushTimeout = 2
 
 	//When sending a flush command to a correctly behaving goroutine, it should succeed
-	c = getFlushChannel()
-	go func(ch chan (chan (bool))) {
+	c = std.getFlushChannel(nil)
+	go func(ch chan (chan (common.FlushResult))) {
 		//Block on c until we get something and send response immediately
 		ret := <-ch
-		ret <- true
+		ret <- common.FlushResult{}
 	}(c)
-	ret = flushHelper(c)
-	if !ret {
+	_, err = std.flushHelper(c, "test", time.Second*time.Duration(std.config.FlushTimeout), nil)
+	if err != nil {
 		t.Fatalf("Flush helper did not succeed although it should have")
 	}
 }
+
+//When flushing with a timeout, it should name the modules which did not respond in time
+func (s *Initialized) TestFlushWithTimeout(t *C) {
+	confirm := make(chan (bool), 1)
+	simulateModuleAndConfirm(std.getFlushChannel(nil), confirm)
+	t.Assert(FlushWithTimeout(time.Second), IsNil)
+
+	//The simulated module responds once only
+	std.getFlushChannel(new(fakeNamedModule))
+	t.Assert(FlushWithTimeout(10*time.Millisecond), ErrorMatches, "flush failed for module\\(s\\): unregistered, fake")
+}
+
+//When flushing with a report, it should sum up the messages flushed by each module and carry their errors
+func (s *Initialized) TestFlushWithReport(t *C) {
+	respond := func(c chan (chan (common.FlushResult)), res common.FlushResult) {
+		go func() {
+			ret := <-c
+			ret <- res
+		}()
+	}
+	respond(std.getFlushChannel(nil), common.FlushResult{Flushed: 3})
+	respond(std.getFlushChannel(new(fakeNamedModule)), common.FlushResult{Flushed: 1, Err: errors.New("disk full")})
+
+	report, err := FlushWithReport()
+	t.Assert(err, ErrorMatches, "flush failed for module\\(s\\): fake")
+	t.Assert(report.Flushed, Equals, 4)
+	t.Assert(report.Modules, HasLen, 2)
+	t.Assert(report.Modules[0], DeepEquals, ModuleFlush{Name: "unregistered", Flushed: 3})
+	t.Assert(report.Modules[1].Name, Equals, "fake")
+	t.Assert(report.Modules[1].Flushed, Equals, 1)
+	t.Assert(report.Modules[1].Err, ErrorMatches, "flush of module fake failed: disk full")
+}
+
+//When flushing a single module, it should only send the flush command to that module
+func (s *Initialized) TestFlushModule(t *C) {
+	named := new(fakeNamedModule)
+	confirm := make(chan (bool), 1)
+	other := std.getFlushChannel(nil)
+	simulateModuleAndConfirm(std.getFlushChannel(named), confirm)
+
+	t.Assert(FlushModule(named), IsNil)
+	t.Assert(<-confirm, Equals, true)
+	t.Assert(len(other), Equals, 0)
+
+	t.Assert(FlushModule(new(fakeLogModule)), ErrorMatches, "module \\*rlog.fakeLogModule not active")
+	ResetState()
+	t.Assert(FlushModule(named), ErrorMatches, "cannot flush module fake when logger not running")
+}
+
+//When flushing while a message is being pushed, it should wait for the push before the modules drain
+//their channels
+func (s *Initialized) TestFlushWaitsForPush(t *C) {
+	confirm := make(chan (bool), 1)
+	simulateModuleAndConfirm(std.getFlushChannel(nil), confirm)
+
+	//Start a push which does not end yet
+	slot := std.beginPush()
+	done := make(chan struct{})
+	go func() {
+		Flush()
+		close(done)
+	}()
+	select {
+	case <-confirm:
+		t.Fatal("modules flushed while a push was in progress")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	std.endPush(slot)
+	<-done
+	t.Assert(<-confirm, Equals, true)
+
+	//A push which does not end (e.g. blocked on a stuck module) delays the flush until its timeout only
+	slot = std.beginPush()
+	defer std.endPush(slot)
+	start := time.Now()
+	t.Assert(FlushWithTimeout(50*time.Millisecond), ErrorMatches, "flush failed for module\\(s\\): .*")
+	t.Assert(time.Since(start) < time.Second, Equals, true)
+}
+
+//When flushing with a context, its deadline should bound all modules together and cancellation should
+//abort the flush
+func (s *Initialized) TestFlushContext(t *C) {
+	confirm := make(chan (bool), 1)
+	simulateModuleAndConfirm(std.getFlushChannel(nil), confirm)
+	t.Assert(FlushContext(context.Background()), IsNil)
+
+	//The simulated module responds once only, the second one is not flushed anymore
+	std.getFlushChannel(new(fakeNamedModule))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	t.Assert(FlushContext(ctx), ErrorMatches, "flush failed for module\\(s\\): unregistered, fake: context deadline exceeded")
+	t.Assert(time.Since(start) < time.Second, Equals, true)
+
+	//A module not responding at all is abandoned on cancellation
+	std.flushChannels = list.New()
+	std.getFlushChannel(nil)
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	t.Assert(FlushContext(ctx), ErrorMatches, ".*: context canceled")
+}
+
+//When a concurrent flush is in progress, a flush with a deadline or context should wait for it until the
+//deadline or cancellation only
+func (s *Initialized) TestFlushWaitsForConcurrentFlush(t *C) {
+	//Hold the lock like a flush of a module which is slow to respond
+	t.Assert(std.lockFlush(time.Time{}, nil), Equals, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	t.Assert(FlushContext(ctx), ErrorMatches, "flush aborted while waiting for a concurrent flush: context deadline exceeded")
+	t.Assert(FlushWithTimeout(20*time.Millisecond), ErrorMatches, "flush aborted while waiting for a concurrent flush")
+	t.Assert(time.Since(start) < time.Second, Equals, true)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	t.Assert(FlushContext(ctx), ErrorMatches, "flush aborted .*: context canceled")
+
+	//Once the concurrent flush completes, flushes proceed
+	std.unlockFlush()
+	confirm := make(chan (bool), 1)
+	simulateModuleAndConfirm(std.getFlushChannel(nil), confirm)
+	t.Assert(FlushWithTimeout(time.Second), IsNil)
+	t.Assert(<-confirm, Equals, true)
+}
+
+//When an auto flush interval is configured, it should flush the modules periodically until the logger
+//is reset
+func (s *Initialized) TestAutoFlush(t *C) {
+	c := std.getFlushChannel(nil)
+	std.startAutoFlush(10 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case ret := <-c:
+			ret <- common.FlushResult{}
+		case <-time.After(time.Second):
+			t.Fatalf("Module not flushed by background flush")
+		}
+	}
+
+	//Once stopped, no further flush command is sent
+	ResetState()
+	t.Assert(std.autoFlushStop, IsNil)
+	select {
+	case ret, ok := <-c:
+		t.Assert(ok, Equals, false, Commentf("Unexpected flush command %v", ret))
+	case <-time.After(50 * time.Millisecond):
+		t.Fatalf("Flush channel not closed on reset")
+	}
+}
+
+//When rlog runs into a problem of its own, it should report it to the internal logger and carry on
+func (s *Initialized) TestInternalLogger(t *C) {
+	var buf bytes.Buffer
+	std.config.InternalLogger = log.New(&buf, "", 0)
+
+	//A corrupt channel list must not bring down the application
+	std.msgChannels = list.New()
+	std.msgChannels.PushBack("corrupt")
+	myChan := std.getMsgChannel(nil)
+	std.flushChannels = list.New()
+	std.flushChannels.PushBack("corrupt")
+
+	Info("still delivered")
+	t.Assert(nonBlockingChanRead(myChan).Msg, Equals, "still delivered")
+	t.Assert(FlushWithTimeout(time.Second), IsNil)
+	t.Assert(buf.String(), Equals, "[RightLog4Go] type assertion for msg channel failed, message not delivered\n"+
+		"[RightLog4Go] type assertion for flush channel failed\n")
+
+	buf.Reset()
+	std.msgChannels = list.New()
+	AddHook(SeverityTrace, func(*common.RlogMsg) { panic("hook failure") })
+	Info("hooked")
+	t.Assert(buf.String(), Equals, "[RightLog4Go] Log hook panicked: hook failure\n")
+}
+
+//When resetting the logger while logging, it should neither race nor push to modules which exited
+func (s *Uninitialized) TestResetWhileLogging(t *C) {
+	module := newFakeAttachedModule()
+	EnableModule(module)
+	conf := GetDefaultConfig()
+	conf.OverflowPolicy = Block
+	Start(conf)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			Info("message")
+		}
+	}()
+	ResetState()
+	wg.Wait()
+
+	select {
+	case <-module.done:
+	case <-time.After(time.Second):
+		t.Fatal("module did not exit")
+	}
+}
@@ -10,108 +10,456 @@ import (
 	"fmt"
 	"github.com/rightscale/rlog/common"
 	"log"
+	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 //logPieces keeps all raw information about a log message for further processing (formatting, etc.)
 type logPieces struct {
-	level      string              //log level.
-	msg        string              //log message
-	severity   common.RlogSeverity //log severity
-	posInfo    bool                //does the log message need to be accompanied by file and line number?
-	file       string              //file where log message was generated
-	line       int                 //line where log message was generated.
-	pc         uint                //program counter position where log message was generated
-	stackTrace string              //stack trace (for error and fatal only)
+	level      string                 //log level.
+	tag        string                 //log message tag ("" if no tag)
+	msg        string                 //log message
+	fields     map[string]interface{} //structured key/value pairs (nil if none)
+	severity   common.RlogSeverity    //log severity
+	posInfo    bool                   //does the log message need to be accompanied by file and line number?
+	file       string                 //file where log message was generated
+	line       int                    //line where log message was generated.
+	pc         uint                   //program counter position where log message was generated
+	funcName   string                 //function where log message was generated ("" unless configured)
+	stackTrace string                 //stack trace (for error and fatal only)
 }
 
 //genericLogHandler is called from various sources like info, error, errorT, etc. It gathers all the data
 //and controls the log message processing until the log message is distributed to the registered modules.
 //Arguments: [level]: log level as it should appear in the log output (INFO, ERROR, etc.).
-//[tag]: log message tag (nil if no tag). [format and a]: printf formatted message. [severity]: log message
-//severity. [posInfo]: True if log message should include file and line number
+//[tags]: log message tags (nil if no tag). [fields]: structured key/value pairs (nil if none). [format and a]: printf formatted message. [severity]: log message
+//severity. [posInfo]: True if log message should include file and line number. [skip]: number of additional
+//frames between the API function and the caller to report, see RlogConfig.CallerSkip (negative totals
+//count as 0). [err]: error logged by one of the Err methods, its stack trace is preferred (nil if none)
 //Returns: false if the logger is not initialized, true otherwise
-func genericLogHandler(level string, tag string, format string, a []interface{}, severity common.RlogSeverity, posInfo bool) bool {
+func (r *Instance) genericLogHandler(level string, tags []string, fields map[string]interface{}, format string, a []interface{}, severity common.RlogSeverity, posInfo bool, skip int, err error) bool {
 
-	if !initialized {
+	if !r.IsInitialized() {
 		//Ensure that logger is initialized
-		log.Printf("[ERROR] Logger not initialized, msg: "+format, a...)
+		r.internalf("[ERROR] Logger not initialized, msg: "+format, a...)
 		return false
 	}
 
-	if isFilteredSeverity(severity) || isFilteredTag(tag) {
-		//Drop message
+	if r.isSuppressed(severity) {
+		//Drop message, logging is muted
 		return true
 	}
 
-	//Gather data: create a struct to hold the raw data and fill it
-	logMsg := fmt.Sprintf(format, a...)
-	pc, file, line := getLogCallPos()
+	if r.isFiltered(severity, tags) {
+		//Drop message before paying for formatting, position and stack trace
+		return true
+	}
+
+	now := time.Now()
+	if !r.limiter.allow(severity, r.config.RateLimit, now) {
+		//Drop message, it is accounted for in the next summary of suppressed messages
+		return true
+	}
+	r.reportSuppressed(now)
+
+	//Gather data: create a struct to hold the raw data and fill it. It does not escape to the heap.
+	raw := logPieces{
+		level:    level,
+		tag:      strings.Join(tags, ","),
+		msg:      formatMsg(format, a),
+		fields:   copyFields(fields),
+		severity: severity,
+	}
 
-	trace := ""
-	if severity <= SeverityError {
-		//Obtain stack trace only for fatal and error
-		trace = getStackTrace()
+	if r.isDuplicate(&raw) {
+		//Drop message, it is accounted for in the summary when the dedupe window closes
+		return true
+	}
+
+	skip += r.config.CallerSkip
+	if skip < 0 {
+		//Frames below the API function are rlog internals, report the caller of the API function
+		skip = 0
+	}
+	if r.config.DisablePositionInfo {
+		//Skip the costly lookup of the log call position
+		posInfo = false
+	} else {
+		raw.pc, raw.file, raw.line = r.getLogCallPos(skip, posInfo)
+		if posInfo && r.config.IncludeFuncName {
+			raw.funcName = funcName(raw.pc)
+		}
+	}
+	raw.posInfo = posInfo
+
+	if r.hasStackTrace(severity) {
+		//Obtain stack trace only for severe messages (fatal and error by default), prefer the stack
+		//trace of a logged error
+		raw.stackTrace = errorStackTrace(err)
+		if raw.stackTrace == "" {
+			raw.stackTrace = r.getStackTrace(skip)
+		}
+		if r.config.StackTraceDedupeWindow > 0 {
+			//Reference stack traces logged recently by ID only
+			r.compressStackTrace(&raw, now)
+		}
 	}
 
-	raw := logPieces{level, logMsg, severity, posInfo, file, line, pc, trace}
+	r.dispatch(&raw)
+	return true
+}
+
+//dispatch creates the log message from raw log information and distributes it to hooks and modules.
+//A fatal message then terminates the process or invokes the fatal callback if configured.
+//Arguments: raw log information
+func (r *Instance) dispatch(raw *logPieces) {
+	sysLogMsg := r.deliver(raw)
 
+	if r.exitsOn(raw.severity) {
+		//Make sure the fatal message reached all modules before cleaning up and terminating
+		r.Flush()
+		if r.config.OnFatal != nil {
+			r.runOnFatal(r.config.OnFatal, sysLogMsg)
+		}
+		if r.config.FatalExits {
+			exitProcess(1)
+		}
+	} else if r.flushesOn(raw.severity) {
+		//Make sure the message is persisted in case the process crashes right after
+		r.Flush()
+	}
+}
+
+//deliver creates the log message from raw log information and distributes it to hooks and modules,
+//without handling fatal messages any further
+//Arguments: raw log information
+//Returns: message distributed
+func (r *Instance) deliver(raw *logPieces) *common.RlogMsg {
 	//Apply algorithm to create a nicely formatted log message as rlog message
-	sysLogMsg := raw.generateLogMsg()
+	sysLogMsg := r.generateLogMsg(raw)
+
+	//Notify hooks before the message is sent to the modules
+	r.runHooks(sysLogMsg)
 
 	//All processing completed, send log message to syslog
-	pushToChannels(sysLogMsg)
-	return true
+	r.pushToChannels(sysLogMsg)
+	return sysLogMsg
+}
+
+//exitsOn determines whether a message of the given severity terminates the process or invokes the fatal
+//callback, such a message is generated even if no module or hook receives it
+func (r *Instance) exitsOn(severity common.RlogSeverity) bool {
+	return severity == SeverityFatal && (r.config.FatalExits || r.config.OnFatal != nil)
+}
+
+//flushesOn determines whether logging a message of the given severity flushes all modules
+func (r *Instance) flushesOn(severity common.RlogSeverity) bool {
+	return r.config.FlushOnSeverity.includes(severity)
+}
+
+//runOnFatal invokes the fatal callback and recovers from a panic raised by it, so that the process
+//still exits if configured
+//Arguments: [fn] fatal callback. [msg] fatal message passed to the callback
+func (r *Instance) runOnFatal(fn func(*common.RlogMsg), msg *common.RlogMsg) {
+	defer func() {
+		if err := recover(); err != nil {
+			// Do not log callback failures using RightLog4Go because it would create a feedback loop
+			r.internalf("[RightLog4Go] OnFatal callback panicked: %v", err)
+		}
+	}()
+	fn(msg)
+}
+
+//internalf reports a problem of rlog itself (e.g. messages dropped because a module cannot keep up) to
+//the configured internal logger, or to the standard library logger if none is configured. Diagnostics
+//never go through rlog because it would create a feedback loop.
+//Arguments: printf formatted diagnostic
+func (r *Instance) internalf(format string, a ...interface{}) {
+	if r.config.InternalLogger != nil {
+		r.config.InternalLogger.Printf(format, a...)
+	} else {
+		log.Printf(format, a...)
+	}
+}
+
+//copyFields creates a private copy of the given fields so that the caller may modify its map once
+//the log call returned without affecting the message on its way to the modules.
+//Returns: copy of fields, nil if there are no fields
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	res := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		res[k] = v
+	}
+	return res
+}
+
+//mergeFields combines the fields of a logger with the fields of a log call. The fields of the log call
+//take precedence. Neither map is modified.
+//Returns: merged fields, nil if there are no fields
+func mergeFields(base map[string]interface{}, fields map[string]interface{}) map[string]interface{} {
+	if len(fields) == 0 {
+		return base
+	}
+	if len(base) == 0 {
+		return fields
+	}
+
+	res := make(map[string]interface{}, len(base)+len(fields))
+	for k, v := range base {
+		res[k] = v
+	}
+	for k, v := range fields {
+		res[k] = v
+	}
+	return res
+}
+
+//handlerFuncName is the fully qualified name of genericLogHandler, used to locate the boundary between
+//rlog internal frames and the caller's frames on the stack. Set in init to avoid an initialization cycle.
+var handlerFuncName string
+
+func init() {
+	handlerFuncName = runtime.FuncForPC(reflect.ValueOf((*Instance).genericLogHandler).Pointer()).Name()
+}
+
+//hasStackTrace determines whether a message of the given severity carries a stack trace
+func (r *Instance) hasStackTrace(severity common.RlogSeverity) bool {
+	return r.config.StackTraceMinSeverity.includes(severity)
 }
 
 //getStackTrace generates a stack trace
+//Arguments: number of frames to cut in addition to the rlog internal frames (e.g. of wrapper libraries)
 //Returns: stack trace
-func getStackTrace() string {
-	//Fetch stack, store in buffer (buffer size limited to 1KB) and convert it to string
-	buf := make([]byte, 2048)
-	n := runtime.Stack(buf, false)
-	str := string(buf[0:n])
-
-	//The stack trace is represented as lines (2 lines ==> 1 level in call hierarchy). Cut off the first
-	//4 hierarchy levels because they are rlog internal calls.
+func (r *Instance) getStackTrace(skip int) string {
+	str := r.stackDump()
+
+	//The stack trace is represented as lines (2 lines ==> 1 level in call hierarchy) following a header
+	//line. Cut off the header, stackDump and the rlog internal calls.
 	//With SplitAfterN, we split (on \n) the stack trace into cutLines substrings ([]string), where the
-	//last substring 	//will be the unsplit remainder. By taking [cutLines-1], we select exactly that
+	//last substring will be the unsplit remainder. By taking [cutLines-1], we select exactly that
 	//unsplit remainder which corresponds to the remainder of the stack trace.
-	cutLines := 8
-	res := strings.SplitAfterN(str, "\n", cutLines)[cutLines-1]
-	res = strings.TrimRight(res, "\n") // Remove trailing newline
+	cutLines := 2 + 2*(1+internalFrames(0)+skip)
+	lines := strings.SplitAfterN(str, "\n", cutLines)
+	if len(lines) < cutLines {
+		return ""
+	}
+	res := strings.TrimRight(lines[cutLines-1], "\n") // Remove trailing newline
+	return res
+}
+
+//stackDump fetches the stack of the calling goroutine and converts it to string. The buffer is grown
+//until the entire stack fits.
+//Returns: stack dump including the header line and stackDump itself
+func (r *Instance) stackDump() string {
+	size := int(r.config.StackBufferSize)
+	if size <= 0 {
+		size = defaultStackBufferSize
+	}
+	for {
+		buf := make([]byte, size)
+		n := runtime.Stack(buf, false)
+		if n < size {
+			return string(buf[0:n])
+		}
+		size *= 2
+	}
+}
+
+//internalFrames determines the number of rlog internal frames on top of the stack of the calling
+//function, i.e. the frames up to and including the API function invoked by the user. It relies on
+//every API function calling genericLogHandler directly.
+//Arguments: number of additional frames to skip (0 starts counting at the calling function)
+//Returns: number of internal frames, 0 if not called by genericLogHandler
+func internalFrames(skip int) int {
+	//Skip runtime.Callers and internalFrames itself
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for i := 0; ; i++ {
+		frame, more := frames.Next()
+		if frame.Function == handlerFuncName {
+			//The frame above genericLogHandler is the API function
+			return i + 2
+		}
+		if !more {
+			return 0
+		}
+	}
+}
+
+//formatMsg creates the message text of a log call. Messages without arguments are taken as they are:
+//a "%" in a plain message (e.g. "50% complete") must not be mangled into "%!c(MISSING)" and the
+//allocation of fmt.Sprintf is saved.
+//Arguments: [format] printf format. [a] arguments
+//Returns: message text
+func formatMsg(format string, a []interface{}) string {
+	if len(a) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, a...)
+}
+
+//sanitize replaces each byte of invalid UTF-8 sequences with the replacement character (U+FFFD) and
+//removes control characters (C0, DEL and C1, e.g. the terminal escape U+009B) except for newlines,
+//carriage returns and tabs, see RlogConfig.SanitizeMessages
+//Arguments: text to sanitize
+//Returns: sanitized text, the text itself if there is nothing to replace
+func sanitize(s string) string {
+	return strings.Map(func(c rune) rune {
+		if (c < ' ' && c != '\n' && c != '\r' && c != '\t') || (c >= 0x7f && c <= 0x9f) {
+			return -1
+		}
+		return c
+	}, s)
+}
+
+//sanitizeFields sanitizes the keys and the string values of structured fields, see sanitize
+//Arguments: fields to sanitize, not modified
+//Returns: sanitized fields, nil if there are no fields
+func sanitizeFields(fields map[string]interface{}) map[string]interface{} {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	res := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if s, ok := v.(string); ok {
+			v = sanitize(s)
+		}
+		res[sanitize(k)] = v
+	}
 	return res
 }
 
-//generateLogMsg generates the actual log message from raw log information
+//generateLogMsg generates the actual log message from raw log information. The message is not recycled
+//once written because modules and hooks may keep it (e.g. the memory module).
+//Arguments: raw log information
 //Returns: RlogMsg ready to send to the modules
-func (lp *logPieces) generateLogMsg() *common.RlogMsg {
+func (r *Instance) generateLogMsg(lp *logPieces) *common.RlogMsg {
 	sysLogMsg := new(common.RlogMsg)
 
-	//Add formatted log message to struct
-	header := formatHeaders(lp.posInfo, lp.level, lp.file, lp.line)
+	//Add formatted log message to struct. The built-in header leaves the position to the formatters (see
+	//common.FormatPosition), a custom header renders it itself
+	var header string
+	if r.config.HeaderFormatter != nil {
+		header = r.config.HeaderFormatter(lp.posInfo, lp.level, lp.tag, lp.file, lp.line)
+		sysLogMsg.PosInHeader = lp.posInfo
+	} else {
+		header = formatHeaders(false, lp.level, lp.tag, lp.file, lp.line)
+	}
+	if r.config.GlobalPrefix != "" {
+		//Identify the service in destinations shared with other services
+		header += r.config.GlobalPrefix + " "
+	}
 	sysLogMsg.Msg = header + lp.msg
 
 	//Set additional parameters
+	sysLogMsg.Fields = lp.fields
 	sysLogMsg.Severity = lp.severity
 	sysLogMsg.Pc = lp.pc
+	if lp.posInfo {
+		sysLogMsg.File = lp.file
+		sysLogMsg.Line = lp.line
+		sysLogMsg.Func = lp.funcName
+	}
 	sysLogMsg.StackTrace = lp.stackTrace
-	sysLogMsg.Timestamp = time.Now().Format(time.Stamp)
+	if r.config.SanitizeMessages {
+		//Binary data logged by accident must not corrupt terminals and log pipelines. The message
+		//includes the header and the global prefix.
+		sysLogMsg.Msg = sanitize(sysLogMsg.Msg)
+		sysLogMsg.StackTrace = sanitize(sysLogMsg.StackTrace)
+		sysLogMsg.Fields = sanitizeFields(sysLogMsg.Fields)
+	}
+	sysLogMsg.Time = r.timestampNow()
+	sysLogMsg.Timestamp = r.formatTimestamp(sysLogMsg.Time)
+	sysLogMsg.Seq = atomic.AddUint64(&r.seq, 1)
 
 	return sysLogMsg
 }
 
+//timestampNow determines the time of a new message. Timestamps never decrease, even if the wall clock
+//is set back, so that messages keep their order with sub-second layouts (e.g. time.StampNano). A clock
+//replaced by SetClock starts over.
+//Returns: current time (see SetClock) or the time of the latest message if the clock went backwards
+func (r *Instance) timestampNow() time.Time {
+	if gen := clockGeneration; atomic.LoadUint64(&r.lastClock) != gen {
+		atomic.StoreInt64(&r.lastTimestamp, 0)
+		atomic.StoreUint64(&r.lastClock, gen)
+	}
+	now := clock()
+	ns := now.UnixNano()
+	for {
+		last := atomic.LoadInt64(&r.lastTimestamp)
+		if ns <= last {
+			return time.Unix(0, last)
+		}
+		if atomic.CompareAndSwapInt64(&r.lastTimestamp, last, ns) {
+			return now
+		}
+	}
+}
+
+//timestampCache holds the latest formatted timestamp, reused for all messages of the same second
+type timestampCache struct {
+	layout    string //layout the timestamp was formatted with
+	utc       bool   //whether the time was converted to UTC
+	cacheable bool   //false if the layout has sub-second fields, the timestamp is not reused then
+	sec       int64  //second of the timestamp (unix time)
+	formatted string //formatted timestamp
+}
+
+//formatTimestamp formats the time of a log message according to the timestamp configuration. Layouts
+//without sub-second fields (e.g. the default time.Stamp) are formatted once per second only.
+//Returns: formatted timestamp
+func (r *Instance) formatTimestamp(t time.Time) string {
+	if r.config.TimestampUTC {
+		t = t.UTC()
+	}
+
+	layout := r.config.TimestampFormat
+	if layout == "" {
+		layout = time.Stamp
+	}
+
+	sec := t.Unix()
+	cache, _ := r.timestamps.Load().(*timestampCache)
+	if cache != nil && cache.cacheable && cache.sec == sec && cache.layout == layout && cache.utc == r.config.TimestampUTC {
+		return cache.formatted
+	}
+
+	formatted := t.Format(layout)
+	cacheable := cache != nil && cache.layout == layout && cache.cacheable
+	if cache == nil || cache.layout != layout {
+		//The layout has no sub-second fields if the first and the last instant of a second look the same
+		start := time.Unix(sec, 0).In(t.Location())
+		cacheable = start.Format(layout) == start.Add(time.Second-1).Format(layout)
+	}
+	r.timestamps.Store(&timestampCache{layout, r.config.TimestampUTC, cacheable, sec, formatted})
+	return formatted
+}
+
 //formatHeaders creates a log message header.
 //Arguments: [posInfo] determines whether file and line number should be included. [level] represents the log level
-//as string. [file] File causing log message. [line] Line number in file causing log message.
+//as string. [tag] log message tag ("" if no tag). [file] File causing log message. [line] Line number in
+//file causing log message.
 //Returns: Formatted header
-func formatHeaders(posInfo bool, level string, file string, line int) string {
+func formatHeaders(posInfo bool, level string, tag string, file string, line int) string {
 
 	var header string
 
+	if tag != "" {
+		//Add tag to log message
+		header += "{" + tag + "} "
+	}
+
 	if posInfo {
 		//Add file and line number to log message
 		header += "[" + file + ":" + strconv.Itoa(line) + "] "
@@ -120,23 +468,50 @@ func formatHeaders(posInfo bool, level string, file string, line int) string {
 	return header
 }
 
+//isFiltered determines whether a message shall be dropped before it is generated, because no module
+//or hook accepts its severity or because of its tags. Fatal messages terminating the process are only
+//filtered by their tags.
+func (r *Instance) isFiltered(severity common.RlogSeverity, tags []string) bool {
+	return (r.isFilteredByAllModules(severity) && r.isFilteredByAllHooks(severity) && !r.exitsOn(severity)) ||
+		r.isFilteredTags(tags)
+}
+
 //isFilteredSeverity determines whether the given log message shall be filtered because of
-//the severity configuration
-func isFilteredSeverity(severity common.RlogSeverity) bool {
-	return severity > config.Severity
+//the global severity configuration
+func (r *Instance) isFilteredSeverity(severity common.RlogSeverity) bool {
+	return severity > r.GetSeverity()
 }
 
-//isFilteredSeverity determines whether the given log message shall be filtered due to tag
-//configuration. A nil argument represents no tag
-func isFilteredTag(tag string) bool {
+//isFilteredTags determines whether the given log message shall be filtered due to tag configuration.
+//Each tag is checked separately, the message is filtered if no tag is allowed (TagMatchAny) or if any
+//tag is filtered (TagMatchAll). A message without tags is never filtered.
+func (r *Instance) isFilteredTags(tags []string) bool {
+	if len(tags) == 0 {
+		return false
+	}
+
+	for _, tag := range tags {
+		filtered := r.isFilteredTag(tag)
+		if r.config.TagMatch == TagMatchAll && filtered {
+			return true
+		}
+		if r.config.TagMatch != TagMatchAll && !filtered {
+			return false
+		}
+	}
+	return r.config.TagMatch != TagMatchAll
+}
+
+//isFilteredTag determines whether the given log message shall be filtered due to tag
+//configuration. An empty string represents no tag
+func (r *Instance) isFilteredTag(tag string) bool {
 
 	filtered := false
 	if tag != "" { // uncategorized log messages default to visible
-		if config.tagsEnabledExcept != nil {
-			filtered, _ = config.tagsEnabledExcept[tag]
-		} else if config.tagsDisabledExcept != nil {
-			filtered, _ = config.tagsDisabledExcept[tag]
-			filtered = !filtered
+		if r.config.tagsEnabledExcept != nil {
+			filtered = r.config.tagsEnabledExcept.contains(tag)
+		} else if r.config.tagsDisabledExcept != nil {
+			filtered = !r.config.tagsDisabledExcept.contains(tag)
 		}
 	}
 
@@ -144,16 +519,29 @@ func isFilteredTag(tag string) bool {
 }
 
 //getLogCallPos obtains information about the place of the rlog invocation.
-//Returns: program counter (pc), file and line of rlog invocation
-func getLogCallPos() (uint, string, int) {
+//Arguments: [skip] number of additional frames to skip, e.g. of wrapper libraries. [resolve] whether file
+//and line are needed, only the program counter is fetched otherwise
+//Returns: program counter (pc), file and line of rlog invocation ("" and 0 unless resolved)
+func (r *Instance) getLogCallPos(skip int, resolve bool) (uint, string, int) {
 	//Important: the information is fetched 3 levels up. Consider the following nested function call:
 	//a(b(c(getLogPos()))). getLogCallPos returns the context from method call b because this is where
-	//the user of rlog printed a message
+	//the user of rlog printed a message. Each skipped frame moves one level further up.
 
-	pc, file, line, ok := runtime.Caller(3)
+	if !resolve {
+		//In contrast to runtime.Caller, fetching the return address alone does not allocate. Callers
+		//counts itself as well.
+		var pcs [1]uintptr
+		if runtime.Callers(4+skip, pcs[:]) == 0 {
+			return 0, "", 0
+		}
+		//Adjust the return address to the call instruction like runtime.Caller does
+		return uint(pcs[0] - 1), "", 0
+	}
+
+	pc, file, line, ok := runtime.Caller(3 + skip)
 	if !ok {
-		log.Printf("Could not fetch log position information")
-		//Set values to unknown, do not print an error message as there is nothing we can do about it
+		r.internalf("[RightLog4Go] Could not fetch log position information")
+		//Set values to unknown, there is nothing else we can do about it
 		pc = 0
 		file = "unknown"
 		line = 0
@@ -161,3 +549,13 @@ func getLogCallPos() (uint, string, int) {
 
 	return uint(pc), file, line
 }
+
+//funcName resolves the function of the rlog invocation, see RlogConfig.IncludeFuncName
+//Arguments: program counter as obtained by getLogCallPos
+//Returns: function name qualified by the package name only (e.g. "rlog.Info"), "" if unknown
+func funcName(pc uint) string {
+	//CallersFrames accounts for inlined functions
+	frame, _ := runtime.CallersFrames([]uintptr{uintptr(pc)}).Next()
+	name := frame.Function
+	return name[strings.LastIndex(name, "/")+1:]
+}
@@ -3,25 +3,37 @@ These tests cover:
 - Message formatting
 - Stack trace creation
 - File and position calculation
+- Caller skip for wrapper libraries
+- Forcing position info on or off per call and per logger
+- Replacing the clock of message timestamps
+- Sanitizing invalid UTF-8 and control characters
+- Prefixing all messages with the global prefix
+- Numeric severity in formatted output
+- Function name in the header
+- Flush after severe messages
+- Skipping message generation without modules
 */
 package rlog
 
 import (
+	"container/list"
 	"github.com/rightscale/rlog/common"
 	. "launchpad.net/gocheck"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 )
 
 //Test log header formatting
 func (s *Stateless) TestFormatHeaders(t *C) {
 	level := "testLevel"
+	tag := "testTag"
 	file := "test/testfile.go"
 	line := 10
 
 	//When posInfo set to true, level, file and line should appear in the log header
-	header := formatHeaders(true, level, file, line)
+	header := formatHeaders(true, level, "", file, line)
 	if !strings.Contains(header, file) {
 		t.Fatalf("Expected file name in header. but header is only: " + header)
 	}
@@ -31,13 +43,113 @@ func (s *Stateless) TestFormatHeaders(t *C) {
 
 	//When posInfo set to false, level should appear in log header but
 	//file and line should not appear in log header
-	header = formatHeaders(false, level, file, line)
+	header = formatHeaders(false, level, "", file, line)
 	if strings.Contains(header, file) {
 		t.Fatalf("Expected no file name in header. but header is only: " + header)
 	}
 	if strings.Contains(header, strconv.Itoa(line)) {
 		t.Fatalf("Expected no line number in header. but header is only: " + header)
 	}
+
+	//When a tag is given, it should appear in the log header
+	header = formatHeaders(true, level, tag, file, line)
+	t.Assert(header, Equals, "{testTag} [test/testfile.go:10] ")
+	header = formatHeaders(false, level, tag, file, line)
+	t.Assert(header, Equals, "{testTag} ")
+}
+
+//When formatting a timestamp, it should apply the configured layout and time zone
+func (s *Initialized) TestFormatTimestamp(t *C) {
+	ts := time.Date(2014, time.March, 4, 5, 6, 7, 0, time.FixedZone("test", 3600))
+
+	//The default configuration keeps the local time in time.Stamp layout
+	t.Assert(std.formatTimestamp(ts), Equals, "Mar  4 05:06:07")
+
+	std.config.TimestampFormat = time.RFC3339
+	t.Assert(std.formatTimestamp(ts), Equals, "2014-03-04T05:06:07+01:00")
+
+	std.config.TimestampUTC = true
+	t.Assert(std.formatTimestamp(ts), Equals, "2014-03-04T04:06:07Z")
+
+	//Sub-second layouts distinguish messages within the same second
+	std.config.TimestampFormat = time.StampMicro
+	t.Assert(std.formatTimestamp(ts.Add(1500*time.Nanosecond)), Equals, "Mar  4 04:06:07.000001")
+}
+
+//When the wall clock is set back, message timestamps should not decrease
+func (s *Initialized) TestTimestampNowMonotonic(t *C) {
+	future := time.Now().Add(time.Hour)
+	std.lastTimestamp, std.lastClock = future.UnixNano(), clockGeneration
+	t.Assert(std.timestampNow().Equal(future), Equals, true)
+
+	std.lastTimestamp = 0
+	first := std.timestampNow()
+	t.Assert(std.timestampNow().Before(first), Equals, false)
+}
+
+//When the clock is replaced, even by an earlier one after messages were logged, messages should carry its
+//time and ResetState should restore time.Now
+func (s *Initialized) TestSetClock(t *C) {
+	std.config.TimestampFormat = time.RFC3339
+	std.config.TimestampUTC = true
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+	Info("now")
+	t.Assert(nonBlockingChanRead(myChan).Msg, Equals, "now")
+
+	frozen := time.Date(2014, time.March, 4, 5, 6, 7, 0, time.UTC)
+	SetClock(func() time.Time { return frozen })
+	Info("first")
+	Info("second")
+	for _, msg := range []string{"first", "second"} {
+		rlm := nonBlockingChanRead(myChan)
+		t.Assert(rlm.Msg, Equals, msg)
+		t.Assert(rlm.Time.Equal(frozen), Equals, true)
+		t.Assert(rlm.Timestamp, Equals, "2014-03-04T05:06:07Z")
+	}
+
+	ResetState()
+	t.Assert(clock().After(frozen), Equals, true)
+}
+
+//When sanitizing messages, invalid UTF-8 should be replaced and control characters other than newlines,
+//carriage returns and tabs stripped from messages, fields and the global prefix, only if enabled
+func (s *Initialized) TestSanitizeMessages(t *C) {
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+	fields := map[string]interface{}{"k\x1bey": "v\u009b31m", "n": 1}
+
+	NewLogger().WithFields(fields).Info("bad\x00 \xff\x1b[31mred\x7f\r\nnext\tcol é")
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm.Msg, Equals, "bad\x00 \xff\x1b[31mred\x7f\r\nnext\tcol é")
+	t.Assert(rlm.Fields, DeepEquals, fields)
+
+	std.config.SanitizeMessages = true
+	std.config.GlobalPrefix = "[app\x07]"
+	NewLogger().WithFields(fields).Info("bad\x00 \xff\x1b[31mred\x7f\u009b\r\nnext\tcol é")
+	rlm = nonBlockingChanRead(myChan)
+	t.Assert(rlm.Msg, Equals, "[app] bad \uFFFD[31mred\r\nnext\tcol é")
+	t.Assert(rlm.Fields, DeepEquals, map[string]interface{}{"key": "v31m", "n": 1})
+	t.Assert(fields["k\x1bey"], Equals, "v\u009b31m")
+
+	t.Assert(sanitize(""), Equals, "")
+	t.Assert(sanitize("\xe2\x82"), Equals, "\uFFFD\uFFFD")
+	t.Assert(sanitize("\u0080\u009f\u00a0"), Equals, "\u00a0")
+}
+
+//When a global prefix is configured, it should be inserted between the header and the message
+func (s *Initialized) TestGlobalPrefix(t *C) {
+	std.config.GlobalPrefix = "[payments:prod]"
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	Info("plain")
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm.Msg, Equals, "[payments:prod] plain")
+
+	InfoT("db", "tagged")
+	rlm = nonBlockingChanRead(myChan)
+	t.Assert(rlm.Msg, Equals, "{db} [payments:prod] tagged")
 }
 
 //When generateLogMessage is invoked, it should create a log message with the appropriate flags set
@@ -46,6 +158,96 @@ func (s *Stateless) TestGenerateLogMessage(t *C) {
 	generateLogMessage_helper(t, SeverityInfo)
 }
 
+//When formatting a message without arguments, it should take the format verbatim
+func (s *Stateless) TestFormatMsg(t *C) {
+	t.Assert(formatMsg("50% complete", nil), Equals, "50% complete")
+	t.Assert(formatMsg("value is %s", nil), Equals, "value is %s")
+	t.Assert(formatMsg("100%% of %s", []interface{}{"files"}), Equals, "100% of files")
+}
+
+//When a header formatter is configured, it should replace the built-in header. A header rendering the
+//position should keep the formatters from repeating it.
+func (s *Initialized) TestHeaderFormatter(t *C) {
+	std.config.HeaderFormatter = func(posInfo bool, level, tag, file string, line int) string {
+		if posInfo {
+			return level + "|" + file + ":" + strconv.Itoa(line) + "|"
+		}
+		return level + "|" + tag + "|"
+	}
+
+	raw := logPieces{
+		level:   "INFO",
+		tag:     "db",
+		msg:     "testMessage",
+		posInfo: true,
+		file:    "test/testfile.go",
+		line:    10,
+	}
+	rlm := std.generateLogMsg(&raw)
+	t.Assert(rlm.Msg, Equals, "INFO|test/testfile.go:10|testMessage")
+	t.Assert(common.FormatMessage(rlm, "", false), Matches, "[^\\[]*INFO\\|test/testfile.go:10\\|testMessage")
+	t.Assert(rlm.File, Equals, "test/testfile.go")
+	t.Assert(rlm.Line, Equals, 10)
+
+	//Without position info, the header is asked to leave it out
+	raw.posInfo = false
+	rlm = std.generateLogMsg(&raw)
+	t.Assert(rlm.Msg, Equals, "INFO|db|testMessage")
+	t.Assert(rlm.PosInHeader, Equals, false)
+}
+
+//When generating a log message with position info, it should carry file and line separately for
+//structured formats
+func (s *Stateless) TestGenerateLogMessagePosition(t *C) {
+	raw := logPieces{
+		level:   "INFO",
+		msg:     "testMessage",
+		posInfo: true,
+		file:    "test/testfile.go",
+		line:    10,
+	}
+	rlm := std.generateLogMsg(&raw)
+	t.Assert(rlm.File, Equals, "test/testfile.go")
+	t.Assert(rlm.Line, Equals, 10)
+	t.Assert(rlm.Msg, Equals, "testMessage")
+
+	raw.posInfo = false
+	rlm = std.generateLogMsg(&raw)
+	t.Assert(rlm.File, Equals, "")
+	t.Assert(rlm.Line, Equals, 0)
+}
+
+//When generating log messages, they should be numbered consecutively
+func (s *Stateless) TestGenerateLogMessageSeq(t *C) {
+	raw := logPieces{level: "INFO", msg: "testMessage"}
+	first := std.generateLogMsg(&raw).Seq
+	t.Assert(first > 0, Equals, true)
+	t.Assert(std.generateLogMsg(&raw).Seq, Equals, first+1)
+}
+
+//When generating a log message, it should carry the time of generation unformatted as well
+func (s *Stateless) TestGenerateLogMessageTime(t *C) {
+	raw := logPieces{level: "INFO", msg: "testMessage"}
+	before := time.Now().Add(-time.Second)
+	rlm := std.generateLogMsg(&raw)
+	t.Assert(rlm.Time.After(before), Equals, true)
+	t.Assert(rlm.Timestamp, Equals, std.formatTimestamp(rlm.Time))
+}
+
+//When a formatter has its own time layout, it should render the message time using that layout
+func (s *Stateless) TestFormatterTimeLayout(t *C) {
+	ts := time.Date(2014, 3, 4, 5, 6, 7, 0, time.UTC)
+	rlm := &common.RlogMsg{Msg: "started", Timestamp: "Mar  4 05:06:07", Time: ts}
+	t.Assert(common.DefaultFormatter{}.Format(rlm, ""), Equals, "Mar  4 05:06:07 started")
+	t.Assert(common.DefaultFormatter{TimeLayout: time.RFC3339}.Format(rlm, ""), Equals, "2014-03-04T05:06:07Z started")
+	t.Assert(strings.HasPrefix(common.LogfmtFormatter{TimeLayout: time.Kitchen}.Format(rlm, ""), "ts=5:06AM "), Equals, true)
+	t.Assert(rlm.Timestamp, Equals, "Mar  4 05:06:07")
+
+	//Without a time, the preformatted timestamp is used
+	rlm.Time = time.Time{}
+	t.Assert(common.JSONFormatter{TimeLayout: time.RFC3339}.Format(rlm, ""), Matches, `\{"timestamp":"Mar  4 05:06:07",.*`)
+}
+
 //generateLogMessage_helper tests the generateLogMsg algorithm.
 //Parameters: [t] Testing framework. [severity] Expected severity level
 func generateLogMessage_helper(t *C, severity common.RlogSeverity) {
@@ -55,8 +257,16 @@ func generateLogMessage_helper(t *C, severity common.RlogSeverity) {
 	line := 10
 	pc := uint(200)
 
-	rawTestInfo := logPieces{level, msg, severity, false, file, line, pc, "trace"}
-	rlm := rawTestInfo.generateLogMsg()
+	rawTestInfo := logPieces{
+		level:      level,
+		msg:        msg,
+		severity:   severity,
+		file:       file,
+		line:       line,
+		pc:         pc,
+		stackTrace: "trace",
+	}
+	rlm := std.generateLogMsg(&rawTestInfo)
 	if rlm.Pc != pc {
 		t.Fatalf("Expected PC to be %d, but it is: %d", pc, rlm.Pc)
 	}
@@ -77,7 +287,7 @@ func (*Uninitialized) TestGenericLogHandler(t *C) {
 	tag1 := "testTag1"
 
 	format, params := simulatePrintf("test - %d\n", 10)
-	ret := genericLogHandler(level, tag1, format, params, SeverityError, false)
+	ret := std.genericLogHandler(level, []string{tag1}, nil, format, params, SeverityError, false, 0, nil)
 	if ret {
 		t.Fatalf("genericLogHandler should have failed because the logger was not initialized")
 	}
@@ -88,15 +298,28 @@ func (s *Stateless) TestGetLogCallPos(t *C) {
 
 	file, line, logMsg := getCurrentStackEnvironment()
 
-	if !strings.Contains(logMsg.Msg, file) {
-		t.Fatalf("Error log message does not contain correct file path (or no file path). Expecting: %s, msg: %s", file, logMsg.Msg)
+	if logMsg.File != file {
+		t.Fatalf("Error log message does not carry correct file path (or no file path). Expecting: %s, file: %s", file, logMsg.File)
 	}
 
-	if !strings.Contains(logMsg.Msg, line) {
-		t.Fatalf("Error log message does not contain correct line in file (or no line). Expecting %s, msg: %s", line, logMsg.Msg)
+	if strconv.Itoa(logMsg.Line) != line {
+		t.Fatalf("Error log message does not carry correct line in file (or no line). Expecting %s, line: %d", line, logMsg.Line)
 	}
 }
 
+//When position info is disabled, it should neither look up nor print the position of the log call
+func (s *Initialized) TestDisablePositionInfo(t *C) {
+	std.config.DisablePositionInfo = true
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	Error("test message")
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm, NotNil)
+	t.Assert(rlm.Msg, Equals, "test message")
+	t.Assert(rlm.Pc, Equals, uint(0))
+}
+
 //When creating a log entry accompanied by a stack trace, it should create a stack trace starting at the position
 //where the log message was created
 func (s *Stateless) TestGetStackTrace(t *C) {
@@ -115,16 +338,149 @@ func (s *Stateless) TestGetStackTrace(t *C) {
 	}
 }
 
+//When the stack trace does not fit the configured buffer, it should grow the buffer instead of
+//truncating the trace
+func (s *Initialized) TestGetStackTraceBufferGrowth(t *C) {
+	std.config.StackBufferSize = 16
+	trace := nestedStackTrace(10)
+
+	//The trace should start at the nested call and end at the test runner
+	t.Assert(strings.HasPrefix(trace, "github.com/rightscale/rlog.nestedStackTrace"), Equals, true)
+	t.Assert(strings.Contains(trace, "TestGetStackTraceBufferGrowth"), Equals, true)
+	t.Assert(strings.Count(trace, "nestedStackTrace("), Equals, 11)
+}
+
+//nestedStackTrace logs an error after the given number of nested calls and returns its stack trace
+func nestedStackTrace(depth int) string {
+	if depth > 0 {
+		return nestedStackTrace(depth - 1)
+	}
+
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+	Error("nested")
+	return nonBlockingChanRead(myChan).StackTrace
+}
+
+//When configuring the stack trace threshold, it should attach stack traces accordingly
+func (s *Initialized) TestHasStackTrace(t *C) {
+	//By default, only fatal and error carry a stack trace
+	t.Assert(std.hasStackTrace(SeverityFatal), Equals, true)
+	t.Assert(std.hasStackTrace(SeverityError), Equals, true)
+	t.Assert(std.hasStackTrace(SeverityWarning), Equals, false)
+
+	std.config.StackTraceMinSeverity = ThresholdAt(SeverityWarning)
+	t.Assert(std.hasStackTrace(SeverityWarning), Equals, true)
+	t.Assert(std.hasStackTrace(SeverityInfo), Equals, false)
+
+	std.config.StackTraceMinSeverity = StackTraceDisabled
+	t.Assert(std.hasStackTrace(SeverityFatal), Equals, false)
+	t.Assert(std.hasStackTrace(SeverityTrace), Equals, false)
+
+	//The zero value of a configuration disables stack traces
+	var conf RlogConfig
+	t.Assert(conf.StackTraceMinSeverity.includes(SeverityFatal), Equals, false)
+}
+
+//When configuring a flush severity, messages of that severity or more severe should flush all modules
+//before the log call returns
+func (s *Initialized) TestFlushOnSeverity(t *C) {
+	//Disabled by default, also by the zero value of a configuration
+	t.Assert(std.flushesOn(SeverityFatal), Equals, false)
+	var conf RlogConfig
+	t.Assert(conf.FlushOnSeverity.includes(SeverityFatal), Equals, false)
+
+	std.config.FlushOnSeverity = ThresholdAt(SeverityError)
+	t.Assert(std.flushesOn(SeverityFatal), Equals, true)
+	t.Assert(std.flushesOn(SeverityError), Equals, true)
+	t.Assert(std.flushesOn(SeverityWarning), Equals, false)
+
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+	std.flushChannels = list.New()
+	c := std.getFlushChannel(nil)
+
+	flushed := make(chan bool, 10)
+	go func() {
+		for ret := range c {
+			flushed <- true
+			ret <- common.FlushResult{}
+		}
+	}()
+
+	Error("about to crash")
+	t.Assert(nonBlockingChanRead(myChan).Msg, Matches, ".*about to crash")
+	select {
+	case <-flushed:
+	default:
+		t.Fatalf("Module not flushed after error message")
+	}
+
+	Warning("not severe enough")
+	t.Assert(nonBlockingChanRead(myChan).Msg, Equals, "not severe enough")
+	select {
+	case <-flushed:
+		t.Fatalf("Module flushed after warning message")
+	default:
+	}
+}
+
+//When no module is enabled, it should not generate messages unless a hook receives them or the
+//process terminates on them
+func (s *Initialized) TestNoModules(t *C) {
+	generated := 0
+	std.config.HeaderFormatter = func(posInfo bool, level, tag, file string, line int) string {
+		generated++
+		return ""
+	}
+
+	std.msgChannels = list.New()
+	t.Assert(std.isFilteredByAllModules(SeverityFatal), Equals, true)
+	Error("nobody listens")
+	Fatal("nobody listens")
+	t.Assert(generated, Equals, 0)
+
+	//A hook receives the message
+	var hooked []string
+	AddHook(SeverityError, func(m *common.RlogMsg) { hooked = append(hooked, m.Msg) })
+	Error("hooked")
+	t.Assert(generated, Equals, 1)
+	t.Assert(hooked, DeepEquals, []string{"hooked"})
+}
+
 func (s *Initialized) TestIsFilteredSeverity(t *C) {
-	config.Severity = SeverityError
-	config.SeverityFromString("warning")
+	std.config.Severity = SeverityError
+	std.config.SeverityFromString("warning")
+	SetSeverity(std.config.Severity)
+
+	//It should filter trace, debug and info
+	t.Assert(std.isFilteredSeverity(SeverityTrace), Equals, true)
+	t.Assert(std.isFilteredSeverity(SeverityDebug), Equals, true)
+	t.Assert(std.isFilteredSeverity(SeverityInfo), Equals, true)
+	t.Assert(std.isFilteredSeverity(SeverityWarning), Equals, false)
+	t.Assert(std.isFilteredSeverity(SeverityError), Equals, false)
+	t.Assert(std.isFilteredSeverity(SeverityFatal), Equals, false)
+
+	//Trace is the most verbose severity, nothing should be filtered
+	std.config.SeverityFromString("trace")
+	t.Assert(std.config.Severity, Equals, SeverityTrace)
+	SetSeverity(std.config.Severity)
+	t.Assert(std.isFilteredSeverity(SeverityTrace), Equals, false)
+	t.Assert(std.isFilteredSeverity(SeverityDebug), Equals, false)
+}
+
+//When converting a severity name, it should accept aliases and report unknown names
+func (s *Stateless) TestSeverityFromString(t *C) {
+	var conf RlogConfig
+	t.Assert(conf.SeverityFromString("warn"), IsNil)
+	t.Assert(conf.Severity, Equals, SeverityWarning)
+	t.Assert(conf.SeverityFromString("ERR"), IsNil)
+	t.Assert(conf.Severity, Equals, SeverityError)
 
-	//It should filter debug and info
-	t.Assert(isFilteredSeverity(SeverityDebug), Equals, true)
-	t.Assert(isFilteredSeverity(SeverityInfo), Equals, true)
-	t.Assert(isFilteredSeverity(SeverityWarning), Equals, false)
-	t.Assert(isFilteredSeverity(SeverityError), Equals, false)
-	t.Assert(isFilteredSeverity(SeverityFatal), Equals, false)
+	//Unknown names leave the severity unchanged
+	t.Assert(conf.SeverityFromString("verbose"), ErrorMatches, "Unknown severity: verbose")
+	t.Assert(conf.Severity, Equals, SeverityError)
+	t.Assert(func() { conf.MustSeverityFromString("verbose") }, PanicMatches, "Unknown severity: verbose")
 }
 
 func (s *Initialized) TestIsFilteredTag(t *C) {
@@ -132,16 +488,64 @@ func (s *Initialized) TestIsFilteredTag(t *C) {
 	const tag2 string = "tag2"
 
 	//Test EnableTagsExcept
-	config.EnableTagsExcept([]string{tag1})
-	t.Assert(isFilteredTag(tag1), Equals, true)
-	t.Assert(isFilteredTag(tag2), Equals, false)
-	t.Assert(isFilteredTag(""), Equals, false)
+	std.config.EnableTagsExcept([]string{tag1})
+	t.Assert(std.isFilteredTag(tag1), Equals, true)
+	t.Assert(std.isFilteredTag(tag2), Equals, false)
+	t.Assert(std.isFilteredTag(""), Equals, false)
 
 	//Test DisableTagsExcept
-	config.DisableTagsExcept([]string{tag1})
-	t.Assert(isFilteredTag(tag1), Equals, false)
-	t.Assert(isFilteredTag(tag2), Equals, true)
-	t.Assert(isFilteredTag(""), Equals, false)
+	std.config.DisableTagsExcept([]string{tag1})
+	t.Assert(std.isFilteredTag(tag1), Equals, false)
+	t.Assert(std.isFilteredTag(tag2), Equals, true)
+	t.Assert(std.isFilteredTag(""), Equals, false)
+}
+
+//When tags contain wildcards, they should match hierarchical tags while plain tags match exactly
+func (s *Initialized) TestIsFilteredTagPattern(t *C) {
+	std.config.DisableTagsExcept([]string{"db.*", "http"})
+	t.Assert(std.isFilteredTag("db.query"), Equals, false)
+	t.Assert(std.isFilteredTag("db.query.slow"), Equals, false)
+	t.Assert(std.isFilteredTag("db"), Equals, true)
+	t.Assert(std.isFilteredTag("http"), Equals, false)
+	t.Assert(std.isFilteredTag("http.request"), Equals, true)
+
+	std.config.EnableTagsExcept([]string{"*.debug"})
+	t.Assert(std.isFilteredTag("db.debug"), Equals, true)
+	t.Assert(std.isFilteredTag("db.query"), Equals, false)
+}
+
+//When matching tag patterns, "*" should match any sequence of characters
+func (s *Stateless) TestMatchTagPattern(t *C) {
+	t.Assert(matchTagPattern("*", ""), Equals, true)
+	t.Assert(matchTagPattern("db.*", "db."), Equals, true)
+	t.Assert(matchTagPattern("db.*", "dbx"), Equals, false)
+	t.Assert(matchTagPattern("db.*.slow", "db.query.slow"), Equals, true)
+	t.Assert(matchTagPattern("db.*.slow", "db.query.fast"), Equals, false)
+	t.Assert(matchTagPattern("a*a", "a"), Equals, false)
+	t.Assert(matchTagPattern("a*b*c", "abbc"), Equals, true)
+}
+
+//When a message carries several tags, it should pass if any tag is enabled or, with TagMatchAll, only
+//if all tags are enabled
+func (s *Initialized) TestIsFilteredTags(t *C) {
+	std.config.DisableTagsExcept([]string{"db", "prod"})
+	t.Assert(std.isFilteredTags(nil), Equals, false)
+	t.Assert(std.isFilteredTags([]string{"db", "staging"}), Equals, false)
+	t.Assert(std.isFilteredTags([]string{"http", "staging"}), Equals, true)
+
+	std.config.TagMatch = TagMatchAll
+	t.Assert(std.isFilteredTags([]string{"db", "staging"}), Equals, true)
+	t.Assert(std.isFilteredTags([]string{"db", "prod"}), Equals, false)
+
+	//The tags appear in the header and the single tag API keeps working
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+	InfoTags([]string{"db", "prod"}, "test message")
+	t.Assert(nonBlockingChanRead(myChan).Msg, Equals, "{db,prod} test message")
+	InfoT("db", "test message")
+	t.Assert(nonBlockingChanRead(myChan).Msg, Equals, "{db} test message")
+	InfoT("staging", "test message")
+	t.Assert(nonBlockingChanRead(myChan), IsNil)
 }
 
 //getCurrentStackEnvironment resets the logger, generates and error message and intercepts it. It furthermore
@@ -150,7 +554,7 @@ func (s *Initialized) TestIsFilteredTag(t *C) {
 func getCurrentStackEnvironment() (string, string, *common.RlogMsg) {
 	//Reset state and capture output using our own channel
 	resetAndInitialize()
-	myChan := getMsgChannel()
+	myChan := std.getMsgChannel(nil)
 
 	//Obtain information about our file and position (baseline). Afterwards, write error message and intercept it
 	_, file, myLine, _ := runtime.Caller(0)
@@ -163,6 +567,217 @@ func getCurrentStackEnvironment() (string, string, *common.RlogMsg) {
 	return file, strconv.Itoa(myLine), logMsg
 }
 
+//When logging through a wrapper, skipping its frame should report the position and stack trace of the
+//wrapper's caller, either per call or by configuration
+func (s *Initialized) TestCallerSkip(t *C) {
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	_, file, line, _ := runtime.Caller(0)
+	wrappedError(1, "skip test")
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm.File, Equals, file)
+	t.Assert(rlm.Line, Equals, line+1)
+	t.Assert(strings.HasPrefix(rlm.StackTrace, "github.com/rightscale/rlog.(*Initialized).TestCallerSkip"), Equals, true)
+
+	std.config.CallerSkip = 1
+	_, _, line, _ = runtime.Caller(0)
+	wrappedError(0, "skip test")
+	rlm = nonBlockingChanRead(myChan)
+	t.Assert(rlm.Line, Equals, line+1)
+}
+
+//When the skip is negative, per call or by configuration, it should report the caller of the API
+//function instead of panicking
+func (s *Initialized) TestNegativeCallerSkip(t *C) {
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	_, file, line, _ := runtime.Caller(0)
+	ErrorSkip(-5, "negative skip")
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm.File, Equals, file)
+	t.Assert(rlm.Line, Equals, line+1)
+	t.Assert(strings.HasPrefix(rlm.StackTrace, "github.com/rightscale/rlog.(*Initialized).TestNegativeCallerSkip"), Equals, true)
+
+	std.config.CallerSkip = -3
+	_, _, line, _ = runtime.Caller(0)
+	Error("negative caller skip")
+	rlm = nonBlockingChanRead(myChan)
+	t.Assert(rlm.Line, Equals, line+1)
+}
+
+//When forcing position info on a logger, it should be included or omitted regardless of the severity
+func (s *Initialized) TestPositionOverride(t *C) {
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	//The override is kept when adding fields
+	_, file, line, _ := runtime.Caller(0)
+	NewLogger().WithPosInfo(true).WithFields(map[string]interface{}{"k": 1}).Info("with position")
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm.File, Equals, file)
+	t.Assert(rlm.Line, Equals, line+1)
+
+	NewLogger().WithPosInfo(false).Error("without position")
+	rlm = nonBlockingChanRead(myChan)
+	t.Assert(rlm.File, Equals, "")
+	t.Assert(rlm.Line, Equals, 0)
+	t.Assert(rlm.StackTrace, Not(Equals), "")
+
+	NewLogger().Info("default")
+	rlm = nonBlockingChanRead(myChan)
+	t.Assert(rlm.Line, Equals, 0)
+}
+
+//When forcing position info per call, it should be included or omitted regardless of the severity
+func (s *Initialized) TestPositionOverridePerCall(t *C) {
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	_, file, line, _ := runtime.Caller(0)
+	InfoPos("with position")
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm.File, Equals, file)
+	t.Assert(rlm.Line, Equals, line+1)
+	t.Assert(rlm.Severity, Equals, SeverityInfo)
+
+	ErrorNoPos("without position")
+	rlm = nonBlockingChanRead(myChan)
+	t.Assert(rlm.File, Equals, "")
+	t.Assert(rlm.Line, Equals, 0)
+	t.Assert(rlm.Severity, Equals, SeverityError)
+	t.Assert(rlm.StackTrace, Not(Equals), "")
+}
+
+//When converting a severity to text, it should use the same name in all places
+func (s *Stateless) TestSeverityString(t *C) {
+	t.Assert(SeverityWarning.String(), Equals, "warning")
+	t.Assert(common.RlogSeverity(9).String(), Equals, "9")
+	t.Assert(levelName(SeverityWarning), Equals, "WARNING")
+	t.Assert(common.LogfmtFormatter{}.Format(&common.RlogMsg{Severity: SeverityDebug}, ""), Matches, ".* level=debug .*")
+}
+
+//When formatting with numeric severity, the syslog priority should be emitted alongside the level
+func (s *Stateless) TestNumericSeverity(t *C) {
+	t.Assert(common.SyslogPriority(SeverityFatal), Equals, 2)
+	t.Assert(common.SyslogPriority(SeverityWarning), Equals, 4)
+	t.Assert(common.SyslogPriority(SeverityTrace), Equals, 7)
+
+	rlm := &common.RlogMsg{Msg: "disk full", Timestamp: "ts", Severity: SeverityError}
+	t.Assert(common.DefaultFormatter{NumericSeverity: true}.Format(rlm, "host: "), Equals, "<3>ts host: disk full")
+	t.Assert(common.DefaultFormatter{}.Format(rlm, "host: "), Equals, "ts host: disk full")
+	t.Assert(common.LogfmtFormatter{NumericSeverity: true}.Format(rlm, ""), Equals,
+		`ts=ts level=error priority=3 seq=0 msg="disk full"`)
+	t.Assert(strings.Contains(common.JSONFormatter{NumericSeverity: true}.Format(rlm, ""), `"priority":3,`), Equals, true)
+	t.Assert(strings.Contains(common.JSONFormatter{}.Format(rlm, ""), `"priority"`), Equals, false)
+}
+
+//When the function name is included, it should be carried alongside file and line and appear in front
+//of the file in the formatted position
+func (s *Initialized) TestIncludeFuncName(t *C) {
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	std.config.IncludeFuncName = true
+	Error("located")
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm.Msg, Equals, "located")
+	t.Assert(rlm.Func, Equals, "rlog.(*Initialized).TestIncludeFuncName")
+	t.Assert(common.FormatPosition(rlm), Matches, `\[rlog\.\(\*Initialized\)\.TestIncludeFuncName .*msgGeneration_test\.go:\d+\] `)
+
+	//Messages without position info do not carry the function either
+	Info("unlocated")
+	rlm = nonBlockingChanRead(myChan)
+	t.Assert(rlm.Func, Equals, "")
+	t.Assert(common.FormatPosition(rlm), Equals, "")
+	t.Assert(funcName(0), Equals, "")
+}
+
+//When formatting a message carrying its position, each formatter should render file, line and
+//function in its own way
+func (s *Stateless) TestFormatPosition(t *C) {
+	rlm := &common.RlogMsg{Msg: "{db} disk full", Timestamp: "ts", File: "main.go", Line: 42, Func: "main.run"}
+	t.Assert(common.DefaultFormatter{}.Format(rlm, "host: "), Equals, "ts host: [main.run main.go:42] {db} disk full")
+	t.Assert(common.LogfmtFormatter{}.Format(rlm, ""), Equals,
+		`ts=ts level=fatal seq=0 msg="{db} disk full" file=main.go line=42 func=main.run`)
+	t.Assert(common.JSONFormatter{}.Format(rlm, ""), Matches,
+		`.*"message":"\{db\} disk full","file":"main.go","line":42,"func":"main.run",.*`)
+
+	rlm.Func = ""
+	t.Assert(common.FormatPosition(rlm), Equals, "[main.go:42] ")
+}
+
+//When removing newlines, it should use the configured replacement and two spaces by default
+func (s *Stateless) TestNewlineReplacement(t *C) {
+	rlm := &common.RlogMsg{Msg: "first\r\nsecond\n\tindented", Timestamp: "ts", StackTrace: "frame 1\nframe 2"}
+
+	t.Assert(common.DefaultFormatter{RemoveNewlines: true}.Format(rlm, ""), Equals,
+		"ts first  second  indented, trace: frame 1  frame 2")
+	escaping := common.DefaultFormatter{RemoveNewlines: true, Newlines: common.NewlineReplacement{Newline: `\n`, Tab: `\t`}}
+	t.Assert(escaping.Format(rlm, ""), Equals, `ts first\nsecond\n\tindented, trace: frame 1\nframe 2`)
+	t.Assert(common.NewlineReplacement{Newline: " | "}.Replace("a\nb\tc"), Equals, "a | bc")
+
+	//The replacement only applies to the text format and only if newlines are removed
+	separating := common.NewlineReplacement{Newline: " | "}
+	t.Assert(common.WithNewlineReplacement(common.DefaultFormatter{}, separating).Format(rlm, ""), Equals,
+		"ts first\r\nsecond\n\tindented\nframe 1\nframe 2")
+	t.Assert(common.WithNewlineReplacement(common.JSONFormatter{}, separating), Equals, common.JSONFormatter{})
+}
+
+//When keeping newlines with a continuation prefix, it should mark all lines of the entry but the first
+func (s *Stateless) TestContinuationPrefix(t *C) {
+	rlm := &common.RlogMsg{Msg: "first\nsecond", Timestamp: "ts", StackTrace: "frame 1\nframe 2\n"}
+
+	t.Assert(common.DefaultFormatter{ContinuationPrefix: "| "}.Format(rlm, ""), Equals,
+		"ts first\n| second\n| frame 1\n| frame 2\n")
+	t.Assert(common.DefaultFormatter{ContinuationPrefix: "| "}.Format(&common.RlogMsg{Msg: "single", Timestamp: "ts"}, ""),
+		Equals, "ts single")
+
+	//Removed newlines leave no lines to mark
+	t.Assert(common.DefaultFormatter{RemoveNewlines: true, ContinuationPrefix: "| "}.Format(rlm, ""), Equals,
+		"ts first  second, trace: frame 1  frame 2")
+}
+
+//When fetching the position without file and line, it should report the same pc as with them
+func (s *Stateless) TestGetLogCallPosPc(t *C) {
+	var pcs [2]uint
+	for i := range pcs {
+		pcs[i] = callPosApi(i == 0)
+	}
+	t.Assert(pcs[0], Not(Equals), uint(0))
+	t.Assert(pcs[1], Equals, pcs[0])
+}
+
+//callPosApi and callPosHandler simulate the frames of an API function and genericLogHandler
+func callPosApi(resolve bool) uint {
+	return callPosHandler(resolve)
+}
+
+func callPosHandler(resolve bool) uint {
+	pc, _, _ := std.getLogCallPos(0, resolve)
+	return pc
+}
+
+//When formatting timestamps of the same second, it should reuse the timestamp unless the layout has
+//sub-second fields
+func (s *Initialized) TestFormatTimestampCache(t *C) {
+	ts := time.Date(2014, 3, 4, 5, 6, 7, 0, time.UTC)
+	std.config.TimestampUTC = true
+	t.Assert(std.formatTimestamp(ts), Equals, "Mar  4 05:06:07")
+	t.Assert(std.formatTimestamp(ts.Add(999*time.Millisecond)), Equals, "Mar  4 05:06:07")
+	t.Assert(std.formatTimestamp(ts.Add(time.Second)), Equals, "Mar  4 05:06:08")
+
+	std.config.TimestampFormat = time.StampMilli
+	t.Assert(std.formatTimestamp(ts), Equals, "Mar  4 05:06:07.000")
+	t.Assert(std.formatTimestamp(ts.Add(999*time.Millisecond)), Equals, "Mar  4 05:06:07.999")
+}
+
+//wrappedError simulates a wrapper library logging on behalf of its caller
+func wrappedError(skip int, msg string) {
+	ErrorSkip(skip, msg)
+}
+
 //simulatePrintf is a helper function converting variadic to slice
 func simulatePrintf(format string, a ...interface{}) (string, []interface{}) {
 	return format, a
@@ -0,0 +1,56 @@
+package rlog
+
+/*
+This file implements the null module which discards all log messages. It allows to measure the overhead
+of the message generation without any I/O and to disable output without removing the rlog calls.
+*/
+
+import (
+	"github.com/rightscale/rlog/common"
+)
+
+//nullLogger is an output module discarding all messages
+type nullLogger struct{}
+
+//NewNullLogger creates an output module which consumes all log messages without writing them anywhere
+//Returns: null module
+func NewNullLogger() *nullLogger {
+	return new(nullLogger)
+}
+
+//Name names the module for rlog diagnostics and statistics
+func (n *nullLogger) Name() string {
+	return "null"
+}
+
+//WriteSync discards a message when rlog runs in synchronous mode
+//Arguments: [msg] message to discard. [prefix] log prefix
+func (n *nullLogger) WriteSync(msg *common.RlogMsg, prefix string) {
+}
+
+//FlushSync does nothing as there is nothing to write back
+func (n *nullLogger) FlushSync() {
+}
+
+//LaunchModule is intended to run in a separate goroutine and used by rlog internally. It drains the
+//data channel and acknowledges flush commands with the number of messages discarded.
+//Arguments: [dataChan] Channel to receive log messages. [flushChan] Channel to receive flush command
+func (n *nullLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
+	for {
+		select {
+		case <-dataChan:
+			//Discard message
+		case ret, ok := <-flushChan:
+			//Discard pending messages
+			flushed := 0
+			for nonBlockingChanRead(dataChan) != nil {
+				flushed++
+			}
+			if !ok {
+				//Flush channel closed by rlog: exit
+				return
+			}
+			ret <- common.FlushResult{Flushed: flushed}
+		}
+	}
+}
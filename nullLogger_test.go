@@ -0,0 +1,75 @@
+/*
+These tests cover:
+- Consumption of messages by the null module
+- Throughput of the message generation (benchmark)
+- Allocations per log call
+*/
+package rlog
+
+import (
+	. "launchpad.net/gocheck"
+	"testing"
+)
+
+//startNullLogger resets the logger and starts it with the null module as only module
+func startNullLogger() {
+	ResetState()
+	EnableModule(NewNullLogger())
+	Start(GetDefaultConfig())
+}
+
+//When logging to the null module, it should consume all messages and acknowledge flush commands
+func (s *Uninitialized) TestNullLogger(t *C) {
+	startNullLogger()
+	capacity := int(GetDefaultConfig().ChanCapacity)
+
+	//Each batch fills the channel, which only fits if the previous batch has been consumed
+	for batch := 0; batch < 3; batch++ {
+		for i := 0; i < capacity; i++ {
+			Info("test message %d", i)
+		}
+		Flush()
+	}
+
+	stats := Stats()
+	t.Assert(stats.Enqueued, Equals, uint64(3*capacity))
+	t.Assert(stats.Dropped, Equals, uint64(0))
+	t.Assert(stats.FlushTimeouts, Equals, uint64(0))
+}
+
+//Measure the throughput of Info without I/O, run with: go test -gocheck.b
+func (s *Uninitialized) BenchmarkInfoNullLogger(t *C) {
+	startNullLogger()
+	t.ResetTimer()
+
+	for i := 0; i < t.N; i++ {
+		Info("test message %d", i)
+	}
+	Flush()
+}
+
+//Measure the throughput of Info with a constant message, which takes the allocation free path for the
+//message text, run with: go test -gocheck.b
+func (s *Uninitialized) BenchmarkInfoConstantNullLogger(t *C) {
+	startNullLogger()
+	t.ResetTimer()
+
+	for i := 0; i < t.N; i++ {
+		Info("test message")
+	}
+	Flush()
+}
+
+//When logging a constant message without position info, only the message itself should be allocated:
+//neither the message text, the timestamp nor the position lookup allocate per call
+func (s *Uninitialized) TestInfoAllocations(t *C) {
+	ResetState()
+	EnableModule(NewNullLogger())
+	conf := GetDefaultConfig()
+	conf.ChanCapacity = 1000
+	Start(conf)
+
+	allocs := testing.AllocsPerRun(100, func() { Info("test message") })
+	Flush()
+	t.Assert(allocs <= 1, Equals, true, Commentf("%v allocations per call", allocs))
+}
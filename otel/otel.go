@@ -0,0 +1,42 @@
+/*
+Package otel attaches the IDs of the current OpenTelemetry span to messages logged with the Ctx methods
+of rlog (e.g. rlog.InfoCtx), which correlates log messages with traces. The OpenTelemetry dependency is
+confined to this package.
+*/
+package otel
+
+import (
+	"context"
+	"github.com/rightscale/rlog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//Names of the structured fields carrying the span IDs
+const (
+	TraceIDField = "trace_id" // hex encoded trace ID
+	SpanIDField  = "span_id"  // hex encoded span ID
+)
+
+//extractorName registers the span extractor with rlog
+const extractorName = "otel"
+
+//Enable attaches the trace and span IDs of the span found in the context to all messages logged with
+//the Ctx methods of rlog. Call it once during setup, e.g. before rlog.Start. Enabling it again has no
+//further effect.
+func Enable() {
+	rlog.RegisterContextExtractor(extractorName, SpanFields)
+}
+
+//SpanFields derives the structured fields of the span found in a context, e.g. for loggers other than
+//the Ctx methods.
+//Returns: fields trace_id and span_id, nil if the context carries no valid span
+func SpanFields(ctx context.Context) map[string]interface{} {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return map[string]interface{}{
+		TraceIDField: sc.TraceID().String(),
+		SpanIDField:  sc.SpanID().String(),
+	}
+}
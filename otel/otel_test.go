@@ -0,0 +1,44 @@
+/*
+These tests cover:
+- Deriving the trace and span IDs from a context with a valid span
+- Omitting the fields if the context carries no valid span
+*/
+package otel
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
+	. "launchpad.net/gocheck"
+	"testing"
+)
+
+//Hook this testing framework into go test
+func Test(t *testing.T) { TestingT(t) }
+
+type OtelSuite struct{}
+
+var _ = Suite(&OtelSuite{})
+
+//A valid span context yields its hex encoded IDs
+func (s *OtelSuite) TestSpanFieldsValid(t *C) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10},
+		SpanID:  trace.SpanID{0xa1, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7, 0xa8},
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	fields := SpanFields(ctx)
+	t.Assert(fields, HasLen, 2)
+	t.Assert(fields[TraceIDField], Equals, "0102030405060708090a0b0c0d0e0f10")
+	t.Assert(fields[SpanIDField], Equals, "a1a2a3a4a5a6a7a8")
+}
+
+//A context without a span or with an invalid span context yields no fields
+func (s *OtelSuite) TestSpanFieldsInvalid(t *C) {
+	t.Assert(SpanFields(context.Background()), IsNil)
+
+	//Zero span ID
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{0x01}})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	t.Assert(SpanFields(ctx), IsNil)
+}
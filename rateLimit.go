@@ -0,0 +1,88 @@
+package rlog
+
+/*
+This file implements rate limiting of log messages. The limit applies to each severity separately and
+is enforced by the genericLogHandler before a message is generated. Messages exceeding the limit are
+dropped and counted; the count is reported periodically as a single summary message.
+*/
+
+import (
+	"fmt"
+	"github.com/rightscale/rlog/common"
+	"sync"
+	"time"
+)
+
+//rateLimiter counts the messages per severity within the current one second window
+type rateLimiter struct {
+	mutex       sync.Mutex
+	windowStart time.Time                 //start of the current one second window
+	counts      [SeverityTrace + 1]uint32 //messages per severity within the current window
+	suppressed  uint64                    //messages dropped since the last report
+	lastReport  time.Time                 //time of the last summary report
+}
+
+//allow determines whether a message of the given severity is within the rate limit and counts it.
+//Arguments: [severity] message severity. [limit] max messages per second (0 means unlimited). [now]
+//current time
+//Returns: true if the message may be logged, false if it has to be dropped
+func (r *rateLimiter) allow(severity common.RlogSeverity, limit uint32, now time.Time) bool {
+	if limit == 0 || int(severity) >= len(r.counts) {
+		return true
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if now.Sub(r.windowStart) >= time.Second {
+		//Start a new window
+		r.windowStart = now
+		r.counts = [len(r.counts)]uint32{}
+	}
+
+	if r.counts[severity] >= limit {
+		r.suppressed++
+		return false
+	}
+	r.counts[severity]++
+	return true
+}
+
+//takeSuppressed returns the number of dropped messages if the report interval elapsed since the
+//last report and resets the count.
+//Arguments: [interval] time between two reports. [now] current time
+//Returns: number of dropped messages to report, 0 if there is nothing to report (yet)
+func (r *rateLimiter) takeSuppressed(interval time.Duration, now time.Time) uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.suppressed == 0 || now.Sub(r.lastReport) < interval {
+		return 0
+	}
+
+	n := r.suppressed
+	r.suppressed = 0
+	r.lastReport = now
+	return n
+}
+
+//reportSuppressed sends a summary message about messages dropped due to the rate limit to all modules
+//if the report interval elapsed. The summary message itself is never rate limited.
+func (r *Instance) reportSuppressed(now time.Time) {
+	if r.config.RateLimit == 0 {
+		return
+	}
+
+	interval := time.Second * time.Duration(r.config.RateLimitReportInterval)
+	n := r.limiter.takeSuppressed(interval, now)
+	if n == 0 {
+		return
+	}
+
+	raw := logPieces{
+		level:    "WARNING",
+		msg:      fmt.Sprintf("suppressed %d messages", n),
+		severity: SeverityWarning,
+	}
+	r.pushToChannels(r.generateLogMsg(&raw))
+}
@@ -0,0 +1,76 @@
+/*
+These tests cover:
+- Rate limiting per severity and window
+- Reporting of suppressed messages
+*/
+package rlog
+
+import (
+	"container/list"
+	. "launchpad.net/gocheck"
+	"strings"
+	"time"
+)
+
+//When the limit is exceeded within one second, it should drop messages of that severity only
+func (s *Stateless) TestRateLimiterAllow(t *C) {
+	r := new(rateLimiter)
+	now := time.Now()
+
+	t.Assert(r.allow(SeverityInfo, 2, now), Equals, true)
+	t.Assert(r.allow(SeverityInfo, 2, now), Equals, true)
+	t.Assert(r.allow(SeverityInfo, 2, now), Equals, false)
+
+	//Other severities have their own budget
+	t.Assert(r.allow(SeverityError, 2, now), Equals, true)
+
+	//A limit of 0 means unlimited
+	t.Assert(r.allow(SeverityInfo, 0, now), Equals, true)
+
+	//The budget is renewed after one second
+	t.Assert(r.allow(SeverityInfo, 2, now.Add(time.Second)), Equals, true)
+	t.Assert(r.suppressed, Equals, uint64(1))
+}
+
+//When taking the suppressed count, it should only report once per interval
+func (s *Stateless) TestRateLimiterTakeSuppressed(t *C) {
+	r := new(rateLimiter)
+	now := time.Now()
+
+	//Nothing to report without suppressed messages
+	t.Assert(r.takeSuppressed(time.Second, now), Equals, uint64(0))
+
+	r.allow(SeverityInfo, 1, now)
+	r.allow(SeverityInfo, 1, now)
+	r.allow(SeverityInfo, 1, now)
+	t.Assert(r.takeSuppressed(time.Second, now), Equals, uint64(2))
+
+	//Count was reset and interval did not elapse yet
+	r.allow(SeverityInfo, 1, now)
+	t.Assert(r.takeSuppressed(time.Second, now), Equals, uint64(0))
+	t.Assert(r.takeSuppressed(time.Second, now.Add(time.Second)), Equals, uint64(1))
+}
+
+//When logging more messages than allowed, it should drop them and report them in a summary
+func (s *Initialized) TestRateLimitLogging(t *C) {
+	std.config.RateLimit = 2
+	std.config.RateLimitReportInterval = 0
+
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	for i := 0; i < 5; i++ {
+		Info("message %d", i)
+	}
+	t.Assert(nonBlockingChanRead(myChan).Msg, Equals, "message 0")
+	t.Assert(nonBlockingChanRead(myChan).Msg, Equals, "message 1")
+	t.Assert(nonBlockingChanRead(myChan), IsNil)
+
+	//The next message passing the limit is preceded by the summary
+	Error("error message")
+	summary := nonBlockingChanRead(myChan)
+	t.Assert(summary, NotNil)
+	t.Assert(strings.Contains(summary.Msg, "suppressed 3 messages"), Equals, true)
+	t.Assert(summary.Severity, Equals, SeverityWarning)
+	t.Assert(nonBlockingChanRead(myChan).Severity, Equals, SeverityError)
+}
@@ -0,0 +1,118 @@
+package rlog
+
+/*
+This file implements logging of recovered panics. The helpers are meant to be deferred directly, e.g.
+"defer rlog.RecoverAndLog()", as recover only stops a panic when called by a deferred function.
+*/
+
+import (
+	"fmt"
+	"strings"
+)
+
+//RecoverAndLog recovers from a panic, logs the panic value as fatal message carrying the stack trace of
+//the panic, flushes the modules and panics again with the same value. Use it as "defer
+//rlog.RecoverAndLog()". Without a panic, it does nothing.
+func RecoverAndLog() {
+	if v := recover(); v != nil {
+		std.logPanic(v)
+		std.Flush()
+		panic(v)
+	}
+}
+
+//RecoverAndLog recovers from a panic, logs the panic value as fatal message carrying the stack trace of
+//the panic, flushes the modules and panics again with the same value. Use it as "defer
+//rlog.RecoverAndLog()". Without a panic, it does nothing.
+func (l logger) RecoverAndLog() {
+	if v := recover(); v != nil {
+		l.inst.logPanic(v)
+		l.inst.Flush()
+		panic(v)
+	}
+}
+
+//RecoverAndLog recovers from a panic, logs the panic value as fatal message carrying the stack trace of
+//the panic, flushes the modules and panics again with the same value. Use it as "defer
+//rlog.RecoverAndLog()". Without a panic, it does nothing.
+func (r *Instance) RecoverAndLog() {
+	if v := recover(); v != nil {
+		r.logPanic(v)
+		r.Flush()
+		panic(v)
+	}
+}
+
+//RecoverAndSwallow recovers from a panic and logs the panic value like RecoverAndLog but does not panic
+//again, e.g. for goroutines which shall survive a failure. Use it as "defer rlog.RecoverAndSwallow()".
+func RecoverAndSwallow() {
+	if v := recover(); v != nil {
+		std.logPanic(v)
+	}
+}
+
+//RecoverAndSwallow recovers from a panic and logs the panic value like RecoverAndLog but does not panic
+//again, e.g. for goroutines which shall survive a failure. Use it as "defer rlog.RecoverAndSwallow()".
+func (l logger) RecoverAndSwallow() {
+	if v := recover(); v != nil {
+		l.inst.logPanic(v)
+	}
+}
+
+//RecoverAndSwallow recovers from a panic and logs the panic value like RecoverAndLog but does not panic
+//again, e.g. for goroutines which shall survive a failure. Use it as "defer rlog.RecoverAndSwallow()".
+func (r *Instance) RecoverAndSwallow() {
+	if v := recover(); v != nil {
+		r.logPanic(v)
+	}
+}
+
+//logPanic logs a recovered panic value as fatal message. The message is neither rate limited nor
+//filtered by tags. It carries the stack trace of the panic instead of the rlog call chain. Unlike other
+//fatal messages, it neither terminates the process nor invokes the fatal callback: the caller decides
+//whether the panic continues.
+//Arguments: recovered panic value
+func (r *Instance) logPanic(v interface{}) {
+	if !r.IsInitialized() {
+		//Ensure that logger is initialized
+		r.internalf("[ERROR] Logger not initialized, panic: %v", v)
+		return
+	}
+
+	if r.isFilteredByAllModules(SeverityFatal) && r.isFilteredByAllHooks(SeverityFatal) {
+		//Drop message
+		return
+	}
+
+	trace := ""
+	if r.hasStackTrace(SeverityFatal) {
+		trace = panicStackTrace(r.stackDump())
+	}
+
+	raw := logPieces{
+		level:      "FATAL",
+		msg:        fmt.Sprintf("panic: %v", v),
+		severity:   SeverityFatal,
+		stackTrace: trace,
+	}
+	r.deliver(&raw)
+	if r.flushesOn(SeverityFatal) {
+		r.Flush()
+	}
+}
+
+//panicStackTrace extracts the frames below the panic from the stack dump of a deferred function, i.e.
+//starting at the function which panicked.
+//Arguments: stack dump taken while panicking
+//Returns: stack trace of the panic, the entire dump without its header if it contains no panic
+func panicStackTrace(dump string) string {
+	//Each frame consists of the function line followed by the file line. Skip everything up to and
+	//including the frame of the builtin panic.
+	lines := strings.Split(strings.TrimRight(dump, "\n"), "\n")
+	for i := 1; i+1 < len(lines); i += 2 {
+		if strings.HasPrefix(lines[i], "panic(") {
+			return strings.Join(lines[i+2:], "\n")
+		}
+	}
+	return strings.Join(lines[1:], "\n")
+}
@@ -0,0 +1,103 @@
+/*
+These tests cover:
+- Logging of recovered panics
+- Stack trace of the panic
+- Recovering with FatalExits and OnFatal set
+*/
+package rlog
+
+import (
+	"container/list"
+	"github.com/rightscale/rlog/common"
+	. "launchpad.net/gocheck"
+	"os"
+	"strings"
+)
+
+//panickingFunc panics to provide a known function at the top of the panic stack trace
+func panickingFunc() {
+	panic("test failure")
+}
+
+//When recovering and swallowing a panic, it should log the panic with the stack trace of the panic
+func (s *Initialized) TestRecoverAndSwallow(t *C) {
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	func() {
+		defer RecoverAndSwallow()
+		panickingFunc()
+	}()
+
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm, NotNil)
+	t.Assert(rlm.Severity, Equals, SeverityFatal)
+	t.Assert(rlm.Msg, Equals, "panic: test failure")
+	t.Assert(strings.HasPrefix(rlm.StackTrace, "github.com/rightscale/rlog.panickingFunc"), Equals, true)
+
+	//Without a panic, nothing should be logged
+	func() {
+		defer RecoverAndSwallow()
+	}()
+	t.Assert(nonBlockingChanRead(myChan), IsNil)
+}
+
+//When recovering and logging a panic, it should log the panic and panic again
+func (s *Initialized) TestRecoverAndLog(t *C) {
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	t.Assert(func() {
+		defer NewLogger().RecoverAndLog()
+		panickingFunc()
+	}, PanicMatches, "test failure")
+
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm, NotNil)
+	t.Assert(rlm.Msg, Equals, "panic: test failure")
+}
+
+//When FatalExits and a fatal callback are set, recovering should neither exit nor invoke the callback
+func (s *Initialized) TestRecoverWithFatalHandling(t *C) {
+	var events []string
+	exitProcess = func(code int) { events = append(events, "exit") }
+	defer func() { exitProcess = os.Exit }()
+	std.config.FatalExits = true
+	std.config.OnFatal = func(msg *common.RlogMsg) { events = append(events, "callback") }
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	//The goroutine survives a swallowed panic
+	func() {
+		defer RecoverAndSwallow()
+		panickingFunc()
+	}()
+	t.Assert(events, IsNil)
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm, NotNil)
+	t.Assert(rlm.Msg, Equals, "panic: test failure")
+
+	//The panic continues after logging
+	t.Assert(func() {
+		defer RecoverAndLog()
+		panickingFunc()
+	}, PanicMatches, "test failure")
+	t.Assert(events, IsNil)
+	t.Assert(nonBlockingChanRead(myChan), NotNil)
+
+	//Fatal messages still exit
+	Fatal("fatal message")
+	t.Assert(events, DeepEquals, []string{"callback", "exit"})
+}
+
+//When extracting the panic stack trace, it should skip the frames up to the builtin panic
+func (s *Stateless) TestPanicStackTrace(t *C) {
+	dump := "goroutine 1 [running]:\n" +
+		"rlog.stackDump()\n\tstack.go:1\n" +
+		"panic({0x1, 0x2})\n\tpanic.go:2\n" +
+		"main.f()\n\tmain.go:3\n"
+	t.Assert(panicStackTrace(dump), Equals, "main.f()\n\tmain.go:3")
+
+	//Without a panic, only the header is removed
+	t.Assert(panicStackTrace("goroutine 1 [running]:\nmain.f()\n\tmain.go:3\n"), Equals, "main.f()\n\tmain.go:3")
+}
@@ -0,0 +1,137 @@
+/*
+Implements a logger forwarding to a log.Logger of the standard library, e.g. to keep an existing log
+sink while migrating to rlog.
+*/
+package stdlog
+
+import (
+	"github.com/rightscale/rlog/common"
+	"log"
+)
+
+// Standard library logger module (fields are private).
+type stdLogModule struct {
+	common.ModuleSeverity
+	logger    *log.Logger
+	formatter common.Formatter
+}
+
+// Creates a logger forwarding to the given log.Logger. The log.Logger adds its own prefix and flags
+// (e.g. date and time) to each message.
+//
+// l: destination of the log messages
+//
+// return: instance of standard library logger module
+func NewStdLogLogger(l *log.Logger) *stdLogModule {
+	module := new(stdLogModule)
+	module.logger = l
+	module.formatter = common.DefaultFormatter{}
+	return module
+}
+
+// Names the module for rlog diagnostics and statistics.
+//
+// return: "stdlog"
+func (conf *stdLogModule) Name() string {
+	return "stdlog"
+}
+
+// Selects the output format, plain text is used by default.
+//
+// format: output format
+//
+// return: the standard library logger module to allow chaining with the constructor
+func (conf *stdLogModule) WithFormat(format common.MessageFormat) *stdLogModule {
+	conf.formatter = common.NewFormatter(format, false)
+	return conf
+}
+
+// Selects a custom formatter creating the text written for each message.
+//
+// formatter: formatter to use instead of the built-in formats
+//
+// return: the standard library logger module to allow chaining with the constructor
+func (conf *stdLogModule) WithFormatter(formatter common.Formatter) *stdLogModule {
+	conf.formatter = formatter
+	return conf
+}
+
+// Sets a severity threshold for this module overriding the global rlog severity.
+//
+// severity: most verbose severity written by this module
+//
+// return: the standard library logger module to allow chaining with the constructor
+func (conf *stdLogModule) WithSeverity(severity common.RlogSeverity) *stdLogModule {
+	conf.SetSeverity(severity)
+	return conf
+}
+
+// Intended to run in a separate goroutine. It forwards log messages to the log.Logger.
+//
+// dataChan: receives log messages.
+//
+// flushChan: receives flush command.
+func (conf *stdLogModule) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
+
+	prefix := common.SyslogHeader()
+
+	// wait forever on data and flush channel
+	for {
+		select {
+		case logMsg := <-dataChan:
+			// received log message, forward it
+			conf.printMsg(logMsg, prefix)
+		case ret, ok := <-flushChan:
+			if !ok {
+				// flush channel closed by rlog: write pending messages and exit
+				conf.flush(dataChan, prefix)
+				return
+			}
+			// flush and return the number of messages forwarded
+			ret <- common.FlushResult{Flushed: conf.flush(dataChan, prefix)}
+		}
+	}
+}
+
+// Forwards a log message when rlog runs in synchronous mode, see rlog.RlogConfig.Synchronous.
+//
+// rawRlogMsg: log message to forward.
+//
+// prefix: log prefix
+func (conf *stdLogModule) WriteSync(rawRlogMsg *common.RlogMsg, prefix string) {
+	conf.printMsg(rawRlogMsg, prefix)
+}
+
+// Does nothing as the log.Logger writes synchronously. Used when rlog runs in synchronous mode.
+func (conf *stdLogModule) FlushSync() {
+}
+
+// Forwards the message to the log.Logger which writes it synchronously.
+//
+// rawRlogMsg: log message received from channel.
+//
+// prefix: log prefix
+func (conf *stdLogModule) printMsg(rawRlogMsg *common.RlogMsg, prefix string) {
+	conf.logger.Print(conf.formatter.Format(rawRlogMsg, prefix))
+}
+
+// Forwards pending messages to the log.Logger.
+//
+// dataChan: data channel to access all pending messages
+//
+// prefix: log prefix
+//
+// return: number of messages forwarded
+func (conf *stdLogModule) flush(dataChan <-chan (*common.RlogMsg), prefix string) int {
+	flushed := 0
+	for {
+		// perform non blocking read until the channel is empty
+		select {
+		case logMsg := <-dataChan:
+			conf.printMsg(logMsg, prefix)
+			flushed++
+		default:
+			return flushed
+		}
+	}
+}
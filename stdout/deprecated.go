@@ -8,7 +8,7 @@ import (
 	"github.com/rightscale/rlog/console"
 )
 
-// deprecated
+// deprecated, the returned console logger supports WithFormat() to select the output format
 func NewStdoutLogger(removeNewlines bool) *console.ConsoleLogger {
 	fmt.Println("rlog.stdout.NewStdoutLogger() is deprecated and will be removed in a future version.\nUse rlog.console.NewStdoutLogger() instead.")
 	return console.NewStdoutLogger(removeNewlines)
@@ -0,0 +1,77 @@
+package rlog
+
+/*
+This file implements quiet mode: while suppressed, log messages are dropped before they are generated.
+Suppression is counted so that nested Suppress/Resume pairs (e.g. in different goroutines) only restore
+logging once the outermost pair completes.
+*/
+
+import (
+	"github.com/rightscale/rlog/common"
+	"sync/atomic"
+)
+
+//Suppress mutes logging until Resume is invoked, e.g. around a noisy library call. Messages logged
+//meanwhile are dropped and counted (see LogStats.Suppressed). Fatal messages are never suppressed.
+//Suppress is thread safe and nestable: logging resumes once Resume has been invoked as often as Suppress.
+func Suppress() {
+	std.Suppress()
+}
+
+//Suppress mutes logging until Resume is invoked, e.g. around a noisy library call. Messages logged
+//meanwhile are dropped and counted (see LogStats.Suppressed). Fatal messages are never suppressed.
+//Suppress is thread safe and nestable: logging resumes once Resume has been invoked as often as Suppress.
+func (r *Instance) Suppress() {
+	atomic.AddInt32(&r.suppressed, 1)
+}
+
+//Resume ends a Suppress. Logging resumes once each Suppress has been ended, surplus invocations are
+//ignored.
+func Resume() {
+	std.Resume()
+}
+
+//Resume ends a Suppress. Logging resumes once each Suppress has been ended, surplus invocations are
+//ignored.
+func (r *Instance) Resume() {
+	for {
+		n := atomic.LoadInt32(&r.suppressed)
+		if n <= 0 || atomic.CompareAndSwapInt32(&r.suppressed, n, n-1) {
+			return
+		}
+	}
+}
+
+//Quiet invokes the given function with logging suppressed, see Suppress. Logging is resumed even if
+//the function panics.
+//Arguments: function to run without logging
+func Quiet(f func()) {
+	std.Quiet(f)
+}
+
+//Quiet invokes the given function with logging suppressed, see Suppress. Logging is resumed even if
+//the function panics.
+//Arguments: function to run without logging
+func (r *Instance) Quiet(f func()) {
+	r.Suppress()
+	defer r.Resume()
+	f()
+}
+
+//isSuppressed determines whether a message has to be dropped because logging is suppressed and counts
+//it if so
+//Arguments: message severity
+//Returns: true if the message has to be dropped
+func (r *Instance) isSuppressed(severity common.RlogSeverity) bool {
+	if !r.suppresses(severity) {
+		return false
+	}
+	atomic.AddUint64(&r.suppressedMsgs, 1)
+	return true
+}
+
+//suppresses determines whether messages of the given severity are dropped because logging is
+//suppressed, without counting them
+func (r *Instance) suppresses(severity common.RlogSeverity) bool {
+	return severity != SeverityFatal && atomic.LoadInt32(&r.suppressed) > 0
+}
@@ -0,0 +1,58 @@
+/*
+These tests cover:
+- Dropping messages while suppressed
+- Nesting of Suppress and Resume
+*/
+package rlog
+
+import (
+	"container/list"
+	. "launchpad.net/gocheck"
+)
+
+//When logging is suppressed, messages should be dropped and counted until each Suppress is resumed
+func (s *Initialized) TestSuppress(t *C) {
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	Suppress()
+	Suppress()
+	Error("noise 1")
+	Resume()
+	Error("noise 2")
+	t.Assert(nonBlockingChanRead(myChan), IsNil)
+
+	Resume()
+	Resume()
+	Error("signal")
+	t.Assert(nonBlockingChanRead(myChan).Msg, Matches, ".*signal")
+	t.Assert(Stats().Suppressed, Equals, uint64(2))
+
+	//Surplus Resume calls are ignored, the next Suppress mutes again
+	Suppress()
+	Info("noise 3")
+	Resume()
+	t.Assert(nonBlockingChanRead(myChan), IsNil)
+}
+
+//When running a function quietly, its messages should be dropped and logging resumed even on panic
+func (s *Initialized) TestQuiet(t *C) {
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	func() {
+		defer func() { recover() }()
+		Quiet(func() {
+			Warning("noise")
+			panic("library failure")
+		})
+	}()
+	t.Assert(nonBlockingChanRead(myChan), IsNil)
+
+	//Fatal messages are never suppressed
+	Quiet(func() { Fatal("fatal") })
+	t.Assert(nonBlockingChanRead(myChan).Msg, Matches, ".*fatal")
+
+	Warning("signal")
+	t.Assert(nonBlockingChanRead(myChan).Msg, Matches, ".*signal")
+}
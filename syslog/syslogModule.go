@@ -4,37 +4,56 @@ Package syslog implements an output module for logging to syslog using rlog.
 package syslog
 
 import (
+	"crypto/tls"
 	"fmt"
-	"github.com/rightscale/rlog"
 	"github.com/rightscale/rlog/common"
 	"log"
 	goSyslog "log/syslog"
 	"os"
 	"path"
 	"path/filepath"
-	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 //Configuration of syslog module
 type syslogModuleConfig struct {
-	network           string           // one of ["", syslogTCP, syslogUDP]
-	raddr             string           // remote syslog server or empty for local
-	facility          int              // facility (e.g. LOG_LOCAL0)
-	tag               string           // tag for messages or empty for full binary path
-	syslogConn        *goSyslog.Writer // writer
-	heartBeatFilePath string           // FIX: remove this when we figure out issue with silent syslogger
+	common.ModuleSeverity
+	network           string                    // one of ["", syslogTCP, syslogUDP, syslogTLS]
+	raddr             string                    // remote syslog server or empty for local
+	facility          int                       // facility (e.g. LOG_LOCAL0)
+	tag               string                    // tag for messages or empty for full binary path
+	syslogConn        syslogWriter              // writer
+	tlsConfig         *tls.Config               // TLS configuration of the syslogTLS network, nil for the default
+	heartBeatFilePath string                    // FIX: remove this when we figure out issue with silent syslogger
+	splitMessages     bool                      // split oversized messages instead of truncating them
+	preserveNewlines  bool                      // keep tabs and newlines instead of stripping them
+	newlines          common.NewlineReplacement // replacement of tabs and newlines if stripped
+	formatter         common.Formatter          // custom format replacing the built-in one, nil if none
+	maxMessageLength  int                       // max message size in bytes, 0 to disable truncation
+	retries           int                       // reconnect attempts after a failed write
+	backoff           time.Duration             // wait time before the first reconnect, doubled for each further one
+	healthMutex       sync.Mutex                // guards healthErr, read concurrently by Healthy
+	healthErr         error                     // error of the last reconnect, nil while connected
 }
 
 //Define constant for logging to syslog on localhost or remote logging
 //Not yet exposed
 const (
-	maxMessageLength int    = 6 * 1024 // FIX: limited to 6 KB to see if this keeps syslogger humming
-	syslogLocalhost  string = ""
-	syslogUnix       string = ""
-	syslogTCP        string = "tcp"
-	syslogUDP        string = "udp"
+	defaultMaxMessageLength int    = 6 * 1024 // fits the datagram size of common daemons
+	defaultRetries          int    = 1        // reconnect once, without waiting
+	maxPartHeader           int    = 32       // reserved for the "[i/n] " header of split messages
+	syslogLocalhost         string = ""
+	syslogUnix              string = ""
+	syslogTCP               string = "tcp"
+	syslogUDP               string = "udp"
+	syslogTLS               string = "tls"
 )
 
+//defaultNewlines strips tabs and separates lines with " -- " as expected by legacy rsyslog setups
+var defaultNewlines = common.NewlineReplacement{Newline: " -- "}
+
 var facilityNames []string = []string{
 	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
 	"uucp", "cron", "security", "ftp", "ntp", "logaudit", "logalert", "clock",
@@ -45,6 +64,9 @@ var facilityNames []string = []string{
 func NewLocalSyslogLogger() (*syslogModuleConfig, error) {
 
 	conf := new(syslogModuleConfig)
+	conf.maxMessageLength = defaultMaxMessageLength
+	conf.newlines = defaultNewlines
+	conf.retries = defaultRetries
 	err := conf.connectToSyslog(
 		syslogUnix,
 		syslogLocalhost,
@@ -56,7 +78,17 @@ func NewLocalSyslogLogger() (*syslogModuleConfig, error) {
 	return conf, nil
 }
 
-//NewSyslogLogger enables logging to syslog with full syslog parameters.
+//MustNewLocalSyslogLogger enables logging to syslog like NewLocalSyslogLogger but panics if syslog is
+//not reachable, for concise setup in main
+func MustNewLocalSyslogLogger() *syslogModuleConfig {
+	conf, err := NewLocalSyslogLogger()
+	if err != nil {
+		panic(err)
+	}
+	return conf
+}
+
+//NewLocalFacilitySyslogLogger enables logging to syslog with full syslog parameters.
 //Params: see syslog.Dial() remarks
 //Returns: instance of syslog logger module in case of success, error otherwise
 func NewLocalFacilitySyslogLogger(
@@ -65,6 +97,9 @@ func NewLocalFacilitySyslogLogger(
 	heartBeatFilePath string) (*syslogModuleConfig, error) {
 
 	conf := new(syslogModuleConfig)
+	conf.maxMessageLength = defaultMaxMessageLength
+	conf.newlines = defaultNewlines
+	conf.retries = defaultRetries
 	conf.heartBeatFilePath = heartBeatFilePath // FIX: strictly for debugging
 	err := conf.connectToSyslog(
 		network,
@@ -77,6 +112,20 @@ func NewLocalFacilitySyslogLogger(
 	return conf, nil
 }
 
+//MustNewLocalFacilitySyslogLogger enables logging to syslog like NewLocalFacilitySyslogLogger but
+//panics if syslog is not reachable, for concise setup in main
+func MustNewLocalFacilitySyslogLogger(
+	network, raddr string,
+	facility int,
+	heartBeatFilePath string) *syslogModuleConfig {
+
+	conf, err := NewLocalFacilitySyslogLogger(network, raddr, facility, heartBeatFilePath)
+	if err != nil {
+		panic(err)
+	}
+	return conf
+}
+
 // converts given (lowercase) facility name to its integer value equivalent.
 func FacilityNameToValue(name string) (int, error) {
 	// note that golang as no built-in way to get index from array.
@@ -99,6 +148,85 @@ func FacilityValueToName(value int) (string, error) {
 	return facilityNames[value], nil
 }
 
+//Name names the module for rlog diagnostics and statistics
+func (conf *syslogModuleConfig) Name() string {
+	if conf.raddr == syslogLocalhost {
+		return "syslog:local"
+	}
+	return "syslog:" + conf.raddr
+}
+
+//WithSeverity sets a severity threshold for this module overriding the global rlog severity.
+//Returns the syslog module to allow chaining with the constructor.
+func (conf *syslogModuleConfig) WithSeverity(severity common.RlogSeverity) *syslogModuleConfig {
+	conf.SetSeverity(severity)
+	return conf
+}
+
+//WithMaxMessageLength sets the max size of a message in bytes, longer messages are truncated (or split,
+//see WithMessageSplitting). The default of 6 KB suits most datagram setups, strict RFC3164 receivers
+//require 1 KB. A length of 0 disables truncation, e.g. for the TCP transport. Returns the syslog module
+//to allow chaining with the constructor.
+func (conf *syslogModuleConfig) WithMaxMessageLength(length int) *syslogModuleConfig {
+	if length < 0 {
+		length = 0
+	}
+	conf.maxMessageLength = length
+	return conf
+}
+
+//WithMessageSplitting sends messages exceeding the max message length (see WithMaxMessageLength) as
+//several numbered parts, e.g. "[1/3] ...", "[2/3] ...", instead of truncating them. This preserves long
+//stack traces when using a datagram transport. Returns the syslog module to allow chaining with the constructor.
+func (conf *syslogModuleConfig) WithMessageSplitting() *syslogModuleConfig {
+	conf.splitMessages = true
+	return conf
+}
+
+//WithPreservedNewlines keeps tabs and newlines of messages and stack traces for syslog daemons
+//handling multiline messages (e.g. RFC5424 receivers, journald). By default, they are stripped for
+//legacy rsyslog. Returns the syslog module to allow chaining with the constructor.
+func (conf *syslogModuleConfig) WithPreservedNewlines() *syslogModuleConfig {
+	conf.preserveNewlines = true
+	return conf
+}
+
+//WithNewlineReplacement selects the strings replacing each newline and each tab when stripping them,
+//e.g. " | " or `\n` for literal escaping. By default, lines are separated by " -- " and tabs removed.
+//Returns the syslog module to allow chaining with the constructor.
+func (conf *syslogModuleConfig) WithNewlineReplacement(newline, tab string) *syslogModuleConfig {
+	conf.newlines = common.NewlineReplacement{Newline: newline, Tab: tab}
+	return conf
+}
+
+//WithRetries sets the number of reconnect attempts after syslog failed to take a message and the wait
+//time before the first attempt, which is doubled for each further attempt, e.g. to ride out a brief
+//outage of a remote syslog server. After each reconnect, the message is sent again. The module panics
+//once the attempts are exhausted. By default, it reconnects once without waiting. Returns the syslog
+//module to allow chaining with the constructor.
+func (conf *syslogModuleConfig) WithRetries(retries int, backoff time.Duration) *syslogModuleConfig {
+	conf.retries = retries
+	conf.backoff = backoff
+	return conf
+}
+
+//Healthy reports whether the module is connected to syslog, e.g. for a readiness probe, see
+//rlog.HealthCheck
+//Returns: nil while connected, error of the last failed reconnect otherwise
+func (conf *syslogModuleConfig) Healthy() error {
+	conf.healthMutex.Lock()
+	defer conf.healthMutex.Unlock()
+	return conf.healthErr
+}
+
+//WithFormatter selects a custom formatter creating the text sent for each message. The formatter
+//receives an empty prefix as the syslog daemon adds timestamp, host and process itself. Newlines are
+//still stripped unless preserved. Returns the syslog module to allow chaining with the constructor.
+func (conf *syslogModuleConfig) WithFormatter(formatter common.Formatter) *syslogModuleConfig {
+	conf.formatter = formatter
+	return conf
+}
+
 // establishes the connection to syslog.
 func (conf *syslogModuleConfig) connectToSyslog(
 	network,
@@ -117,7 +245,17 @@ func (conf *syslogModuleConfig) connectToSyslog(
 	conf.raddr = raddr
 	conf.facility = facility
 	conf.tag = tag
-	conf.syslogConn, err = goSyslog.Dial(network, raddr, priority, tag)
+	if network == syslogTLS {
+		var w *tlsWriter
+		if w, err = dialTLS(raddr, conf.tlsConfig, facility, tag); err == nil {
+			conf.syslogConn = w
+		}
+	} else {
+		var w *goSyslog.Writer
+		if w, err = goSyslog.Dial(network, raddr, priority, tag); err == nil && w != nil {
+			conf.syslogConn = w
+		}
+	}
 
 	if err != nil {
 		log.Printf("Could not open connection to syslog, reason: " + err.Error())
@@ -161,68 +299,110 @@ func (conf *syslogModuleConfig) connectToSyslog(
 
 //LaunchModule is intended to run in a separate goroutine. It prints log messages to syslog
 //Arguments: [dataChan] Channel to receive log messages. [flushChan] Channel to receive flush command
-func (conf *syslogModuleConfig) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (bool))) {
+func (conf *syslogModuleConfig) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
 
 	//Wait forever on data and flush channel
 	for {
 		select {
 		case logMsg := <-dataChan:
 			//Received log message, print it
-			var err error
-			if conf.heartBeatFilePath != "" {
-				err = conf.writeHeartBeat("Message popped from internal syslogger queue:", true)
-				if err != nil {
-					panic(err)
-				}
-			}
-			err = conf.syslogProcessMessage(logMsg)
-			if err != nil {
-				// we may be able to work around intermittent failures by reconnecting.
-				if conf.syslogReconnect() != nil {
-					if conf.heartBeatFilePath != "" {
-						err = conf.writeHeartBeat("Popped message following syslog reconnect:", true)
-						if err != nil {
-							panic(err)
-						}
-					}
-					err = conf.syslogProcessMessage(logMsg)
-				}
+			conf.WriteSync(logMsg, "")
+		case ret, ok := <-flushChan:
+			if !ok {
+				//Flush channel closed by rlog: write pending messages and exit
+				conf.syslogFlush(dataChan)
+				return
 			}
+			//Flush and return the number of messages written
+			ret <- common.FlushResult{Flushed: conf.syslogFlush(dataChan)}
+		}
+	}
+}
+
+//WriteSync prints a log message to syslog, reconnecting on failure. It is used by LaunchModule and by
+//rlog directly when running in synchronous mode (see rlog.RlogConfig.Synchronous).
+//Arguments: [logMsg] log message. [prefix] log prefix (unused, syslog adds its own header)
+func (conf *syslogModuleConfig) WriteSync(logMsg *common.RlogMsg, prefix string) {
+	var err error
+	if conf.heartBeatFilePath != "" {
+		err = conf.writeHeartBeat("Message popped from internal syslogger queue:", true)
+		if err != nil {
+			panic(err)
+		}
+	}
+	// we may be able to work around intermittent failures by reconnecting.
+	err = conf.retry(conf.syslogProcessMessage(logMsg), func() error {
+		if conf.heartBeatFilePath != "" {
+			err := conf.writeHeartBeat("Popped message following syslog reconnect:", true)
 			if err != nil {
-				// panic if reconnecting did not resolve the issue.
 				panic(err)
 			}
-		case ret := <-flushChan:
-			//Flush and return success
-			conf.syslogFlush(dataChan)
-			ret <- true
 		}
+		return conf.syslogProcessMessage(logMsg)
+	})
+	if err != nil {
+		// panic if reconnecting did not resolve the issue.
+		panic(err)
 	}
 }
 
+//FlushSync reestablishes the syslog connection when rlog runs in synchronous mode, see syslogFlush
+func (conf *syslogModuleConfig) FlushSync() {
+	//A nil channel has no pending messages
+	conf.syslogFlush(nil)
+}
+
 //syslogProcessMessage prints the message to syslog
 //Arguments: log message
 func (conf *syslogModuleConfig) syslogProcessMessage(m *common.RlogMsg) error {
 
-	//Prepare log message. Add stack trace of severity is error or fatal
-	logMsg := m.Msg
-	if m.Severity == rlog.SeverityError || m.Severity == rlog.SeverityFatal {
-		logMsg += " -- " + m.StackTrace
+	//Prepare log message. Add stack trace if present (error or fatal by default)
+	var logMsg string
+	if conf.formatter != nil {
+		logMsg = conf.formatter.Format(m, "")
+	} else {
+		logMsg = common.FormatPosition(m) + m.Msg + common.FormatFields(m.Fields)
+		if m.StackTrace != "" {
+			// the stack trace starts on a line of its own, separated like any other line if stripped.
+			logMsg += "\n" + m.StackTrace
+		}
 	}
 
-	// remove tabs, carriage returns and newlines from any messages sent to syslog
-	// due to problems with recording whitespace.
-	logMsg = strings.Replace(logMsg, "\t", "", -1)
-	logMsg = strings.Replace(logMsg, "\r", "", -1)
-	logMsg = strings.Replace(logMsg, "\n", " -- ", -1)
+	if !conf.preserveNewlines {
+		// replace tabs, carriage returns and newlines of any messages sent to syslog
+		// due to problems with recording whitespace.
+		logMsg = conf.newlines.Replace(logMsg)
+	}
 
-	// FIX: truncate message in attempt to resolve issue with syslog going quiet.
-	// not sure what the max datagram size is or if this will help anything...
-	if len(logMsg) > maxMessageLength {
-		runes := []rune(logMsg)
-		logMsg = string(runes[0:maxMessageLength])
+	if conf.maxMessageLength == 0 || len(logMsg) <= conf.maxMessageLength {
+		return conf.syslogWritePart(logMsg, m.Severity)
 	}
 
+	if conf.splitMessages {
+		// send numbered parts which the receiver can reassemble.
+		size := conf.maxMessageLength - maxPartHeader
+		if size < 1 {
+			// the header alone exceeds the limit, send at least one character per part.
+			size = 1
+		}
+		parts := splitMessage(logMsg, size)
+		for i, part := range parts {
+			err := conf.syslogWritePart(fmt.Sprintf("[%d/%d] %s", i+1, len(parts), part), m.Severity)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// truncate at a character boundary, the limit is in bytes.
+	return conf.syslogWritePart(logMsg[:runeBoundary(logMsg, conf.maxMessageLength)], m.Severity)
+}
+
+//syslogWritePart writes a single message to syslog
+//Arguments: [logMsg] message ready for syslog. [severity] rlog severity of the message
+func (conf *syslogModuleConfig) syslogWritePart(logMsg string, severity common.RlogSeverity) error {
+
 	// FIX: write to heartbeat file to determine if this go routine is still
 	// running or has been blocked or died silently, etc.
 	var err error
@@ -234,34 +414,64 @@ func (conf *syslogModuleConfig) syslogProcessMessage(m *common.RlogMsg) error {
 	}
 	defer conf.writeHeartBeat("Successfully written to syslog.", false)
 
-	//Write log message using appropriate syslog severity level
-	switch m.Severity {
-	case rlog.SeverityDebug:
+	//Write log message using appropriate syslog severity level, syslog has no level below debug
+	switch severity.SyslogPriority() {
+	case goSyslog.LOG_DEBUG:
 		err = conf.syslogConn.Debug(logMsg)
-	case rlog.SeverityInfo:
+	case goSyslog.LOG_INFO:
 		err = conf.syslogConn.Info(logMsg)
-	case rlog.SeverityWarning:
+	case goSyslog.LOG_WARNING:
 		err = conf.syslogConn.Warning(logMsg)
-	case rlog.SeverityError:
+	case goSyslog.LOG_ERR:
 		err = conf.syslogConn.Err(logMsg)
-	case rlog.SeverityFatal:
+	case goSyslog.LOG_CRIT:
 		err = conf.syslogConn.Crit(logMsg)
 	}
 	return err
 }
 
+//splitMessage splits a message into parts of at most size bytes without breaking UTF-8 characters
+//Arguments: [msg] message to split. [size] max part size in bytes
+//Returns: parts in order
+func splitMessage(msg string, size int) []string {
+	var parts []string
+	for len(msg) > size {
+		cut := runeBoundary(msg, size)
+		parts = append(parts, msg[:cut])
+		msg = msg[cut:]
+	}
+	return append(parts, msg)
+}
+
+//runeBoundary finds the position to cut a message after at most size bytes without breaking UTF-8
+//characters. If the first character is longer than size, the position after it is returned.
+//Arguments: [msg] message to cut. [size] max size in bytes, less than the message length
+//Returns: byte position of a character boundary, greater than 0
+func runeBoundary(msg string, size int) int {
+	cut := size
+	for cut > 0 && !utf8.RuneStart(msg[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		// the first character exceeds the size, keep it to guarantee progress.
+		_, cut = utf8.DecodeRuneInString(msg)
+	}
+	return cut
+}
+
 //syslogFlush writes all pending log messages to syslog
 //Arguments: data channel to access all pending messages
-func (conf *syslogModuleConfig) syslogFlush(dataChan <-chan (*common.RlogMsg)) {
+//Returns: number of messages written
+func (conf *syslogModuleConfig) syslogFlush(dataChan <-chan (*common.RlogMsg)) int {
 
 	// we may already be panicking due to losing syslog connection.
 	if conf.syslogConn == nil {
-		return
+		return 0
 	}
 
 	// always reestablish syslog connection before flushing message channel to
 	// ensure connection liveness (after a day of being open, etc.).
-	err := conf.syslogReconnect()
+	err := conf.retry(conf.syslogReconnect(), nil)
 	if err != nil {
 		// panic if unable to reestablish connection (rsyslog service is down, etc.)
 		// this is useful for a service because it can be restarted by its outer
@@ -269,6 +479,7 @@ func (conf *syslogModuleConfig) syslogFlush(dataChan <-chan (*common.RlogMsg)) {
 		panic(err)
 	}
 
+	flushed := 0
 	for {
 		//Read from data channel until there is nothing more to read, then return
 		select {
@@ -279,14 +490,16 @@ func (conf *syslogModuleConfig) syslogFlush(dataChan <-chan (*common.RlogMsg)) {
 					panic(err)
 				}
 			}
-			err = conf.syslogProcessMessage(logMsg)
+			err = conf.retry(conf.syslogProcessMessage(logMsg), func() error {
+				return conf.syslogProcessMessage(logMsg)
+			})
 			if err != nil {
-				// we reconnected before we began flushing so any failure during flush
-				// cannot logically be resolved by reconnecting again here.
+				// panic if reconnecting did not resolve the issue.
 				panic(err)
 			}
+			flushed++
 		default:
-			return
+			return flushed
 		}
 	}
 }
@@ -295,11 +508,35 @@ func (conf *syslogModuleConfig) syslogFlush(dataChan <-chan (*common.RlogMsg)) {
 func (conf *syslogModuleConfig) syslogReconnect() error {
 	oldSyslogConn := conf.syslogConn
 	conf.syslogConn = nil
-	err := oldSyslogConn.Close()
+	var err error
+	if oldSyslogConn != nil {
+		// a previous reconnect attempt may have failed, leaving no connection to close.
+		err = oldSyslogConn.Close()
+	}
 	if err == nil {
 		err = conf.connectToSyslog(conf.network, conf.raddr, conf.facility, conf.tag)
 	}
 
+	conf.healthMutex.Lock()
+	conf.healthErr = err
+	conf.healthMutex.Unlock()
+	return err
+}
+
+//retry reconnects and repeats a failed operation according to the retry policy, see WithRetries
+//Arguments: [err] error of the first attempt, nil if it succeeded. [op] operation repeated after each
+//reconnect, nil if reconnecting is all there is to do
+//Returns: nil once an attempt succeeded, error of the last attempt otherwise
+func (conf *syslogModuleConfig) retry(err error, op func() error) error {
+	backoff := conf.backoff
+	for i := 0; err != nil && i < conf.retries; i++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		err = conf.syslogReconnect()
+		if err == nil && op != nil {
+			err = op()
+		}
+	}
 	return err
 }
 
@@ -0,0 +1,142 @@
+package syslog
+
+/*
+This file implements the TLS transport of syslog messages (RFC5425): each message is formatted per
+RFC5424 and framed by its length in bytes (octet counting), as log/syslog only supports plain
+connections.
+*/
+
+import (
+	"crypto/tls"
+	"fmt"
+	goSyslog "log/syslog"
+	"net"
+	"os"
+	"path"
+	"time"
+)
+
+//rfc5424Time is the timestamp layout of RFC5424 messages
+const rfc5424Time = "2006-01-02T15:04:05.000000Z07:00"
+
+//tlsTimeout bounds connecting to the syslog server and writing a message, a stalled server must not
+//block the module forever
+const tlsTimeout = 10 * time.Second
+
+//syslogWriter writes messages to syslog at a given priority, implemented by log/syslog.Writer and
+//tlsWriter
+type syslogWriter interface {
+	Debug(m string) error
+	Info(m string) error
+	Warning(m string) error
+	Err(m string) error
+	Crit(m string) error
+	Close() error
+}
+
+//tlsWriter sends syslog messages over a TLS connection
+type tlsWriter struct {
+	conn     *tls.Conn     // connection to the syslog server
+	facility int           // facility index (e.g. 16 for local0), see FacilityNameToValue
+	hostname string        // name of this host, "-" if unknown
+	tag      string        // application name
+	pid      int           // id of this process
+	timeout  time.Duration // max time to write a message
+}
+
+//NewTLSSyslogLogger enables logging to a remote syslog server over TLS, e.g. for compliance with
+//encrypted transport requirements. Messages are sent per RFC5425, i.e. formatted per RFC5424 and framed
+//by their length. Like other syslog modules, it reconnects on failure (see WithRetries), a write
+//stalled for 10 seconds counts as failure.
+//Arguments: [raddr] host:port of the syslog server (usually port 6514). [tlsConfig] TLS configuration,
+//nil verifies the server certificate against the system roots. [facility] facility index 0-23 as
+//returned by FacilityNameToValue (e.g. 16 for local0), not a log/syslog constant like LOG_LOCAL0
+//Returns: instance of syslog logger module in case of success, error otherwise
+func NewTLSSyslogLogger(raddr string, tlsConfig *tls.Config, facility int) (*syslogModuleConfig, error) {
+
+	conf := new(syslogModuleConfig)
+	conf.maxMessageLength = defaultMaxMessageLength
+	conf.newlines = defaultNewlines
+	conf.retries = defaultRetries
+	conf.tlsConfig = tlsConfig
+	err := conf.connectToSyslog(
+		syslogTLS,
+		raddr,
+		facility,
+		path.Base(os.Args[0]))
+	if err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+//MustNewTLSSyslogLogger enables logging to syslog over TLS like NewTLSSyslogLogger but panics if the
+//server is not reachable, for concise setup in main
+func MustNewTLSSyslogLogger(raddr string, tlsConfig *tls.Config, facility int) *syslogModuleConfig {
+	conf, err := NewTLSSyslogLogger(raddr, tlsConfig, facility)
+	if err != nil {
+		panic(err)
+	}
+	return conf
+}
+
+//dialTLS establishes a TLS connection to a syslog server
+//Arguments: [raddr] host:port of the syslog server. [config] TLS configuration, may be nil. [facility]
+//facility index of all messages. [tag] application name
+//Returns: writer in case of success, error otherwise
+func dialTLS(raddr string, config *tls.Config, facility int, tag string) (*tlsWriter, error) {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: tlsTimeout}, "tcp", raddr, config)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	return &tlsWriter{conn: conn, facility: facility, hostname: hostname, tag: tag, pid: os.Getpid(), timeout: tlsTimeout}, nil
+}
+
+//Debug sends a message of severity LOG_DEBUG
+func (w *tlsWriter) Debug(m string) error {
+	return w.write(goSyslog.LOG_DEBUG, m)
+}
+
+//Info sends a message of severity LOG_INFO
+func (w *tlsWriter) Info(m string) error {
+	return w.write(goSyslog.LOG_INFO, m)
+}
+
+//Warning sends a message of severity LOG_WARNING
+func (w *tlsWriter) Warning(m string) error {
+	return w.write(goSyslog.LOG_WARNING, m)
+}
+
+//Err sends a message of severity LOG_ERR
+func (w *tlsWriter) Err(m string) error {
+	return w.write(goSyslog.LOG_ERR, m)
+}
+
+//Crit sends a message of severity LOG_CRIT
+func (w *tlsWriter) Crit(m string) error {
+	return w.write(goSyslog.LOG_CRIT, m)
+}
+
+//Close closes the connection to the syslog server
+func (w *tlsWriter) Close() error {
+	return w.conn.Close()
+}
+
+//write sends a message formatted per RFC5424 and prefixed by its length in bytes (RFC5425)
+//Arguments: [severity] syslog severity. [msg] message text
+//Returns: error if the write failed or timed out
+func (w *tlsWriter) write(severity goSyslog.Priority, msg string) error {
+	priority := w.facility<<3 | int(severity)
+	frame := fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		priority, time.Now().Format(rfc5424Time), w.hostname, w.tag, w.pid, msg)
+	if err := w.conn.SetWriteDeadline(time.Now().Add(w.timeout)); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w.conn, "%d %s", len(frame), frame)
+	return err
+}
@@ -0,0 +1,146 @@
+/*
+These tests cover:
+- Framing of messages sent over TLS by their length (octet counting, RFC5425)
+- The priority derived from the facility index and the severity
+- The write deadline on a stalled connection
+*/
+package syslog
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	. "launchpad.net/gocheck"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+//Hook this testing framework into go test
+func Test(t *testing.T) { TestingT(t) }
+
+type TLSSuite struct{}
+
+var _ = Suite(&TLSSuite{})
+
+//listenTLS starts a TLS listener on localhost with a self-signed certificate
+//Returns: listener, client configuration trusting the certificate
+func listenTLS(c *C) (net.Listener, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+	cert, err := x509.ParseCertificate(der)
+	c.Assert(err, IsNil)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	c.Assert(err, IsNil)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return listener, &tls.Config{RootCAs: roots}
+}
+
+//readFrame reads a message framed by its length
+//Returns: message without the length, error if the frame is malformed
+func readFrame(r *bufio.Reader) (string, error) {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+	if err != nil {
+		return "", err
+	}
+	frame := make([]byte, n)
+	_, err = io.ReadFull(r, frame)
+	return string(frame), err
+}
+
+//When sending messages over TLS, each should be prefixed by its length in bytes
+func (s *TLSSuite) TestOctetCounting(c *C) {
+	listener, config := listenTLS(c)
+	defer listener.Close()
+
+	frames := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			frame, err := readFrame(r)
+			if err != nil {
+				close(frames)
+				return
+			}
+			frames <- frame
+		}
+	}()
+
+	w, err := dialTLS(listener.Addr().String(), config, 16, "app")
+	c.Assert(err, IsNil)
+	c.Assert(w.Err("first message"), IsNil)
+	c.Assert(w.Info("second ünïcode message\nwith newline"), IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	pattern := `1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}(Z|[+-]\d\d:\d\d) \S+ app ` + strconv.Itoa(w.pid) + ` - - `
+	c.Assert(<-frames, Matches, `<131>`+pattern+`first message`)
+	c.Assert(<-frames, Matches, `(?s)<134>`+pattern+`second ünïcode message\nwith newline`)
+	_, open := <-frames
+	c.Assert(open, Equals, false)
+}
+
+//When the server stops reading, a write should fail once the deadline passed instead of blocking
+func (s *TLSSuite) TestWriteDeadline(c *C) {
+	listener, config := listenTLS(c)
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		//Complete the handshake, then never read
+		conn.(*tls.Conn).Handshake()
+		accepted <- conn
+	}()
+
+	w, err := dialTLS(listener.Addr().String(), config, 16, "app")
+	c.Assert(err, IsNil)
+	defer w.Close()
+	conn := <-accepted
+	defer conn.Close()
+
+	w.timeout = 50 * time.Millisecond
+	large := strings.Repeat("x", 1<<20)
+	start := time.Now()
+	for i := 0; i < 1000 && err == nil; i++ {
+		err = w.Warning(large)
+	}
+	c.Assert(err, NotNil)
+	netErr, ok := err.(net.Error)
+	c.Assert(ok && netErr.Timeout(), Equals, true, Commentf("error %v", err))
+	c.Assert(time.Since(start) < 10*time.Second, Equals, true)
+}
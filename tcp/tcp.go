@@ -0,0 +1,253 @@
+/*
+Package tcp implements an output module for logging to a remote collector speaking a line-delimited
+TCP protocol using rlog.
+*/
+package tcp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/rightscale/rlog/common"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+//Configuration of tcp logging module
+type tcpLogger struct {
+	common.ModuleSeverity
+	addr           string           // address of the remote collector (host:port)
+	removeNewlines bool             // replace newlines and tabs
+	writeTimeout   time.Duration    // max time a single write may block, 0 to wait forever
+	formatter      common.Formatter // creates the text written for each message
+	conn           net.Conn         // connection to the collector
+	writer         *bufio.Writer    // buffered writer on top of conn
+	healthMutex    sync.Mutex       // guards healthErr, read concurrently by Healthy
+	healthErr      error            // error of the last reconnect, nil while connected
+	dropped        int              // messages dropped since the last flush
+	dropErr        error            // error dropping the latest message, reported by the next flush
+}
+
+//errNotConnected is returned when writing after a failed reconnect attempt
+var errNotConnected = errors.New("rlog tcp: not connected")
+
+//NewTCPLogger enables logging to a remote collector. Each log message is written as a single line.
+//When removeNewlines is set, newlines and tabs are replaced with ASCII characters as in syslog.
+//Returns: instance of tcp logger module in case of success, error otherwise
+func NewTCPLogger(addr string, removeNewlines bool) (*tcpLogger, error) {
+	return NewTCPLoggerWithTimeout(addr, removeNewlines, 0)
+}
+
+//MustNewTCPLogger enables logging to a remote collector like NewTCPLogger but panics if the collector
+//is not reachable, for concise setup in main
+func MustNewTCPLogger(addr string, removeNewlines bool) *tcpLogger {
+	conf, err := NewTCPLogger(addr, removeNewlines)
+	if err != nil {
+		panic(err)
+	}
+	return conf
+}
+
+//NewTCPLoggerWithTimeout enables logging to a remote collector like NewTCPLogger. In addition, every
+//write is limited to writeTimeout so a stalled collector cannot block the module forever (0 disables
+//the timeout).
+//Returns: instance of tcp logger module in case of success, error otherwise
+func NewTCPLoggerWithTimeout(addr string, removeNewlines bool, writeTimeout time.Duration) (*tcpLogger, error) {
+	conf := new(tcpLogger)
+	conf.addr = addr
+	conf.removeNewlines = removeNewlines
+	conf.writeTimeout = writeTimeout
+	conf.formatter = common.DefaultFormatter{RemoveNewlines: removeNewlines}
+	err := conf.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+//Name names the module for rlog diagnostics and statistics
+func (conf *tcpLogger) Name() string {
+	return "tcp:" + conf.addr
+}
+
+//WithFormat selects the output format, plain text is used by default. Returns the tcp logger to
+//allow chaining with the constructor.
+func (conf *tcpLogger) WithFormat(format common.MessageFormat) *tcpLogger {
+	conf.formatter = common.NewFormatter(format, conf.removeNewlines)
+	return conf
+}
+
+//WithFormatter selects a custom formatter creating the text written for each message. Returns the tcp
+//logger to allow chaining with the constructor.
+func (conf *tcpLogger) WithFormatter(formatter common.Formatter) *tcpLogger {
+	conf.formatter = formatter
+	return conf
+}
+
+//WithSeverity sets a severity threshold for this module overriding the global rlog severity.
+//Returns the tcp logger to allow chaining with the constructor.
+func (conf *tcpLogger) WithSeverity(severity common.RlogSeverity) *tcpLogger {
+	conf.SetSeverity(severity)
+	return conf
+}
+
+//Healthy reports whether the module is connected to the collector, e.g. for a readiness probe, see
+//rlog.HealthCheck
+//Returns: nil while connected, error of the last failed reconnect otherwise
+func (conf *tcpLogger) Healthy() error {
+	conf.healthMutex.Lock()
+	defer conf.healthMutex.Unlock()
+	return conf.healthErr
+}
+
+//LaunchModule is intended to run in a separate goroutine and used by rlog internally. It writes log
+//messages to the collector. Arguments: [dataChan] Channel to receive log messages. [flushChan]
+//Channel to receive flush command
+func (conf *tcpLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
+
+	prefix := common.SyslogHeader()
+
+	//Wait forever on data and flush channel
+	for {
+		select {
+		case logMsg := <-dataChan:
+			//Received log message, send it
+			conf.WriteSync(logMsg, prefix)
+		case ret, ok := <-flushChan:
+			if !ok {
+				//Flush channel closed by rlog: write pending messages and exit
+				conf.flush(dataChan, prefix)
+				return
+			}
+			//Flush and return the number of messages sent and the messages dropped meanwhile
+			flushed, err := conf.flush(dataChan, prefix)
+			ret <- common.FlushResult{Flushed: flushed, Err: err}
+		}
+	}
+}
+
+//WriteSync sends a log message to the collector, reconnecting on failure. It is used by LaunchModule
+//and by rlog directly when running in synchronous mode (see rlog.RlogConfig.Synchronous).
+//Arguments: [rawRlogMsg] log message. [prefix] log prefix
+func (conf *tcpLogger) WriteSync(rawRlogMsg *common.RlogMsg, prefix string) {
+	err := conf.retry(func() error { return conf.writeMsg(rawRlogMsg, prefix) })
+	if err != nil {
+		// the collector may come back later, the next flush panics if it does not.
+		log.Printf("[RightLog4Go] tcp connection to %s failed, message dropped: %s", conf.addr, err.Error())
+		conf.dropped++
+		conf.dropErr = err
+	}
+}
+
+//FlushSync writes buffered data to the collector when rlog runs in synchronous mode
+func (conf *tcpLogger) FlushSync() {
+	//A nil channel has no pending messages
+	conf.flush(nil, "")
+}
+
+//writeMsg writes message to the buffered connection
+func (conf *tcpLogger) writeMsg(rawRlogMsg *common.RlogMsg, prefix string) error {
+	if conf.writer == nil {
+		return errNotConnected
+	}
+
+	conf.setWriteDeadline()
+	_, err := fmt.Fprintln(conf.writer, conf.formatter.Format(rawRlogMsg, prefix))
+	return err
+}
+
+//flushWriter writes the buffered data to the connection
+func (conf *tcpLogger) flushWriter() error {
+	if conf.writer == nil {
+		return errNotConnected
+	}
+
+	conf.setWriteDeadline()
+	return conf.writer.Flush()
+}
+
+//flush writes all pending log messages to the collector
+//Arguments:[dataChan] data channel to access all pending messages, [prefix] log prefix
+//Returns: number of messages sent, error if messages were dropped since the last flush
+func (conf *tcpLogger) flush(dataChan <-chan (*common.RlogMsg), prefix string) (int, error) {
+	flushed := 0
+	for {
+		//Perform non blocking read until the channel is empty
+		select {
+		case logMsg := <-dataChan:
+			err := conf.retry(func() error { return conf.writeMsg(logMsg, prefix) })
+			if err != nil {
+				// panic if reconnecting did not resolve the issue so that the service can be
+				// restarted by its outer harness with alerts, etc.
+				panic(err)
+			}
+			flushed++
+		default:
+			err := conf.retry(conf.flushWriter)
+			if err != nil {
+				panic(err)
+			}
+			if conf.dropped > 0 {
+				err = fmt.Errorf("%d message(s) dropped: %s", conf.dropped, conf.dropErr.Error())
+				conf.dropped, conf.dropErr = 0, nil
+			}
+			return flushed, err
+		}
+	}
+}
+
+//retry runs the given write operation and, if it fails, reconnects and runs it once more.
+//Returns: error of the last attempt
+func (conf *tcpLogger) retry(write func() error) error {
+	err := write()
+	if err != nil {
+		// we may be able to work around intermittent failures by reconnecting.
+		err = conf.reconnect()
+		if err == nil {
+			err = write()
+		}
+	}
+
+	return err
+}
+
+//setWriteDeadline limits the time the next write may take if a write timeout is configured
+func (conf *tcpLogger) setWriteDeadline() {
+	if conf.writeTimeout > 0 {
+		conf.conn.SetWriteDeadline(time.Now().Add(conf.writeTimeout))
+	}
+}
+
+// establishes the connection to the collector.
+func (conf *tcpLogger) connect() error {
+	conn, err := net.Dial("tcp", conf.addr)
+	if err != nil {
+		log.Printf("Could not open connection to %s, reason: %s", conf.addr, err.Error())
+		return err
+	}
+
+	conf.conn = conn
+	conf.writer = bufio.NewWriter(conn)
+	return nil
+}
+
+// closes existing connection and attempts to reconnect to the collector. Data still buffered for
+// the old connection is lost.
+func (conf *tcpLogger) reconnect() error {
+	oldConn := conf.conn
+	conf.conn = nil
+	conf.writer = nil
+	if oldConn != nil {
+		//Do not handle error, the connection is most likely broken already
+		oldConn.Close()
+	}
+
+	err := conf.connect()
+	conf.healthMutex.Lock()
+	conf.healthErr = err
+	conf.healthMutex.Unlock()
+	return err
+}
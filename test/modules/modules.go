@@ -20,10 +20,7 @@ func main() {
 		panic("Getting syslog facility value failed: " + err.Error())
 	}
 
-	syslogModule, err := syslog.NewLocalFacilitySyslogLogger("", "", facility, "tmp/sysloggerHeartbeat.txt")
-	if err != nil {
-		panic("Getting syslog logger instance failed: " + err.Error())
-	}
+	syslogModule := syslog.MustNewLocalFacilitySyslogLogger("", "", facility, "tmp/sysloggerHeartbeat.txt")
 
 	//Setup file logger
 	log_file_name := "tmp/test.txt"
@@ -31,10 +28,7 @@ func main() {
 	if _, err = os.Stat(rotated_log_name); err == nil {
 		os.Remove(rotated_log_name)
 	}
-	fileModule, err := file.NewFileLogger(log_file_name, true, true)
-	if err != nil {
-		panic("Getting file logger instance failed: " + err.Error())
-	}
+	fileModule := file.MustNewFileLogger(log_file_name, true, true)
 
 	rlog.EnableModule(syslogModule)
 	rlog.EnableModule(fileModule)
@@ -0,0 +1,144 @@
+/*
+Implements a module capturing log messages in memory to assert on them in tests.
+*/
+package rlogtest
+
+import (
+	"github.com/rightscale/rlog"
+	"github.com/rightscale/rlog/common"
+	"strings"
+	"sync"
+)
+
+// Test module recording every log message it receives. All methods are goroutine-safe.
+type Capture struct {
+	mutex    sync.Mutex
+	messages []*common.RlogMsg
+}
+
+// Creates a capturing module. Enable it using rlog.EnableModule before starting rlog.
+//
+// return: instance of capturing module
+func NewCapture() *Capture {
+	return new(Capture)
+}
+
+// Convenience method to initialize rlog with a single capturing module receiving
+// messages of all severities and start rlog.
+//
+// return: the capturing module
+func StartCapture() *Capture {
+	capture := NewCapture()
+	rlog.ResetState()
+	rlog.EnableModule(capture)
+	rlogConf := rlog.GetDefaultConfig()
+	rlogConf.Severity = rlog.SeverityTrace
+	rlog.Start(rlogConf)
+	return capture
+}
+
+// Retrieves the messages recorded so far. Messages reach the module asynchronously,
+// call rlog.Flush() first to include all messages logged before.
+//
+// return: recorded messages in the order they were received
+func (self *Capture) Messages() []*common.RlogMsg {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	res := make([]*common.RlogMsg, len(self.messages))
+	copy(res, self.messages)
+	return res
+}
+
+// Determines whether a recorded message contains the given text. See Messages
+// regarding flushing.
+//
+// substr: text to look for in the messages
+//
+// return: true if at least one message contains the text
+func (self *Capture) Contains(substr string) bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, msg := range self.messages {
+		if strings.Contains(msg.Msg, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Discards the messages recorded so far.
+func (self *Capture) Reset() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.messages = nil
+}
+
+// Intended to run in a separate goroutine. It records log messages.
+//
+// dataChan: receives log messages.
+//
+// flushChan: receives flush command.
+func (self *Capture) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
+
+	// wait forever on data and flush channel
+	for {
+		select {
+		case logMsg := <-dataChan:
+			// received log message, record it
+			self.record(logMsg)
+		case ret, ok := <-flushChan:
+			if !ok {
+				// flush channel closed by rlog: record pending messages and exit
+				self.flush(dataChan)
+				return
+			}
+			// flush and return the number of messages recorded
+			ret <- common.FlushResult{Flushed: self.flush(dataChan)}
+		}
+	}
+}
+
+// Records a log message when rlog runs in synchronous mode, see rlog.RlogConfig.Synchronous.
+//
+// rawRlogMsg: log message to record.
+//
+// prefix: log prefix (unused)
+func (self *Capture) WriteSync(rawRlogMsg *common.RlogMsg, prefix string) {
+	self.record(rawRlogMsg)
+}
+
+// Does nothing as messages are recorded right away. Used when rlog runs in synchronous mode.
+func (self *Capture) FlushSync() {
+}
+
+// Records the message.
+//
+// rawRlogMsg: log message received from channel.
+func (self *Capture) record(rawRlogMsg *common.RlogMsg) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.messages = append(self.messages, rawRlogMsg)
+}
+
+// Records pending messages.
+//
+// dataChan: data channel to access all pending messages
+//
+// return: number of messages recorded
+func (self *Capture) flush(dataChan <-chan (*common.RlogMsg)) int {
+	flushed := 0
+	for {
+		// perform non blocking read until the channel is empty
+		select {
+		case logMsg := <-dataChan:
+			self.record(logMsg)
+			flushed++
+		default:
+			return flushed
+		}
+	}
+}
@@ -41,7 +41,7 @@ func StartGoCheckLogger(c *gocheck.C) {
 // dataChan: receives log messages.
 //
 // flushChan: receives flush command.
-func (self *GoCheckLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (bool))) {
+func (self *GoCheckLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
 
 	prefix := common.SyslogHeader()
 
@@ -51,10 +51,14 @@ func (self *GoCheckLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flush
 		case logMsg := <-dataChan:
 			// received log message, print it
 			self.printMsg(logMsg, prefix)
-		case ret := <-flushChan:
-			// flush and return success
-			self.flush(dataChan, prefix)
-			ret <- true
+		case ret, ok := <-flushChan:
+			if !ok {
+				// flush channel closed by rlog: write pending messages and exit
+				self.flush(dataChan, prefix)
+				return
+			}
+			// flush and return the number of messages printed
+			ret <- common.FlushResult{Flushed: self.flush(dataChan, prefix)}
 		}
 	}
 }
@@ -74,14 +78,18 @@ func (self *GoCheckLogger) printMsg(rawRlogMsg *common.RlogMsg, prefix string) {
 // dataChan: data channel to access all pending messages
 //
 // prefix: log prefix
-func (self *GoCheckLogger) flush(dataChan <-chan (*common.RlogMsg), prefix string) {
+//
+// return: number of messages printed
+func (self *GoCheckLogger) flush(dataChan <-chan (*common.RlogMsg), prefix string) int {
+	flushed := 0
 	for {
 		// perform non blocking read until the channel is empty
 		select {
 		case logMsg := <-dataChan:
 			self.printMsg(logMsg, prefix)
+			flushed++
 		default:
-			return
+			return flushed
 		}
 	}
 }
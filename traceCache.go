@@ -0,0 +1,92 @@
+package rlog
+
+/*
+This file implements the compression of repeated stack traces. The first message carrying a stack trace
+logs it in full along with a short ID. Messages carrying the same stack trace within the window only
+reference the ID. Recently seen stack traces are kept in a small LRU cache, the least recently seen
+trace is forgotten once the cache is full.
+*/
+
+import (
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+//stackIDField is the structured field carrying the ID of a stack trace, distinct from the "trace_id" of
+//distributed tracing (see the otel package)
+const stackIDField = "stack_id"
+
+//defaultTraceCacheSize is the number of distinct stack traces remembered
+const defaultTraceCacheSize = 256
+
+//traceCache keeps track of the stack traces logged in full recently
+type traceCache struct {
+	mutex   sync.Mutex
+	size    int                      //max number of stack traces remembered
+	entries map[uint64]*list.Element //elements of lru by trace hash
+	lru     *list.List               //*traceEntry ordered from most to least recently seen
+}
+
+//traceEntry holds the time a stack trace was logged in full
+type traceEntry struct {
+	hash   uint64    //hash of the stack trace, 64 bits make collisions unlikely
+	logged time.Time //time the stack trace was logged in full, starts its window
+}
+
+//newTraceCache creates a cache without any stack traces
+//Arguments: max number of stack traces remembered
+func newTraceCache(size int) *traceCache {
+	return &traceCache{size: size, entries: make(map[uint64]*list.Element), lru: list.New()}
+}
+
+//check determines whether a stack trace has been logged in full within the window. If not, the window
+//of the stack trace starts now.
+//Arguments: [trace] stack trace. [now] time of the message. [window] duration of the window
+//Returns: ID of the stack trace, true if the stack trace can be referenced by its ID only
+func (c *traceCache) check(trace string, now time.Time, window time.Duration) (string, bool) {
+	h := fnv.New64a()
+	h.Write([]byte(trace))
+	hash := h.Sum64()
+	id := fmt.Sprintf("%016x", hash)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if el, ok := c.entries[hash]; ok {
+		c.lru.MoveToFront(el)
+		e := el.Value.(*traceEntry)
+		if now.Sub(e.logged) < window {
+			return id, true
+		}
+		e.logged = now
+		return id, false
+	}
+
+	c.entries[hash] = c.lru.PushFront(&traceEntry{hash: hash, logged: now})
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Remove(c.lru.Back()).(*traceEntry)
+		delete(c.entries, oldest.hash)
+	}
+	return id, false
+}
+
+//compressStackTrace adds the ID of the stack trace to the fields of a message and drops the stack
+//trace itself if it has been logged in full within the window, see RlogConfig.StackTraceDedupeWindow
+//Arguments: [raw] message carrying a stack trace. [now] time of the message
+func (r *Instance) compressStackTrace(raw *logPieces, now time.Time) {
+	id, seen := r.traces.check(raw.stackTrace, now, r.config.StackTraceDedupeWindow)
+	if seen {
+		raw.stackTrace = ""
+	}
+
+	//Copy the fields rather than adding to them, the deduplicator may hold on to the map
+	fields := make(map[string]interface{}, len(raw.fields)+1)
+	for k, v := range raw.fields {
+		fields[k] = v
+	}
+	fields[stackIDField] = id
+	raw.fields = fields
+}
@@ -0,0 +1,64 @@
+/*
+These tests cover:
+- Remembering stack traces within their window
+- Eviction of the least recently seen stack trace
+- Referencing repeated stack traces by ID
+*/
+package rlog
+
+import (
+	"container/list"
+	"github.com/rightscale/rlog/common"
+	. "launchpad.net/gocheck"
+	"time"
+)
+
+//When a stack trace is checked repeatedly, it should be referenced by ID within the window only
+func (s *Stateless) TestTraceCacheCheck(t *C) {
+	c := newTraceCache(2)
+	now := time.Now()
+
+	id, seen := c.check("trace a", now, time.Minute)
+	t.Assert(seen, Equals, false)
+	t.Assert(id, Matches, "[0-9a-f]{16}")
+	other, seen := c.check("trace a", now.Add(time.Second), time.Minute)
+	t.Assert(seen, Equals, true)
+	t.Assert(other, Equals, id)
+
+	//Once the window closed, the stack trace is logged in full again and a new window starts
+	_, seen = c.check("trace a", now.Add(time.Minute), time.Minute)
+	t.Assert(seen, Equals, false)
+	_, seen = c.check("trace a", now.Add(time.Minute+time.Second), time.Minute)
+	t.Assert(seen, Equals, true)
+
+	//The least recently seen stack trace is forgotten once the cache is full
+	c.check("trace b", now, time.Minute)
+	c.check("trace a", now, time.Minute)
+	c.check("trace c", now, time.Minute)
+	_, seen = c.check("trace a", now, time.Minute)
+	t.Assert(seen, Equals, true)
+	_, seen = c.check("trace b", now, time.Minute)
+	t.Assert(seen, Equals, false)
+}
+
+//When logging the same stack trace repeatedly, only the first message should carry it in full
+func (s *Initialized) TestStackTraceDedupe(t *C) {
+	std.config.StackTraceDedupeWindow = time.Minute
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	var msgs [2]*common.RlogMsg
+	for i := range msgs {
+		NewLogger().WithFields(map[string]interface{}{"attempt": i}).Error("failing")
+		msgs[i] = nonBlockingChanRead(myChan)
+	}
+	t.Assert(msgs[0].StackTrace, Not(Equals), "")
+	t.Assert(msgs[0].Fields[stackIDField], Matches, "[0-9a-f]{16}")
+	t.Assert(msgs[1].StackTrace, Equals, "")
+	t.Assert(msgs[1].Fields[stackIDField], Equals, msgs[0].Fields[stackIDField])
+	t.Assert(msgs[1].Fields["attempt"], Equals, 1)
+
+	//Messages without stack trace do not carry an ID
+	Info("healthy")
+	t.Assert(nonBlockingChanRead(myChan).Fields, IsNil)
+}
@@ -2,11 +2,15 @@ package rlog
 
 import (
 	"container/list"
+	"context"
 	"fmt"
 	"github.com/rightscale/rlog/common"
 	"log"
 	"math/rand"
+	"os"
+	"reflect"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -18,52 +22,339 @@ const (
 	SeverityWarning common.RlogSeverity = iota
 	SeverityInfo    common.RlogSeverity = iota
 	SeverityDebug   common.RlogSeverity = iota
+	SeverityTrace   common.RlogSeverity = iota
 )
 
 //===== Data types =====
 
-//logger is an empty struct because the rlog functions on top of it are all
-//referring to the singleton rlog instance.
-type logger struct{}
+//logger carries the fields added to each of its messages. Apart from that, the rlog functions on top
+//of it are all referring to the rlog instance the logger was created from.
+type logger struct {
+	inst          *Instance              //instance processing the messages
+	fields        map[string]interface{} //structured key/value pairs added to every message (nil if none)
+	printSeverity common.RlogSeverity    //severity of messages logged with Print, Printf and Println
+	forcePos      bool                   //true if posInfo overrides the position info of the log methods
+	posInfo       bool                   //include the position of the call in all messages, see WithPosInfo
+}
 
 //RlogConfig holds the logger configuration. It allows rlog users to configure the logger.
 type RlogConfig struct {
-	ChanCapacity       uint32 //Buffer capacity for communication between logger and each module
-	FlushTimeout       uint32 //Max time for rlog modules to write-back their data (seconds)
-	Severity           common.RlogSeverity
-	tagsDisabledExcept map[string]bool //All except the listed tags are disabled
-	tagsEnabledExcept  map[string]bool //All tags are filtered except for the listed tags
+	ChanCapacity            uint32                //Buffer capacity for communication between logger and each module
+	FlushTimeout            uint32                //Max time for rlog modules to write-back their data (seconds)
+	Severity                common.RlogSeverity   //Default severity threshold for modules without their own
+	TimestampFormat         string                //Go reference time layout of the message timestamp (e.g. time.StampMicro)
+	TimestampUTC            bool                  //Convert the message timestamp to UTC before formatting
+	FatalExits              bool                  //Flush and exit the process with status 1 after a fatal message
+	OnFatal                 func(*common.RlogMsg) //Invoked after a fatal message has been flushed, before exiting
+	RateLimit               uint32                //Max messages per second and severity, 0 for unlimited
+	RateLimitReportInterval uint32                //Min time between summaries of rate limited messages (seconds)
+	StackBufferSize         uint32                //Initial buffer size for stack traces, grown as needed (bytes)
+	StackTraceMinSeverity   SeverityThreshold     //Least severe level carrying a stack trace, e.g. ThresholdAt(SeverityError), 0 to disable
+	HeaderFormatter         HeaderFormatter       //Creates the message header, nil for the built-in header
+	DisablePositionInfo     bool                  //Omit file, line and pc of the log call to save the runtime lookup
+	IncludeFuncName         bool                  //Add the calling function to the header position, e.g. "[pkg.Func file:42]"
+	SanitizeMessages        bool                  //Replace invalid UTF-8 and strip control characters except newlines, carriage returns and tabs
+	GlobalPrefix            string                //Prepended to every message after the header, e.g. "[payments:prod]"
+	DedupeWindow            time.Duration         //Collapse identical messages within this window, 0 to disable
+	CallerSkip              int                   //Frames of wrapper libraries to skip when reporting the log call position (>= 0)
+	StartupBanner           bool                  //Log an info message describing process and configuration on Start
+	Version                 string                //Application version (e.g. commit) included in the startup banner
+	OverflowPolicy          OverflowPolicy        //Behavior when a module channel is full (DropOldest by default)
+	BlockTimeout            time.Duration         //Max time to block with the Block overflow policy, 0 waits forever
+	Watermark               float64               //Fill level of a module channel (fraction of ChanCapacity) above which BlockAboveWatermark blocks
+	WatermarkTimeout        time.Duration         //Max time to block with the BlockAboveWatermark overflow policy, 0 for the default (100ms)
+	PanicOnOverflow         bool                  //Panic instead of dropping messages, to find undersized buffers in tests
+	TagMatch                TagMatch              //Whether any or all tags of a message have to be enabled
+	Synchronous             bool                  //Write messages in the logging goroutine, see syncModule
+	AutoFlushInterval       time.Duration         //Flush all modules periodically in the background, 0 to disable
+	Routes                  []Route               //Modules receiving each severity range, nil to send messages to all modules
+	FlushOnSeverity         SeverityThreshold     //Least severe level flushing all modules once logged, e.g. ThresholdAt(SeverityError), 0 to disable
+	InternalLogger          *log.Logger           //Destination of rlog's own diagnostics, nil for the standard library logger
+	StackTraceDedupeWindow  time.Duration         //Reference stack traces logged within this window by ID only, 0 to disable
+	tagsDisabledExcept      *tagSet               //All except the listed tags are disabled
+	tagsEnabledExcept       *tagSet               //All tags are filtered except for the listed tags
 }
 
 //rlogModule interface is implemented by output modules. It requires a function which takes a message
 //and a flush channel as argument. When rlog is launched and the module is enabled, this
-//function is launched as separate goroutine.
+//function is launched as separate goroutine. On flush, the module writes the pending messages and
+//responds with their number. rlog closes the flush channel when it is reset, the module shall then
+//write pending messages and return.
 type rlogModule interface {
-	LaunchModule(<-chan (*common.RlogMsg), chan (chan (bool)))
+	LaunchModule(<-chan (*common.RlogMsg), chan (chan (common.FlushResult)))
+}
+
+//syncModule is implemented by output modules supporting the synchronous mode (RlogConfig.Synchronous).
+//In synchronous mode, no goroutine is launched for such a module: WriteSync is invoked by the logging
+//goroutine for each message and returns once the message is written, FlushSync is invoked on flush and
+//reset. rlog serializes the calls. Modules not implementing it are launched as usual.
+type syncModule interface {
+	rlogModule
+	WriteSync(msg *common.RlogMsg, prefix string)
+	FlushSync()
+}
+
+//validatingModule is implemented by output modules able to check their health before they are launched
+//(e.g. whether their file is still open). StartE refuses to start if a module fails the check, Start
+//does not check the modules. Modules not implementing it are assumed to be healthy.
+type validatingModule interface {
+	Validate() error
+}
+
+//healthModule is implemented by output modules able to report their health while running (e.g. whether
+//their connection is up), see HealthCheck. Healthy is called concurrently to the module's goroutine.
+type healthModule interface {
+	Healthy() error
+}
+
+//severityModule is implemented by output modules carrying their own severity threshold (see
+//common.ModuleSeverity). Modules not implementing it use the global threshold of RlogConfig.
+type severityModule interface {
+	Severity() (common.RlogSeverity, bool)
+}
+
+//HeaderFormatter creates the header prepended to each log message. It receives the log level as string
+//(INFO, ERROR, etc.), the message tag ("" if none) and the position of the rlog invocation. File and line
+//are meant to be included only if posInfo is set. The header then owns the position: the text formatters
+//do not render it again (see common.RlogMsg.PosInHeader), while structured formats (JSON, logfmt) still
+//carry file and line as fields.
+type HeaderFormatter func(posInfo bool, level, tag, file string, line int) string
+
+//TagMatch determines how the tags of a message carrying several tags are matched against the enabled
+//and disabled tags (see EnableTagsExcept and DisableTagsExcept)
+type TagMatch int
+
+const (
+	TagMatchAny TagMatch = iota //a message passes if any of its tags is enabled (default)
+	TagMatchAll                 //a message passes only if all of its tags are enabled
+)
+
+//OverflowPolicy determines what happens to a message if the channel to a module is full, i.e. if the
+//module cannot keep up with the messages logged
+type OverflowPolicy int
+
+const (
+	DropOldest          OverflowPolicy = iota //delete the oldest message in the channel to make room (default)
+	DropNewest                                //drop the message being logged
+	Block                                     //block the logging goroutine until the module makes room
+	BlockAboveWatermark                       //block while the channel is filled above RlogConfig.Watermark, then drop the oldest message if full
+)
+
+//Route sends the messages of a severity range to a subset of the modules. Once a module is listed in any
+//route of RlogConfig.Routes, it only receives the messages of the routes listing it. Modules not listed
+//in any route receive all messages as usual. The severity thresholds apply in addition to the routes.
+type Route struct {
+	MinSeverity common.RlogSeverity //least severe level routed (e.g. SeverityTrace)
+	MaxSeverity common.RlogSeverity //most severe level routed (e.g. SeverityFatal)
+	modules     []rlogModule        //modules receiving the routed messages
+}
+
+//lazyMessage defers creating a message until it is formatted, which happens only if the message is not
+//filtered, see DebugFunc
+type lazyMessage func() string
+
+//String creates the message
+func (fn lazyMessage) String() string {
+	return fn()
+}
+
+//SeverityThreshold enables a feature for the messages of a severity or more severe, see ThresholdAt.
+//Its zero value disables the feature.
+type SeverityThreshold uint
+
+//ThresholdAt creates a threshold enabling a feature for the messages of the given severity or more severe
+//Arguments: least severe level enabling the feature (e.g. SeverityError)
+//Returns: threshold
+func ThresholdAt(severity common.RlogSeverity) SeverityThreshold {
+	return SeverityThreshold(severity) + 1
+}
+
+//includes determines whether the messages of a severity reach the threshold
+//Returns: false if the threshold is disabled or the severity is less severe
+func (t SeverityThreshold) includes(severity common.RlogSeverity) bool {
+	return t != 0 && SeverityThreshold(severity) < t
+}
+
+//StackTraceDisabled is the zero value of RlogConfig.StackTraceMinSeverity, which disables stack traces
+//entirely
+const StackTraceDisabled SeverityThreshold = 0
+
+//FlushDisabled is the zero value of RlogConfig.FlushOnSeverity, which never flushes after logging a
+//message
+const FlushDisabled SeverityThreshold = 0
+
+//defaultStackBufferSize is the initial buffer size for stack traces unless configured otherwise
+const defaultStackBufferSize = 2048
+
+//defaultWatermark is the fill level of module channels above which BlockAboveWatermark blocks unless
+//configured otherwise
+const defaultWatermark = 0.9
+
+//defaultWatermarkTimeout bounds the time BlockAboveWatermark blocks unless configured otherwise, so that a
+//module which stopped taking messages does not stall the logging goroutines
+const defaultWatermarkTimeout = 100 * time.Millisecond
+
+//LogStats holds counters about the delivery of log messages to the modules. A message sent to several
+//modules is counted once per module.
+type LogStats struct {
+	Enqueued      uint64        //messages pushed to module channels
+	Dropped       uint64        //messages lost because a module channel was full
+	FlushTimeouts uint64        //flush commands not acknowledged by a module in time
+	Suppressed    uint64        //messages dropped while logging was suppressed, see Suppress
+	Modules       []ModuleStats //counters per module in the order the modules were enabled
+}
+
+//ModuleStats holds counters about the delivery of log messages to a single module
+type ModuleStats struct {
+	Name     string //module name, see namedModule
+	Enqueued uint64 //messages pushed to the module channel
+	Dropped  uint64 //messages lost because the module channel was full
+}
+
+//FlushReport holds the outcome of a flush, see FlushWithReport
+type FlushReport struct {
+	Flushed int           //pending messages written by all modules
+	Modules []ModuleFlush //outcome per module in the order the modules were enabled
+}
+
+//ModuleFlush holds the outcome of a flush of a single module
+type ModuleFlush struct {
+	Name    string //module name, see namedModule
+	Flushed int    //pending messages written by the module
+	Err     error  //nil if the module flushed, otherwise the reason it did not
+}
+
+//namedModule is implemented by output modules providing a name for diagnostics and statistics.
+//Modules not implementing it are named after their type.
+type namedModule interface {
+	Name() string
+}
+
+//Instance is an independent logger owning its configuration, modules and channels. The rlog package
+//functions refer to a default instance. A library may create its own instance to log independently of
+//the application using rlog.
+type Instance struct {
+	//64-bit fields accessed atomically come first, 32-bit platforms only align the start of the struct
+	inFlight       [2]int64      //pushes in progress per parity of pushEpoch (atomic access only)
+	flushTimeouts  uint64        //flush commands not acknowledged in time (atomic access only)
+	lastTimestamp  int64         //time of the latest message in ns since epoch (atomic access only)
+	lastClock      uint64        //clockGeneration lastTimestamp was taken with (atomic access only)
+	seq            uint64        //sequence number of the latest message (atomic access only)
+	timestamps     atomic.Value  //*timestampCache holding the latest formatted timestamp
+	suppressedMsgs uint64        //messages dropped while logging was suppressed (atomic access only)
+	suppressed     int32         //number of Suppress calls not resumed yet (atomic access only)
+	activeSeverity uint32        //global severity threshold in effect (atomic access only)
+	initialized    int32         //1 once the logger has been initialized (atomic access only)
+	config         RlogConfig    //logger configuration
+	modulesMutex   sync.RWMutex  //guards activeModules, msgChannels and flushChannels once started
+	activeModules  *list.List    //modules to launch as soon as the logger is started
+	mirrorErrors   bool          //whether warnings and more severe messages are mirrored to stderr
+	msgChannels    *list.List    //msgChannel per module, used to send messages to the modules
+	flushChannels  *list.List    //flushChannel per module, used to send the flush command to the modules
+	limiter        *rateLimiter  //rate limiter of the instance
+	dedupe         *deduplicator //collapses duplicate messages of the instance
+	traces         *traceCache   //stack traces logged in full recently
+	hooksMutex     sync.RWMutex  //guards hooks
+	hooks          []hook        //callbacks invoked for each message, see AddHook
+	flushSem       chan struct{} //holds a token while a flush runs, serializes flushes of the application and the background flush
+	pushEpoch      uint32        //incremented by each flush to tell earlier pushes apart (atomic access only)
+	autoFlushStop  chan struct{} //closed to stop the background flush, nil if not running
+	autoFlushDone  chan struct{} //closed once the background flush has stopped
 }
 
 //===== rlog global data =====
 
-//Keep reference to module initialization functions to launch them as soon as the logger is started
-var activeModules *list.List = list.New()
+//std is the default instance all rlog package functions refer to
+var std *Instance = New()
+
+//exitProcess terminates the process after a fatal message, replaced by tests
+var exitProcess = os.Exit
 
-//Initialized stores whether the logger has been initialized
-var initialized bool = false
+//clock determines the time of new messages, replaced by SetClock
+var clock = time.Now
 
-//rlogConfig holds the logger configuration
-var config RlogConfig
+//clockGeneration counts the calls to SetClock, the latest timestamp of an instance only bounds the
+//timestamps taken with the same clock
+var clockGeneration uint64
 
-//A variable for ID generation. Access it ONLY using thread safe methods from sync/atomic!
+//A variable for ID generation shared by all instances. Access it ONLY using thread safe methods from
+//sync/atomic!
 var uniqueMsgID uint64
 
+//idPrefix and idMinWidth determine the format of generated IDs, see ConfigureIDGenerator
+var idPrefix string
+var idMinWidth int
+
 //===== Initialization functions =====
 
+//New creates an independent logger instance. An instance offers the same API as the rlog package
+//(EnableModule, Start, Info, Flush, etc.) but has its own modules and configuration.
+//Returns: new instance, not started yet
+func New() *Instance {
+	r := new(Instance)
+	r.activeModules = list.New()
+	r.msgChannels = list.New()
+	r.flushChannels = list.New()
+	r.limiter = new(rateLimiter)
+	r.dedupe = newDeduplicator()
+	r.traces = newTraceCache(defaultTraceCacheSize)
+	r.flushSem = make(chan struct{}, 1)
+	return r
+}
+
 //Newlogger creates a new instance of the logger struct. The entire interface for writing
 //log messages is available on top of a logger and calls the singleton rlog instance. In contrast
 //to using the rlog package directly, a logger can satisfy a log interface required by an
 //external library and so decouple the rlog package from the library logger.
 func NewLogger() *logger {
-	return new(logger)
+	return std.NewLogger()
+}
+
+//Newlogger creates a new instance of the logger struct referring to this instance. See NewLogger.
+func (r *Instance) NewLogger() *logger {
+	return r.NewLoggerAtSeverity(SeverityInfo)
+}
+
+//NewLoggerAtSeverity creates a new instance of the logger struct like NewLogger. Messages logged with
+//the standard library style methods Print, Printf and Println get the given severity instead of "info".
+//Arguments: severity of messages logged with Print, Printf and Println
+func NewLoggerAtSeverity(severity common.RlogSeverity) *logger {
+	return std.NewLoggerAtSeverity(severity)
+}
+
+//NewLoggerAtSeverity creates a new instance of the logger struct referring to this instance. See
+//NewLoggerAtSeverity.
+func (r *Instance) NewLoggerAtSeverity(severity common.RlogSeverity) *logger {
+	return &logger{inst: r, printSeverity: severity}
+}
+
+//WithFields returns a new logger adding the given fields to every message in addition to the fields of
+//this logger. On conflict, the given fields take precedence. Fields passed to a log call (e.g. InfoF)
+//take precedence over the fields of the logger. The original logger remains unchanged.
+//Returns: logger carrying the merged fields
+func (l logger) WithFields(fields map[string]interface{}) *logger {
+	l.fields = copyFields(mergeFields(l.fields, fields))
+	return &l
+}
+
+//WithPosInfo returns a new logger including or omitting the file and line number of the call in every
+//message, regardless of the severity (by default, only Fatal and Error include it). It does not override
+//RlogConfig.DisablePositionInfo. The original logger remains unchanged.
+//Arguments: true to include the position, false to omit it
+//Returns: logger with the position info override
+func (l logger) WithPosInfo(on bool) *logger {
+	l.forcePos, l.posInfo = true, on
+	return &l
+}
+
+//pos determines whether a message of the logger includes the position of the call
+//Arguments: default of the log method
+//Returns: the override set by WithPosInfo, the default if none
+func (l logger) pos(def bool) bool {
+	if l.forcePos {
+		return l.posInfo
+	}
+	return def
 }
 
 //GetDefaultConfig returns a default configuration for the core logger. Only logging to syslog is activated
@@ -74,6 +365,13 @@ func GetDefaultConfig() RlogConfig {
 	conf.ChanCapacity = 100
 	conf.FlushTimeout = 2
 	conf.Severity = SeverityInfo
+	conf.TimestampFormat = time.Stamp
+	conf.RateLimitReportInterval = 10
+	conf.StackBufferSize = defaultStackBufferSize
+	conf.StackTraceMinSeverity = ThresholdAt(SeverityError)
+	conf.FlushOnSeverity = FlushDisabled
+	conf.Watermark = defaultWatermark
+	conf.WatermarkTimeout = defaultWatermarkTimeout
 
 	return conf
 }
@@ -82,33 +380,86 @@ func GetDefaultConfig() RlogConfig {
 //Start is not thread safe: use Start before spawning any goroutine using the logger.
 //Arguments: logger configuration.
 func Start(conf RlogConfig) {
+	std.Start(conf)
+}
+
+//Start configures the logger and launches it. Once the logger is started, it cannot be started again.
+//Start is not thread safe: use Start before spawning any goroutine using the logger.
+//Arguments: logger configuration.
+func (r *Instance) Start(conf RlogConfig) {
 
-	if !initialized {
+	if !r.IsInitialized() {
 		//Set configuration and launch modules
-		config = conf
+		r.config = conf
+		atomic.StoreUint32(&r.activeSeverity, uint32(conf.Severity))
+		r.limiter = new(rateLimiter)
+		r.dedupe = newDeduplicator()
+		r.traces = newTraceCache(defaultTraceCacheSize)
 
 		//Initialize the ID generation service to some large number so that it can be found easily
-		//in the logs when using grep.
-		uniqueMsgID = generateRandomNumber()
+		//in the logs when using grep. The service is shared, initialize it only once.
+		atomic.CompareAndSwapUint64(&uniqueMsgID, 0, generateRandomNumber())
 
 		//Now that the configuration is set, we can launch the modules
-		launchAllModules()
+		r.launchAllModules()
+
+		atomic.StoreInt32(&r.initialized, 1)
 
-		initialized = true
+		if conf.AutoFlushInterval > 0 {
+			r.startAutoFlush(conf.AutoFlushInterval)
+		}
+
+		if conf.StartupBanner {
+			r.logStartupBanner()
+		}
 	} else {
-		Error("Logger initialization triggered but logger already initialized")
+		r.Error("Logger initialization triggered but logger already initialized")
+	}
+}
+
+//StartE validates the enabled modules and starts the logger like Start if all of them are healthy. If
+//a module fails validation, the logger is not started and no module is launched, e.g. to fail fast on
+//startup. StartE is not thread safe: use StartE before spawning any goroutine using the logger.
+//Arguments: logger configuration.
+//Returns: nil on success, error naming the modules failing validation or if already started otherwise
+func StartE(conf RlogConfig) error {
+	return std.StartE(conf)
+}
+
+//StartE validates the enabled modules and starts the logger like Start if all of them are healthy. If
+//a module fails validation, the logger is not started and no module is launched, e.g. to fail fast on
+//startup. StartE is not thread safe: use StartE before spawning any goroutine using the logger.
+//Arguments: logger configuration.
+//Returns: nil on success, error naming the modules failing validation or if already started otherwise
+func (r *Instance) StartE(conf RlogConfig) error {
+	if r.IsInitialized() {
+		return fmt.Errorf("logger already initialized")
 	}
+	if err := r.validateModules(); err != nil {
+		return err
+	}
+
+	r.Start(conf)
+	return nil
 }
 
 //EnableModule activates an output module
 //Arguments: module to be activated, must implement the rlogModule interface
 func EnableModule(module rlogModule) {
-	if initialized {
+	std.EnableModule(module)
+}
+
+//EnableModule activates an output module
+//Arguments: module to be activated, must implement the rlogModule interface
+func (r *Instance) EnableModule(module rlogModule) {
+	if r.IsInitialized() {
 		// Do not allow modification if logger already initialized
-		Error("Cannot modify StdoutModuleConfig when logger already running")
+		r.Error("Cannot modify StdoutModuleConfig when logger already running")
 	} else {
-		//Launch module
-		activeModules.PushBack(module)
+		//Launch module, HealthCheck may read the list concurrently
+		r.modulesMutex.Lock()
+		r.activeModules.PushBack(module)
+		r.modulesMutex.Unlock()
 	}
 }
 
@@ -117,61 +468,355 @@ func EnableModule(module rlogModule) {
 //configuration. More precisely: the modules require a data and flush channel. The
 //channel configuration is set by the user when setting the core configuration. However,
 //the core configuration is set when rlog is started which is after enabling the modules.
-func launchAllModules() {
-	for e := activeModules.Front(); e != nil; e = e.Next() {
+func (r *Instance) launchAllModules() {
+	prefix := r.syncPrefix()
+	for e := r.activeModules.Front(); e != nil; e = e.Next() {
 		//Cycle over all registered modules and active them
-		c, ok := e.Value.(rlogModule)
-		if ok {
-			go c.LaunchModule(getMsgChannel(), getFlushChannel())
+		if c, ok := e.Value.(rlogModule); ok {
+			r.launchModule(c, prefix)
 		} else {
-			log.Panic("[RightLog4Go FATAL] type assertion for module channel failed\n")
+			r.internalf("[RightLog4Go] type assertion for module channel failed, module %v not launched", e.Value)
+		}
+	}
+
+	if r.mirrorErrors {
+		//The mirror is not enabled by the application, keep it out of the statistics
+		r.launchModule(newStderrMirror(), prefix)
+		r.msgChannels.Back().Value.(*msgChannel).internal = true
+	}
+}
+
+//syncPrefix determines the log prefix passed to synchronous modules
+//Returns: log prefix, empty if rlog does not run in synchronous mode
+func (r *Instance) syncPrefix() string {
+	if r.config.Synchronous {
+		//Synchronous modules receive the prefix with each message instead of computing it on launch
+		return common.SyslogHeader()
+	}
+	return ""
+}
+
+//launchModule registers the channels of a module and launches it
+//Arguments: [c] module to launch. [prefix] log prefix passed to synchronous modules
+func (r *Instance) launchModule(c rlogModule, prefix string) {
+	if sm, isSync := c.(syncModule); isSync && r.config.Synchronous {
+		//Messages are written by the logging goroutines, no need to launch the module
+		r.registerSyncModule(sm, prefix)
+	} else {
+		//Register the flush channel first: once the message channel is registered, a flush has to reach
+		//the module
+		fc := r.getFlushChannel(c)
+		go c.LaunchModule(r.getMsgChannel(c), fc)
+	}
+}
+
+//validateModules checks the health of all enabled modules implementing the validatingModule interface
+//Returns: nil if all modules are healthy, otherwise an error naming the failing modules and their errors
+func (r *Instance) validateModules() error {
+	var failed []string
+	for e := r.activeModules.Front(); e != nil; e = e.Next() {
+		vm, ok := e.Value.(validatingModule)
+		if !ok {
+			continue
+		}
+		if err := vm.Validate(); err != nil {
+			failed = append(failed, moduleName(e.Value.(rlogModule))+" ("+err.Error()+")")
 		}
 	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("validation failed for module(s): %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+//logStartupBanner logs an info message anchoring the log output: it carries hostname, pid, severity,
+//enabled modules and the application version as structured fields. It is subject to the severity
+//thresholds like any other message.
+func (r *Instance) logStartupBanner() {
+	hostname, _ := os.Hostname()
+	conf := r.EffectiveConfig()
+
+	fields := map[string]interface{}{
+		"hostname": hostname,
+		"pid":      os.Getpid(),
+		"severity": conf.Severity.String(),
+		"modules":  strings.Join(r.ActiveModules(), ","),
+	}
+	if conf.Version != "" {
+		fields["version"] = conf.Version
+	}
+
+	raw := logPieces{
+		level:    "INFO",
+		msg:      "logger started",
+		fields:   fields,
+		severity: SeverityInfo,
+	}
+	r.dispatch(&raw)
 }
 
 //===== Configuration API =====
-// converts the given string value to log level (severity).
+// converts the given string value to log level (severity). "warn" and "err" are
+// accepted as aliases of "warning" and "error". The severity remains unchanged
+// if the value is unknown.
 //
 // value: to convert
-func (c *RlogConfig) SeverityFromString(value string) {
+//
+// return: error if the value is not a known severity
+func (c *RlogConfig) SeverityFromString(value string) error {
+	severity, err := parseSeverity(value)
+	if err != nil {
+		return err
+	}
+	c.Severity = severity
+	return nil
+}
+
+//parseSeverity converts the given string value to a severity, see SeverityFromString
+//Returns: severity, error if the value is not a known severity
+func parseSeverity(value string) (common.RlogSeverity, error) {
 	switch strings.ToLower(value) {
 	case "fatal":
-		c.Severity = SeverityFatal
-	case "error":
-		c.Severity = SeverityError
-	case "warning":
-		c.Severity = SeverityWarning
+		return SeverityFatal, nil
+	case "error", "err":
+		return SeverityError, nil
+	case "warning", "warn":
+		return SeverityWarning, nil
 	case "info":
-		c.Severity = SeverityInfo
+		return SeverityInfo, nil
 	case "debug":
-		c.Severity = SeverityDebug
-	default:
-		panic(fmt.Sprintf("Unknown severity: %s", value))
+		return SeverityDebug, nil
+	case "trace":
+		return SeverityTrace, nil
+	}
+	return 0, fmt.Errorf("Unknown severity: %s", value)
+}
+
+// converts the given string value to log level (severity) like SeverityFromString
+// but panics if the value is unknown.
+//
+// value: to convert
+func (c *RlogConfig) MustSeverityFromString(value string) {
+	err := c.SeverityFromString(value)
+	if err != nil {
+		panic(err)
+	}
+}
+
+//NewRoute creates a route sending messages from minSeverity up to maxSeverity to the given modules, e.g.
+//NewRoute(SeverityWarning, SeverityFatal, fileModule, syslogModule). The modules have to be enabled as
+//usual using EnableModule.
+//Arguments: [minSeverity] least severe level routed. [maxSeverity] most severe level routed. [modules]
+//modules receiving the routed messages
+//Returns: route to add to RlogConfig.Routes
+func NewRoute(minSeverity, maxSeverity common.RlogSeverity, modules ...rlogModule) Route {
+	return Route{MinSeverity: minSeverity, MaxSeverity: maxSeverity, modules: modules}
+}
+
+//includes determines whether a route covers the given severity
+func (rt *Route) includes(severity common.RlogSeverity) bool {
+	//The most severe level has the lowest value
+	return severity <= rt.MinSeverity && severity >= rt.MaxSeverity
+}
+
+//routesOf collects the routes listing the given module
+//Arguments: [routes] configured routes. [module] module to look up (may be nil)
+//Returns: routes listing the module, nil if it is not routed
+func routesOf(routes []Route, module rlogModule) []Route {
+	var res []Route
+	for _, rt := range routes {
+		for _, m := range rt.modules {
+			if sameModule(m, module) {
+				res = append(res, rt)
+				break
+			}
+		}
+	}
+	return res
+}
+
+//sameModule determines whether two module references refer to the same module. Modules of types which
+//are not comparable (e.g. structs holding a slice) are never the same.
+func sameModule(a, b rlogModule) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	ta := reflect.TypeOf(a)
+	return ta == reflect.TypeOf(b) && ta.Comparable() && a == b
+}
+
+//SetSeverity changes the global severity threshold of the running logger, e.g. to temporarily increase
+//verbosity while diagnosing an incident. Modules with their own severity threshold are not affected.
+//SetSeverity is thread safe and can be called at any time after Start.
+//Arguments: new severity threshold
+//Returns: previous severity threshold to allow restoring it
+func SetSeverity(severity common.RlogSeverity) common.RlogSeverity {
+	return std.SetSeverity(severity)
+}
+
+//SetSeverity changes the global severity threshold of the running logger, e.g. to temporarily increase
+//verbosity while diagnosing an incident. Modules with their own severity threshold are not affected.
+//SetSeverity is thread safe and can be called at any time after Start.
+//Arguments: new severity threshold
+//Returns: previous severity threshold to allow restoring it
+func (r *Instance) SetSeverity(severity common.RlogSeverity) common.RlogSeverity {
+	return common.RlogSeverity(atomic.SwapUint32(&r.activeSeverity, uint32(severity)))
+}
+
+//GetSeverity returns the global severity threshold currently in effect
+func GetSeverity() common.RlogSeverity {
+	return std.GetSeverity()
+}
+
+//GetSeverity returns the global severity threshold currently in effect
+func (r *Instance) GetSeverity() common.RlogSeverity {
+	return common.RlogSeverity(atomic.LoadUint32(&r.activeSeverity))
+}
+
+//EffectiveConfig returns a copy of the configuration in effect, e.g. to find out why messages are
+//filtered. Severity is the global threshold as changed by SetSeverity since Start. It is safe to call
+//concurrently to logging.
+//Returns: configuration passed to Start, the zero configuration if the logger is not running
+func EffectiveConfig() RlogConfig {
+	return std.EffectiveConfig()
+}
+
+//EffectiveConfig returns a copy of the configuration in effect, e.g. to find out why messages are
+//filtered. Severity is the global threshold as changed by SetSeverity since Start. It is safe to call
+//concurrently to logging.
+//Returns: configuration passed to Start, the zero configuration if the logger is not running
+func (r *Instance) EffectiveConfig() RlogConfig {
+	if !r.IsInitialized() {
+		return RlogConfig{}
 	}
+	conf := r.config
+	conf.Severity = r.GetSeverity()
+	//The caller must not modify the routes in effect
+	conf.Routes = append([]Route(nil), conf.Routes...)
+	return conf
+}
+
+//IsEnabled determines whether a message of the given severity would be logged, e.g. to guard building
+//expensive debug output. Besides the global severity, module thresholds, routes, hooks and Suppress are
+//taken into account. Rate limiting and deduplication are not.
+//Arguments: message severity
+//Returns: false if the message would be dropped or the logger is not running
+func IsEnabled(severity common.RlogSeverity) bool {
+	return std.IsEnabled(severity)
+}
+
+//IsEnabled determines whether a message of the given severity would be logged, e.g. to guard building
+//expensive debug output. Besides the global severity, module thresholds, routes, hooks and Suppress are
+//taken into account. Rate limiting and deduplication are not.
+//Arguments: message severity
+//Returns: false if the message would be dropped or the logger is not running
+func (l logger) IsEnabled(severity common.RlogSeverity) bool {
+	return l.inst.IsEnabled(severity)
+}
+
+//IsEnabled determines whether a message of the given severity would be logged, e.g. to guard building
+//expensive debug output. Besides the global severity, module thresholds, routes, hooks and Suppress are
+//taken into account. Rate limiting and deduplication are not.
+//Arguments: message severity
+//Returns: false if the message would be dropped or the logger is not running
+func (r *Instance) IsEnabled(severity common.RlogSeverity) bool {
+	return r.IsInitialized() && !r.suppresses(severity) && !r.isFiltered(severity, nil)
+}
+
+//IsEnabledTag determines whether a message of the given severity carrying the given tag would be
+//logged, see IsEnabled. The tag has to pass RlogConfig.EnableTagsExcept and DisableTagsExcept as well.
+//Arguments: [severity] message severity. [tag] message tag
+//Returns: false if the message would be dropped or the logger is not running
+func IsEnabledTag(severity common.RlogSeverity, tag string) bool {
+	return std.IsEnabledTag(severity, tag)
+}
+
+//IsEnabledTag determines whether a message of the given severity carrying the given tag would be
+//logged, see IsEnabled. The tag has to pass RlogConfig.EnableTagsExcept and DisableTagsExcept as well.
+//Arguments: [severity] message severity. [tag] message tag
+//Returns: false if the message would be dropped or the logger is not running
+func (l logger) IsEnabledTag(severity common.RlogSeverity, tag string) bool {
+	return l.inst.IsEnabledTag(severity, tag)
+}
+
+//IsEnabledTag determines whether a message of the given severity carrying the given tag would be
+//logged, see IsEnabled. The tag has to pass RlogConfig.EnableTagsExcept and DisableTagsExcept as well.
+//Arguments: [severity] message severity. [tag] message tag
+//Returns: false if the message would be dropped or the logger is not running
+func (r *Instance) IsEnabledTag(severity common.RlogSeverity, tag string) bool {
+	return r.IsInitialized() && !r.suppresses(severity) && !r.isFiltered(severity, []string{tag})
 }
 
 //EnableTagsExcept enables output for all messages except the ones carrying one of the tags
-//specified. Using "EnableTagsExcept" overwrites the settings from "DisableTagsExcept".
+//specified. Using "EnableTagsExcept" overwrites the settings from "DisableTagsExcept". Tags are
+//matched exactly unless they contain "*", which matches any sequence of characters (e.g. "db.*"
+//matches "db.query" and "db.conn").
 func (c *RlogConfig) EnableTagsExcept(tags []string) {
 	c.tagsDisabledExcept = nil
-	c.tagsEnabledExcept = createAndFillStringHt(tags)
+	c.tagsEnabledExcept = newTagSet(tags)
 }
 
 //DisableTagsExcept enables output for messages carrying one of the tags specified. All other log
 //messages are filtered. Using "DisableTagsExcept" overwrites the settings from "EnableTagsExcept".
+//Tags may contain "*" wildcards, see EnableTagsExcept.
 func (c *RlogConfig) DisableTagsExcept(tags []string) {
-	c.tagsDisabledExcept = createAndFillStringHt(tags)
+	c.tagsDisabledExcept = newTagSet(tags)
 	c.tagsEnabledExcept = nil
 }
 
-//createAndFillStringHt creates a hash map and fills it with the elements from the given slice
-func createAndFillStringHt(tags []string) map[string]bool {
-	ht := make(map[string]bool)
+//tagSet holds the tags configured by EnableTagsExcept or DisableTagsExcept
+type tagSet struct {
+	exact    map[string]bool //tags without wildcard
+	patterns []string        //tags containing "*" wildcards
+}
+
+//newTagSet creates a tag set and fills it with the elements from the given slice
+func newTagSet(tags []string) *tagSet {
+	s := &tagSet{exact: make(map[string]bool)}
 	for _, e := range tags {
-		ht[e] = true
+		if strings.Contains(e, "*") {
+			s.patterns = append(s.patterns, e)
+		} else {
+			s.exact[e] = true
+		}
+	}
+
+	return s
+}
+
+//contains determines whether the tag matches one of the tags of the set. Exact tags are looked up
+//first, the patterns are only iterated if there is no exact match.
+func (s *tagSet) contains(tag string) bool {
+	if s.exact[tag] {
+		return true
+	}
+	for _, p := range s.patterns {
+		if matchTagPattern(p, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+//matchTagPattern matches a tag against a pattern in which "*" matches any sequence of characters
+//including dots, i.e. "db.*" matches "db.query" as well as "db.query.slow"
+func matchTagPattern(pattern, tag string) bool {
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(tag, parts[0]) {
+		return false
 	}
+	tag = tag[len(parts[0]):]
 
-	return ht
+	last := len(parts) - 1
+	for _, part := range parts[1:last] {
+		i := strings.Index(tag, part)
+		if i < 0 {
+			return false
+		}
+		tag = tag[i+len(part):]
+	}
+	return strings.HasSuffix(tag, parts[last])
 }
 
 //===== Logging API no tags =====
@@ -179,61 +824,109 @@ func createAndFillStringHt(tags []string) map[string]bool {
 //Fatal logs a message of severity "fatal".
 //Arguments: printf formatted message
 func Fatal(format string, a ...interface{}) {
-	genericLogHandler("FATAL", "", format, a, SeverityFatal, true)
+	std.genericLogHandler("FATAL", nil, nil, format, a, SeverityFatal, true, 0, nil)
 }
 
 //Fatal logs a message of severity "fatal".
 //Arguments: printf formatted message
 func (l logger) Fatal(format string, a ...interface{}) {
-	genericLogHandler("FATAL", "", format, a, SeverityFatal, true)
+	l.inst.genericLogHandler("FATAL", nil, l.fields, format, a, SeverityFatal, l.pos(true), 0, nil)
+}
+
+//Fatal logs a message of severity "fatal".
+//Arguments: printf formatted message
+func (r *Instance) Fatal(format string, a ...interface{}) {
+	r.genericLogHandler("FATAL", nil, nil, format, a, SeverityFatal, true, 0, nil)
 }
 
 //Error logs a message of severity "error".
 //Arguments: printf formatted message
 func Error(format string, a ...interface{}) {
-	genericLogHandler("ERROR", "", format, a, SeverityError, true)
+	std.genericLogHandler("ERROR", nil, nil, format, a, SeverityError, true, 0, nil)
 }
 
 //Error logs a message of severity "error".
 //Arguments: printf formatted message
 func (l logger) Error(format string, a ...interface{}) {
-	genericLogHandler("ERROR", "", format, a, SeverityError, true)
+	l.inst.genericLogHandler("ERROR", nil, l.fields, format, a, SeverityError, l.pos(true), 0, nil)
+}
+
+//Error logs a message of severity "error".
+//Arguments: printf formatted message
+func (r *Instance) Error(format string, a ...interface{}) {
+	r.genericLogHandler("ERROR", nil, nil, format, a, SeverityError, true, 0, nil)
 }
 
 //Warning logs a message of severity "warning".
 //Arguments: printf formatted message
 func Warning(format string, a ...interface{}) {
-	genericLogHandler("WARNING", "", format, a, SeverityWarning, false)
+	std.genericLogHandler("WARNING", nil, nil, format, a, SeverityWarning, false, 0, nil)
 }
 
 //Warning logs a message of severity "warning".
 //Arguments: printf formatted message
 func (l logger) Warning(format string, a ...interface{}) {
-	genericLogHandler("WARNING", "", format, a, SeverityWarning, false)
+	l.inst.genericLogHandler("WARNING", nil, l.fields, format, a, SeverityWarning, l.pos(false), 0, nil)
+}
+
+//Warning logs a message of severity "warning".
+//Arguments: printf formatted message
+func (r *Instance) Warning(format string, a ...interface{}) {
+	r.genericLogHandler("WARNING", nil, nil, format, a, SeverityWarning, false, 0, nil)
 }
 
 //Info logs a message of severity "info".
 //Arguments: printf formatted message
 func Info(format string, a ...interface{}) {
-	genericLogHandler("INFO", "", format, a, SeverityInfo, false)
+	std.genericLogHandler("INFO", nil, nil, format, a, SeverityInfo, false, 0, nil)
 }
 
 //Info logs a message of severity "info".
 //Arguments: printf formatted message
 func (l logger) Info(format string, a ...interface{}) {
-	genericLogHandler("INFO", "", format, a, SeverityInfo, false)
+	l.inst.genericLogHandler("INFO", nil, l.fields, format, a, SeverityInfo, l.pos(false), 0, nil)
+}
+
+//Info logs a message of severity "info".
+//Arguments: printf formatted message
+func (r *Instance) Info(format string, a ...interface{}) {
+	r.genericLogHandler("INFO", nil, nil, format, a, SeverityInfo, false, 0, nil)
 }
 
 //Debug logs a message of severity "debug".
 //Arguments: printf formatted message
 func Debug(format string, a ...interface{}) {
-	genericLogHandler("DEBUG", "", format, a, SeverityDebug, false)
+	std.genericLogHandler("DEBUG", nil, nil, format, a, SeverityDebug, false, 0, nil)
 }
 
 //Debug logs a message of severity "debug".
 //Arguments: printf formatted message
 func (l logger) Debug(format string, a ...interface{}) {
-	genericLogHandler("DEBUG", "", format, a, SeverityDebug, false)
+	l.inst.genericLogHandler("DEBUG", nil, l.fields, format, a, SeverityDebug, l.pos(false), 0, nil)
+}
+
+//Debug logs a message of severity "debug".
+//Arguments: printf formatted message
+func (r *Instance) Debug(format string, a ...interface{}) {
+	r.genericLogHandler("DEBUG", nil, nil, format, a, SeverityDebug, false, 0, nil)
+}
+
+//Trace logs a message of severity "trace".
+//Arguments: printf formatted message
+func Trace(format string, a ...interface{}) {
+	std.genericLogHandler("TRACE", nil, nil, format, a, SeverityTrace, false, 0, nil)
+}
+
+//Trace logs a message of severity "trace".
+//Arguments: printf formatted message
+func (l logger) Trace(format string, a ...interface{}) {
+	l.inst.genericLogHandler("TRACE", nil, l.fields, format, a, SeverityTrace, l.pos(false), 0, nil)
+}
+
+//Trace logs a message of severity "trace".
+//Arguments: printf formatted message
+func (r *Instance) Trace(format string, a ...interface{}) {
+	r.genericLogHandler("TRACE", nil, nil, format, a, SeverityTrace, false, 0, nil)
 }
 
 //===== Logging API with tags =====
@@ -241,107 +934,1112 @@ func (l logger) Debug(format string, a ...interface{}) {
 //FatalT logs a message of severity "fatal".
 //Arguments: tag and printf formatted message
 func FatalT(tag string, format string, a ...interface{}) {
-	genericLogHandler("FATAL", tag, format, a, SeverityFatal, true)
+	std.genericLogHandler("FATAL", []string{tag}, nil, format, a, SeverityFatal, true, 0, nil)
 }
 
 //FatalT logs a message of severity "fatal".
 //Arguments: tag and printf formatted message
 func (l logger) FatalT(tag string, format string, a ...interface{}) {
-	genericLogHandler("FATAL", tag, format, a, SeverityFatal, true)
+	l.inst.genericLogHandler("FATAL", []string{tag}, l.fields, format, a, SeverityFatal, l.pos(true), 0, nil)
+}
+
+//FatalT logs a message of severity "fatal".
+//Arguments: tag and printf formatted message
+func (r *Instance) FatalT(tag string, format string, a ...interface{}) {
+	r.genericLogHandler("FATAL", []string{tag}, nil, format, a, SeverityFatal, true, 0, nil)
 }
 
 //ErrorT logs a message of severity "error".
 //Arguments: tag and printf formatted message
 func ErrorT(tag string, format string, a ...interface{}) {
-	genericLogHandler("ERROR", tag, format, a, SeverityError, true)
+	std.genericLogHandler("ERROR", []string{tag}, nil, format, a, SeverityError, true, 0, nil)
 }
 
 //ErrorT logs a message of severity "error".
 //Arguments: tag and printf formatted message
 func (l logger) ErrorT(tag string, format string, a ...interface{}) {
-	genericLogHandler("ERROR", tag, format, a, SeverityError, true)
+	l.inst.genericLogHandler("ERROR", []string{tag}, l.fields, format, a, SeverityError, l.pos(true), 0, nil)
+}
+
+//ErrorT logs a message of severity "error".
+//Arguments: tag and printf formatted message
+func (r *Instance) ErrorT(tag string, format string, a ...interface{}) {
+	r.genericLogHandler("ERROR", []string{tag}, nil, format, a, SeverityError, true, 0, nil)
 }
 
 //WarningT logs a message of severity "warning".
 //Arguments: tag and printf formatted message
 func WarningT(tag string, format string, a ...interface{}) {
-	genericLogHandler("WARNING", tag, format, a, SeverityWarning, false)
+	std.genericLogHandler("WARNING", []string{tag}, nil, format, a, SeverityWarning, false, 0, nil)
 }
 
 //WarningT logs a message of severity "warning".
 //Arguments: tag and printf formatted message
 func (l logger) WarningT(tag string, format string, a ...interface{}) {
-	genericLogHandler("WARNING", tag, format, a, SeverityWarning, false)
+	l.inst.genericLogHandler("WARNING", []string{tag}, l.fields, format, a, SeverityWarning, l.pos(false), 0, nil)
+}
+
+//WarningT logs a message of severity "warning".
+//Arguments: tag and printf formatted message
+func (r *Instance) WarningT(tag string, format string, a ...interface{}) {
+	r.genericLogHandler("WARNING", []string{tag}, nil, format, a, SeverityWarning, false, 0, nil)
 }
 
 //InfoT logs a message of severity "info".
 //Arguments: tag and printf formatted message
 func InfoT(tag string, format string, a ...interface{}) {
-	genericLogHandler("INFO", tag, format, a, SeverityInfo, false)
+	std.genericLogHandler("INFO", []string{tag}, nil, format, a, SeverityInfo, false, 0, nil)
 }
 
 //InfoT logs a message of severity "info".
 //Arguments: tag and printf formatted message
 func (l logger) InfoT(tag string, format string, a ...interface{}) {
-	genericLogHandler("INFO", tag, format, a, SeverityInfo, false)
+	l.inst.genericLogHandler("INFO", []string{tag}, l.fields, format, a, SeverityInfo, l.pos(false), 0, nil)
+}
+
+//InfoT logs a message of severity "info".
+//Arguments: tag and printf formatted message
+func (r *Instance) InfoT(tag string, format string, a ...interface{}) {
+	r.genericLogHandler("INFO", []string{tag}, nil, format, a, SeverityInfo, false, 0, nil)
 }
 
 //DebugT logs a message of severity "debug".
 //Arguments: tag and printf formatted message
 func DebugT(tag string, format string, a ...interface{}) {
-	genericLogHandler("DEBUG", tag, format, a, SeverityDebug, false)
+	std.genericLogHandler("DEBUG", []string{tag}, nil, format, a, SeverityDebug, false, 0, nil)
 }
 
 //DebugT logs a message of severity "debug".
 //Arguments: tag and printf formatted message
 func (l logger) DebugT(tag string, format string, a ...interface{}) {
-	genericLogHandler("DEBUG", tag, format, a, SeverityDebug, false)
+	l.inst.genericLogHandler("DEBUG", []string{tag}, l.fields, format, a, SeverityDebug, l.pos(false), 0, nil)
 }
 
-//===== Logging API: tools =====
+//DebugT logs a message of severity "debug".
+//Arguments: tag and printf formatted message
+func (r *Instance) DebugT(tag string, format string, a ...interface{}) {
+	r.genericLogHandler("DEBUG", []string{tag}, nil, format, a, SeverityDebug, false, 0, nil)
+}
 
-//GenerateID creates a unique ID, i.e. two calls to GenerateID are guaranteed to return different IDs
-//Returns: unique ID
-func GenerateID() string {
-	id := atomic.AddUint64(&uniqueMsgID, 1)
-	return fmt.Sprintf("%x", id)
+//TraceT logs a message of severity "trace".
+//Arguments: tag and printf formatted message
+func TraceT(tag string, format string, a ...interface{}) {
+	std.genericLogHandler("TRACE", []string{tag}, nil, format, a, SeverityTrace, false, 0, nil)
+}
+
+//TraceT logs a message of severity "trace".
+//Arguments: tag and printf formatted message
+func (l logger) TraceT(tag string, format string, a ...interface{}) {
+	l.inst.genericLogHandler("TRACE", []string{tag}, l.fields, format, a, SeverityTrace, l.pos(false), 0, nil)
+}
 
+//TraceT logs a message of severity "trace".
+//Arguments: tag and printf formatted message
+func (r *Instance) TraceT(tag string, format string, a ...interface{}) {
+	r.genericLogHandler("TRACE", []string{tag}, nil, format, a, SeverityTrace, false, 0, nil)
 }
 
-//GenerateID creates a unique ID, i.e. two calls to GenerateID are guaranteed to return different IDs
-//Returns: unique ID
-func (l logger) GenerateID() string {
-	return GenerateID()
+//===== Logging API with multiple tags =====
+
+//FatalTags logs a message of severity "fatal" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func FatalTags(tags []string, format string, a ...interface{}) {
+	std.genericLogHandler("FATAL", tags, nil, format, a, SeverityFatal, true, 0, nil)
 }
 
-//Flush should be called before the program using RightLog4Go exits (e.g. by using defer in main).
-//Flush notifies the registered logger modules to write back their buffered data.
-func Flush() {
-	for e := flushChannels.Front(); e != nil; e = e.Next() {
-		//Cycle over all registered channels, perform a type conversion because of the linked list
-		// and call the helper function implementing the flush protocol
-		c, ok := e.Value.(chan chan (bool))
-		if ok {
-			flushHelper(c)
-		} else {
-			log.Printf("[RightLog4Go FATAL] type assertion for flush channel failed\n")
-		}
-	}
+//FatalTags logs a message of severity "fatal" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func (l logger) FatalTags(tags []string, format string, a ...interface{}) {
+	l.inst.genericLogHandler("FATAL", tags, l.fields, format, a, SeverityFatal, l.pos(true), 0, nil)
 }
 
-// Performs a reset of rlog state, intended for testing purposes only (with or
-// without flushing before-hand). Applications should call Flush() but should
-// usually not reset state. A reset is needed for unit testing due to rlog being
-// a singleton. Tests that leverage rlog therefore cannot be run in parallel and
-// also call reset state.
-func ResetState() {
-	if initialized {
-		config = *new(RlogConfig)
-		msgChannels = list.New()
-		flushChannels = list.New()
-		activeModules = list.New()
-		initialized = false
-	}
+//FatalTags logs a message of severity "fatal" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func (r *Instance) FatalTags(tags []string, format string, a ...interface{}) {
+	r.genericLogHandler("FATAL", tags, nil, format, a, SeverityFatal, true, 0, nil)
+}
+
+//ErrorTags logs a message of severity "error" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func ErrorTags(tags []string, format string, a ...interface{}) {
+	std.genericLogHandler("ERROR", tags, nil, format, a, SeverityError, true, 0, nil)
+}
+
+//ErrorTags logs a message of severity "error" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func (l logger) ErrorTags(tags []string, format string, a ...interface{}) {
+	l.inst.genericLogHandler("ERROR", tags, l.fields, format, a, SeverityError, l.pos(true), 0, nil)
+}
+
+//ErrorTags logs a message of severity "error" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func (r *Instance) ErrorTags(tags []string, format string, a ...interface{}) {
+	r.genericLogHandler("ERROR", tags, nil, format, a, SeverityError, true, 0, nil)
+}
+
+//WarningTags logs a message of severity "warning" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func WarningTags(tags []string, format string, a ...interface{}) {
+	std.genericLogHandler("WARNING", tags, nil, format, a, SeverityWarning, false, 0, nil)
+}
+
+//WarningTags logs a message of severity "warning" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func (l logger) WarningTags(tags []string, format string, a ...interface{}) {
+	l.inst.genericLogHandler("WARNING", tags, l.fields, format, a, SeverityWarning, l.pos(false), 0, nil)
+}
+
+//WarningTags logs a message of severity "warning" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func (r *Instance) WarningTags(tags []string, format string, a ...interface{}) {
+	r.genericLogHandler("WARNING", tags, nil, format, a, SeverityWarning, false, 0, nil)
+}
+
+//InfoTags logs a message of severity "info" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func InfoTags(tags []string, format string, a ...interface{}) {
+	std.genericLogHandler("INFO", tags, nil, format, a, SeverityInfo, false, 0, nil)
+}
+
+//InfoTags logs a message of severity "info" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func (l logger) InfoTags(tags []string, format string, a ...interface{}) {
+	l.inst.genericLogHandler("INFO", tags, l.fields, format, a, SeverityInfo, l.pos(false), 0, nil)
+}
+
+//InfoTags logs a message of severity "info" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func (r *Instance) InfoTags(tags []string, format string, a ...interface{}) {
+	r.genericLogHandler("INFO", tags, nil, format, a, SeverityInfo, false, 0, nil)
+}
+
+//DebugTags logs a message of severity "debug" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func DebugTags(tags []string, format string, a ...interface{}) {
+	std.genericLogHandler("DEBUG", tags, nil, format, a, SeverityDebug, false, 0, nil)
+}
+
+//DebugTags logs a message of severity "debug" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func (l logger) DebugTags(tags []string, format string, a ...interface{}) {
+	l.inst.genericLogHandler("DEBUG", tags, l.fields, format, a, SeverityDebug, l.pos(false), 0, nil)
+}
+
+//DebugTags logs a message of severity "debug" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func (r *Instance) DebugTags(tags []string, format string, a ...interface{}) {
+	r.genericLogHandler("DEBUG", tags, nil, format, a, SeverityDebug, false, 0, nil)
+}
+
+//TraceTags logs a message of severity "trace" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func TraceTags(tags []string, format string, a ...interface{}) {
+	std.genericLogHandler("TRACE", tags, nil, format, a, SeverityTrace, false, 0, nil)
+}
+
+//TraceTags logs a message of severity "trace" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func (l logger) TraceTags(tags []string, format string, a ...interface{}) {
+	l.inst.genericLogHandler("TRACE", tags, l.fields, format, a, SeverityTrace, l.pos(false), 0, nil)
+}
+
+//TraceTags logs a message of severity "trace" carrying several tags. See RlogConfig.TagMatch for filtering.
+//Arguments: tags and printf formatted message
+func (r *Instance) TraceTags(tags []string, format string, a ...interface{}) {
+	r.genericLogHandler("TRACE", tags, nil, format, a, SeverityTrace, false, 0, nil)
+}
+
+//===== Logging API with structured fields =====
+
+//FatalF logs a message of severity "fatal" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func FatalF(fields map[string]interface{}, format string, a ...interface{}) {
+	std.genericLogHandler("FATAL", nil, fields, format, a, SeverityFatal, true, 0, nil)
+}
+
+//FatalF logs a message of severity "fatal" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func (l logger) FatalF(fields map[string]interface{}, format string, a ...interface{}) {
+	l.inst.genericLogHandler("FATAL", nil, mergeFields(l.fields, fields), format, a, SeverityFatal, l.pos(true), 0, nil)
+}
+
+//FatalF logs a message of severity "fatal" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func (r *Instance) FatalF(fields map[string]interface{}, format string, a ...interface{}) {
+	r.genericLogHandler("FATAL", nil, fields, format, a, SeverityFatal, true, 0, nil)
+}
+
+//ErrorF logs a message of severity "error" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func ErrorF(fields map[string]interface{}, format string, a ...interface{}) {
+	std.genericLogHandler("ERROR", nil, fields, format, a, SeverityError, true, 0, nil)
+}
+
+//ErrorF logs a message of severity "error" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func (l logger) ErrorF(fields map[string]interface{}, format string, a ...interface{}) {
+	l.inst.genericLogHandler("ERROR", nil, mergeFields(l.fields, fields), format, a, SeverityError, l.pos(true), 0, nil)
+}
+
+//ErrorF logs a message of severity "error" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func (r *Instance) ErrorF(fields map[string]interface{}, format string, a ...interface{}) {
+	r.genericLogHandler("ERROR", nil, fields, format, a, SeverityError, true, 0, nil)
+}
+
+//WarningF logs a message of severity "warning" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func WarningF(fields map[string]interface{}, format string, a ...interface{}) {
+	std.genericLogHandler("WARNING", nil, fields, format, a, SeverityWarning, false, 0, nil)
+}
+
+//WarningF logs a message of severity "warning" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func (l logger) WarningF(fields map[string]interface{}, format string, a ...interface{}) {
+	l.inst.genericLogHandler("WARNING", nil, mergeFields(l.fields, fields), format, a, SeverityWarning, l.pos(false), 0, nil)
+}
+
+//WarningF logs a message of severity "warning" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func (r *Instance) WarningF(fields map[string]interface{}, format string, a ...interface{}) {
+	r.genericLogHandler("WARNING", nil, fields, format, a, SeverityWarning, false, 0, nil)
+}
+
+//InfoF logs a message of severity "info" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func InfoF(fields map[string]interface{}, format string, a ...interface{}) {
+	std.genericLogHandler("INFO", nil, fields, format, a, SeverityInfo, false, 0, nil)
+}
+
+//InfoF logs a message of severity "info" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func (l logger) InfoF(fields map[string]interface{}, format string, a ...interface{}) {
+	l.inst.genericLogHandler("INFO", nil, mergeFields(l.fields, fields), format, a, SeverityInfo, l.pos(false), 0, nil)
+}
+
+//InfoF logs a message of severity "info" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func (r *Instance) InfoF(fields map[string]interface{}, format string, a ...interface{}) {
+	r.genericLogHandler("INFO", nil, fields, format, a, SeverityInfo, false, 0, nil)
+}
+
+//DebugF logs a message of severity "debug" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func DebugF(fields map[string]interface{}, format string, a ...interface{}) {
+	std.genericLogHandler("DEBUG", nil, fields, format, a, SeverityDebug, false, 0, nil)
+}
+
+//DebugF logs a message of severity "debug" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func (l logger) DebugF(fields map[string]interface{}, format string, a ...interface{}) {
+	l.inst.genericLogHandler("DEBUG", nil, mergeFields(l.fields, fields), format, a, SeverityDebug, l.pos(false), 0, nil)
+}
+
+//DebugF logs a message of severity "debug" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func (r *Instance) DebugF(fields map[string]interface{}, format string, a ...interface{}) {
+	r.genericLogHandler("DEBUG", nil, fields, format, a, SeverityDebug, false, 0, nil)
+}
+
+//TraceF logs a message of severity "trace" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func TraceF(fields map[string]interface{}, format string, a ...interface{}) {
+	std.genericLogHandler("TRACE", nil, fields, format, a, SeverityTrace, false, 0, nil)
+}
+
+//TraceF logs a message of severity "trace" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func (l logger) TraceF(fields map[string]interface{}, format string, a ...interface{}) {
+	l.inst.genericLogHandler("TRACE", nil, mergeFields(l.fields, fields), format, a, SeverityTrace, l.pos(false), 0, nil)
+}
+
+//TraceF logs a message of severity "trace" carrying the given key/value pairs.
+//Arguments: fields and printf formatted message
+func (r *Instance) TraceF(fields map[string]interface{}, format string, a ...interface{}) {
+	r.genericLogHandler("TRACE", nil, fields, format, a, SeverityTrace, false, 0, nil)
+}
+
+//===== Logging API raw bytes =====
+
+//FatalBytes logs a message of severity "fatal" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func FatalBytes(b []byte) {
+	std.genericLogHandler("FATAL", nil, nil, string(b), nil, SeverityFatal, true, 0, nil)
+}
+
+//FatalBytes logs a message of severity "fatal" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func (l logger) FatalBytes(b []byte) {
+	l.inst.genericLogHandler("FATAL", nil, l.fields, string(b), nil, SeverityFatal, l.pos(true), 0, nil)
+}
+
+//FatalBytes logs a message of severity "fatal" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func (r *Instance) FatalBytes(b []byte) {
+	r.genericLogHandler("FATAL", nil, nil, string(b), nil, SeverityFatal, true, 0, nil)
+}
+
+//ErrorBytes logs a message of severity "error" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func ErrorBytes(b []byte) {
+	std.genericLogHandler("ERROR", nil, nil, string(b), nil, SeverityError, true, 0, nil)
+}
+
+//ErrorBytes logs a message of severity "error" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func (l logger) ErrorBytes(b []byte) {
+	l.inst.genericLogHandler("ERROR", nil, l.fields, string(b), nil, SeverityError, l.pos(true), 0, nil)
+}
+
+//ErrorBytes logs a message of severity "error" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func (r *Instance) ErrorBytes(b []byte) {
+	r.genericLogHandler("ERROR", nil, nil, string(b), nil, SeverityError, true, 0, nil)
+}
+
+//WarningBytes logs a message of severity "warning" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func WarningBytes(b []byte) {
+	std.genericLogHandler("WARNING", nil, nil, string(b), nil, SeverityWarning, false, 0, nil)
+}
+
+//WarningBytes logs a message of severity "warning" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func (l logger) WarningBytes(b []byte) {
+	l.inst.genericLogHandler("WARNING", nil, l.fields, string(b), nil, SeverityWarning, l.pos(false), 0, nil)
+}
+
+//WarningBytes logs a message of severity "warning" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func (r *Instance) WarningBytes(b []byte) {
+	r.genericLogHandler("WARNING", nil, nil, string(b), nil, SeverityWarning, false, 0, nil)
+}
+
+//InfoBytes logs a message of severity "info" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func InfoBytes(b []byte) {
+	std.genericLogHandler("INFO", nil, nil, string(b), nil, SeverityInfo, false, 0, nil)
+}
+
+//InfoBytes logs a message of severity "info" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func (l logger) InfoBytes(b []byte) {
+	l.inst.genericLogHandler("INFO", nil, l.fields, string(b), nil, SeverityInfo, l.pos(false), 0, nil)
+}
+
+//InfoBytes logs a message of severity "info" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func (r *Instance) InfoBytes(b []byte) {
+	r.genericLogHandler("INFO", nil, nil, string(b), nil, SeverityInfo, false, 0, nil)
+}
+
+//DebugBytes logs a message of severity "debug" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func DebugBytes(b []byte) {
+	std.genericLogHandler("DEBUG", nil, nil, string(b), nil, SeverityDebug, false, 0, nil)
+}
+
+//DebugBytes logs a message of severity "debug" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func (l logger) DebugBytes(b []byte) {
+	l.inst.genericLogHandler("DEBUG", nil, l.fields, string(b), nil, SeverityDebug, l.pos(false), 0, nil)
+}
+
+//DebugBytes logs a message of severity "debug" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func (r *Instance) DebugBytes(b []byte) {
+	r.genericLogHandler("DEBUG", nil, nil, string(b), nil, SeverityDebug, false, 0, nil)
+}
+
+//TraceBytes logs a message of severity "trace" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func TraceBytes(b []byte) {
+	std.genericLogHandler("TRACE", nil, nil, string(b), nil, SeverityTrace, false, 0, nil)
+}
+
+//TraceBytes logs a message of severity "trace" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func (l logger) TraceBytes(b []byte) {
+	l.inst.genericLogHandler("TRACE", nil, l.fields, string(b), nil, SeverityTrace, l.pos(false), 0, nil)
+}
+
+//TraceBytes logs a message of severity "trace" consisting of the given bytes. The bytes are not
+//interpreted as printf format, i.e. percent signs appear as they are.
+//Arguments: message
+func (r *Instance) TraceBytes(b []byte) {
+	r.genericLogHandler("TRACE", nil, nil, string(b), nil, SeverityTrace, false, 0, nil)
+}
+
+//===== Logging API with caller skip =====
+
+//FatalSkip logs a message of severity "fatal" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Fatal.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func FatalSkip(skip int, format string, a ...interface{}) {
+	std.genericLogHandler("FATAL", nil, nil, format, a, SeverityFatal, true, skip, nil)
+}
+
+//FatalSkip logs a message of severity "fatal" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Fatal.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func (l logger) FatalSkip(skip int, format string, a ...interface{}) {
+	l.inst.genericLogHandler("FATAL", nil, l.fields, format, a, SeverityFatal, l.pos(true), skip, nil)
+}
+
+//FatalSkip logs a message of severity "fatal" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Fatal.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func (r *Instance) FatalSkip(skip int, format string, a ...interface{}) {
+	r.genericLogHandler("FATAL", nil, nil, format, a, SeverityFatal, true, skip, nil)
+}
+
+//ErrorSkip logs a message of severity "error" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Error.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func ErrorSkip(skip int, format string, a ...interface{}) {
+	std.genericLogHandler("ERROR", nil, nil, format, a, SeverityError, true, skip, nil)
+}
+
+//ErrorSkip logs a message of severity "error" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Error.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func (l logger) ErrorSkip(skip int, format string, a ...interface{}) {
+	l.inst.genericLogHandler("ERROR", nil, l.fields, format, a, SeverityError, l.pos(true), skip, nil)
+}
+
+//ErrorSkip logs a message of severity "error" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Error.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func (r *Instance) ErrorSkip(skip int, format string, a ...interface{}) {
+	r.genericLogHandler("ERROR", nil, nil, format, a, SeverityError, true, skip, nil)
+}
+
+//WarningSkip logs a message of severity "warning" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Warning.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func WarningSkip(skip int, format string, a ...interface{}) {
+	std.genericLogHandler("WARNING", nil, nil, format, a, SeverityWarning, false, skip, nil)
+}
+
+//WarningSkip logs a message of severity "warning" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Warning.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func (l logger) WarningSkip(skip int, format string, a ...interface{}) {
+	l.inst.genericLogHandler("WARNING", nil, l.fields, format, a, SeverityWarning, l.pos(false), skip, nil)
+}
+
+//WarningSkip logs a message of severity "warning" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Warning.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func (r *Instance) WarningSkip(skip int, format string, a ...interface{}) {
+	r.genericLogHandler("WARNING", nil, nil, format, a, SeverityWarning, false, skip, nil)
+}
+
+//InfoSkip logs a message of severity "info" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Info.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func InfoSkip(skip int, format string, a ...interface{}) {
+	std.genericLogHandler("INFO", nil, nil, format, a, SeverityInfo, false, skip, nil)
+}
+
+//InfoSkip logs a message of severity "info" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Info.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func (l logger) InfoSkip(skip int, format string, a ...interface{}) {
+	l.inst.genericLogHandler("INFO", nil, l.fields, format, a, SeverityInfo, l.pos(false), skip, nil)
+}
+
+//InfoSkip logs a message of severity "info" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Info.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func (r *Instance) InfoSkip(skip int, format string, a ...interface{}) {
+	r.genericLogHandler("INFO", nil, nil, format, a, SeverityInfo, false, skip, nil)
+}
+
+//DebugSkip logs a message of severity "debug" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Debug.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func DebugSkip(skip int, format string, a ...interface{}) {
+	std.genericLogHandler("DEBUG", nil, nil, format, a, SeverityDebug, false, skip, nil)
+}
+
+//DebugSkip logs a message of severity "debug" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Debug.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func (l logger) DebugSkip(skip int, format string, a ...interface{}) {
+	l.inst.genericLogHandler("DEBUG", nil, l.fields, format, a, SeverityDebug, l.pos(false), skip, nil)
+}
+
+//DebugSkip logs a message of severity "debug" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Debug.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func (r *Instance) DebugSkip(skip int, format string, a ...interface{}) {
+	r.genericLogHandler("DEBUG", nil, nil, format, a, SeverityDebug, false, skip, nil)
+}
+
+//TraceSkip logs a message of severity "trace" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Trace.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func TraceSkip(skip int, format string, a ...interface{}) {
+	std.genericLogHandler("TRACE", nil, nil, format, a, SeverityTrace, false, skip, nil)
+}
+
+//TraceSkip logs a message of severity "trace" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Trace.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func (l logger) TraceSkip(skip int, format string, a ...interface{}) {
+	l.inst.genericLogHandler("TRACE", nil, l.fields, format, a, SeverityTrace, l.pos(false), skip, nil)
+}
+
+//TraceSkip logs a message of severity "trace" reporting the position of a caller further up the stack,
+//e.g. when called by a wrapper library. A skip of 0 is equivalent to Trace.
+//Arguments: number of frames to skip in addition to RlogConfig.CallerSkip and printf formatted message
+func (r *Instance) TraceSkip(skip int, format string, a ...interface{}) {
+	r.genericLogHandler("TRACE", nil, nil, format, a, SeverityTrace, false, skip, nil)
+}
+
+//===== Logging API with position override =====
+
+//The functions below include or omit the position for a single message of the default instance. Loggers,
+//including those of other instances, override it for all of their messages using WithPosInfo.
+
+//FatalNoPos logs a message of severity "fatal" omitting the file and line number of the call,
+//which Fatal and Error include by default.
+//Arguments: printf formatted message
+func FatalNoPos(format string, a ...interface{}) {
+	std.genericLogHandler("FATAL", nil, nil, format, a, SeverityFatal, false, 0, nil)
+}
+
+//ErrorNoPos logs a message of severity "error" omitting the file and line number of the call,
+//which Fatal and Error include by default.
+//Arguments: printf formatted message
+func ErrorNoPos(format string, a ...interface{}) {
+	std.genericLogHandler("ERROR", nil, nil, format, a, SeverityError, false, 0, nil)
+}
+
+//WarningPos logs a message of severity "warning" including the file and line number of the call,
+//which only Fatal and Error include by default.
+//Arguments: printf formatted message
+func WarningPos(format string, a ...interface{}) {
+	std.genericLogHandler("WARNING", nil, nil, format, a, SeverityWarning, true, 0, nil)
+}
+
+//InfoPos logs a message of severity "info" including the file and line number of the call,
+//which only Fatal and Error include by default.
+//Arguments: printf formatted message
+func InfoPos(format string, a ...interface{}) {
+	std.genericLogHandler("INFO", nil, nil, format, a, SeverityInfo, true, 0, nil)
+}
+
+//DebugPos logs a message of severity "debug" including the file and line number of the call,
+//which only Fatal and Error include by default.
+//Arguments: printf formatted message
+func DebugPos(format string, a ...interface{}) {
+	std.genericLogHandler("DEBUG", nil, nil, format, a, SeverityDebug, true, 0, nil)
+}
+
+//TracePos logs a message of severity "trace" including the file and line number of the call,
+//which only Fatal and Error include by default.
+//Arguments: printf formatted message
+func TracePos(format string, a ...interface{}) {
+	std.genericLogHandler("TRACE", nil, nil, format, a, SeverityTrace, true, 0, nil)
+}
+
+//===== Logging API with lazy evaluation =====
+
+//FatalFunc logs a message of severity "fatal" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func FatalFunc(fn func() string) {
+	std.genericLogHandler("FATAL", nil, nil, "%s", []interface{}{lazyMessage(fn)}, SeverityFatal, true, 0, nil)
+}
+
+//FatalFunc logs a message of severity "fatal" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func (l logger) FatalFunc(fn func() string) {
+	l.inst.genericLogHandler("FATAL", nil, l.fields, "%s", []interface{}{lazyMessage(fn)}, SeverityFatal, l.pos(true), 0, nil)
+}
+
+//FatalFunc logs a message of severity "fatal" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func (r *Instance) FatalFunc(fn func() string) {
+	r.genericLogHandler("FATAL", nil, nil, "%s", []interface{}{lazyMessage(fn)}, SeverityFatal, true, 0, nil)
+}
+
+//ErrorFunc logs a message of severity "error" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func ErrorFunc(fn func() string) {
+	std.genericLogHandler("ERROR", nil, nil, "%s", []interface{}{lazyMessage(fn)}, SeverityError, true, 0, nil)
+}
+
+//ErrorFunc logs a message of severity "error" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func (l logger) ErrorFunc(fn func() string) {
+	l.inst.genericLogHandler("ERROR", nil, l.fields, "%s", []interface{}{lazyMessage(fn)}, SeverityError, l.pos(true), 0, nil)
+}
+
+//ErrorFunc logs a message of severity "error" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func (r *Instance) ErrorFunc(fn func() string) {
+	r.genericLogHandler("ERROR", nil, nil, "%s", []interface{}{lazyMessage(fn)}, SeverityError, true, 0, nil)
+}
+
+//WarningFunc logs a message of severity "warning" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func WarningFunc(fn func() string) {
+	std.genericLogHandler("WARNING", nil, nil, "%s", []interface{}{lazyMessage(fn)}, SeverityWarning, false, 0, nil)
+}
+
+//WarningFunc logs a message of severity "warning" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func (l logger) WarningFunc(fn func() string) {
+	l.inst.genericLogHandler("WARNING", nil, l.fields, "%s", []interface{}{lazyMessage(fn)}, SeverityWarning, l.pos(false), 0, nil)
+}
+
+//WarningFunc logs a message of severity "warning" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func (r *Instance) WarningFunc(fn func() string) {
+	r.genericLogHandler("WARNING", nil, nil, "%s", []interface{}{lazyMessage(fn)}, SeverityWarning, false, 0, nil)
+}
+
+//InfoFunc logs a message of severity "info" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func InfoFunc(fn func() string) {
+	std.genericLogHandler("INFO", nil, nil, "%s", []interface{}{lazyMessage(fn)}, SeverityInfo, false, 0, nil)
+}
+
+//InfoFunc logs a message of severity "info" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func (l logger) InfoFunc(fn func() string) {
+	l.inst.genericLogHandler("INFO", nil, l.fields, "%s", []interface{}{lazyMessage(fn)}, SeverityInfo, l.pos(false), 0, nil)
+}
+
+//InfoFunc logs a message of severity "info" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func (r *Instance) InfoFunc(fn func() string) {
+	r.genericLogHandler("INFO", nil, nil, "%s", []interface{}{lazyMessage(fn)}, SeverityInfo, false, 0, nil)
+}
+
+//DebugFunc logs a message of severity "debug" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func DebugFunc(fn func() string) {
+	std.genericLogHandler("DEBUG", nil, nil, "%s", []interface{}{lazyMessage(fn)}, SeverityDebug, false, 0, nil)
+}
+
+//DebugFunc logs a message of severity "debug" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func (l logger) DebugFunc(fn func() string) {
+	l.inst.genericLogHandler("DEBUG", nil, l.fields, "%s", []interface{}{lazyMessage(fn)}, SeverityDebug, l.pos(false), 0, nil)
+}
+
+//DebugFunc logs a message of severity "debug" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func (r *Instance) DebugFunc(fn func() string) {
+	r.genericLogHandler("DEBUG", nil, nil, "%s", []interface{}{lazyMessage(fn)}, SeverityDebug, false, 0, nil)
+}
+
+//TraceFunc logs a message of severity "trace" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func TraceFunc(fn func() string) {
+	std.genericLogHandler("TRACE", nil, nil, "%s", []interface{}{lazyMessage(fn)}, SeverityTrace, false, 0, nil)
+}
+
+//TraceFunc logs a message of severity "trace" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func (l logger) TraceFunc(fn func() string) {
+	l.inst.genericLogHandler("TRACE", nil, l.fields, "%s", []interface{}{lazyMessage(fn)}, SeverityTrace, l.pos(false), 0, nil)
+}
+
+//TraceFunc logs a message of severity "trace" created by fn. fn is only invoked if the message is not
+//filtered, e.g. to avoid the cost of building a verbose message which would be dropped anyway.
+//Arguments: function creating the message
+func (r *Instance) TraceFunc(fn func() string) {
+	r.genericLogHandler("TRACE", nil, nil, "%s", []interface{}{lazyMessage(fn)}, SeverityTrace, false, 0, nil)
+}
+
+//===== Logging API: standard library compatibility =====
+
+//levelName determines the log level of a severity as it appears in the log output, e.g. "WARNING"
+func levelName(severity common.RlogSeverity) string {
+	return strings.ToUpper(severity.String())
+}
+
+//Printf logs a message like the standard library log.Printf. The message gets the severity of the
+//logger, i.e. "info" unless created by NewLoggerAtSeverity. Together with Print and Println, it allows to
+//pass a logger to libraries expecting a standard library style logger.
+//Arguments: printf formatted message
+func (l logger) Printf(format string, a ...interface{}) {
+	l.inst.genericLogHandler(levelName(l.printSeverity), nil, l.fields, format, a, l.printSeverity, l.pos(l.printSeverity <= SeverityError), 0, nil)
+}
+
+//Print logs a message like the standard library log.Print, i.e. the arguments are formatted as by
+//fmt.Sprint. The message gets the severity of the logger, see Printf.
+//Arguments: values to log
+func (l logger) Print(a ...interface{}) {
+	l.inst.genericLogHandler(levelName(l.printSeverity), nil, l.fields, "%s", []interface{}{fmt.Sprint(a...)}, l.printSeverity, l.pos(l.printSeverity <= SeverityError), 0, nil)
+}
+
+//Println logs a message like the standard library log.Println, i.e. the arguments are formatted as by
+//fmt.Sprintln without the trailing newline. The message gets the severity of the logger, see Printf.
+//Arguments: values to log
+func (l logger) Println(a ...interface{}) {
+	l.inst.genericLogHandler(levelName(l.printSeverity), nil, l.fields, "%s", []interface{}{strings.TrimSuffix(fmt.Sprintln(a...), "\n")}, l.printSeverity, l.pos(l.printSeverity <= SeverityError), 0, nil)
+}
+
+//===== Logging API: tools =====
+
+//ConfigureIDGenerator sets the prefix and the minimal width of the IDs generated by GenerateID. The hex
+//formatted counter is padded with zeros up to minWidth digits so that IDs sort lexically, e.g. prefix
+//"req-" and minWidth 10 produce IDs like "req-0000001a3f". By default, IDs are plain hex numbers.
+//ConfigureIDGenerator is not thread safe: use it before Start.
+//Arguments: [prefix] prefix of all IDs. [minWidth] minimal number of hex digits
+func ConfigureIDGenerator(prefix string, minWidth int) {
+	idPrefix = prefix
+	idMinWidth = minWidth
+}
+
+//GenerateID creates a unique ID, i.e. two calls to GenerateID are guaranteed to return different IDs
+//Returns: unique ID
+func GenerateID() string {
+	return GenerateIDWithPrefix(idPrefix)
+}
+
+//GenerateID creates a unique ID, i.e. two calls to GenerateID are guaranteed to return different IDs
+//Returns: unique ID
+func (l logger) GenerateID() string {
+	return GenerateID()
+}
+
+//GenerateID creates a unique ID, i.e. two calls to GenerateID are guaranteed to return different IDs
+//Returns: unique ID
+func (r *Instance) GenerateID() string {
+	return GenerateID()
+}
+
+//GenerateIDWithPrefix creates a unique ID like GenerateID but with the given prefix instead of the
+//configured one
+//Returns: unique ID
+func GenerateIDWithPrefix(prefix string) string {
+	id := atomic.AddUint64(&uniqueMsgID, 1)
+	return fmt.Sprintf("%s%0*x", prefix, idMinWidth, id)
+}
+
+//GenerateIDWithPrefix creates a unique ID like GenerateID but with the given prefix instead of the
+//configured one
+//Returns: unique ID
+func (l logger) GenerateIDWithPrefix(prefix string) string {
+	return GenerateIDWithPrefix(prefix)
+}
+
+//GenerateIDWithPrefix creates a unique ID like GenerateID but with the given prefix instead of the
+//configured one
+//Returns: unique ID
+func (r *Instance) GenerateIDWithPrefix(prefix string) string {
+	return GenerateIDWithPrefix(prefix)
+}
+
+//Stats returns counters about the delivery of log messages to the modules since the logger was started.
+//Stats is thread safe.
+//Returns: message statistics
+func Stats() LogStats {
+	return std.getStats()
+}
+
+//Stats returns counters about the delivery of log messages to the modules since the logger was started.
+//Stats is thread safe.
+//Returns: message statistics
+func (r *Instance) Stats() LogStats {
+	return r.getStats()
+}
+
+//IsInitialized determines whether the logger has been started, e.g. for libraries logging only if the
+//application set up rlog.
+//Returns: true if Start has been called (and the logger has not been reset since)
+func IsInitialized() bool {
+	return std.IsInitialized()
+}
+
+//IsInitialized determines whether the logger has been started, e.g. for libraries logging only if the
+//application set up rlog.
+//Returns: true if Start has been called (and the logger has not been reset since)
+func (r *Instance) IsInitialized() bool {
+	return atomic.LoadInt32(&r.initialized) == 1
+}
+
+//ActiveModules lists the names of the enabled modules in the order they were enabled. Modules name
+//themselves by implementing a Name method, otherwise they are named after their type.
+//Returns: module names, empty if no module is enabled
+func ActiveModules() []string {
+	return std.ActiveModules()
+}
+
+//ActiveModules lists the names of the enabled modules in the order they were enabled. Modules name
+//themselves by implementing a Name method, otherwise they are named after their type.
+//Returns: module names, empty if no module is enabled
+func (r *Instance) ActiveModules() []string {
+	r.modulesMutex.RLock()
+	defer r.modulesMutex.RUnlock()
+
+	names := []string{}
+	for e := r.activeModules.Front(); e != nil; e = e.Next() {
+		if c, ok := e.Value.(rlogModule); ok {
+			names = append(names, moduleName(c))
+		}
+	}
+	return names
+}
+
+//Flush should be called before the program using RightLog4Go exits (e.g. by using defer in main).
+//Flush notifies the registered logger modules to write back their buffered data. All messages
+//logged before, including messages still being handed to the modules when Flush is called, are written
+//before Flush returns. A message blocked on a module which does not take messages anymore (see
+//OverflowPolicy) is only waited for until the flush timeout. Messages logged while Flush runs may be left
+//to the next flush.
+func Flush() {
+	std.Flush()
+}
+
+//Flush should be called before the program using RightLog4Go exits (e.g. by using defer in main).
+//Flush notifies the registered logger modules to write back their buffered data. All messages
+//logged before, including messages still being handed to the modules when Flush is called, are written
+//before Flush returns. A message blocked on a module which does not take messages anymore (see
+//OverflowPolicy) is only waited for until the flush timeout. Messages logged while Flush runs may be left
+//to the next flush.
+func (r *Instance) Flush() {
+	r.FlushWithReport()
+}
+
+//FlushWithReport notifies the registered logger modules to write back their buffered data like Flush
+//and reports how many pending messages each module wrote, e.g. to account for the messages buffered
+//at shutdown.
+//Returns: messages flushed in total and per module, nil on success, error naming the modules which
+//did not respond in time otherwise
+func FlushWithReport() (FlushReport, error) {
+	return std.FlushWithReport()
+}
+
+//FlushWithReport notifies the registered logger modules to write back their buffered data like Flush
+//and reports how many pending messages each module wrote, e.g. to account for the messages buffered
+//at shutdown.
+//Returns: messages flushed in total and per module, nil on success, error naming the modules which
+//did not respond in time otherwise
+func (r *Instance) FlushWithReport() (FlushReport, error) {
+	//Each module gets the configured timeout
+	timeout := time.Second * time.Duration(r.config.FlushTimeout)
+	return r.flushModules(func() time.Duration { return timeout }, time.Time{}, nil)
+}
+
+//FlushModule notifies a single module to write back its buffered data like Flush does for all modules,
+//e.g. to checkpoint a critical sink without waiting for the other modules.
+//Arguments: module to be flushed, the one passed to EnableModule or AttachModule
+//Returns: nil on success, error if the module is not active or did not respond in time
+func FlushModule(module rlogModule) error {
+	return std.FlushModule(module)
+}
+
+//FlushModule notifies a single module to write back its buffered data like Flush does for all modules,
+//e.g. to checkpoint a critical sink without waiting for the other modules.
+//Arguments: module to be flushed, the one passed to EnableModule or AttachModule
+//Returns: nil on success, error if the module is not active or did not respond in time
+func (r *Instance) FlushModule(module rlogModule) error {
+	if !r.IsInitialized() {
+		return fmt.Errorf("cannot flush module %s when logger not running", moduleName(module))
+	}
+
+	//A module accepts a single pending flush command
+	r.lockFlush(time.Time{}, nil)
+	defer r.unlockFlush()
+
+	r.modulesMutex.RLock()
+	fc := findChannel(r.flushChannels, module)
+	r.modulesMutex.RUnlock()
+	if fc == nil {
+		return fmt.Errorf("module %s not active", moduleName(module))
+	}
+
+	//Wait for the pushes in progress like Flush does
+	timeout := time.Second * time.Duration(r.config.FlushTimeout)
+	r.waitForPushes(timeout, nil)
+	_, err := r.flushModule(fc, timeout, nil)
+	return err
+}
+
+//FlushWithTimeout notifies the registered logger modules to write back their buffered data like Flush
+//but all modules have to respond within the given time.
+//Arguments: max time to wait for all modules
+//Returns: nil on success, error naming the modules which did not respond in time otherwise
+func FlushWithTimeout(d time.Duration) error {
+	return std.FlushWithTimeout(d)
+}
+
+//FlushWithTimeout notifies the registered logger modules to write back their buffered data like Flush
+//but all modules have to respond within the given time.
+//Arguments: max time to wait for all modules
+//Returns: nil on success, error naming the modules which did not respond in time otherwise
+func (r *Instance) FlushWithTimeout(d time.Duration) error {
+	//Each module gets the remaining time
+	deadline := time.Now().Add(d)
+	_, err := r.flushModules(func() time.Duration { return deadline.Sub(time.Now()) }, deadline, nil)
+	return err
+}
+
+//FlushContext notifies the registered logger modules to write back their buffered data like Flush but
+//the deadline of the context applies to all modules together, e.g. to fit into a graceful shutdown
+//window. Without a deadline, each module gets the configured flush timeout. Once the context is done,
+//the remaining modules are not flushed anymore.
+//Arguments: context bounding the flush
+//Returns: nil on success, error naming the modules which did not respond before the context expired
+//(or timed out) otherwise
+func FlushContext(ctx context.Context) error {
+	return std.FlushContext(ctx)
+}
+
+//FlushContext notifies the registered logger modules to write back their buffered data like Flush but
+//the deadline of the context applies to all modules together, e.g. to fit into a graceful shutdown
+//window. Without a deadline, each module gets the configured flush timeout. Once the context is done,
+//the remaining modules are not flushed anymore.
+//Arguments: context bounding the flush
+//Returns: nil on success, error naming the modules which did not respond before the context expired
+//(or timed out) otherwise
+func (r *Instance) FlushContext(ctx context.Context) error {
+	//Each module gets the remaining time, or the configured timeout if there is no deadline
+	timeout := func() time.Duration { return time.Second * time.Duration(r.config.FlushTimeout) }
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		timeout = func() time.Duration { return deadline.Sub(time.Now()) }
+	}
+
+	_, err := r.flushModules(timeout, deadline, ctx.Done())
+	if err == nil {
+		return nil
+	}
+
+	//The timeout of a module may fire right before the context notices its deadline
+	cause := ctx.Err()
+	if cause == nil && hasDeadline && !time.Now().Before(deadline) {
+		cause = context.DeadlineExceeded
+	}
+	if cause != nil {
+		return fmt.Errorf("%s: %s", err.Error(), cause.Error())
+	}
+	return err
+}
+
+// Performs a reset of rlog state, intended for testing purposes only (with or
+// without flushing before-hand). Applications should call Flush() but should
+// usually not reset state. A reset is needed for unit testing due to rlog being
+// a singleton. Tests that leverage rlog therefore cannot be run in parallel and
+// also call reset state. The modules of the reset logger write their pending
+// messages and exit. Messages logged concurrently are either written before or
+// dropped.
+func ResetState() {
+	std.resetState()
+	ConfigureIDGenerator("", 0)
+	SetClock(nil)
+}
+
+// Replaces the clock determining the timestamps of new messages, intended for
+// testing purposes only (e.g. to freeze the time and compare formatted
+// timestamps). A nil clock restores time.Now, as does ResetState. Timestamps
+// of the new clock are not bounded by the messages logged before (see
+// timestampNow), so a clock may be set back. SetClock is not thread safe: use
+// it before Start or while no goroutine is logging.
+func SetClock(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+	clock = now
+	clockGeneration++
+}
+
+//resetState performs a reset of the instance state, see ResetState
+func (r *Instance) resetState() {
+	if r.IsInitialized() {
+		//Stop the background flush first, it must not send to the flush channels closed below
+		r.stopAutoFlush()
+
+		//Drop pending summaries of duplicate messages, a summary being logged may still flush the
+		//modules
+		r.dedupe.stop()
+
+		//Unregister the modules first: a flush in progress must not send to the flush channels closed
+		//below and messages logged meanwhile must not be pushed to modules which exited
+		r.lockFlush(time.Time{}, nil)
+		defer r.unlockFlush()
+		r.modulesMutex.Lock()
+		msgChannels, flushChannels := r.msgChannels, r.flushChannels
+		r.msgChannels = list.New()
+		r.flushChannels = list.New()
+		r.modulesMutex.Unlock()
+
+		//Release the pushes still blocked on the modules
+		for e := msgChannels.Front(); e != nil; e = e.Next() {
+			if mc, ok := e.Value.(*msgChannel); ok {
+				close(mc.done)
+			}
+		}
+
+		//Signal the modules to exit so that their goroutines do not leak, synchronous modules have no
+		//goroutine and only write back their buffered data
+		for e := flushChannels.Front(); e != nil; e = e.Next() {
+			if fc, ok := e.Value.(*flushChannel); ok && fc.sync != nil {
+				fc.sync.flush()
+			} else if ok {
+				close(fc.c)
+			}
+		}
+
+		//The configuration is kept, goroutines which just passed the initialization check may still
+		//read it. Start replaces it.
+		atomic.StoreUint32(&r.activeSeverity, 0)
+		atomic.StoreUint64(&r.flushTimeouts, 0)
+		atomic.StoreUint64(&r.suppressedMsgs, 0)
+		atomic.StoreInt32(&r.suppressed, 0)
+		atomic.StoreInt64(&r.lastTimestamp, 0)
+		r.hooksMutex.Lock()
+		r.hooks = nil
+		r.hooksMutex.Unlock()
+		atomic.StoreInt32(&r.initialized, 0)
+	}
+
+	//Modules enabled but never launched (e.g. because StartE failed) are discarded as well
+	r.modulesMutex.Lock()
+	r.activeModules = list.New()
+	r.modulesMutex.Unlock()
+	r.mirrorErrors = false
 }
 
 //===== Tools =====
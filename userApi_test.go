@@ -7,18 +7,23 @@ These tests cover:
 package rlog
 
 import (
+	"bytes"
 	"container/list"
+	"errors"
 	"github.com/rightscale/rlog/common"
 	. "launchpad.net/gocheck"
+	"os"
+	"runtime"
 	"strings"
+	"time"
 )
 
 type fakeLogModule struct {
 	msgChan   <-chan (*common.RlogMsg)
-	flushChan chan (chan (bool))
+	flushChan chan (chan (common.FlushResult))
 }
 
-func (f *fakeLogModule) LaunchModule(msgChan <-chan (*common.RlogMsg), flushChan chan (chan (bool))) {
+func (f *fakeLogModule) LaunchModule(msgChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
 	f.msgChan = msgChan
 	f.flushChan = flushChan
 }
@@ -32,17 +37,17 @@ func (s *Uninitialized) TestStart(t *C) {
 
 	//When calling start, it should (1) set the logger state to initialized
 	Start(conf)
-	if initialized == false {
+	if !std.IsInitialized() {
 		t.Fatalf("Initialization variable not set")
 	}
 
 	//(2) apply the given configuration
-	if config.ChanCapacity != 101 {
+	if std.config.ChanCapacity != 101 {
 		t.Fatalf("Initialize did not apply capacity configuration")
 	}
 
 	//(3) Create at least one communication channel because stdout logging is enabled
-	if msgChannels.Front() == nil {
+	if std.msgChannels.Front() == nil {
 		t.Fatalf("Channel not initialized after initialization")
 	}
 
@@ -52,8 +57,8 @@ func (s *Uninitialized) TestStart(t *C) {
 	}
 
 	//Hook in our own channel to intercept messages for testing
-	msgChannels = list.New()
-	c := getMsgChannel()
+	std.msgChannels = list.New()
+	c := std.getMsgChannel(nil)
 
 	//When the logger is initialized a second time, it should generate an error log entry
 	Start(GetDefaultConfig())
@@ -65,6 +70,260 @@ func (s *Uninitialized) TestStart(t *C) {
 	}
 }
 
+//fakeInvalidModule is a module failing validation
+type fakeInvalidModule struct {
+	fakeLogModule
+}
+
+func (f *fakeInvalidModule) Validate() error {
+	return errors.New("bad handle")
+}
+
+//When starting with validation, it should refuse to start if a module is unhealthy
+func (s *Uninitialized) TestStartE(t *C) {
+	valid := new(fakeLogModule)
+	EnableModule(valid)
+	EnableModule(new(fakeInvalidModule))
+	err := StartE(GetDefaultConfig())
+	t.Assert(err, ErrorMatches, `validation failed for module\(s\): \*rlog.fakeInvalidModule \(bad handle\)`)
+	t.Assert(std.IsInitialized(), Equals, false)
+	t.Assert(valid.flushChan, IsNil)
+
+	ResetState()
+	EnableModule(valid)
+	t.Assert(StartE(GetDefaultConfig()), IsNil)
+	t.Assert(std.IsInitialized(), Equals, true)
+	t.Assert(StartE(GetDefaultConfig()), ErrorMatches, "logger already initialized")
+}
+
+//When using a separate instance, its messages and configuration should not affect the default instance
+func (s *Initialized) TestNewInstance(t *C) {
+	std.msgChannels = list.New()
+	stdChan := std.getMsgChannel(nil)
+
+	r := New()
+	conf := GetDefaultConfig()
+	conf.Severity = SeverityError
+	r.Start(conf)
+	myChan := r.getMsgChannel(nil)
+
+	r.Error("instance message")
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm, NotNil)
+	t.Assert(rlm.Msg, Matches, ".*instance message")
+	t.Assert(nonBlockingChanRead(stdChan), IsNil)
+
+	//Each instance applies its own configuration
+	r.Info("filtered")
+	t.Assert(nonBlockingChanRead(myChan), IsNil)
+	r.NewLogger().Error("logger message")
+	t.Assert(nonBlockingChanRead(myChan), NotNil)
+
+	Info("default message")
+	t.Assert(nonBlockingChanRead(stdChan), NotNil)
+	t.Assert(nonBlockingChanRead(myChan), IsNil)
+}
+
+//When resetting the logger, it should stop the goroutines of the launched modules
+func (s *Uninitialized) TestResetStopsModules(t *C) {
+	baseline := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		EnableModule(NewNullLogger())
+		Start(GetDefaultConfig())
+		ResetState()
+	}
+
+	//The modules exit asynchronously
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	t.Assert(runtime.NumGoroutine() <= baseline, Equals, true)
+}
+
+//When querying the logger state, it should report initialization and the enabled modules
+func (s *Uninitialized) TestIsInitializedAndActiveModules(t *C) {
+	t.Assert(IsInitialized(), Equals, false)
+	t.Assert(ActiveModules(), DeepEquals, []string{})
+
+	EnableModule(NewNullLogger())
+	EnableModule(new(fakeLogModule))
+	Start(GetDefaultConfig())
+	t.Assert(IsInitialized(), Equals, true)
+	t.Assert(ActiveModules(), DeepEquals, []string{"null", "*rlog.fakeLogModule"})
+
+	ResetState()
+	t.Assert(IsInitialized(), Equals, false)
+}
+
+//When starting with the startup banner enabled, it should log process, configuration and modules as
+//first message
+func (s *Uninitialized) TestStartupBanner(t *C) {
+	var banner *common.RlogMsg
+	AddHook(SeverityInfo, func(msg *common.RlogMsg) {
+		if banner == nil {
+			banner = msg
+		}
+	})
+	EnableModule(NewNullLogger())
+	conf := GetDefaultConfig()
+	conf.StartupBanner = true
+	conf.Version = "1.2.3"
+	Start(conf)
+
+	t.Assert(banner, NotNil)
+	t.Assert(banner.Msg, Equals, "logger started")
+	t.Assert(banner.Severity, Equals, SeverityInfo)
+	t.Assert(banner.Fields["pid"], Equals, os.Getpid())
+	t.Assert(banner.Fields["severity"], Equals, "info")
+	t.Assert(banner.Fields["modules"], Equals, "null")
+	t.Assert(banner.Fields["version"], Equals, "1.2.3")
+}
+
+//fakeSyncModule is a module supporting the synchronous mode
+type fakeSyncModule struct {
+	fakeLogModule
+	written []*common.RlogMsg
+	flushed int
+}
+
+func (f *fakeSyncModule) WriteSync(msg *common.RlogMsg, prefix string) {
+	f.written = append(f.written, msg)
+}
+
+func (f *fakeSyncModule) FlushSync() {
+	f.flushed++
+}
+
+//When running in synchronous mode, it should write messages before the log call returns and flush
+//without a module goroutine
+func (s *Uninitialized) TestSynchronous(t *C) {
+	module := new(fakeSyncModule)
+	EnableModule(module)
+	conf := GetDefaultConfig()
+	conf.Synchronous = true
+	Start(conf)
+
+	Info("sync message")
+	Debug("filtered")
+	t.Assert(len(module.written), Equals, 1)
+	t.Assert(module.written[0].Msg, Equals, "sync message")
+	t.Assert(module.msgChan, IsNil)
+	t.Assert(Stats().Enqueued, Equals, uint64(1))
+
+	t.Assert(FlushWithTimeout(time.Second), IsNil)
+	t.Assert(module.flushed, Equals, 1)
+
+	//Resetting flushes the module a last time
+	ResetState()
+	t.Assert(module.flushed, Equals, 2)
+}
+
+//When mirroring errors to stderr, it should write warnings and more severe messages regardless of the
+//global severity and leave modules and statistics alone
+func (s *Uninitialized) TestMirrorErrorsToStderr(t *C) {
+	var buf bytes.Buffer
+	mirrorOutput = &buf
+	defer func() { mirrorOutput = os.Stderr }()
+
+	module := new(fakeSyncModule)
+	EnableModule(module)
+	MirrorErrorsToStderr(true)
+	conf := GetDefaultConfig()
+	conf.Severity = SeverityError
+	conf.Synchronous = true
+	Start(conf)
+
+	Warning("mirrored warning")
+	Error("mirrored error")
+	Info("filtered")
+	t.Assert(len(module.written), Equals, 1)
+	t.Assert(buf.String(), Matches, "(?s).*mirrored warning\n.*mirrored error\n.*")
+	t.Assert(strings.Contains(buf.String(), "filtered"), Equals, false)
+
+	//The mirror is neither listed nor counted
+	t.Assert(ActiveModules(), DeepEquals, []string{"*rlog.fakeSyncModule"})
+	stats := Stats()
+	t.Assert(stats.Enqueued, Equals, uint64(1))
+	t.Assert(len(stats.Modules), Equals, 1)
+
+	//Resetting stops mirroring
+	ResetState()
+	t.Assert(std.mirrorErrors, Equals, false)
+}
+
+//When changing the severity at runtime, it should apply to subsequent messages and return the
+//previous severity
+func (s *Initialized) TestSetSeverity(t *C) {
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	t.Assert(GetSeverity(), Equals, SeverityDebug)
+	t.Assert(SetSeverity(SeverityError), Equals, SeverityDebug)
+	t.Assert(GetSeverity(), Equals, SeverityError)
+
+	Info("filtered")
+	t.Assert(nonBlockingChanRead(myChan), IsNil)
+
+	SetSeverity(SeverityInfo)
+	Info("not filtered")
+	t.Assert(nonBlockingChanRead(myChan), NotNil)
+}
+
+//When retrieving the effective configuration, it should reflect Start and SetSeverity without exposing
+//the configuration in effect to modifications
+func (s *Uninitialized) TestEffectiveConfig(t *C) {
+	t.Assert(EffectiveConfig().ChanCapacity, Equals, uint32(0))
+
+	conf := GetDefaultConfig()
+	conf.ChanCapacity = 42
+	conf.Routes = []Route{NewRoute(SeverityWarning, SeverityFatal)}
+	Start(conf)
+	SetSeverity(SeverityDebug)
+
+	effective := EffectiveConfig()
+	t.Assert(effective.ChanCapacity, Equals, uint32(42))
+	t.Assert(effective.Severity, Equals, SeverityDebug)
+	t.Assert(effective.FlushTimeout, Equals, conf.FlushTimeout)
+
+	effective.Routes[0] = Route{}
+	effective.ChanCapacity = 1
+	t.Assert(EffectiveConfig().Routes[0].MinSeverity, Equals, SeverityWarning)
+	t.Assert(EffectiveConfig().ChanCapacity, Equals, uint32(42))
+}
+
+//When asking whether a severity is enabled, it should consider the global and module thresholds, tags
+//and suppression without logging anything
+func (s *Initialized) TestIsEnabled(t *C) {
+	//Without modules, there is nobody to log to
+	std.msgChannels = list.New()
+	t.Assert(IsEnabled(SeverityError), Equals, false)
+
+	SetSeverity(SeverityInfo)
+	myChan := std.getMsgChannel(nil)
+	t.Assert(IsEnabled(SeverityInfo), Equals, true)
+	t.Assert(IsEnabled(SeverityDebug), Equals, false)
+	t.Assert(NewLogger().IsEnabled(SeverityDebug), Equals, false)
+
+	//A module with its own threshold enables more verbose messages
+	verbose := new(fakeSeverityModule)
+	verbose.SetSeverity(SeverityDebug)
+	std.getMsgChannel(verbose)
+	t.Assert(IsEnabled(SeverityDebug), Equals, true)
+	t.Assert(IsEnabled(SeverityTrace), Equals, false)
+
+	std.config.EnableTagsExcept([]string{"db"})
+	t.Assert(IsEnabledTag(SeverityInfo, "db"), Equals, false)
+	t.Assert(NewLogger().IsEnabledTag(SeverityInfo, "http"), Equals, true)
+
+	Suppress()
+	t.Assert(IsEnabled(SeverityError), Equals, false)
+	t.Assert(IsEnabled(SeverityFatal), Equals, true)
+	Resume()
+	t.Assert(Stats().Suppressed, Equals, uint64(0))
+	t.Assert(nonBlockingChanRead(myChan), IsNil)
+}
+
 //When generating two IDs, it should create different ones
 func (s *Stateless) TestIDGeneration(t *C) {
 
@@ -73,6 +332,19 @@ func (s *Stateless) TestIDGeneration(t *C) {
 	}
 }
 
+//When the ID generator is configured, it should apply the prefix and pad the counter with zeros
+func (s *Initialized) TestIDGeneratorFormat(t *C) {
+	t.Assert(GenerateID(), Matches, "[0-9a-f]+")
+
+	ConfigureIDGenerator("req-", 10)
+	id1 := GenerateID()
+	id2 := GenerateID()
+	t.Assert(id1, Matches, "req-[0-9a-f]{10}")
+	t.Assert(id1 < id2, Equals, true)
+
+	t.Assert(GenerateIDWithPrefix("job-"), Matches, "job-[0-9a-f]{10}")
+}
+
 //Test the various logging routines. This is for integration testing, as the various sub components like
 //channels, msg formatting are tested independently.
 func (s *Initialized) TestLoggingRoutines(t *C) {
@@ -81,8 +353,8 @@ func (s *Initialized) TestLoggingRoutines(t *C) {
 	msg := "testmessage 10"
 
 	//Create our own destination channel for testing purpose
-	msgChannels = list.New()
-	myChan := getMsgChannel()
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
 
 	//When printing an Error message, it should generate an Error message and push it to the channel
 	Fatal("testmessage %d", 10)
@@ -103,6 +375,190 @@ func (s *Initialized) TestLoggingRoutines(t *C) {
 	//When printing an Error message, it should generate an Error message and push it to the channel
 	Debug("testmessage %d", 10)
 	logFunctionVerify(t, SeverityDebug, false, msg, myChan)
+
+	//Trace messages are filtered unless the severity is set to trace
+	SetSeverity(SeverityTrace)
+	Trace("testmessage %d", 10)
+	logFunctionVerify(t, SeverityTrace, false, msg, myChan)
+}
+
+//When logging with structured fields, the fields should reach the module unaltered even if the
+//caller modifies its map afterwards
+func (s *Initialized) TestLoggingRoutinesWithFields(t *C) {
+
+	//Create our own destination channel for testing purpose
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	fields := map[string]interface{}{"request": "abc", "user": 42}
+	InfoF(fields, "testmessage %d", 10)
+	fields["request"] = "modified"
+
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm, NotNil)
+	t.Assert(rlm.Msg, Equals, "testmessage 10")
+	t.Assert(rlm.Fields["request"], Equals, "abc")
+	t.Assert(rlm.Fields["user"], Equals, 42)
+
+	//Messages without fields should not carry a field map
+	Info("testmessage %d", 10)
+	rlm = nonBlockingChanRead(myChan)
+	t.Assert(rlm, NotNil)
+	t.Assert(rlm.Fields, IsNil)
+}
+
+//When logging with the standard library style methods, it should use the severity of the logger
+func (s *Initialized) TestLoggingRoutinesStdlibStyle(t *C) {
+
+	//Create our own destination channel for testing purpose
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	l := NewLogger()
+	l.Printf("testmessage %d", 10)
+	logFunctionVerify(t, SeverityInfo, false, "testmessage 10", myChan)
+	l.Print("testmessage ", 10)
+	logFunctionVerify(t, SeverityInfo, false, "testmessage 10", myChan)
+	l.Println("testmessage", 10)
+	logFunctionVerify(t, SeverityInfo, false, "testmessage 10", myChan)
+
+	//The severity is kept when adding fields
+	l = NewLoggerAtSeverity(SeverityWarning).WithFields(map[string]interface{}{"k": "v"})
+	l.Printf("testmessage %d", 10)
+	logFunctionVerify(t, SeverityWarning, false, "testmessage 10", myChan)
+	//Trace messages are filtered unless the severity is set to trace
+	l = NewLoggerAtSeverity(SeverityTrace)
+	l.Printf("testmessage %d", 10)
+	logFunctionVerify(t, SeverityTrace, true, "testmessage 10", myChan)
+}
+
+//When logging raw bytes, it should not interpret them as printf format
+func (s *Initialized) TestLoggingRoutinesWithBytes(t *C) {
+
+	//Create our own destination channel for testing purpose
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	InfoBytes([]byte("100% done %d"))
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm, NotNil)
+	t.Assert(rlm.Msg, Equals, "100% done %d")
+	t.Assert(rlm.Severity, Equals, SeverityInfo)
+
+	NewLogger().ErrorBytes([]byte("50%"))
+	rlm = nonBlockingChanRead(myChan)
+	t.Assert(rlm, NotNil)
+	t.Assert(rlm.Msg, Equals, "50%")
+	t.Assert(rlm.File, Not(Equals), "")
+	t.Assert(rlm.Severity, Equals, SeverityError)
+}
+
+//When logging lazily, the message should only be created if it is not filtered
+func (s *Initialized) TestLoggingRoutinesLazy(t *C) {
+
+	//Create our own destination channel for testing purpose
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	calls := 0
+	expensive := func() string {
+		calls++
+		return "100% expensive"
+	}
+
+	SetSeverity(SeverityInfo)
+	DebugFunc(expensive)
+	NewLogger().TraceFunc(expensive)
+	t.Assert(calls, Equals, 0)
+	t.Assert(nonBlockingChanRead(myChan), IsNil)
+
+	InfoFunc(expensive)
+	t.Assert(calls, Equals, 1)
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm, NotNil)
+	t.Assert(rlm.Msg, Equals, "100% expensive")
+	t.Assert(rlm.Severity, Equals, SeverityInfo)
+}
+
+//When logging through a logger with fields, the fields should be added to every message
+func (s *Initialized) TestLoggerWithFields(t *C) {
+
+	//Create our own destination channel for testing purpose
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
+
+	base := NewLogger().WithFields(map[string]interface{}{"request": "abc", "user": 42})
+	l := base.WithFields(map[string]interface{}{"user": 43, "session": "xyz"})
+
+	//Chained loggers merge their fields, the most recent ones take precedence
+	l.Info("testmessage %d", 10)
+	rlm := nonBlockingChanRead(myChan)
+	t.Assert(rlm, NotNil)
+	t.Assert(rlm.Fields, DeepEquals, map[string]interface{}{"request": "abc", "user": 43, "session": "xyz"})
+
+	//Fields of the log call take precedence over the fields of the logger
+	l.ErrorF(map[string]interface{}{"request": "def"}, "testmessage %d", 10)
+	rlm = nonBlockingChanRead(myChan)
+	t.Assert(rlm, NotNil)
+	t.Assert(rlm.Fields, DeepEquals, map[string]interface{}{"request": "def", "user": 43, "session": "xyz"})
+
+	//The original logger and the singleton remain unchanged
+	base.Info("testmessage %d", 10)
+	rlm = nonBlockingChanRead(myChan)
+	t.Assert(rlm, NotNil)
+	t.Assert(rlm.Fields, DeepEquals, map[string]interface{}{"request": "abc", "user": 42})
+	Info("testmessage %d", 10)
+	rlm = nonBlockingChanRead(myChan)
+	t.Assert(rlm, NotNil)
+	t.Assert(rlm.Fields, IsNil)
+}
+
+//When FatalExits is set, a fatal message should flush all modules and exit the process
+func (s *Initialized) TestFatalExits(t *C) {
+
+	//Intercept the exit and register a module confirming the flush
+	exitCode := -1
+	exitProcess = func(code int) { exitCode = code }
+	defer func() { exitProcess = os.Exit }()
+	confirm := make(chan (bool), 1)
+	simulateModuleAndConfirm(std.getFlushChannel(nil), confirm)
+
+	//Without FatalExits, a fatal message should not terminate the process
+	Fatal("fatal message")
+	t.Assert(exitCode, Equals, -1)
+
+	//With FatalExits, it should flush before exiting with status 1
+	std.config.FatalExits = true
+	Error("error message")
+	t.Assert(exitCode, Equals, -1)
+	Fatal("fatal message")
+	t.Assert(exitCode, Equals, 1)
+	select {
+	case <-confirm:
+	case <-time.After(time.Second):
+		t.Fatalf("Modules were not flushed before exiting")
+	}
+}
+
+//When a fatal callback is set, it should run after flushing and before exiting, even if it panics
+func (s *Initialized) TestOnFatal(t *C) {
+	var events []string
+	exitProcess = func(code int) { events = append(events, "exit") }
+	defer func() { exitProcess = os.Exit }()
+
+	std.config.DisablePositionInfo = true
+	std.config.OnFatal = func(msg *common.RlogMsg) {
+		events = append(events, "callback: "+msg.Msg)
+		panic("cleanup failed")
+	}
+	Error("error message")
+	t.Assert(events, IsNil)
+	Fatal("fatal message")
+	t.Assert(events, DeepEquals, []string{"callback: fatal message"})
+
+	std.config.FatalExits = true
+	Fatal("fatal message")
+	t.Assert(events, DeepEquals, []string{"callback: fatal message", "callback: fatal message", "exit"})
 }
 
 //Test the various logging routines defined on top of log objects.
@@ -112,8 +568,8 @@ func (s *Initialized) TestLogObjectRoutines(t *C) {
 	msg := "logger object test message 20"
 
 	//Create our own destination channel for testing purpose
-	msgChannels = list.New()
-	myChan := getMsgChannel()
+	std.msgChannels = list.New()
+	myChan := std.getMsgChannel(nil)
 
 	//Create a log object
 	myLogger := NewLogger()
@@ -0,0 +1,169 @@
+/*
+Implements a generic logger writing to any io.Writer.
+*/
+package writer
+
+import (
+	"fmt"
+	"github.com/rightscale/rlog/common"
+	"io"
+)
+
+// Writer logger (fields are private).
+type writerLogger struct {
+	common.ModuleSeverity
+	removeNewlines bool
+	writer         io.Writer
+	formatter      common.Formatter
+	writeErr       error // first write error since the last flush, reported by the next flush
+}
+
+// Creates a logger for the given writer.
+//
+// w: destination of the log messages (e.g. bytes.Buffer, pipe, gzip writer)
+//
+// removeNewlines: true to replace newlines
+//
+// return: instance of writer logger
+func NewWriterLogger(w io.Writer, removeNewlines bool) *writerLogger {
+	logger := new(writerLogger)
+	logger.removeNewlines = removeNewlines
+	logger.writer = w
+	logger.formatter = common.DefaultFormatter{RemoveNewlines: removeNewlines}
+	return logger
+}
+
+// Names the module for rlog diagnostics and statistics.
+//
+// return: "writer"
+func (conf *writerLogger) Name() string {
+	return "writer"
+}
+
+// Selects the output format, plain text is used by default.
+//
+// format: output format
+//
+// return: the writer logger to allow chaining with the constructor
+func (conf *writerLogger) WithFormat(format common.MessageFormat) *writerLogger {
+	conf.formatter = common.NewFormatter(format, conf.removeNewlines)
+	return conf
+}
+
+// Selects a custom formatter creating the text written for each message.
+//
+// formatter: formatter to use instead of the built-in formats
+//
+// return: the writer logger to allow chaining with the constructor
+func (conf *writerLogger) WithFormatter(formatter common.Formatter) *writerLogger {
+	conf.formatter = formatter
+	return conf
+}
+
+// Sets a severity threshold for this module overriding the global rlog severity.
+//
+// severity: most verbose severity written by this module
+//
+// return: the writer logger to allow chaining with the constructor
+func (conf *writerLogger) WithSeverity(severity common.RlogSeverity) *writerLogger {
+	conf.SetSeverity(severity)
+	return conf
+}
+
+// Checks that the logger has a writer to write to, see rlog.StartE.
+//
+// return: error if the writer is nil
+func (conf *writerLogger) Validate() error {
+	if conf.writer == nil {
+		return fmt.Errorf("rlog writer: no writer given")
+	}
+	return nil
+}
+
+// Closes the underlying writer if it implements io.Closer. Flushing never closes the writer, call
+// Close after rlog.Flush() once no more messages are written.
+//
+// return: error from closing the writer, nil if the writer cannot be closed
+func (conf *writerLogger) Close() error {
+	if closer, ok := conf.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Intended to run in a separate goroutine. It writes log messages to the writer.
+//
+// dataChan: receives log messages.
+//
+// flushChan: receives flush command.
+func (conf *writerLogger) LaunchModule(dataChan <-chan (*common.RlogMsg), flushChan chan (chan (common.FlushResult))) {
+
+	prefix := common.SyslogHeader()
+
+	// wait forever on data and flush channel
+	for {
+		select {
+		case logMsg := <-dataChan:
+			// received log message, write it
+			conf.writeMsg(logMsg, prefix)
+		case ret, ok := <-flushChan:
+			if !ok {
+				// flush channel closed by rlog: write pending messages and exit
+				conf.flush(dataChan, prefix)
+				return
+			}
+			// flush and return the number of messages written and the write errors
+			flushed, err := conf.flush(dataChan, prefix)
+			ret <- common.FlushResult{Flushed: flushed, Err: err}
+		}
+	}
+}
+
+// Writes a log message when rlog runs in synchronous mode, see rlog.RlogConfig.Synchronous.
+//
+// rawRlogMsg: log message to write.
+//
+// prefix: log prefix
+func (conf *writerLogger) WriteSync(rawRlogMsg *common.RlogMsg, prefix string) {
+	conf.writeMsg(rawRlogMsg, prefix)
+}
+
+// Does nothing as messages are passed to the writer right away. Used when rlog runs in
+// synchronous mode.
+func (conf *writerLogger) FlushSync() {
+}
+
+// Writes the message to the writer. A write error is kept for the next flush.
+//
+// rawRlogMsg: log message received from channel.
+//
+// prefix: log prefix
+func (conf *writerLogger) writeMsg(rawRlogMsg *common.RlogMsg, prefix string) {
+	msg := conf.formatter.Format(rawRlogMsg, prefix)
+	if _, err := fmt.Fprintln(conf.writer, msg); err != nil && conf.writeErr == nil {
+		conf.writeErr = err
+	}
+}
+
+// Writes pending messages to the writer.
+//
+// dataChan: data channel to access all pending messages
+//
+// prefix: log prefix
+//
+// return: number of messages written, first write error since the last flush
+func (conf *writerLogger) flush(dataChan <-chan (*common.RlogMsg), prefix string) (int, error) {
+	flushed := 0
+	for {
+		// perform non blocking read until the channel is empty
+		select {
+		case logMsg := <-dataChan:
+			conf.writeMsg(logMsg, prefix)
+			flushed++
+		default:
+			err := conf.writeErr
+			conf.writeErr = nil
+			return flushed, err
+		}
+	}
+}